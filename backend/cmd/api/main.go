@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -14,6 +15,8 @@ import (
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
 	_ "github.com/lib/pq"
+	"github.com/rhblitstein/cad-version-control/internal/analysis"
+	"github.com/rhblitstein/cad-version-control/internal/encryption"
 	"github.com/rhblitstein/cad-version-control/internal/handlers"
 	"github.com/rhblitstein/cad-version-control/internal/repository"
 	"github.com/rhblitstein/cad-version-control/internal/storage"
@@ -27,11 +30,44 @@ func main() {
 	dbPass := getEnv("DB_PASSWORD", "cadpass")
 	dbName := getEnv("DB_NAME", "cadversion")
 	minioEndpoint := getEnv("MINIO_ENDPOINT", "localhost:9000")
+	minioPublicEndpoint := getEnv("MINIO_PUBLIC_ENDPOINT", minioEndpoint)
 	minioAccessKey := getEnv("MINIO_ACCESS_KEY", "minioadmin")
 	minioSecretKey := getEnv("MINIO_SECRET_KEY", "minioadmin")
 	redisHost := getEnv("REDIS_HOST", "localhost:6379")
+	encryptionMasterKey := getEnv("ENCRYPTION_MASTER_KEY", "")
+	encryptionKeyringFile := getEnv("ENCRYPTION_KEYRING_FILE", "")
 	port := getEnv("PORT", "8080")
 
+	presignExpiry, err := time.ParseDuration(getEnv("PRESIGN_EXPIRY", "15m"))
+	if err != nil {
+		log.Fatalf("Invalid PRESIGN_EXPIRY: %v", err)
+	}
+
+	gltfOnCommit, err := strconv.ParseBool(getEnv("GLTF_ON_COMMIT", "false"))
+	if err != nil {
+		log.Fatalf("Invalid GLTF_ON_COMMIT: %v", err)
+	}
+
+	maxInspectSize, err := strconv.ParseInt(getEnv("MAX_INSPECT_SIZE", "67108864"), 10, 64)
+	if err != nil || maxInspectSize <= 0 {
+		log.Fatalf("Invalid MAX_INSPECT_SIZE: %v", getEnv("MAX_INSPECT_SIZE", ""))
+	}
+
+	backgroundWorkers, err := strconv.Atoi(getEnv("BACKGROUND_WORKERS", "2"))
+	if err != nil || backgroundWorkers <= 0 {
+		log.Fatalf("Invalid BACKGROUND_WORKERS: %v", getEnv("BACKGROUND_WORKERS", ""))
+	}
+
+	lodOnCommit, err := strconv.ParseBool(getEnv("LOD_ON_COMMIT", "false"))
+	if err != nil {
+		log.Fatalf("Invalid LOD_ON_COMMIT: %v", err)
+	}
+
+	thumbnailSpecs, err := analysis.ParseThumbnailSpecs(getEnv("THUMBNAIL_SIZES", "256"), getEnv("THUMBNAIL_VIEWS", "iso"))
+	if err != nil {
+		log.Fatalf("Invalid thumbnail config: %v", err)
+	}
+
 	//Initialize database connection
 	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPass, dbName)
@@ -42,12 +78,18 @@ func main() {
 	defer db.Close()
 
 	//Initialize minio client
-	minioClient, err := storage.NewMinioClient(minioEndpoint, minioAccessKey, minioSecretKey)
+	minioClient, err := storage.NewMinioClient(minioEndpoint, minioPublicEndpoint, minioAccessKey, minioSecretKey)
 	if err != nil {
 		log.Fatalf("Failed to connect to MinIO: %v", err)
 	}
 	log.Println("✓ Connected to MinIO")
 
+	// Presigned uploads that are never committed would otherwise stay in
+	// storage, unencrypted, indefinitely
+	if err := minioClient.ExpireStagedUploads(context.Background(), 1); err != nil {
+		log.Printf("Failed to set staged upload expiry: %v", err)
+	}
+
 	//Initialize Redis client
 	redisClient := repository.NewRedisClient(redisHost)
 	log.Println("✓ Connected to Redis")
@@ -58,12 +100,51 @@ func main() {
 	commitRepo := repository.NewCommitRepository(db.DB)
 	fileRepo := repository.NewFileRepository(db.DB)
 	mrRepo := repository.NewMergeRequestRepository(db.DB)
+	projectKeyRepo := repository.NewProjectKeyRepository(db.DB)
+	meshRepo := repository.NewMeshRepository(db.DB)
+	stepRepo := repository.NewStepRepository(db.DB)
+	dxfRepo := repository.NewDXFRepository(db.DB)
+	gerberRepo := repository.NewGerberRepository(db.DB)
+	kicadRepo := repository.NewKiCadRepository(db.DB)
+	bomRepo := repository.NewBOMRepository(db.DB)
+	refRepo := repository.NewReferenceRepository(db.DB)
+
+	//Initialize encryption at rest
+	keyring, err := encryption.KeyringFromConfig(encryptionMasterKey, encryptionKeyringFile)
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	var keyManager *encryption.KeyManager
+	if keyring != nil {
+		keyManager = encryption.NewKeyManager(keyring, projectKeyRepo)
+		log.Printf("✓ Encryption at rest enabled (master key %s)", keyring.ActiveID())
+	}
+	blobStore := storage.NewBlobStore(minioClient, keyManager)
+
+	thumbnailer := analysis.NewThumbnailer(blobStore, thumbnailSpecs)
+	gltfConverter := analysis.NewGLTFConverter(blobStore)
+	var eagerGLTF *analysis.GLTFConverter
+	if gltfOnCommit {
+		eagerGLTF = gltfConverter
+	}
+	lodGenerator := analysis.NewLODGenerator(blobStore)
+	var eagerLODs *analysis.LODGenerator
+	if lodOnCommit {
+		eagerLODs = lodGenerator
+	}
+	background := analysis.NewBackground(backgroundWorkers, 256)
+	analyzer := analysis.NewAnalyzer(meshRepo, stepRepo, dxfRepo, gerberRepo, kicadRepo, thumbnailer, eagerGLTF, eagerLODs, background)
+	meshLoader := analysis.NewMeshLoader(fileRepo, blobStore)
+	bomExtractor := analysis.NewBOMExtractor(fileRepo, meshRepo, stepRepo, kicadRepo, bomRepo, meshLoader)
+	refExtractor := analysis.NewReferenceExtractor(fileRepo, stepRepo, refRepo, meshLoader)
 
 	//Initialize handlers
 	projectHandler := handlers.NewProjectHandler(projectRepo)
 	branchHandler := handlers.NewBranchHandler(branchRepo, projectRepo)
-	commitHandler := handlers.NewCommitHandler(commitRepo, branchRepo, fileRepo, minioClient)
-	mrHandler := handlers.NewMergeRequestHandler(mrRepo, branchRepo, fileRepo)
+	commitHandler := handlers.NewCommitHandler(commitRepo, branchRepo, fileRepo, projectRepo, meshRepo, blobStore, analyzer, bomExtractor, refExtractor, background, presignExpiry, maxInspectSize)
+	mrHandler := handlers.NewMergeRequestHandler(db, mrRepo, branchRepo, commitRepo, fileRepo, projectRepo, meshRepo, blobStore, meshLoader, analyzer, bomExtractor, refExtractor)
+	archiveHandler := handlers.NewArchiveHandler(commitRepo, branchRepo, fileRepo, blobStore)
+	geometryHandler := handlers.NewGeometryHandler(fileRepo, meshRepo, stepRepo, dxfRepo, gerberRepo, kicadRepo, meshLoader, analyzer, thumbnailer, gltfConverter, lodGenerator, projectRepo, redisClient)
 
 	//Setup router
 	r := chi.NewRouter()
@@ -75,9 +156,9 @@ func main() {
 	r.Use(middleware.RealIP)
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5173", "http://localhost:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Range", "If-None-Match", "If-Range"},
+		ExposedHeaders:   []string{"Link", "ETag", "Content-Range", "Accept-Ranges", "Content-Length", "X-Vertex-Count", "X-LOD-Level"},
 		AllowCredentials: true,
 		MaxAge:           300,
 	}))
@@ -95,6 +176,7 @@ func main() {
 		r.Post("/projects", projectHandler.Create)
 		r.Get("/projects", projectHandler.List)
 		r.Get("/projects/{id}", projectHandler.Get)
+		r.Patch("/projects/{id}", projectHandler.Update)
 
 		// Branches
 		r.Post("/projects/{project_id}/branches", branchHandler.Create)
@@ -103,12 +185,47 @@ func main() {
 
 		// Commits
 		r.Post("/projects/{project_id}/commits", commitHandler.Create)
+		r.Post("/projects/{project_id}/uploads", commitHandler.CreateUpload)
 		r.Get("/commits/{id}", commitHandler.Get)
 		r.Get("/branches/{branch_id}/commits", commitHandler.ListByBranch)
+		r.Get("/commits/{id}/bom", commitHandler.GetBOM)
+		r.Get("/commits/{id}/bom/diff", commitHandler.GetBOMDiff)
+		r.Get("/commits/{id}/references", commitHandler.GetReferences)
+
+		// Archives
+		r.Get("/commits/{id}/archive", archiveHandler.ArchiveCommit)
+		r.Get("/projects/{project_id}/archive", archiveHandler.ArchiveRef)
 
 		// Files
 		r.Get("/files/{id}/versions", commitHandler.GetFileVersions)
 		r.Get("/file-versions/{id}/download", commitHandler.DownloadFile)
+		r.Head("/file-versions/{id}/download", commitHandler.DownloadFile)
+		r.Get("/file-versions/{id}/depends-on", commitHandler.GetDependsOn)
+		r.Get("/file-versions/{id}/where-used", commitHandler.GetWhereUsed)
+
+		// Geometry
+		r.Get("/file-versions/{id}/stats", geometryHandler.GetStats)
+		r.Get("/file-versions/{id}/validation", geometryHandler.GetValidation)
+		r.Get("/file-versions/{id}/objects", geometryHandler.GetObjects)
+		r.Get("/file-versions/{id}/step", geometryHandler.GetStep)
+		r.Get("/file-versions/{id}/dxf", geometryHandler.GetDXF)
+		r.Get("/file-versions/{id}/dxf/entities", geometryHandler.GetDXFEntities)
+		r.Get("/file-versions/{id}/dxf.svg", geometryHandler.GetDXFPreview)
+		r.Get("/file-versions/{id}/gerber", geometryHandler.GetGerber)
+		r.Get("/file-versions/{id}/gerber.svg", geometryHandler.GetGerberSVG)
+		r.Get("/file-versions/{id}/gerber.png", geometryHandler.GetGerberPNG)
+		r.Get("/file-versions/{id}/kicad", geometryHandler.GetKiCad)
+		r.Get("/file-versions/{id}/kicad/diff", geometryHandler.GetKiCadDiff)
+		r.Get("/file-versions/{id}/deviation", geometryHandler.GetDeviation)
+		r.Get("/file-versions/{id}/heatmap", geometryHandler.GetHeatmap)
+		r.Get("/file-versions/{id}/heatmap.bin", geometryHandler.GetHeatmapBuffer)
+		r.Get("/file-versions/{id}/section", geometryHandler.GetSection)
+		r.Get("/file-versions/{id}/thumbnail", geometryHandler.GetThumbnail)
+		r.Get("/file-versions/{id}/stl", geometryHandler.GetViewerMesh)
+		r.Get("/file-versions/{id}/gltf", geometryHandler.GetGLTF)
+		r.Get("/file-versions/{id}/lod", geometryHandler.GetLODs)
+		r.Get("/file-versions/{id}/lod/{level}", geometryHandler.GetLOD)
+		r.Get("/file-versions/{id}/companions", geometryHandler.GetCompanions)
 
 		// Merge Requests
 		r.Post("/merge-requests", mrHandler.Create)
@@ -152,6 +269,7 @@ func main() {
 	if err := srv.Shutdown(ctx); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
+	background.Close(ctx)
 
 	log.Println("Server exited")
 }
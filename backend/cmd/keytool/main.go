@@ -0,0 +1,148 @@
+// Command keytool manages encryption-at-rest keys. It uses the same
+// environment variables as the API server.
+//
+//	keytool rewrap                  re-wrap all data keys with the active master key
+//	keytool rotate -project <id>    issue a new data key and re-encrypt the project's blobs
+//
+// Rotation also encrypts blobs stored before encryption was enabled.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/google/uuid"
+	_ "github.com/lib/pq"
+	"github.com/rhblitstein/cad-version-control/internal/encryption"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+
+	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		getEnv("DB_HOST", "localhost"),
+		getEnv("DB_PORT", "5432"),
+		getEnv("DB_USER", "caduser"),
+		getEnv("DB_PASSWORD", "cadpass"),
+		getEnv("DB_NAME", "cadversion"))
+
+	keyring, err := encryption.KeyringFromConfig(getEnv("ENCRYPTION_MASTER_KEY", ""), getEnv("ENCRYPTION_KEYRING_FILE", ""))
+	if err != nil {
+		log.Fatalf("Failed to load encryption keys: %v", err)
+	}
+	if keyring == nil {
+		log.Fatal("Set ENCRYPTION_MASTER_KEY or ENCRYPTION_KEYRING_FILE")
+	}
+
+	db, err := repository.NewPostgres(dsn)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	keyManager := encryption.NewKeyManager(keyring, repository.NewProjectKeyRepository(db.DB))
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "rewrap":
+		count, err := keyManager.Rewrap(ctx)
+		if err != nil {
+			log.Fatalf("Rewrap failed after %d keys: %v", count, err)
+		}
+		log.Printf("✓ Re-wrapped %d data keys with master key %s", count, keyring.ActiveID())
+
+	case "rotate":
+		fs := flag.NewFlagSet("rotate", flag.ExitOnError)
+		projectIDStr := fs.String("project", "", "project ID")
+		fs.Parse(os.Args[2:])
+
+		projectID, err := uuid.Parse(*projectIDStr)
+		if err != nil {
+			log.Fatalf("Invalid project ID: %v", err)
+		}
+
+		minioEndpoint := getEnv("MINIO_ENDPOINT", "localhost:9000")
+		minioClient, err := storage.NewMinioClient(minioEndpoint, minioEndpoint,
+			getEnv("MINIO_ACCESS_KEY", "minioadmin"), getEnv("MINIO_SECRET_KEY", "minioadmin"))
+		if err != nil {
+			log.Fatalf("Failed to connect to MinIO: %v", err)
+		}
+		blobStore := storage.NewBlobStore(minioClient, keyManager)
+
+		version, err := keyManager.Rotate(ctx, projectID)
+		if err != nil {
+			log.Fatalf("Failed to rotate key: %v", err)
+		}
+		log.Printf("✓ Project %s now uses data key v%d", projectID, version)
+
+		count, err := reencryptProject(ctx, blobStore, projectID)
+		if err != nil {
+			log.Fatalf("Re-encryption failed after %d objects: %v", count, err)
+		}
+		log.Printf("✓ Re-encrypted %d objects", count)
+
+	default:
+		usage()
+	}
+}
+
+// reencryptProject rewrites every blob under the project's prefix with the
+// active data key. Each object is staged to a temp file first so the source
+// is never read while it is being overwritten.
+func reencryptProject(ctx context.Context, blobStore *storage.BlobStore, projectID uuid.UUID) (int, error) {
+	names, err := blobStore.List(ctx, fmt.Sprintf("projects/%s/", projectID))
+	if err != nil {
+		return 0, err
+	}
+
+	for i, name := range names {
+		if err := reencryptObject(ctx, blobStore, projectID, name); err != nil {
+			return i, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return len(names), nil
+}
+
+func reencryptObject(ctx context.Context, blobStore *storage.BlobStore, projectID uuid.UUID, name string) error {
+	tmp, err := os.CreateTemp("", "keytool-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	object, err := blobStore.Download(ctx, projectID, name)
+	if err != nil {
+		return err
+	}
+	size, err := io.Copy(tmp, object)
+	object.Close()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return blobStore.Upload(ctx, projectID, name, tmp, size, "application/octet-stream")
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: keytool rewrap | keytool rotate -project <id>")
+	os.Exit(2)
+}
+
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,268 @@
+// Package analysis runs format-specific processing on file versions as they
+// are committed, storing derived data such as mesh statistics.
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gerber"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/validate"
+
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+)
+
+type Analyzer struct {
+	meshRepo   *repository.MeshRepository
+	stepRepo   *repository.StepRepository
+	dxfRepo    *repository.DXFRepository
+	gerberRepo *repository.GerberRepository
+	kicadRepo  *repository.KiCadRepository
+	thumbnails *Thumbnailer
+	// gltf converts meshes after each commit; nil leaves conversion to the
+	// first viewer request
+	gltf *GLTFConverter
+	// lods decimates previews after each commit; nil likewise defers them
+	lods *LODGenerator
+	// background runs preview jobs once the commit request has returned
+	background *Background
+}
+
+func NewAnalyzer(meshRepo *repository.MeshRepository, stepRepo *repository.StepRepository, dxfRepo *repository.DXFRepository, gerberRepo *repository.GerberRepository, kicadRepo *repository.KiCadRepository, thumbnails *Thumbnailer, gltf *GLTFConverter, lods *LODGenerator, background *Background) *Analyzer {
+	return &Analyzer{
+		meshRepo:   meshRepo,
+		stepRepo:   stepRepo,
+		dxfRepo:    dxfRepo,
+		gerberRepo: gerberRepo,
+		kicadRepo:  kicadRepo,
+		thumbnails: thumbnails,
+		gltf:       gltf,
+		lods:       lods,
+		background: background,
+	}
+}
+
+// Inspection is the parsed form of a file plus anything checked before it
+// is committed. STEP files have no mesh, only their exchange structure, DXF
+// drawings only their 2D entities, Gerber and drill files only their
+// apertures and primitives and KiCad designs only components and nets.
+type Inspection struct {
+	Mesh       *geometry.Mesh
+	Validation *validate.Report
+	// Package is set for multi-object formats; Mesh is then every object
+	// placed on the build plate
+	Package *threemf.Package
+	Step    *step.File
+	DXF     *dxf.File
+	Gerber  *gerber.File
+	KiCad   *kicad.File
+}
+
+// GeometryHash is the mesh's canonical hash, or empty when there's no mesh
+func (i *Inspection) GeometryHash() string {
+	if i == nil || i.Mesh == nil {
+		return ""
+	}
+	return i.Mesh.CanonicalHash()
+}
+
+// Inspect parses a mesh and, when asked, validates it. It returns nil for
+// files in formats we don't understand.
+func Inspect(filename string, content []byte, validation bool) (*Inspection, error) {
+	if step.IsSTEP(filename) {
+		f, err := step.ParseBytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse STEP: %w", err)
+		}
+		return &Inspection{Step: f}, nil
+	}
+
+	if dxf.IsDXF(filename) {
+		f, err := dxf.ParseBytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse DXF: %w", err)
+		}
+		return &Inspection{DXF: f}, nil
+	}
+
+	if gerber.IsGerber(filename) {
+		f, err := gerber.ParseBytes(filename, content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Gerber: %w", err)
+		}
+		return &Inspection{Gerber: f}, nil
+	}
+
+	if kicad.IsKiCad(filename) {
+		f, err := kicad.ParseBytes(content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse KiCad file: %w", err)
+		}
+		return &Inspection{KiCad: f}, nil
+	}
+
+	if !IsMesh(filename) {
+		return nil, nil
+	}
+
+	inspection := &Inspection{}
+	if IsPackage(filename) {
+		pkg, err := ParsePackage(filename, content)
+		if err != nil {
+			return nil, err
+		}
+		inspection.Package = pkg
+		inspection.Mesh = pkg.Mesh()
+	} else {
+		mesh, err := ParseMesh(filename, content)
+		if err != nil {
+			return nil, err
+		}
+		inspection.Mesh = mesh
+	}
+
+	if validation {
+		inspection.Validation = validate.Check(inspection.Mesh)
+	}
+	return inspection, nil
+}
+
+// Analyze inspects and stores metadata for a version in one step
+func (a *Analyzer) Analyze(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, content []byte) error {
+	inspection, err := Inspect(version.Filename, content, true)
+	if err != nil {
+		return err
+	}
+	return a.Store(ctx, projectID, version, inspection)
+}
+
+// Store saves derived data for a newly committed version and attaches it to
+// the version for the commit response. A nil inspection is a no-op.
+func (a *Analyzer) Store(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, inspection *Inspection) error {
+	if inspection == nil {
+		return nil
+	}
+
+	if inspection.Step != nil {
+		metadata := &models.StepMetadata{FileVersionID: version.ID, File: *inspection.Step}
+		if err := a.stepRepo.Create(ctx, metadata); err != nil {
+			return err
+		}
+		version.Step = metadata
+	}
+
+	if inspection.DXF != nil {
+		metadata := &models.DXFMetadata{FileVersionID: version.ID, File: *inspection.DXF}
+		if err := a.dxfRepo.Create(ctx, metadata); err != nil {
+			return err
+		}
+		version.DXF = metadata
+	}
+
+	if inspection.Gerber != nil {
+		metadata := &models.GerberMetadata{FileVersionID: version.ID, File: *inspection.Gerber}
+		if err := a.gerberRepo.Create(ctx, metadata); err != nil {
+			return err
+		}
+		version.Gerber = metadata
+	}
+
+	if inspection.KiCad != nil {
+		metadata := &models.KiCadMetadata{FileVersionID: version.ID, File: *inspection.KiCad}
+		if err := a.kicadRepo.Create(ctx, metadata); err != nil {
+			return err
+		}
+		version.KiCad = metadata
+	}
+
+	if inspection.Mesh == nil {
+		return nil
+	}
+
+	stats := &models.MeshStats{
+		FileVersionID: version.ID,
+		Stats:         inspection.Mesh.Stats(),
+	}
+	if err := a.meshRepo.CreateStats(ctx, stats); err != nil {
+		return err
+	}
+	version.MeshStats = stats
+
+	if inspection.Validation != nil {
+		validation := &models.MeshValidation{
+			FileVersionID: version.ID,
+			Report:        *inspection.Validation,
+		}
+		if err := a.meshRepo.CreateValidation(ctx, validation); err != nil {
+			return err
+		}
+		version.Validation = validation
+	}
+
+	if inspection.Package != nil {
+		pkg := NewModelPackage(version.ID, inspection.Package)
+		if err := a.meshRepo.CreatePackage(ctx, pkg); err != nil {
+			return err
+		}
+		version.Package = pkg
+	}
+
+	return nil
+}
+
+// QueuePreviews renders thumbnails and, when enabled, the glTF conversion
+// and LOD levels of a committed mesh in the background. Each is its own job,
+// so one failing doesn't hold up the others, and all of them are also made
+// on first request. Levels depend on the project's triangle budget rather
+// than the file alone, so it's passed in.
+func (a *Analyzer) QueuePreviews(projectID uuid.UUID, version models.FileVersion, inspection *Inspection, budget int) {
+	if inspection == nil || inspection.Mesh == nil {
+		return
+	}
+	mesh := inspection.Mesh
+
+	a.background.Submit("thumbnails "+version.ID.String(), func(ctx context.Context) error {
+		if err := a.thumbnails.Generate(ctx, projectID, &version, mesh); err != nil {
+			return fmt.Errorf("failed to generate thumbnails: %w", err)
+		}
+		return nil
+	})
+
+	if a.gltf != nil {
+		a.background.Submit("glTF "+version.ID.String(), func(ctx context.Context) error {
+			_, err := a.gltf.Convert(ctx, projectID, &version, mesh)
+			return err
+		})
+	}
+
+	if a.lods != nil {
+		a.background.Submit("LODs "+version.ID.String(), func(ctx context.Context) error {
+			levels := LODLevels(len(mesh.Triangles), budget)
+			if _, err := a.lods.Generate(ctx, projectID, &version, mesh, levels); err != nil {
+				return fmt.Errorf("failed to generate LODs: %w", err)
+			}
+			return nil
+		})
+	}
+}
+
+// NewModelPackage summarizes a parsed package for storage
+func NewModelPackage(versionID uuid.UUID, pkg *threemf.Package) *models.ModelPackage {
+	out := &models.ModelPackage{
+		FileVersionID: versionID,
+		Unit:          pkg.Unit,
+		Metadata:      pkg.Metadata,
+		Objects:       make([]models.PackageObject, len(pkg.Objects)),
+	}
+	for i, o := range pkg.Objects {
+		out.Objects[i] = models.PackageObject{Object: o, Stats: o.Mesh.Stats()}
+	}
+	return out
+}
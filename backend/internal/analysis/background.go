@@ -0,0 +1,101 @@
+package analysis
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+)
+
+// Background runs work derived from a commit, such as previews, the
+// inspection of large uploads and the commit's BOM and references, after
+// the request that made the commit has returned. Previews, BOMs and
+// references are also made on first request, so dropping one only costs a
+// slower first view; a dropped inspection leaves its version's inspection
+// status pending.
+type Background struct {
+	jobs   chan job
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	mu     sync.RWMutex
+	closed bool
+}
+
+type job struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// NewBackground starts workers goroutines sharing a queue of queueSize jobs
+func NewBackground(workers, queueSize int) *Background {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Background{
+		jobs:   make(chan job, queueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	for range max(workers, 1) {
+		b.wg.Add(1)
+		go b.work()
+	}
+	return b
+}
+
+func (b *Background) work() {
+	defer b.wg.Done()
+	for j := range b.jobs {
+		b.run(j)
+	}
+}
+
+// run runs one job; a panic, e.g. from a parser fed a malformed file, fails
+// that job rather than the server
+func (b *Background) run(j job) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Background job %s panicked: %v\n%s", j.name, r, debug.Stack())
+		}
+	}()
+	if err := j.run(b.ctx); err != nil {
+		log.Printf("Background job %s failed: %v", j.name, err)
+	}
+}
+
+// Submit queues a job without waiting for it. Failures are logged.
+func (b *Background) Submit(name string, run func(ctx context.Context) error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		log.Printf("Background job %s dropped: shutting down", name)
+		return
+	}
+	select {
+	case b.jobs <- job{name: name, run: run}:
+	default:
+		log.Printf("Background job %s dropped: queue full", name)
+	}
+}
+
+// Close stops accepting jobs and waits for queued ones to finish, until
+// ctx is done, at which point running jobs are cancelled
+func (b *Background) Close(ctx context.Context) {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		close(b.jobs)
+	}
+	b.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		b.cancel()
+		<-done
+	}
+}
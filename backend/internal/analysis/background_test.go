@@ -0,0 +1,31 @@
+package analysis
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+func TestBackgroundRecoversPanics(t *testing.T) {
+	b := NewBackground(1, 4)
+	var ran atomic.Int32
+	b.Submit("panics", func(ctx context.Context) error {
+		var s []int
+		_ = s[1]
+		return nil
+	})
+	b.Submit("fails", func(ctx context.Context) error {
+		ran.Add(1)
+		return errors.New("failed")
+	})
+	b.Submit("runs", func(ctx context.Context) error {
+		ran.Add(1)
+		return nil
+	})
+	b.Close(context.Background())
+
+	if got := ran.Load(); got != 2 {
+		t.Errorf("%d jobs ran after the panic, want 2", got)
+	}
+}
@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/bom"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+)
+
+// BOMExtractor derives a bill of materials from a commit's tree and stores
+// it per commit. Design files are read from their stored metadata where
+// the analyzer already saved it.
+type BOMExtractor struct {
+	fileRepo  *repository.FileRepository
+	meshRepo  *repository.MeshRepository
+	stepRepo  *repository.StepRepository
+	kicadRepo *repository.KiCadRepository
+	bomRepo   *repository.BOMRepository
+	loader    *MeshLoader
+}
+
+func NewBOMExtractor(
+	fileRepo *repository.FileRepository,
+	meshRepo *repository.MeshRepository,
+	stepRepo *repository.StepRepository,
+	kicadRepo *repository.KiCadRepository,
+	bomRepo *repository.BOMRepository,
+	loader *MeshLoader,
+) *BOMExtractor {
+	return &BOMExtractor{
+		fileRepo:  fileRepo,
+		meshRepo:  meshRepo,
+		stepRepo:  stepRepo,
+		kicadRepo: kicadRepo,
+		bomRepo:   bomRepo,
+		loader:    loader,
+	}
+}
+
+// Get returns a commit's stored BOM, extracting it first for commits made
+// before BOMs were
+func (e *BOMExtractor) Get(ctx context.Context, commitID uuid.UUID) (*models.CommitBOM, error) {
+	stored, err := e.bomRepo.GetByCommit(ctx, commitID)
+	if err != nil || stored != nil {
+		return stored, err
+	}
+	return e.Extract(ctx, commitID)
+}
+
+// Extract builds the BOM of the commit's tree and stores it. Files that
+// can't be read are skipped with a warning rather than failing the BOM.
+func (e *BOMExtractor) Extract(ctx context.Context, commitID uuid.UUID) (*models.CommitBOM, error) {
+	tree, err := e.fileRepo.GetTreeAtCommit(ctx, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+
+	b := bom.NewBuilder()
+	for i := range tree {
+		version := &tree[i]
+		if err := e.add(ctx, b, version); err != nil {
+			b.Warn(fmt.Sprintf("%s could not be read: %v", version.Filename, err))
+		}
+	}
+
+	commitBOM := &models.CommitBOM{CommitID: commitID, BOM: *b.BOM()}
+	if err := e.bomRepo.Create(ctx, commitBOM); err != nil {
+		return nil, err
+	}
+	return commitBOM, nil
+}
+
+func (e *BOMExtractor) add(ctx context.Context, b *bom.Builder, version *models.FileVersion) error {
+	switch {
+	case bom.IsTable(version.Filename):
+		content, err := e.loader.Read(ctx, version)
+		if err != nil {
+			return err
+		}
+		rows, err := bom.ReadTable(version.Filename, content)
+		if err != nil {
+			return err
+		}
+		b.AddTable(version.Filename, rows)
+
+	case kicad.IsKiCad(version.Filename):
+		metadata, err := e.kicadRepo.GetByVersion(ctx, version.ID)
+		if err != nil {
+			return err
+		}
+		if metadata != nil {
+			b.AddKiCad(version.Filename, &metadata.File)
+			return nil
+		}
+		design, err := e.loader.LoadKiCad(ctx, version)
+		if err != nil {
+			return err
+		}
+		b.AddKiCad(version.Filename, design)
+
+	case step.IsSTEP(version.Filename):
+		metadata, err := e.stepRepo.GetByVersion(ctx, version.ID)
+		if err != nil {
+			return err
+		}
+		if metadata != nil {
+			b.AddStep(version.Filename, &metadata.File)
+			return nil
+		}
+		f, err := e.loader.LoadStep(ctx, version)
+		if err != nil {
+			return err
+		}
+		b.AddStep(version.Filename, f)
+
+	case IsPackage(version.Filename):
+		stored, err := e.meshRepo.GetPackageByVersion(ctx, version.ID)
+		if err != nil {
+			return err
+		}
+		if stored != nil {
+			objects := make([]threemf.Object, len(stored.Objects))
+			for i, o := range stored.Objects {
+				objects[i] = o.Object
+			}
+			b.AddObjects(version.Filename, objects)
+			return nil
+		}
+		pkg, err := e.loader.LoadPackage(ctx, version)
+		if err != nil {
+			return err
+		}
+		b.AddObjects(version.Filename, pkg.Objects)
+
+	case IsMesh(version.Filename), dxf.IsDXF(version.Filename):
+		b.AddPart(version.Filename)
+	}
+	return nil
+}
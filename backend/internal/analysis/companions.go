@@ -0,0 +1,100 @@
+package analysis
+
+import (
+	"context"
+
+	"github.com/rhblitstein/cad-version-control/internal/assembly"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/obj"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+const (
+	CompanionMaterialLibrary = assembly.KindMaterialLibrary
+	CompanionTexture         = assembly.KindTexture
+)
+
+// Companion is a file another file loads by name, such as the MTL behind an
+// OBJ. Version is nil when nothing in the tree matches the reference.
+type Companion struct {
+	Reference    string              `json:"reference"`
+	Kind         string              `json:"kind"`
+	ReferencedBy string              `json:"referenced_by"`
+	Version      *models.FileVersion `json:"version,omitempty"`
+	// Warning is set when several files match the reference and Version is
+	// only the nearest of them
+	Warning string `json:"warning,omitempty"`
+}
+
+// companionRefs lists the files named inside content and what they are
+func companionRefs(filename string, content []byte) ([]string, string) {
+	switch {
+	case obj.IsOBJ(filename):
+		return obj.MaterialLibraries(content), CompanionMaterialLibrary
+	case obj.IsMTL(filename):
+		return obj.Textures(content), CompanionTexture
+	}
+	return nil, ""
+}
+
+// HasCompanions reports whether files of this type can reference others
+func HasCompanions(filename string) bool {
+	return obj.IsOBJ(filename) || obj.IsMTL(filename)
+}
+
+// Companions resolves the files a version references against tree, the
+// commit snapshot it belongs to, following MTLs through to their textures
+func (l *MeshLoader) Companions(ctx context.Context, version *models.FileVersion, tree []models.FileVersion) ([]Companion, error) {
+	companions := []Companion{}
+	visited := map[string]bool{version.Filename: true}
+
+	queue := []*models.FileVersion{version}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+
+		content, err := l.Read(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+
+		refs, kind := companionRefs(current.Filename, content)
+		for _, ref := range refs {
+			companion := Companion{Reference: ref, Kind: kind, ReferencedBy: current.Filename}
+			if match, warning := resolveReference(current.Filename, ref, tree); match != nil {
+				companion.Version = match
+				companion.Warning = warning
+				if !visited[match.Filename] {
+					visited[match.Filename] = true
+					if HasCompanions(match.Filename) {
+						queue = append(queue, match)
+					}
+				}
+			}
+			companions = append(companions, companion)
+		}
+	}
+	return companions, nil
+}
+
+// resolveReference finds ref in tree the way assembly references resolve,
+// with a warning when the match was a guess among several
+func resolveReference(from, ref string, tree []models.FileVersion) (*models.FileVersion, string) {
+	paths := make([]string, len(tree))
+	for i := range tree {
+		paths[i] = tree[i].Filename
+	}
+	match, others, ok := assembly.Resolve(from, ref, paths)
+	if !ok {
+		return nil, ""
+	}
+	var warning string
+	if len(others) > 0 {
+		warning = assembly.AmbiguityWarning(from, ref, match, others)
+	}
+	for i := range tree {
+		if tree[i].Filename == match {
+			return &tree[i], warning
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gltf"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+)
+
+// GLTFConverter stores a GLB conversion next to each mesh version's blob,
+// so the viewer downloads a compact indexed file instead of the original
+type GLTFConverter struct {
+	storage *storage.BlobStore
+}
+
+func NewGLTFConverter(storage *storage.BlobStore) *GLTFConverter {
+	return &GLTFConverter{storage: storage}
+}
+
+func GLBPath(version *models.FileVersion) string {
+	return version.StoragePath + ".glb"
+}
+
+// Get returns a stored conversion, or nil if it hasn't been made yet
+func (c *GLTFConverter) Get(ctx context.Context, projectID uuid.UUID, version *models.FileVersion) ([]byte, error) {
+	path := GLBPath(version)
+	if _, err := c.storage.Stat(ctx, path); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	object, err := c.storage.Download(ctx, projectID, path)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+// Convert encodes and stores the GLB, returning its bytes
+func (c *GLTFConverter) Convert(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, mesh *geometry.Mesh) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gltf.WriteGLB(&buf, mesh, gltf.DefaultOptions()); err != nil {
+		return nil, fmt.Errorf("failed to encode glTF: %w", err)
+	}
+
+	if err := c.storage.Upload(ctx, projectID, GLBPath(version), bytes.NewReader(buf.Bytes()), int64(buf.Len()), "model/gltf-binary"); err != nil {
+		return nil, fmt.Errorf("failed to store glTF: %w", err)
+	}
+	return buf.Bytes(), nil
+}
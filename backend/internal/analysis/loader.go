@@ -0,0 +1,219 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gerber"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/obj"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/stl"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+)
+
+var ErrNotMesh = errors.New("file is not a supported mesh format")
+
+// MeshLoader fetches file versions from storage and parses them
+type MeshLoader struct {
+	fileRepo *repository.FileRepository
+	storage  *storage.BlobStore
+}
+
+func NewMeshLoader(fileRepo *repository.FileRepository, storage *storage.BlobStore) *MeshLoader {
+	return &MeshLoader{
+		fileRepo: fileRepo,
+		storage:  storage,
+	}
+}
+
+func IsMesh(filename string) bool {
+	return stl.IsSTL(filename) || obj.IsOBJ(filename) || threemf.Is3MF(filename)
+}
+
+// ParseMesh parses content according to the filename's format
+func ParseMesh(filename string, content []byte) (*geometry.Mesh, error) {
+	var mesh *geometry.Mesh
+	var err error
+	switch {
+	case stl.IsSTL(filename):
+		mesh, err = stl.ParseBytes(content)
+	case obj.IsOBJ(filename):
+		mesh, err = obj.ParseBytes(content)
+	case threemf.Is3MF(filename):
+		var pkg *threemf.Package
+		if pkg, err = ParsePackage(filename, content); err == nil {
+			mesh = pkg.Mesh()
+		}
+	default:
+		return nil, ErrNotMesh
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse mesh: %w", err)
+	}
+	return mesh, nil
+}
+
+// IsPackage reports whether a format holds several separately placed
+// objects rather than one mesh
+func IsPackage(filename string) bool {
+	return threemf.Is3MF(filename)
+}
+
+func ParsePackage(filename string, content []byte) (*threemf.Package, error) {
+	if !IsPackage(filename) {
+		return nil, ErrNotMesh
+	}
+	pkg, err := threemf.ParseBytes(content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse package: %w", err)
+	}
+	return pkg, nil
+}
+
+// CanEncode reports whether EncodeMesh can write the filename's format.
+// Packages can't be rebuilt from a single merged mesh.
+func CanEncode(filename string) bool {
+	return stl.IsSTL(filename) || obj.IsOBJ(filename)
+}
+
+// EncodeMesh writes a mesh back out in the filename's format, so generated
+// versions such as merge results keep the type their extension promises
+func EncodeMesh(filename string, mesh *geometry.Mesh, comment string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	switch {
+	case stl.IsSTL(filename):
+		err = stl.WriteBinary(&buf, mesh, comment)
+	case obj.IsOBJ(filename):
+		err = obj.Write(&buf, mesh, comment)
+	default:
+		return nil, ErrNotMesh
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mesh: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func (l *MeshLoader) Read(ctx context.Context, version *models.FileVersion) ([]byte, error) {
+	file, err := l.fileRepo.GetByID(ctx, version.FileID)
+	if err != nil {
+		return nil, err
+	}
+
+	object, err := l.storage.Download(ctx, file.ProjectID, version.StoragePath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+func (l *MeshLoader) Load(ctx context.Context, version *models.FileVersion) (*geometry.Mesh, error) {
+	if !IsMesh(version.Filename) {
+		return nil, ErrNotMesh
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return ParseMesh(version.Filename, content)
+}
+
+// LoadIn loads a mesh converted into the given unit, so versions exported
+// in different units can be compared
+func (l *MeshLoader) LoadIn(ctx context.Context, version *models.FileVersion, unit string) (*geometry.Mesh, error) {
+	mesh, err := l.Load(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	if k := units.Scale(VersionUnit(version), unit); k != 1 {
+		mesh = mesh.Transformed(geometry.Scaling(k))
+	}
+	return mesh, nil
+}
+
+// VersionUnit is the unit a mesh version's coordinates are in. Versions
+// stored without one were read as the default.
+func VersionUnit(version *models.FileVersion) string {
+	if version.Unit == "" {
+		return units.Default
+	}
+	return version.Unit
+}
+
+func (l *MeshLoader) LoadPackage(ctx context.Context, version *models.FileVersion) (*threemf.Package, error) {
+	if !IsPackage(version.Filename) {
+		return nil, ErrNotMesh
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePackage(version.Filename, content)
+}
+
+// LoadStep reads a STEP version's exchange structure
+func (l *MeshLoader) LoadStep(ctx context.Context, version *models.FileVersion) (*step.File, error) {
+	if !step.IsSTEP(version.Filename) {
+		return nil, step.ErrNotStep
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return step.ParseBytes(content)
+}
+
+// LoadDXF reads a DXF version's drawing
+func (l *MeshLoader) LoadDXF(ctx context.Context, version *models.FileVersion) (*dxf.File, error) {
+	if !dxf.IsDXF(version.Filename) {
+		return nil, dxf.ErrNotDXF
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return dxf.ParseBytes(content)
+}
+
+// LoadGerber reads a Gerber layer or Excellon drill version
+func (l *MeshLoader) LoadGerber(ctx context.Context, version *models.FileVersion) (*gerber.File, error) {
+	if !gerber.IsGerber(version.Filename) {
+		return nil, gerber.ErrNotGerber
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return gerber.ParseBytes(version.Filename, content)
+}
+
+// LoadKiCad reads a KiCad schematic or board version
+func (l *MeshLoader) LoadKiCad(ctx context.Context, version *models.FileVersion) (*kicad.File, error) {
+	if !kicad.IsKiCad(version.Filename) {
+		return nil, kicad.ErrNotKiCad
+	}
+
+	content, err := l.Read(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	return kicad.ParseBytes(content)
+}
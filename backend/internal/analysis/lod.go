@@ -0,0 +1,116 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/decimate"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gltf"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+)
+
+const (
+	// Each level below the budget keeps a quarter of the one above it
+	lodReduction = 4
+	lodMaxLevels = 3
+	// Coarser than this isn't worth a download of its own
+	lodMinTriangles = 1000
+)
+
+// LODLevel is one preview of a mesh. Level 0 is the full-resolution mesh;
+// Triangles is an upper bound for decimated levels, which can stop short
+// of it when no further collapse keeps the surface manifold.
+type LODLevel struct {
+	Level     int `json:"level"`
+	Triangles int `json:"triangles"`
+}
+
+// LODLevels lists the preview levels for a mesh under a triangle budget:
+// the full mesh, then the budget itself and successive quarters of it, for
+// every target smaller than the mesh
+func LODLevels(triangles, budget int) []LODLevel {
+	levels := []LODLevel{{Level: 0, Triangles: triangles}}
+	target := budget
+	for len(levels) <= lodMaxLevels && target >= lodMinTriangles {
+		if target < triangles {
+			levels = append(levels, LODLevel{Level: len(levels), Triangles: target})
+		}
+		target /= lodReduction
+	}
+	return levels
+}
+
+// RecommendedLOD picks the most detailed level within the budget
+func RecommendedLOD(levels []LODLevel, budget int) LODLevel {
+	for _, l := range levels {
+		if l.Triangles <= budget {
+			return l
+		}
+	}
+	return levels[len(levels)-1]
+}
+
+// LODPath keys each level by its target rather than its number, so
+// changing the project budget doesn't serve stale previews
+func LODPath(version *models.FileVersion, level LODLevel) string {
+	return fmt.Sprintf("%s.lod/%d.glb", version.StoragePath, level.Triangles)
+}
+
+// LODGenerator decimates meshes into GLB preview levels and stores them
+// next to the version's blob, like thumbnails
+type LODGenerator struct {
+	storage *storage.BlobStore
+}
+
+func NewLODGenerator(storage *storage.BlobStore) *LODGenerator {
+	return &LODGenerator{storage: storage}
+}
+
+// Get returns a stored level, or nil if it hasn't been generated yet
+func (g *LODGenerator) Get(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, level LODLevel) ([]byte, error) {
+	path := LODPath(version, level)
+	if _, err := g.storage.Stat(ctx, path); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	object, err := g.storage.Download(ctx, projectID, path)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+// Generate stores every decimated level, each simplified from the one
+// before so only the first pass sees the full mesh. It returns the GLBs
+// indexed by level; level 0 is left nil since it's the plain conversion.
+func (g *LODGenerator) Generate(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, mesh *geometry.Mesh, levels []LODLevel) ([][]byte, error) {
+	out := make([][]byte, len(levels))
+	current := mesh
+	for _, level := range levels {
+		if level.Level == 0 {
+			continue
+		}
+		current = decimate.Decimate(current, level.Triangles)
+
+		var buf bytes.Buffer
+		if err := gltf.WriteGLB(&buf, current, gltf.DefaultOptions()); err != nil {
+			return nil, fmt.Errorf("failed to encode LOD %d: %w", level.Level, err)
+		}
+		if err := g.storage.Upload(ctx, projectID, LODPath(version, level), bytes.NewReader(buf.Bytes()), int64(buf.Len()), "model/gltf-binary"); err != nil {
+			return nil, fmt.Errorf("failed to store LOD %d: %w", level.Level, err)
+		}
+		out[level.Level] = buf.Bytes()
+	}
+	return out, nil
+}
@@ -0,0 +1,112 @@
+package analysis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/assembly"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+)
+
+// ReferenceExtractor derives the graph of file references in a commit's
+// tree and stores it per commit, like BOMExtractor does the BOM
+type ReferenceExtractor struct {
+	fileRepo *repository.FileRepository
+	stepRepo *repository.StepRepository
+	refRepo  *repository.ReferenceRepository
+	loader   *MeshLoader
+}
+
+func NewReferenceExtractor(
+	fileRepo *repository.FileRepository,
+	stepRepo *repository.StepRepository,
+	refRepo *repository.ReferenceRepository,
+	loader *MeshLoader,
+) *ReferenceExtractor {
+	return &ReferenceExtractor{
+		fileRepo: fileRepo,
+		stepRepo: stepRepo,
+		refRepo:  refRepo,
+		loader:   loader,
+	}
+}
+
+// Get returns a commit's stored references, extracting them first for
+// commits made before references were
+func (e *ReferenceExtractor) Get(ctx context.Context, commitID uuid.UUID) (*models.CommitReferences, error) {
+	stored, err := e.Stored(ctx, commitID)
+	if err != nil || stored != nil {
+		return stored, err
+	}
+	return e.Extract(ctx, commitID)
+}
+
+// Stored returns a commit's references if they've been extracted, or nil
+func (e *ReferenceExtractor) Stored(ctx context.Context, commitID uuid.UUID) (*models.CommitReferences, error) {
+	return e.refRepo.GetByCommit(ctx, commitID)
+}
+
+// Extract reads the references of every file in the commit's tree and
+// stores the graph. Files that can't be read are skipped with a warning.
+func (e *ReferenceExtractor) Extract(ctx context.Context, commitID uuid.UUID) (*models.CommitReferences, error) {
+	tree, err := e.fileRepo.GetTreeAtCommit(ctx, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit tree: %w", err)
+	}
+
+	paths := make([]string, len(tree))
+	for i := range tree {
+		paths[i] = tree[i].Filename
+	}
+	b := assembly.NewBuilder(paths)
+	for i := range tree {
+		version := &tree[i]
+		if err := e.add(ctx, b, version); err != nil {
+			b.Warn(fmt.Sprintf("%s could not be read: %v", version.Filename, err))
+		}
+	}
+
+	refs := &models.CommitReferences{CommitID: commitID, Graph: *b.Graph()}
+	if err := e.refRepo.Create(ctx, refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func (e *ReferenceExtractor) add(ctx context.Context, b *assembly.Builder, version *models.FileVersion) error {
+	switch {
+	case assembly.IsManifest(version.Filename):
+		content, err := e.loader.Read(ctx, version)
+		if err != nil {
+			return err
+		}
+		return b.AddManifest(version.Filename, content)
+
+	case HasCompanions(version.Filename):
+		content, err := e.loader.Read(ctx, version)
+		if err != nil {
+			return err
+		}
+		refs, kind := companionRefs(version.Filename, content)
+		b.Add(version.Filename, kind, refs)
+
+	case step.IsSTEP(version.Filename):
+		metadata, err := e.stepRepo.GetByVersion(ctx, version.ID)
+		if err != nil {
+			return err
+		}
+		if metadata != nil {
+			b.AddStep(version.Filename, &metadata.File)
+			return nil
+		}
+		f, err := e.loader.LoadStep(ctx, version)
+		if err != nil {
+			return err
+		}
+		b.AddStep(version.Filename, f)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package analysis
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/render"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+)
+
+// ThumbnailSpec is one rendered size and camera angle
+type ThumbnailSpec struct {
+	Size      int
+	Azimuth   float64
+	Elevation float64
+}
+
+func DefaultThumbnailSpec() ThumbnailSpec {
+	return ThumbnailSpec{
+		Size:      render.DefaultSize,
+		Azimuth:   render.DefaultAzimuth,
+		Elevation: render.DefaultElevation,
+	}
+}
+
+// Thumbnailer renders PNG previews and stores them next to the version's
+// blob. Deduplicated versions share a blob, so they share thumbnails too.
+type Thumbnailer struct {
+	storage *storage.BlobStore
+	// Specs rendered eagerly at commit time; others render on first request
+	specs []ThumbnailSpec
+}
+
+func NewThumbnailer(storage *storage.BlobStore, specs []ThumbnailSpec) *Thumbnailer {
+	if len(specs) == 0 {
+		specs = []ThumbnailSpec{DefaultThumbnailSpec()}
+	}
+	return &Thumbnailer{
+		storage: storage,
+		specs:   specs,
+	}
+}
+
+// ParseThumbnailSpecs combines comma-separated sizes and named views, e.g.
+// "128,512" and "iso,front", into the specs rendered at commit time
+func ParseThumbnailSpecs(sizes, views string) ([]ThumbnailSpec, error) {
+	var specs []ThumbnailSpec
+	for _, s := range strings.Split(sizes, ",") {
+		size, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || size <= 0 || size > render.MaxSize {
+			return nil, fmt.Errorf("invalid thumbnail size %q", s)
+		}
+		for _, v := range strings.Split(views, ",") {
+			angles, ok := render.Views[strings.TrimSpace(v)]
+			if !ok {
+				return nil, fmt.Errorf("unknown thumbnail view %q", v)
+			}
+			specs = append(specs, ThumbnailSpec{Size: size, Azimuth: angles[0], Elevation: angles[1]})
+		}
+	}
+	return specs, nil
+}
+
+func ThumbnailPath(version *models.FileVersion, spec ThumbnailSpec) string {
+	return fmt.Sprintf("%s.thumbnails/%d-az%s-el%s.png",
+		version.StoragePath, spec.Size, formatAngle(spec.Azimuth), formatAngle(spec.Elevation))
+}
+
+func formatAngle(deg float64) string {
+	return fmt.Sprintf("%g", math.Round(deg*10)/10)
+}
+
+// Generate renders and stores every configured spec for a committed mesh
+func (t *Thumbnailer) Generate(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, mesh *geometry.Mesh) error {
+	for _, spec := range t.specs {
+		if _, err := t.Render(ctx, projectID, version, mesh, spec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Get returns a stored thumbnail, or nil if it hasn't been rendered yet
+func (t *Thumbnailer) Get(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, spec ThumbnailSpec) ([]byte, error) {
+	path := ThumbnailPath(version, spec)
+	if _, err := t.storage.Stat(ctx, path); err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	object, err := t.storage.Download(ctx, projectID, path)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+// Render draws and stores a thumbnail, returning the PNG bytes
+func (t *Thumbnailer) Render(ctx context.Context, projectID uuid.UUID, version *models.FileVersion, mesh *geometry.Mesh, spec ThumbnailSpec) ([]byte, error) {
+	img := render.Render(mesh, render.Options{
+		Width:     spec.Size,
+		Height:    spec.Size,
+		Azimuth:   spec.Azimuth,
+		Elevation: spec.Elevation,
+	})
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+
+	path := ThumbnailPath(version, spec)
+	if err := t.storage.Upload(ctx, projectID, path, bytes.NewReader(buf.Bytes()), int64(buf.Len()), "image/png"); err != nil {
+		return nil, fmt.Errorf("failed to store thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,400 @@
+// Package assembly models how the files of a commit reference each other:
+// assemblies placing parts, OBJs loading their materials. References are
+// read from the files themselves where the format carries them (STEP
+// external references, OBJ material libraries, MTL textures) or declared
+// in assembly manifests. The resulting graph answers which files a file
+// depends on and where a file is used.
+package assembly
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+)
+
+// What a reference loads
+const (
+	KindPart            = "part"
+	KindMaterialLibrary = "material_library"
+	KindTexture         = "texture"
+)
+
+// Where a reference was read from
+const (
+	OriginExtracted = "extracted"
+	OriginManifest  = "manifest"
+)
+
+// maxDepth bounds walks through the graph; deeper nesting is malformed
+const maxDepth = 64
+
+// maxQuantity caps multiplied-out quantities, which nested assemblies can
+// push past any integer
+const maxQuantity = math.MaxInt32
+
+// Reference is one assembly → part edge. Part is the referenced file's path
+// in the tree, empty when nothing there matches what the assembly names.
+type Reference struct {
+	Assembly  string `json:"assembly"`
+	Reference string `json:"reference"`
+	Part      string `json:"part,omitempty"`
+	Kind      string `json:"kind"`
+	Quantity  int    `json:"quantity"`
+	// Transforms place each instance of the part, when the source gives them
+	Transforms []geometry.Transform `json:"transforms,omitempty"`
+	Origin     string               `json:"origin"`
+	// DeclaredIn is the file the reference was read from: the assembly
+	// itself, or a manifest
+	DeclaredIn string `json:"declared_in"`
+}
+
+type Graph struct {
+	References []Reference `json:"references"`
+	Warnings   []string    `json:"warnings,omitempty"`
+}
+
+// Usage is a file reached from another through the graph. Quantity is how
+// many instances the walk multiplies out to; Depth is 1 for direct
+// references.
+type Usage struct {
+	File     string `json:"file"`
+	Kind     string `json:"kind"`
+	Quantity int    `json:"quantity"`
+	Depth    int    `json:"depth"`
+	// Missing marks a reference nothing in the tree matches
+	Missing bool `json:"missing,omitempty"`
+}
+
+// Builder collects a tree's references and resolves them against its paths
+type Builder struct {
+	paths    []string
+	refs     []Reference
+	warnings []string
+}
+
+// NewBuilder starts a graph over the tree holding paths
+func NewBuilder(paths []string) *Builder {
+	return &Builder{paths: paths}
+}
+
+// Warn records a problem with the tree, such as a file that couldn't be
+// read, in the graph's warnings
+func (b *Builder) Warn(msg string) {
+	b.warnings = append(b.warnings, msg)
+}
+
+// Add records the files an assembly names, such as an OBJ's material
+// libraries; each name counts once
+func (b *Builder) Add(file, kind string, names []string) {
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		b.refs = append(b.refs, Reference{
+			Assembly:   file,
+			Reference:  name,
+			Kind:       kind,
+			Quantity:   1,
+			Origin:     OriginExtracted,
+			DeclaredIn: file,
+		})
+	}
+}
+
+// AddStep records a STEP assembly's externally referenced parts, each used
+// as many times as the product structure multiplies out to. Structure below
+// an external part lives in that part's file, so the walk stops there.
+func (b *Builder) AddStep(file string, f *step.File) {
+	external := make(map[string]string)
+	for _, p := range f.Products {
+		if p.File != "" {
+			external[p.Key()] = p.File
+		}
+	}
+	if len(external) == 0 {
+		return
+	}
+
+	// The product structure as edges, under a root above the top-level
+	// products so one walk counts them all
+	const root = ""
+	next := make(map[string][]Reference)
+	isChild := make(map[string]bool)
+	for _, u := range f.Structure {
+		next[u.Parent] = append(next[u.Parent], Reference{Assembly: u.Parent, Part: u.Child, Quantity: u.Quantity})
+		isChild[u.Child] = true
+	}
+	for _, p := range f.Products {
+		if k := p.Key(); k != root && !isChild[k] {
+			next[root] = append(next[root], Reference{Assembly: root, Part: k, Quantity: 1})
+			isChild[k] = true
+		}
+	}
+
+	// External parts end the walk, except at the top where their own
+	// structure is what's in this file
+	quantities := make(map[string]int)
+	usages := walk(next, func(ref Reference) (string, bool) {
+		_, ok := external[ref.Part]
+		return ref.Part, ok && ref.Assembly != root
+	}, root, true)
+	for _, u := range usages {
+		if u.Missing {
+			name := external[u.File]
+			quantities[name] = addQuantity(quantities[name], u.Quantity)
+		}
+	}
+
+	names := make([]string, 0, len(quantities))
+	for name := range quantities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		b.refs = append(b.refs, Reference{
+			Assembly:   file,
+			Reference:  name,
+			Kind:       KindPart,
+			Quantity:   quantities[name],
+			Origin:     OriginExtracted,
+			DeclaredIn: file,
+		})
+	}
+}
+
+// Graph resolves the collected references. A manifest declaring an edge the
+// assembly also carries replaces it, since it's the one someone wrote down.
+func (b *Builder) Graph() *Graph {
+	g := &Graph{References: []Reference{}, Warnings: b.warnings}
+
+	type edge struct{ assembly, target, kind string }
+	index := make(map[edge]int)
+	for _, ref := range b.refs {
+		if ref.Part == "" {
+			if part, others, ok := Resolve(ref.Assembly, ref.Reference, b.paths); ok {
+				ref.Part = part
+				if len(others) > 0 {
+					g.Warnings = append(g.Warnings, AmbiguityWarning(ref.Assembly, ref.Reference, part, others))
+				}
+			}
+		}
+		target := ref.Part
+		if target == "" {
+			target = ref.Reference
+		}
+		key := edge{ref.Assembly, target, ref.Kind}
+		if i, ok := index[key]; ok {
+			if ref.Origin == OriginManifest && g.References[i].Origin != OriginManifest {
+				g.References[i] = ref
+			}
+			continue
+		}
+		index[key] = len(g.References)
+		g.References = append(g.References, ref)
+	}
+
+	for _, ref := range g.References {
+		if ref.Part == "" {
+			g.Warnings = append(g.Warnings, ref.Assembly+" references "+ref.Reference+", which is not in the tree")
+		}
+	}
+	sort.SliceStable(g.References, func(i, j int) bool {
+		a, b := g.References[i], g.References[j]
+		if a.Assembly != b.Assembly {
+			return a.Assembly < b.Assembly
+		}
+		return a.Reference < b.Reference
+	})
+	return g
+}
+
+// Resolve finds ref relative to the referencing file's directory, falling
+// back to a case-insensitive match on the base name since exporters often
+// write absolute paths from the machine that produced the file. When
+// several files share the base name the one nearest from is picked and the
+// rest are returned as others, so the caller can warn that it's a guess.
+func Resolve(from, ref string, paths []string) (part string, others []string, ok bool) {
+	ref = strings.ReplaceAll(ref, "\\", "/")
+	want := path.Join(path.Dir(from), ref)
+	for _, p := range paths {
+		if p == want {
+			return p, nil, true
+		}
+	}
+
+	base := path.Base(ref)
+	var matches []string
+	for _, p := range paths {
+		if strings.EqualFold(path.Base(p), base) {
+			matches = append(matches, p)
+		}
+	}
+	if len(matches) == 0 {
+		return "", nil, false
+	}
+	dir := path.Dir(from)
+	sort.SliceStable(matches, func(i, j int) bool {
+		a, b := sharedDirs(dir, path.Dir(matches[i])), sharedDirs(dir, path.Dir(matches[j]))
+		if a != b {
+			return a > b
+		}
+		return matches[i] < matches[j]
+	})
+	return matches[0], matches[1:], true
+}
+
+// sharedDirs counts the leading directories two directories have in common
+func sharedDirs(a, b string) int {
+	if a == "." || b == "." {
+		return 0
+	}
+	as, bs := strings.Split(a, "/"), strings.Split(b, "/")
+	n := 0
+	for n < len(as) && n < len(bs) && as[n] == bs[n] {
+		n++
+	}
+	return n
+}
+
+// AmbiguityWarning describes a reference Resolve had to guess at
+func AmbiguityWarning(from, ref, part string, others []string) string {
+	return fmt.Sprintf("%s references %s, which matches %s and %s; using %s", from, ref, part, strings.Join(others, ", "), part)
+}
+
+// DependsOn lists the files file references, and with recursive the files
+// those reference in turn. Unresolved references are listed as missing.
+func (g *Graph) DependsOn(file string, recursive bool) []Usage {
+	next := make(map[string][]Reference)
+	for _, ref := range g.References {
+		next[ref.Assembly] = append(next[ref.Assembly], ref)
+	}
+	return walk(next, func(ref Reference) (string, bool) {
+		if ref.Part == "" {
+			return ref.Reference, true
+		}
+		return ref.Part, false
+	}, file, recursive)
+}
+
+// WhereUsed lists the assemblies that reference file, and with recursive
+// the assemblies those are used in, up to the top-level assemblies. A
+// change to file affects every one of them.
+func (g *Graph) WhereUsed(file string, recursive bool) []Usage {
+	next := make(map[string][]Reference)
+	for _, ref := range g.References {
+		if ref.Part != "" {
+			next[ref.Part] = append(next[ref.Part], ref)
+		}
+	}
+	return walk(next, func(ref Reference) (string, bool) {
+		return ref.Assembly, false
+	}, file, recursive)
+}
+
+// walk follows edges from file, multiplying quantities along each path and
+// adding them up where paths meet. Each file is visited once: quantities
+// are summed in topological order rather than path by path, which on a
+// graph of shared sub-assemblies would be exponential. Cycles are cut where
+// a depth-first walk first closes them, and Depth is the shortest path.
+func walk(next map[string][]Reference, other func(Reference) (string, bool), file string, recursive bool) []Usage {
+	found := make(map[string]*Usage)
+	expands := func(from string) bool {
+		if from == file {
+			return true
+		}
+		u := found[from]
+		return recursive && !u.Missing && u.Depth < maxDepth
+	}
+
+	// Breadth first, so each file's depth is its shortest path
+	queue := []string{file}
+	for len(queue) > 0 {
+		from := queue[0]
+		queue = queue[1:]
+		if !expands(from) {
+			continue
+		}
+		depth := 1
+		if from != file {
+			depth = found[from].Depth + 1
+		}
+		for _, ref := range next[from] {
+			to, missing := other(ref)
+			if _, ok := found[to]; ok || to == file {
+				continue
+			}
+			found[to] = &Usage{File: to, Kind: ref.Kind, Depth: depth, Missing: missing}
+			queue = append(queue, to)
+		}
+	}
+
+	// Reverse postorder puts every file after all that reach it, except
+	// along the edges that close a cycle
+	order := make(map[string]int, len(found)+1)
+	postorder := make([]string, 0, len(found)+1)
+	var visit func(from string)
+	visit = func(from string) {
+		order[from] = -1
+		if expands(from) {
+			for _, ref := range next[from] {
+				if to, _ := other(ref); order[to] == 0 && (to == file || found[to] != nil) {
+					visit(to)
+				}
+			}
+		}
+		postorder = append(postorder, from)
+	}
+	visit(file)
+	for i, f := range postorder {
+		order[f] = len(postorder) - i
+	}
+
+	quantities := map[string]int{file: 1}
+	for i := len(postorder) - 1; i >= 0; i-- {
+		from := postorder[i]
+		if !expands(from) {
+			continue
+		}
+		for _, ref := range next[from] {
+			to, _ := other(ref)
+			if order[to] <= order[from] {
+				continue
+			}
+			n := multiplyQuantity(quantities[from], max(ref.Quantity, 1))
+			quantities[to] = addQuantity(quantities[to], n)
+		}
+	}
+	for f, u := range found {
+		u.Quantity = quantities[f]
+	}
+
+	out := make([]Usage, 0, len(found))
+	for _, u := range found {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Depth != out[j].Depth {
+			return out[i].Depth < out[j].Depth
+		}
+		return out[i].File < out[j].File
+	})
+	return out
+}
+
+func addQuantity(a, b int) int {
+	return min(a+b, maxQuantity)
+}
+
+func multiplyQuantity(a, b int) int {
+	if a != 0 && b > maxQuantity/a {
+		return maxQuantity
+	}
+	return a * b
+}
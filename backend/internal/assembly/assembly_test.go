@@ -0,0 +1,160 @@
+package assembly
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+)
+
+func part(assembly, p string, qty int) Reference {
+	return Reference{Assembly: assembly, Reference: p, Part: p, Kind: KindPart, Quantity: qty}
+}
+
+func usage(t *testing.T, usages []Usage, file string) Usage {
+	t.Helper()
+	for _, u := range usages {
+		if u.File == file {
+			return u
+		}
+	}
+	t.Fatalf("%s not in %+v", file, usages)
+	return Usage{}
+}
+
+func TestWalkSharedSubassemblies(t *testing.T) {
+	// top uses two of left and one of right, both of which use bolts
+	g := &Graph{References: []Reference{
+		part("top.step", "left.step", 2),
+		part("top.step", "right.step", 1),
+		part("left.step", "bolt.step", 4),
+		part("right.step", "bolt.step", 3),
+		part("top.step", "bolt.step", 1),
+	}}
+
+	deps := g.DependsOn("top.step", true)
+	if len(deps) != 3 {
+		t.Fatalf("depends on %+v, want 3 files", deps)
+	}
+	bolt := usage(t, deps, "bolt.step")
+	if bolt.Quantity != 2*4+3+1 || bolt.Depth != 1 {
+		t.Errorf("bolt quantity %d depth %d, want 12 and 1", bolt.Quantity, bolt.Depth)
+	}
+
+	used := g.WhereUsed("bolt.step", true)
+	if top := usage(t, used, "top.step"); top.Quantity != 12 || top.Depth != 1 {
+		t.Errorf("top quantity %d depth %d, want 12 and 1", top.Quantity, top.Depth)
+	}
+
+	direct := g.DependsOn("top.step", false)
+	if bolt := usage(t, direct, "bolt.step"); bolt.Quantity != 1 {
+		t.Errorf("direct bolt quantity %d, want 1", bolt.Quantity)
+	}
+}
+
+func TestWalkExponentialPaths(t *testing.T) {
+	// 2^30 paths lead to the last level, each using four times as many as
+	// the level above
+	g := &Graph{References: diamonds(30)}
+
+	start := time.Now()
+	deps := g.DependsOn("0", true)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("DependsOn took %v", elapsed)
+	}
+	if mid := usage(t, deps, "10"); mid.Quantity != 1<<20 || mid.Depth != 20 {
+		t.Errorf("level 10 quantity %d depth %d, want %d and 20", mid.Quantity, mid.Depth, 1<<20)
+	}
+	if last := usage(t, deps, "30"); last.Quantity != maxQuantity {
+		t.Errorf("last quantity = %d, want it to saturate at %d", last.Quantity, maxQuantity)
+	}
+}
+
+// diamonds chains n levels, each file i using two of ai and two of bi,
+// which each use one of i+1
+func diamonds(n int) []Reference {
+	var refs []Reference
+	for i := range n {
+		level, next := fmt.Sprint(i), fmt.Sprint(i+1)
+		refs = append(refs,
+			part(level, "a"+level, 2), part(level, "b"+level, 2),
+			part("a"+level, next, 1), part("b"+level, next, 1))
+	}
+	return refs
+}
+
+func TestWalkCycle(t *testing.T) {
+	g := &Graph{References: []Reference{
+		part("a", "b", 2),
+		part("b", "c", 3),
+		part("c", "a", 5),
+	}}
+	deps := g.DependsOn("a", true)
+	if len(deps) != 2 {
+		t.Fatalf("depends on %+v, want b and c", deps)
+	}
+	if c := usage(t, deps, "c"); c.Quantity != 6 || c.Depth != 2 {
+		t.Errorf("c quantity %d depth %d, want 6 and 2", c.Quantity, c.Depth)
+	}
+}
+
+func TestAddStep(t *testing.T) {
+	f := &step.File{
+		Products: []step.Product{
+			{ID: "top"}, {ID: "sub"}, {ID: "screw", File: "screw.step"}, {ID: "plate", File: "plate.step"},
+		},
+		Structure: []step.Usage{
+			{Parent: "top", Child: "sub", Quantity: 3},
+			{Parent: "sub", Child: "screw", Quantity: 4},
+			{Parent: "top", Child: "screw", Quantity: 2},
+			{Parent: "top", Child: "plate", Quantity: 1},
+		},
+	}
+	b := NewBuilder([]string{"asm.step", "screw.step", "plate.step"})
+	b.AddStep("asm.step", f)
+	g := b.Graph()
+
+	want := map[string]int{"plate.step": 1, "screw.step": 14}
+	if len(g.References) != len(want) {
+		t.Fatalf("references = %+v, want %v", g.References, want)
+	}
+	for _, ref := range g.References {
+		if ref.Quantity != want[ref.Part] {
+			t.Errorf("%s quantity = %d, want %d", ref.Part, ref.Quantity, want[ref.Part])
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	paths := []string{"asm/top.step", "asm/parts/bolt.step", "other/Bolt.STEP", "asm/nut.step"}
+
+	if got, others, ok := Resolve("asm/top.step", "nut.step", paths); !ok || got != "asm/nut.step" || len(others) != 0 {
+		t.Errorf("relative Resolve = %q, %q, %v", got, others, ok)
+	}
+	if got, others, ok := Resolve("asm/top.step", "parts/bolt.step", paths); !ok || got != "asm/parts/bolt.step" || len(others) != 0 {
+		t.Errorf("exact Resolve = %q, %q, %v", got, others, ok)
+	}
+
+	got, others, ok := Resolve("asm/top.step", `C:\work\BOLT.step`, paths)
+	if !ok || got != "asm/parts/bolt.step" {
+		t.Fatalf("base name Resolve = %q, %v, want the bolt nearest the assembly", got, ok)
+	}
+	if len(others) != 1 || others[0] != "other/Bolt.STEP" {
+		t.Errorf("others = %q, want the other bolt", others)
+	}
+
+	if _, _, ok := Resolve("asm/top.step", "washer.step", paths); ok {
+		t.Error("Resolve found a file that isn't in the tree")
+	}
+}
+
+func TestGraphWarnsAmbiguousReference(t *testing.T) {
+	b := NewBuilder([]string{"top.obj", "a/shared.mtl", "b/shared.mtl"})
+	b.Add("top.obj", KindMaterialLibrary, []string{"/home/me/shared.mtl"})
+	g := b.Graph()
+	if len(g.Warnings) != 1 || !strings.Contains(g.Warnings[0], "b/shared.mtl") {
+		t.Errorf("warnings = %q, want one naming both matches", g.Warnings)
+	}
+}
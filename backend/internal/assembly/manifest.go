@@ -0,0 +1,101 @@
+package assembly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+var ErrInvalidManifest = errors.New("invalid assembly manifest")
+
+// manifest declares references for formats that don't carry them, e.g.
+// an STL assembly exported from a CAD tool. Paths are relative to the
+// manifest's directory:
+//
+//	{"assemblies": [{"file": "enclosure.3mf", "parts": [
+//	  {"file": "parts/bracket.stl", "quantity": 4},
+//	  {"file": "parts/lid.step", "transforms": [{"translation": [0, 0, 40]}]}
+//	]}]}
+//
+// A part's quantity defaults to the number of transforms given, or 1.
+type manifest struct {
+	Assemblies []struct {
+		File  string `json:"file"`
+		Parts []struct {
+			File       string               `json:"file"`
+			Quantity   int                  `json:"quantity"`
+			Transforms []geometry.Transform `json:"transforms"`
+		} `json:"parts"`
+	} `json:"assemblies"`
+}
+
+// IsManifest reports whether a file declares assembly references: one
+// named assembly.json, or ending in .assembly.json
+func IsManifest(filename string) bool {
+	base := strings.ToLower(path.Base(filename))
+	return base == "assembly.json" || strings.HasSuffix(base, ".assembly.json")
+}
+
+// AddManifest records the references a manifest declares. Assemblies it
+// names that aren't in the tree are skipped with a warning.
+func (b *Builder) AddManifest(file string, data []byte) error {
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidManifest, err)
+	}
+
+	for i, a := range m.Assemblies {
+		if a.File == "" {
+			return fmt.Errorf("%w: assembly %d has no file", ErrInvalidManifest, i+1)
+		}
+		assembly, others, ok := Resolve(file, a.File, b.paths)
+		if !ok {
+			b.Warn(fmt.Sprintf("%s declares %s, which is not in the tree", file, a.File))
+			continue
+		}
+		if len(others) > 0 {
+			b.Warn(AmbiguityWarning(file, a.File, assembly, others))
+		}
+		for j, p := range a.Parts {
+			if p.File == "" {
+				return fmt.Errorf("%w: part %d of %s has no file", ErrInvalidManifest, j+1, a.File)
+			}
+			if p.Quantity < 0 {
+				return fmt.Errorf("%w: part %s of %s has a negative quantity", ErrInvalidManifest, p.File, a.File)
+			}
+			for k := range p.Transforms {
+				// A placement given only as a translation isn't rotated
+				if p.Transforms[k].M == ([3][3]float64{}) {
+					p.Transforms[k].M = geometry.Identity().M
+				}
+			}
+			qty := p.Quantity
+			if qty == 0 {
+				qty = max(len(p.Transforms), 1)
+			}
+
+			ref := Reference{
+				Assembly:   assembly,
+				Reference:  p.File,
+				Kind:       KindPart,
+				Quantity:   qty,
+				Transforms: p.Transforms,
+				Origin:     OriginManifest,
+				DeclaredIn: file,
+			}
+			// Parts are named relative to the manifest, not the assembly
+			if part, others, ok := Resolve(file, p.File, b.paths); ok {
+				ref.Part = part
+				if len(others) > 0 {
+					b.Warn(AmbiguityWarning(file, p.File, part, others))
+				}
+			}
+			b.refs = append(b.refs, ref)
+		}
+	}
+	return nil
+}
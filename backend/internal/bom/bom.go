@@ -0,0 +1,424 @@
+// Package bom derives a bill of materials from a commit's files. BOM files
+// checked into the tree (CSV, TSV or XLSX) are taken as written; without
+// them lines come from design files (KiCad components, 3MF build items,
+// STEP product structure), and failing that from the part files
+// themselves, one line each.
+package bom
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+)
+
+// Where a BOM's lines came from, in order of precedence
+const (
+	SourceBOMFile  = "bom_file"
+	SourceDesign   = "design"
+	SourceFileTree = "file_tree"
+	// SourceNone is an empty BOM: the tree had nothing to derive one from
+	SourceNone = "none"
+)
+
+// Line is one part and how many of it the design uses. Lines are matched
+// across commits by Key: the part number when there is one, else what
+// describes the part, e.g. a KiCad value and footprint.
+type Line struct {
+	Key          string  `json:"key"`
+	PartNumber   string  `json:"part_number,omitempty"`
+	Manufacturer string  `json:"manufacturer,omitempty"`
+	Description  string  `json:"description,omitempty"`
+	Value        string  `json:"value,omitempty"`
+	Footprint    string  `json:"footprint,omitempty"`
+	Quantity     float64 `json:"quantity"`
+	// References are designators such as R1, from KiCad or BOM files
+	References []string `json:"references,omitempty"`
+	// Files the line was read from
+	Files []string `json:"files"`
+}
+
+type BOM struct {
+	Source   string   `json:"source"`
+	Lines    []Line   `json:"lines"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// origin tells design sources apart so schematics and boards of the same
+// design aren't counted twice
+type origin int
+
+const (
+	originBOMFile origin = iota
+	originSchematic
+	originBoard
+	originModel
+	originFile
+	originCount
+)
+
+// Builder collects lines from a tree's files; BOM picks the best source
+type Builder struct {
+	lines    [originCount]map[string]*Line
+	warnings []string
+}
+
+func NewBuilder() *Builder {
+	b := &Builder{}
+	for i := range b.lines {
+		b.lines[i] = make(map[string]*Line)
+	}
+	return b
+}
+
+// Warn records a problem with the tree, such as a file that couldn't be
+// read, in the BOM's warnings
+func (b *Builder) Warn(msg string) {
+	b.warnings = append(b.warnings, msg)
+}
+
+// add merges a line into those with the same key: quantities add up and
+// references and files are combined
+func (b *Builder) add(o origin, l Line) {
+	l.Key = lineKey(l)
+	if l.Key == "" {
+		return
+	}
+	existing, ok := b.lines[o][l.Key]
+	if !ok {
+		b.lines[o][l.Key] = &l
+		return
+	}
+	existing.Quantity += l.Quantity
+	existing.References = append(existing.References, l.References...)
+	for _, f := range l.Files {
+		if !contains(existing.Files, f) {
+			existing.Files = append(existing.Files, f)
+		}
+	}
+	fill := func(dst *string, src string) {
+		if *dst == "" {
+			*dst = src
+		}
+	}
+	fill(&existing.PartNumber, l.PartNumber)
+	fill(&existing.Manufacturer, l.Manufacturer)
+	fill(&existing.Description, l.Description)
+	fill(&existing.Value, l.Value)
+	fill(&existing.Footprint, l.Footprint)
+}
+
+// lineKey is the upper-cased part number, or else the description, value
+// and footprint that identify the part
+func lineKey(l Line) string {
+	if pn := strings.TrimSpace(l.PartNumber); pn != "" {
+		return strings.ToUpper(pn)
+	}
+	var parts []string
+	for _, s := range []string{l.Description, l.Value, l.Footprint} {
+		if s = strings.TrimSpace(s); s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " | ")
+}
+
+// AddTable reads a BOM file's rows. The header row is found by its column
+// names, so title rows above it are skipped. Tables without a recognizable
+// header are ignored, with a warning when the file is named as a BOM.
+func (b *Builder) AddTable(file string, rows [][]string) {
+	header, cols := findHeader(rows)
+	if header < 0 {
+		if strings.Contains(strings.ToLower(path.Base(file)), "bom") {
+			b.Warn(file + " has no part number, description or quantity columns; it was not read as a BOM")
+		}
+		return
+	}
+
+	for _, row := range rows[header+1:] {
+		cell := func(c column) string {
+			i, ok := cols[c]
+			if !ok || i >= len(row) {
+				return ""
+			}
+			return strings.TrimSpace(row[i])
+		}
+		l := Line{
+			PartNumber:   cell(columnPartNumber),
+			Manufacturer: cell(columnManufacturer),
+			Description:  cell(columnDescription),
+			Value:        cell(columnValue),
+			Footprint:    cell(columnFootprint),
+			References:   splitReferences(cell(columnReferences)),
+			Files:        []string{file},
+		}
+		if lineKey(l) == "" {
+			continue
+		}
+		qty, ok := parseQuantity(cell(columnQuantity))
+		switch {
+		case ok:
+			l.Quantity = qty
+		case len(l.References) > 0:
+			l.Quantity = float64(len(l.References))
+		default:
+			l.Quantity = 1
+		}
+		b.add(originBOMFile, l)
+	}
+}
+
+// AddKiCad adds a schematic's or board's components, leaving out parts
+// marked DNP or excluded from the BOM. Part numbers come from fields such
+// as MPN.
+func (b *Builder) AddKiCad(file string, f *kicad.File) {
+	o := originSchematic
+	if f.Kind == kicad.KindPCB {
+		o = originBoard
+	}
+	for _, c := range f.Components {
+		if c.DNP || c.ExcludeFromBOM {
+			continue
+		}
+		l := Line{
+			Value:      c.Value,
+			Footprint:  c.Footprint,
+			Quantity:   1,
+			References: []string{c.Reference},
+			Files:      []string{file},
+		}
+		for name, value := range c.Fields {
+			switch columnFor(name) {
+			case columnPartNumber:
+				l.PartNumber = value
+			case columnManufacturer:
+				l.Manufacturer = value
+			case columnDescription:
+				l.Description = value
+			}
+		}
+		b.add(o, l)
+	}
+}
+
+// AddObjects adds a 3MF's build items, one per placement, by part number
+// or object name
+func (b *Builder) AddObjects(file string, objects []threemf.Object) {
+	for _, o := range objects {
+		l := Line{PartNumber: o.PartNumber, Description: o.Name, Quantity: 1, Files: []string{file}}
+		if l.PartNumber == "" && l.Description == "" {
+			l.Description = path.Base(file)
+		}
+		b.add(originModel, l)
+	}
+}
+
+// AddStep adds a STEP assembly's leaf products, each used as many times as
+// the assembly tree multiplies out to. A file without structure is one
+// part.
+func (b *Builder) AddStep(file string, f *step.File) {
+	children := make(map[string][]step.Usage)
+	isChild := make(map[string]bool)
+	for _, u := range f.Structure {
+		children[u.Parent] = append(children[u.Parent], u)
+		isChild[u.Child] = true
+	}
+
+	// Shared sub-assemblies make the paths through the tree exponential, so
+	// quantities are multiplied once per product in topological order: the
+	// reverse of a depth-first postorder. Cyclic structures are malformed;
+	// the edges closing a cycle are ignored.
+	totals := make(map[string]float64)
+	visited := make(map[string]bool)
+	var postorder []string
+	var visit func(id string)
+	visit = func(id string) {
+		visited[id] = true
+		for _, u := range children[id] {
+			if !visited[u.Child] {
+				visit(u.Child)
+			}
+		}
+		postorder = append(postorder, id)
+	}
+	for _, p := range f.Products {
+		if k := p.Key(); !isChild[k] && !visited[k] {
+			totals[k] = 1
+			visit(k)
+		}
+	}
+
+	order := make(map[string]int, len(postorder))
+	for i, id := range postorder {
+		order[id] = len(postorder) - i
+	}
+	quantities := make(map[string]float64)
+	for i := len(postorder) - 1; i >= 0; i-- {
+		id := postorder[i]
+		if len(children[id]) == 0 {
+			quantities[id] = totals[id]
+			continue
+		}
+		for _, u := range children[id] {
+			if order[u.Child] > order[id] {
+				totals[u.Child] += totals[id] * float64(max(u.Quantity, 1))
+			}
+		}
+	}
+
+	for _, p := range f.Products {
+		qty, ok := quantities[p.Key()]
+		if !ok {
+			continue
+		}
+		delete(quantities, p.Key())
+		// The product id is its part number; the name often repeats it
+		l := Line{PartNumber: p.Key(), Description: p.Name, Quantity: qty, Files: []string{file}}
+		if l.Description == l.PartNumber {
+			l.Description = p.Description
+		}
+		b.add(originModel, l)
+	}
+}
+
+// AddPart adds a part file itself, named by its base name. Files with the
+// same base name, e.g. an STL and its DXF flat pattern, are one part.
+func (b *Builder) AddPart(file string) {
+	name := strings.TrimSuffix(path.Base(file), path.Ext(file))
+	if existing, ok := b.lines[originFile][strings.ToUpper(name)]; ok {
+		existing.Files = append(existing.Files, file)
+		return
+	}
+	b.add(originFile, Line{PartNumber: name, Quantity: 1, Files: []string{file}})
+}
+
+// BOM returns the lines of the best source present: BOM files, then design
+// files, then part files. Schematics stand for their boards when both are
+// in the tree.
+func (b *Builder) BOM() *BOM {
+	out := &BOM{Source: SourceNone, Lines: []Line{}, Warnings: b.warnings}
+
+	var origins []origin
+	switch {
+	case len(b.lines[originBOMFile]) > 0:
+		out.Source = SourceBOMFile
+		origins = []origin{originBOMFile}
+	case len(b.lines[originSchematic]) > 0 || len(b.lines[originBoard]) > 0 || len(b.lines[originModel]) > 0:
+		out.Source = SourceDesign
+		origins = []origin{originSchematic, originModel}
+		if len(b.lines[originSchematic]) == 0 {
+			origins[0] = originBoard
+		}
+	case len(b.lines[originFile]) > 0:
+		out.Source = SourceFileTree
+		origins = []origin{originFile}
+	}
+
+	merged := NewBuilder()
+	for _, o := range origins {
+		for _, l := range b.lines[o] {
+			merged.add(0, *l)
+		}
+	}
+	for _, l := range merged.lines[0] {
+		sort.Slice(l.References, func(i, j int) bool { return naturalLess(l.References[i], l.References[j]) })
+		sort.Strings(l.Files)
+		out.Lines = append(out.Lines, *l)
+	}
+	sort.Slice(out.Lines, func(i, j int) bool { return naturalLess(out.Lines[i].Key, out.Lines[j].Key) })
+	return out
+}
+
+// splitReferences reads designator lists like "R1, R2 R5" and expands
+// ranges like "R1-R4"
+func splitReferences(s string) []string {
+	var out []string
+	for _, ref := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || unicode.IsSpace(r) }) {
+		out = append(out, expandRange(ref)...)
+	}
+	return out
+}
+
+func expandRange(ref string) []string {
+	first, last, ok := strings.Cut(ref, "-")
+	if !ok {
+		return []string{ref}
+	}
+	prefix, from := splitDigits(first)
+	lastPrefix, to := splitDigits(last)
+	if lastPrefix == "" {
+		lastPrefix = prefix
+	}
+	if prefix == "" || prefix != lastPrefix || from < 0 || to < from || to-from > 1000 {
+		return []string{ref}
+	}
+	out := make([]string, 0, to-from+1)
+	for n := from; n <= to; n++ {
+		out = append(out, prefix+strconv.Itoa(n))
+	}
+	return out
+}
+
+// splitDigits splits "R12" into "R" and 12; -1 when there's no number
+func splitDigits(s string) (string, int) {
+	i := len(s)
+	for i > 0 && s[i-1] >= '0' && s[i-1] <= '9' {
+		i--
+	}
+	if i == len(s) || len(s)-i > 6 {
+		return s, -1
+	}
+	n := 0
+	for _, c := range s[i:] {
+		n = n*10 + int(c-'0')
+	}
+	return s[:i], n
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// naturalLess orders designators and part numbers so R2 comes before R10
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		if isDigit(a[0]) && isDigit(b[0]) {
+			na, ra := leadingDigits(a)
+			nb, rb := leadingDigits(b)
+			na, nb = strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func leadingDigits(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
@@ -0,0 +1,95 @@
+package bom
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+)
+
+func quantities(b *Builder) map[string]float64 {
+	out := make(map[string]float64)
+	for _, l := range b.BOM().Lines {
+		out[l.PartNumber] = l.Quantity
+	}
+	return out
+}
+
+func TestAddStep(t *testing.T) {
+	f := &step.File{
+		Products: []step.Product{{ID: "TOP"}, {ID: "SUB"}, {ID: "SCREW"}, {ID: "PLATE"}},
+		Structure: []step.Usage{
+			{Parent: "TOP", Child: "SUB", Quantity: 3},
+			{Parent: "SUB", Child: "SCREW", Quantity: 4},
+			{Parent: "TOP", Child: "SCREW", Quantity: 2},
+			{Parent: "TOP", Child: "PLATE", Quantity: 1},
+		},
+	}
+	b := NewBuilder()
+	b.AddStep("asm.step", f)
+	got := quantities(b)
+	want := map[string]float64{"SCREW": 14, "PLATE": 1}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("quantities = %v, want %v", got, want)
+	}
+}
+
+func TestAddStepWithoutStructure(t *testing.T) {
+	b := NewBuilder()
+	b.AddStep("bracket.step", &step.File{Products: []step.Product{{ID: "BRACKET"}}})
+	if got := quantities(b); got["BRACKET"] != 1 || len(got) != 1 {
+		t.Errorf("quantities = %v, want one BRACKET", got)
+	}
+}
+
+func TestAddStepCycle(t *testing.T) {
+	f := &step.File{
+		Products: []step.Product{{ID: "TOP"}, {ID: "A"}, {ID: "B"}, {ID: "LEAF"}},
+		Structure: []step.Usage{
+			{Parent: "TOP", Child: "A", Quantity: 2},
+			{Parent: "A", Child: "B", Quantity: 1},
+			{Parent: "B", Child: "A", Quantity: 1},
+			{Parent: "B", Child: "LEAF", Quantity: 3},
+		},
+	}
+	b := NewBuilder()
+	b.AddStep("asm.step", f)
+	if got := quantities(b); got["LEAF"] != 6 || len(got) != 1 {
+		t.Errorf("quantities = %v, want 6 LEAF", got)
+	}
+}
+
+// Every level of the tree uses two sub-assemblies that both use the next
+// level, so the paths to the leaf double at each of the 60 levels
+func TestAddStepSharedLevels(t *testing.T) {
+	const levels = 60
+	f := &step.File{Products: []step.Product{{ID: "L0"}, {ID: "LEAF"}}}
+	for i := range levels {
+		level, next := fmt.Sprintf("L%d", i), fmt.Sprintf("L%d", i+1)
+		if i == levels-1 {
+			next = "LEAF"
+		}
+		for _, side := range []string{"A", "B"} {
+			sub := fmt.Sprintf("%s%d", side, i)
+			f.Products = append(f.Products, step.Product{ID: sub})
+			f.Structure = append(f.Structure,
+				step.Usage{Parent: level, Child: sub, Quantity: 1},
+				step.Usage{Parent: sub, Child: next, Quantity: 1})
+		}
+		if next != "LEAF" {
+			f.Products = append(f.Products, step.Product{ID: next})
+		}
+	}
+
+	b := NewBuilder()
+	start := time.Now()
+	b.AddStep("asm.step", f)
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("AddStep took %v", elapsed)
+	}
+	if got := quantities(b)["LEAF"]; got != math.Pow(2, levels) {
+		t.Errorf("LEAF quantity = %v, want 2^%d", got, levels)
+	}
+}
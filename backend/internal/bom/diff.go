@@ -0,0 +1,117 @@
+package bom
+
+import "sort"
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// LineChange is a part in both BOMs whose quantity, designators or
+// description changed
+type LineChange struct {
+	Key               string        `json:"key"`
+	PartNumber        string        `json:"part_number,omitempty"`
+	Description       string        `json:"description,omitempty"`
+	QuantityFrom      float64       `json:"quantity_from"`
+	QuantityTo        float64       `json:"quantity_to"`
+	Delta             float64       `json:"delta"`
+	ReferencesAdded   []string      `json:"references_added,omitempty"`
+	ReferencesRemoved []string      `json:"references_removed,omitempty"`
+	Changes           []FieldChange `json:"changes,omitempty"`
+}
+
+type Diff struct {
+	SourceFrom string       `json:"source_from"`
+	SourceTo   string       `json:"source_to"`
+	Added      []Line       `json:"added"`
+	Removed    []Line       `json:"removed"`
+	Changed    []LineChange `json:"changed"`
+	// Total part counts
+	QuantityFrom float64 `json:"quantity_from"`
+	QuantityTo   float64 `json:"quantity_to"`
+}
+
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Compare reports how the "to" BOM differs from the "from" BOM, matching
+// lines by key
+func Compare(from, to *BOM) *Diff {
+	d := &Diff{
+		SourceFrom: from.Source,
+		SourceTo:   to.Source,
+		Added:      []Line{},
+		Removed:    []Line{},
+		Changed:    []LineChange{},
+	}
+
+	after := make(map[string]Line, len(to.Lines))
+	for _, l := range to.Lines {
+		after[l.Key] = l
+		d.QuantityTo += l.Quantity
+	}
+	before := make(map[string]bool, len(from.Lines))
+	for _, a := range from.Lines {
+		before[a.Key] = true
+		d.QuantityFrom += a.Quantity
+		b, ok := after[a.Key]
+		if !ok {
+			d.Removed = append(d.Removed, a)
+			continue
+		}
+		if c, changed := compareLines(a, b); changed {
+			d.Changed = append(d.Changed, c)
+		}
+	}
+	for _, b := range to.Lines {
+		if !before[b.Key] {
+			d.Added = append(d.Added, b)
+		}
+	}
+	sort.Slice(d.Changed, func(i, j int) bool { return naturalLess(d.Changed[i].Key, d.Changed[j].Key) })
+	return d
+}
+
+func compareLines(a, b Line) (LineChange, bool) {
+	c := LineChange{
+		Key:          b.Key,
+		PartNumber:   b.PartNumber,
+		Description:  b.Description,
+		QuantityFrom: a.Quantity,
+		QuantityTo:   b.Quantity,
+		Delta:        b.Quantity - a.Quantity,
+	}
+
+	had := make(map[string]bool, len(a.References))
+	for _, r := range a.References {
+		had[r] = true
+	}
+	has := make(map[string]bool, len(b.References))
+	for _, r := range b.References {
+		has[r] = true
+		if !had[r] {
+			c.ReferencesAdded = append(c.ReferencesAdded, r)
+		}
+	}
+	for _, r := range a.References {
+		if !has[r] {
+			c.ReferencesRemoved = append(c.ReferencesRemoved, r)
+		}
+	}
+
+	field := func(name, x, y string) {
+		if x != y {
+			c.Changes = append(c.Changes, FieldChange{Field: name, From: x, To: y})
+		}
+	}
+	field("manufacturer", a.Manufacturer, b.Manufacturer)
+	field("description", a.Description, b.Description)
+	field("value", a.Value, b.Value)
+	field("footprint", a.Footprint, b.Footprint)
+
+	changed := c.Delta != 0 || len(c.ReferencesAdded) > 0 || len(c.ReferencesRemoved) > 0 || len(c.Changes) > 0
+	return c, changed
+}
@@ -0,0 +1,177 @@
+package bom
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var ErrNotTable = errors.New("file is not a CSV, TSV or XLSX table")
+
+type column int
+
+const (
+	columnNone column = iota
+	columnPartNumber
+	columnManufacturer
+	columnDescription
+	columnValue
+	columnFootprint
+	columnQuantity
+	columnReferences
+)
+
+// Header names as BOM exporters write them, lower-cased with everything
+// but letters and digits removed
+var columnAliases = map[string]column{
+	"partnumber":             columnPartNumber,
+	"partno":                 columnPartNumber,
+	"pn":                     columnPartNumber,
+	"mpn":                    columnPartNumber,
+	"manufacturerpartnumber": columnPartNumber,
+	"manufacturerpartno":     columnPartNumber,
+	"mfrpartnumber":          columnPartNumber,
+	"mfrpartno":              columnPartNumber,
+	"mfgpartnumber":          columnPartNumber,
+	"itemnumber":             columnPartNumber,
+	"itemno":                 columnPartNumber,
+	"sku":                    columnPartNumber,
+	"manufacturer":           columnManufacturer,
+	"manufacturername":       columnManufacturer,
+	"mfr":                    columnManufacturer,
+	"mfg":                    columnManufacturer,
+	"vendor":                 columnManufacturer,
+	"description":            columnDescription,
+	"desc":                   columnDescription,
+	"partname":               columnDescription,
+	"name":                   columnDescription,
+	"itemdescription":        columnDescription,
+	"value":                  columnValue,
+	"val":                    columnValue,
+	"comment":                columnValue,
+	"footprint":              columnFootprint,
+	"pcbfootprint":           columnFootprint,
+	"package":                columnFootprint,
+	"qty":                    columnQuantity,
+	"quantity":               columnQuantity,
+	"count":                  columnQuantity,
+	"qtyper":                 columnQuantity,
+	"amount":                 columnQuantity,
+	"reference":              columnReferences,
+	"references":             columnReferences,
+	"designator":             columnReferences,
+	"designators":            columnReferences,
+	"refdes":                 columnReferences,
+	"referencedesignator":    columnReferences,
+	"referencedesignators":   columnReferences,
+	"ref":                    columnReferences,
+	"refs":                   columnReferences,
+}
+
+func columnFor(name string) column {
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return columnAliases[b.String()]
+}
+
+// headerSearchRows bounds how far down title rows may push the header
+const headerSearchRows = 20
+
+// findHeader finds the first row naming something that identifies a part
+// and something that counts it, and maps its columns. It returns -1 when
+// there is none.
+func findHeader(rows [][]string) (int, map[column]int) {
+	for i, row := range rows {
+		if i >= headerSearchRows {
+			break
+		}
+		cols := make(map[column]int)
+		for j, cell := range row {
+			if c := columnFor(cell); c != columnNone {
+				if _, seen := cols[c]; !seen {
+					cols[c] = j
+				}
+			}
+		}
+		_, pn := cols[columnPartNumber]
+		_, desc := cols[columnDescription]
+		_, value := cols[columnValue]
+		_, qty := cols[columnQuantity]
+		_, refs := cols[columnReferences]
+		if (pn || desc || value) && (qty || refs || pn) {
+			return i, cols
+		}
+	}
+	return -1, nil
+}
+
+// parseQuantity reads counts like "4", "2.5" or "1,000"
+func parseQuantity(s string) (float64, bool) {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ",", "")
+	if s == "" {
+		return 0, false
+	}
+	q, err := strconv.ParseFloat(s, 64)
+	if err != nil || q < 0 {
+		return 0, false
+	}
+	return q, true
+}
+
+// IsTable reports whether a file may hold a BOM table
+func IsTable(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv", ".tsv", ".xlsx":
+		return true
+	}
+	return false
+}
+
+// ReadTable reads a CSV, TSV or XLSX file's rows; workbooks are read from
+// their first sheet
+func ReadTable(filename string, data []byte) ([][]string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		return readXLSX(data)
+	case ".tsv":
+		return readDelimited(data, '\t')
+	case ".csv":
+		return readDelimited(data, sniffDelimiter(data))
+	}
+	return nil, ErrNotTable
+}
+
+// sniffDelimiter picks the separator most used on the first line: CSVs
+// from European spreadsheets are often semicolon-separated
+func sniffDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, count := ',', bytes.Count(line, []byte(","))
+	for _, d := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(d))); n > count {
+			best, count = d, n
+		}
+	}
+	return best
+}
+
+func readDelimited(data []byte, delimiter rune) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	rows, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table: %w", err)
+	}
+	return rows, nil
+}
@@ -0,0 +1,280 @@
+package bom
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Workbooks can be large; BOMs never are
+const (
+	maxXLSXRows    = 100000
+	maxXLSXColumns = 256
+	// Parts are read no further than this many decompressed bytes; a small
+	// zip can inflate to gigabytes
+	maxXLSXPartSize = 64 << 20
+)
+
+var errPartTooLarge = errors.New("workbook part is too large")
+
+// readXLSX reads the first worksheet of an Office Open XML workbook as
+// text, numbers as stored and shared or inline strings resolved
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[strings.TrimPrefix(f.Name, "/")] = f
+	}
+
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = sharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f, ok := files[sheet]
+	if !ok {
+		return nil, fmt.Errorf("workbook is missing %s", sheet)
+	}
+	rc, err := openPart(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open worksheet: %w", err)
+	}
+	defer rc.Close()
+
+	// Rows are decoded one at a time so reading stops at the row limit
+	var rows [][]string
+	d := xml.NewDecoder(rc)
+	for len(rows) < maxXLSXRows {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse worksheet: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		var r struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Type   string `xml:"t,attr"`
+				Value  string `xml:"v"`
+				Inline struct {
+					Text string `xml:",innerxml"`
+				} `xml:"is"`
+			} `xml:"c"`
+		}
+		if err := d.DecodeElement(&r, &start); err != nil {
+			return nil, fmt.Errorf("failed to parse worksheet: %w", err)
+		}
+
+		var row []string
+		for i, c := range r.Cells {
+			col := i
+			if c.Ref != "" {
+				col = columnIndex(c.Ref)
+			}
+			if col < 0 || col >= maxXLSXColumns {
+				continue
+			}
+			for len(row) <= col {
+				row = append(row, "")
+			}
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(strings.TrimSpace(c.Value))
+				if err == nil && n >= 0 && n < len(shared) {
+					row[col] = shared[n]
+				}
+			case "inlineStr":
+				row[col] = richText(c.Inline.Text)
+			default:
+				row[col] = c.Value
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// limitedPart fails reads past maxXLSXPartSize instead of truncating, so
+// an oversized part is reported rather than parsed as malformed XML
+type limitedPart struct {
+	r *io.LimitedReader
+	io.Closer
+}
+
+func (p limitedPart) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if p.r.N <= 0 {
+		return n, errPartTooLarge
+	}
+	return n, err
+}
+
+// openPart opens a zip entry for reading, limited to maxXLSXPartSize
+// decompressed bytes
+func openPart(f *zip.File) (io.ReadCloser, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	return limitedPart{r: &io.LimitedReader{R: rc, N: maxXLSXPartSize + 1}, Closer: rc}, nil
+}
+
+// firstSheet follows the workbook's first sheet to its part name
+func firstSheet(files map[string]*zip.File) (string, error) {
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(files, "xl/workbook.xml", &workbook); err != nil {
+		return "", err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return "", err
+	}
+	if len(workbook.Sheets) == 0 {
+		return "", fmt.Errorf("workbook has no sheets")
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/"), nil
+		}
+		return path.Join("xl", rel.Target), nil
+	}
+	return "xl/worksheets/sheet1.xml", nil
+}
+
+func decodePart(files map[string]*zip.File, name string, v any) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("workbook is missing %s", name)
+	}
+	rc, err := openPart(f)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+	if err := xml.NewDecoder(rc).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	return nil
+}
+
+// sharedStrings reads the string table one item at a time, from a part
+// limited like the worksheet's
+func sharedStrings(f *zip.File) ([]string, error) {
+	rc, err := openPart(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open shared strings: %w", err)
+	}
+	defer rc.Close()
+
+	var out []string
+	d := xml.NewDecoder(rc)
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return out, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "si" {
+			continue
+		}
+		var item struct {
+			Text string `xml:",innerxml"`
+		}
+		if err := d.DecodeElement(&item, &start); err != nil {
+			return nil, fmt.Errorf("failed to parse shared strings: %w", err)
+		}
+		out = append(out, richText(item.Text))
+	}
+}
+
+// richText joins the <t> runs of a string item, skipping phonetic hints
+func richText(inner string) string {
+	d := xml.NewDecoder(strings.NewReader(inner))
+	var b strings.Builder
+	depth, skip := 0, 0
+	inText := false
+	for {
+		tok, err := d.Token()
+		if err == io.EOF || err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			depth++
+			switch t.Name.Local {
+			case "rPh":
+				if skip == 0 {
+					skip = depth
+				}
+			case "t":
+				inText = true
+			}
+		case xml.EndElement:
+			if t.Name.Local == "t" {
+				inText = false
+			}
+			if skip == depth {
+				skip = 0
+			}
+			depth--
+		case xml.CharData:
+			if inText && skip == 0 {
+				b.Write(t)
+			}
+		}
+	}
+	return b.String()
+}
+
+// columnIndex turns a cell reference like "AB12" into its zero-based
+// column
+func columnIndex(ref string) int {
+	col := 0
+	n := 0
+	for _, c := range ref {
+		if c < 'A' || c > 'Z' {
+			break
+		}
+		col = col*26 + int(c-'A'+1)
+		n++
+	}
+	if n == 0 {
+		return -1
+	}
+	return col - 1
+}
@@ -0,0 +1,111 @@
+package bom
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+const (
+	testWorkbook = `<workbook xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="BOM" sheetId="1" r:id="rId1"/></sheets></workbook>`
+	testRels     = `<Relationships><Relationship Id="rId1" Target="worksheets/sheet1.xml"/></Relationships>`
+)
+
+// workbook zips a single-sheet workbook; parts may be streamed so a test
+// can write more than it holds in memory
+func workbook(t *testing.T, sheet, shared io.Reader) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	parts := []struct {
+		name string
+		r    io.Reader
+	}{
+		{"xl/workbook.xml", strings.NewReader(testWorkbook)},
+		{"xl/_rels/workbook.xml.rels", strings.NewReader(testRels)},
+		{"xl/worksheets/sheet1.xml", sheet},
+		{"xl/sharedStrings.xml", shared},
+	}
+	for _, p := range parts {
+		if p.r == nil {
+			continue
+		}
+		w, err := zw.Create(p.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.Copy(w, p.r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func sheetXML(rows string) io.Reader {
+	return strings.NewReader("<worksheet><sheetData>" + rows + "</sheetData></worksheet>")
+}
+
+func TestReadXLSX(t *testing.T) {
+	shared := strings.NewReader(`<sst><si><t>Part</t></si><si><r><t>Qty</t></r><rPh><t>x</t></rPh></si></sst>`)
+	sheet := sheetXML(`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+		`<row r="2"><c r="A2" t="inlineStr"><is><t>R-10K</t></is></c><c r="C2"><v>4</v></c></row>`)
+
+	rows, err := ReadTable("bom.xlsx", workbook(t, sheet, shared))
+	if err != nil {
+		t.Fatalf("ReadTable: %v", err)
+	}
+	want := [][]string{{"Part", "", "Qty"}, {"R-10K", "", "4"}}
+	if fmt.Sprint(rows) != fmt.Sprint(want) {
+		t.Errorf("rows = %q, want %q", rows, want)
+	}
+}
+
+func TestReadXLSXRowLimit(t *testing.T) {
+	var b strings.Builder
+	for i := range maxXLSXRows + 10 {
+		fmt.Fprintf(&b, `<row><c t="inlineStr"><is><t>%d</t></is></c></row>`, i)
+	}
+	// Reading stops at the limit, before the malformed tail
+	b.WriteString("<row><c>")
+
+	rows, err := ReadTable("bom.xlsx", workbook(t, strings.NewReader("<worksheet><sheetData>"+b.String()), nil))
+	if err != nil {
+		t.Fatalf("ReadTable: %v", err)
+	}
+	if len(rows) != maxXLSXRows {
+		t.Errorf("rows = %d, want %d", len(rows), maxXLSXRows)
+	}
+}
+
+// padding is n bytes of padding, which compresses to almost nothing
+func padding(n int64) io.Reader {
+	return io.LimitReader(repeatReader(' '), n)
+}
+
+type repeatReader byte
+
+func (r repeatReader) Read(b []byte) (int, error) {
+	for i := range b {
+		b[i] = byte(r)
+	}
+	return len(b), nil
+}
+
+func TestReadXLSXPartTooLarge(t *testing.T) {
+	bomb := io.MultiReader(strings.NewReader("<worksheet>"), padding(maxXLSXPartSize+1), strings.NewReader("</worksheet>"))
+	if _, err := ReadTable("bom.xlsx", workbook(t, bomb, nil)); !errors.Is(err, errPartTooLarge) {
+		t.Errorf("worksheet error = %v, want errPartTooLarge", err)
+	}
+
+	bomb = io.MultiReader(strings.NewReader("<sst>"), padding(maxXLSXPartSize+1), strings.NewReader("</sst>"))
+	if _, err := ReadTable("bom.xlsx", workbook(t, sheetXML(""), bomb)); !errors.Is(err, errPartTooLarge) {
+		t.Errorf("shared strings error = %v, want errPartTooLarge", err)
+	}
+}
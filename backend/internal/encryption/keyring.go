@@ -0,0 +1,134 @@
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Keyring holds the master keys that wrap per-project data keys. It stands in
+// for a real KMS: new data keys are wrapped with the active key while older
+// keys stay available to unwrap until everything has been re-wrapped.
+type Keyring struct {
+	activeID string
+	keys     map[string][]byte
+}
+
+type keyringFile struct {
+	ActiveKeyID string            `json:"active_key_id"`
+	Keys        map[string]string `json:"keys"`
+}
+
+// NewStaticKeyring builds a single-key keyring from a base64 master key
+func NewStaticKeyring(id, encodedKey string) (*Keyring, error) {
+	key, err := decodeMasterKey(encodedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Keyring{
+		activeID: id,
+		keys:     map[string][]byte{id: key},
+	}, nil
+}
+
+// LoadKeyring reads a local key file of the form
+//
+//	{"active_key_id": "2026-01", "keys": {"2026-01": "<base64 32 bytes>"}}
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var file keyringFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+
+	keyring := &Keyring{
+		activeID: file.ActiveKeyID,
+		keys:     make(map[string][]byte),
+	}
+	for id, encoded := range file.Keys {
+		key, err := decodeMasterKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("master key %q: %w", id, err)
+		}
+		keyring.keys[id] = key
+	}
+
+	if _, ok := keyring.keys[keyring.activeID]; !ok {
+		return nil, fmt.Errorf("active master key %q not in keyring", keyring.activeID)
+	}
+
+	return keyring, nil
+}
+
+func decodeMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("master key is not valid base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func (k *Keyring) ActiveID() string {
+	return k.activeID
+}
+
+// Wrap seals a data key under the active master key
+func (k *Keyring) Wrap(dataKey []byte) ([]byte, string, error) {
+	aead, err := newAEAD(k.keys[k.activeID])
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	wrapped := aead.Seal(nonce, nonce, dataKey, []byte(k.activeID))
+	return wrapped, k.activeID, nil
+}
+
+func (k *Keyring) Unwrap(masterKeyID string, wrapped []byte) ([]byte, error) {
+	masterKey, ok := k.keys[masterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("master key %q not in keyring", masterKeyID)
+	}
+
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(wrapped) < aead.NonceSize() {
+		return nil, fmt.Errorf("wrapped key is too short")
+	}
+
+	nonce, sealed := wrapped[:aead.NonceSize()], wrapped[aead.NonceSize():]
+	dataKey, err := aead.Open(nil, nonce, sealed, []byte(masterKeyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	return dataKey, nil
+}
+
+// KeyringFromConfig prefers a keyring file over a single configured master
+// key. It returns nil when neither is set, meaning encryption is disabled.
+func KeyringFromConfig(masterKey, keyringFile string) (*Keyring, error) {
+	switch {
+	case keyringFile != "":
+		return LoadKeyring(keyringFile)
+	case masterKey != "":
+		return NewStaticKeyring("config", masterKey)
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,119 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func masterKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func writeKeyring(t *testing.T, active string, keys map[string]string) *Keyring {
+	t.Helper()
+	data, err := json.Marshal(keyringFile{ActiveKeyID: active, Keys: keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	k, err := LoadKeyring(path)
+	if err != nil {
+		t.Fatalf("LoadKeyring: %v", err)
+	}
+	return k
+}
+
+// Rotating the master key wraps new data keys with the new one while keys
+// wrapped with the old one still unwrap, until they're rewrapped and the
+// old master key is dropped
+func TestKeyringRotation(t *testing.T) {
+	oldKey, newKey := masterKey(t), masterKey(t)
+	dataKey := testKey(t)
+
+	before := writeKeyring(t, "2025", map[string]string{"2025": oldKey})
+	wrapped, id, err := before.Wrap(dataKey)
+	if err != nil || id != "2025" {
+		t.Fatalf("Wrap = %q, %v", id, err)
+	}
+
+	rotated := writeKeyring(t, "2026", map[string]string{"2025": oldKey, "2026": newKey})
+	got, err := rotated.Unwrap(id, wrapped)
+	if err != nil || !bytes.Equal(got, dataKey) {
+		t.Fatalf("Unwrap with the old master key after rotation: %v", err)
+	}
+	rewrapped, newID, err := rotated.Wrap(got)
+	if err != nil || newID != "2026" {
+		t.Fatalf("Wrap after rotation = %q, %v", newID, err)
+	}
+
+	after := writeKeyring(t, "2026", map[string]string{"2026": newKey})
+	if got, err := after.Unwrap(newID, rewrapped); err != nil || !bytes.Equal(got, dataKey) {
+		t.Errorf("Unwrap rewrapped key: %v", err)
+	}
+	if _, err := after.Unwrap(id, wrapped); err == nil {
+		t.Error("Unwrap succeeded with the old master key removed")
+	}
+}
+
+func TestKeyringRejectsTampering(t *testing.T) {
+	k, err := NewStaticKeyring("config", masterKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, id, err := k.Wrap(testKey(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped[len(wrapped)-1] ^= 1
+	if _, err := k.Unwrap(id, wrapped); err == nil {
+		t.Error("Unwrap accepted a tampered key")
+	}
+	if _, err := k.Unwrap(id, wrapped[:4]); err == nil {
+		t.Error("Unwrap accepted a truncated key")
+	}
+}
+
+// Blobs name the data key version they were sealed with, so they stay
+// readable after the project's data key rotates
+func TestDataKeyRotation(t *testing.T) {
+	v1, v2 := testKey(t), testKey(t)
+	plain := testPlaintext(DefaultChunkSize + 10)
+	old := encrypt(t, v1, 1, plain)
+	current := encrypt(t, v2, 2, plain)
+
+	keys := map[uint32][]byte{1: v1, 2: v2}
+	for _, stored := range [][]byte{old, current} {
+		header, _ := ParseHeader(stored)
+		got, err := decrypt(stored, keys[header.KeyVersion])
+		if err != nil || !bytes.Equal(got, plain) {
+			t.Errorf("key version %d: %v", header.KeyVersion, err)
+		}
+	}
+}
+
+func TestLoadKeyringErrors(t *testing.T) {
+	if _, err := NewStaticKeyring("config", base64.StdEncoding.EncodeToString([]byte("short"))); err == nil {
+		t.Error("NewStaticKeyring accepted a short key")
+	}
+	data, _ := json.Marshal(keyringFile{ActiveKeyID: "missing", Keys: map[string]string{"2026": masterKey(t)}})
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKeyring(path); err == nil {
+		t.Error("LoadKeyring accepted an active key that isn't in the keyring")
+	}
+}
@@ -0,0 +1,175 @@
+package encryption
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+)
+
+// KeyManager hands out per-project data keys, creating them on first use.
+// Unwrapped keys are cached in memory for the life of the process.
+type KeyManager struct {
+	keyring *Keyring
+	repo    *repository.ProjectKeyRepository
+
+	mu    sync.Mutex
+	cache map[string][]byte
+}
+
+func NewKeyManager(keyring *Keyring, repo *repository.ProjectKeyRepository) *KeyManager {
+	return &KeyManager{
+		keyring: keyring,
+		repo:    repo,
+		cache:   make(map[string][]byte),
+	}
+}
+
+// ActiveKey returns the key new blobs for the project are encrypted with
+func (m *KeyManager) ActiveKey(ctx context.Context, projectID uuid.UUID) ([]byte, uint32, error) {
+	pk, err := m.repo.GetActive(ctx, projectID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if pk == nil {
+		latest, err := m.repo.GetLatestVersion(ctx, projectID)
+		if err != nil {
+			return nil, 0, err
+		}
+		if pk, err = m.createKey(ctx, projectID, latest+1); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	key, err := m.unwrap(pk)
+	if err != nil {
+		return nil, 0, err
+	}
+	return key, uint32(pk.Version), nil
+}
+
+// Key returns a specific key version, retired or not, to decrypt older blobs
+func (m *KeyManager) Key(ctx context.Context, projectID uuid.UUID, version uint32) ([]byte, error) {
+	if key, ok := m.cached(projectID, int(version)); ok {
+		return key, nil
+	}
+
+	pk, err := m.repo.GetByVersion(ctx, projectID, int(version))
+	if err != nil {
+		return nil, err
+	}
+	return m.unwrap(pk)
+}
+
+// Rotate creates a new data key version and retires the previous ones.
+// Existing blobs stay readable and should be re-encrypted afterwards.
+func (m *KeyManager) Rotate(ctx context.Context, projectID uuid.UUID) (uint32, error) {
+	latest, err := m.repo.GetLatestVersion(ctx, projectID)
+	if err != nil {
+		return 0, err
+	}
+
+	pk, err := m.createKey(ctx, projectID, latest+1)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := m.repo.RetireBefore(ctx, projectID, pk.Version); err != nil {
+		return 0, err
+	}
+	return uint32(pk.Version), nil
+}
+
+// Rewrap re-seals every data key not wrapped by the active master key,
+// after which older master keys can be removed from the keyring
+func (m *KeyManager) Rewrap(ctx context.Context) (int, error) {
+	keys, err := m.repo.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	rewrapped := 0
+	for _, pk := range keys {
+		if pk.MasterKeyID == m.keyring.ActiveID() {
+			continue
+		}
+
+		dataKey, err := m.keyring.Unwrap(pk.MasterKeyID, pk.WrappedKey)
+		if err != nil {
+			return rewrapped, fmt.Errorf("project %s key v%d: %w", pk.ProjectID, pk.Version, err)
+		}
+
+		wrapped, masterKeyID, err := m.keyring.Wrap(dataKey)
+		if err != nil {
+			return rewrapped, err
+		}
+
+		if err := m.repo.UpdateWrappedKey(ctx, pk.ProjectID, pk.Version, wrapped, masterKeyID); err != nil {
+			return rewrapped, err
+		}
+		rewrapped++
+	}
+
+	return rewrapped, nil
+}
+
+func (m *KeyManager) createKey(ctx context.Context, projectID uuid.UUID, version int) (*models.ProjectKey, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	wrapped, masterKeyID, err := m.keyring.Wrap(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pk := &models.ProjectKey{
+		ProjectID:   projectID,
+		Version:     version,
+		WrappedKey:  wrapped,
+		MasterKeyID: masterKeyID,
+	}
+
+	created, err := m.repo.Create(ctx, pk)
+	if err != nil {
+		return nil, err
+	}
+	if !created {
+		// Another request created this version first; use theirs
+		return m.repo.GetByVersion(ctx, projectID, version)
+	}
+	return pk, nil
+}
+
+func (m *KeyManager) unwrap(pk *models.ProjectKey) ([]byte, error) {
+	if key, ok := m.cached(pk.ProjectID, pk.Version); ok {
+		return key, nil
+	}
+
+	key, err := m.keyring.Unwrap(pk.MasterKeyID, pk.WrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	m.cache[cacheKey(pk.ProjectID, pk.Version)] = key
+	m.mu.Unlock()
+	return key, nil
+}
+
+func (m *KeyManager) cached(projectID uuid.UUID, version int) ([]byte, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key, ok := m.cache[cacheKey(projectID, version)]
+	return key, ok
+}
+
+func cacheKey(projectID uuid.UUID, version int) string {
+	return fmt.Sprintf("%s:%d", projectID, version)
+}
@@ -0,0 +1,261 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Encrypted objects are a fixed header followed by independently sealed
+// AES-256-GCM chunks. Chunking keeps memory flat for huge meshes and lets a
+// byte range be decrypted without reading the whole object.
+//
+//	header: magic(8) | key version(4) | nonce prefix(8) | chunk size(4)
+//	chunk:  ciphertext(<= chunk size) | tag(16)
+//
+// Each chunk's nonce is the prefix plus its big-endian index, and the index
+// and a final-chunk flag are authenticated so chunks cannot be reordered or
+// the object truncated.
+const (
+	HeaderSize       = 24
+	DefaultChunkSize = 64 * 1024
+	// MaxChunkSize bounds the buffer a header can ask a reader to allocate
+	MaxChunkSize = 1 << 20
+	tagSize      = 16
+)
+
+var magic = []byte("CADENC01")
+
+var ErrCorrupt = errors.New("encrypted object is corrupt")
+
+type Header struct {
+	KeyVersion  uint32
+	NoncePrefix [8]byte
+	ChunkSize   uint32
+}
+
+func (h Header) marshal() []byte {
+	buf := make([]byte, HeaderSize)
+	copy(buf[0:8], magic)
+	binary.BigEndian.PutUint32(buf[8:12], h.KeyVersion)
+	copy(buf[12:20], h.NoncePrefix[:])
+	binary.BigEndian.PutUint32(buf[20:24], h.ChunkSize)
+	return buf
+}
+
+// ParseHeader returns false if buf does not start with an encryption header,
+// meaning the object was stored as plaintext, or if the header's chunk size
+// is out of range.
+func ParseHeader(buf []byte) (Header, bool) {
+	if len(buf) < HeaderSize || !bytes.Equal(buf[0:8], magic) {
+		return Header{}, false
+	}
+
+	var h Header
+	h.KeyVersion = binary.BigEndian.Uint32(buf[8:12])
+	copy(h.NoncePrefix[:], buf[12:20])
+	h.ChunkSize = binary.BigEndian.Uint32(buf[20:24])
+	if h.ChunkSize == 0 || h.ChunkSize > MaxChunkSize {
+		return Header{}, false
+	}
+	return h, true
+}
+
+// EncryptedSize is the stored size of a plaintext of the given length
+func EncryptedSize(plainSize int64, chunkSize int) int64 {
+	chunks := (plainSize + int64(chunkSize) - 1) / int64(chunkSize)
+	if chunks == 0 {
+		chunks = 1
+	}
+	return HeaderSize + plainSize + chunks*tagSize
+}
+
+// ChunkOffset is the stored offset of the chunk containing plaintext offset off
+func ChunkOffset(h Header, off int64) (index uint32, storedOffset int64) {
+	index = uint32(off / int64(h.ChunkSize))
+	storedOffset = HeaderSize + int64(index)*(int64(h.ChunkSize)+tagSize)
+	return index, storedOffset
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+func chunkNonce(prefix [8]byte, index uint32) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix[:])
+	binary.BigEndian.PutUint32(nonce[8:], index)
+	return nonce
+}
+
+func chunkAAD(index uint32, last bool) []byte {
+	aad := make([]byte, 5)
+	binary.BigEndian.PutUint32(aad, index)
+	if last {
+		aad[4] = 1
+	}
+	return aad
+}
+
+type encryptWriter struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header Header
+	buf    []byte
+	index  uint32
+	closed bool
+}
+
+// NewEncryptWriter writes the header immediately and encrypts everything
+// written to it. Close must be called to seal the final chunk.
+func NewEncryptWriter(w io.Writer, key []byte, keyVersion uint32) (io.WriteCloser, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	header := Header{KeyVersion: keyVersion, ChunkSize: DefaultChunkSize}
+	if _, err := rand.Read(header.NoncePrefix[:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	if _, err := w.Write(header.marshal()); err != nil {
+		return nil, err
+	}
+
+	return &encryptWriter{
+		w:      w,
+		aead:   aead,
+		header: header,
+		buf:    make([]byte, 0, DefaultChunkSize),
+	}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		// A full chunk is only sealed once more data arrives, so the last
+		// chunk is always the one sealed by Close
+		if len(e.buf) == cap(e.buf) {
+			if err := e.seal(false); err != nil {
+				return written, err
+			}
+		}
+
+		n := min(cap(e.buf)-len(e.buf), len(p))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+	}
+	return written, nil
+}
+
+func (e *encryptWriter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.seal(true)
+}
+
+func (e *encryptWriter) seal(last bool) error {
+	sealed := e.aead.Seal(nil, chunkNonce(e.header.NoncePrefix, e.index), e.buf, chunkAAD(e.index, last))
+	if _, err := e.w.Write(sealed); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  Header
+	index   uint32
+	skip    int
+	pending []byte
+	chunk   []byte
+	done    bool
+}
+
+// NewDecryptReader decrypts chunks read from r, which must be positioned at
+// the start of chunk index. The first skip plaintext bytes are discarded so
+// a range can begin mid-chunk.
+func NewDecryptReader(r io.Reader, key []byte, header Header, index uint32, skip int) (io.Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &decryptReader{
+		src:    bufio.NewReaderSize(r, int(header.ChunkSize)+tagSize),
+		aead:   aead,
+		header: header,
+		index:  index,
+		skip:   skip,
+		chunk:  make([]byte, int(header.ChunkSize)+tagSize),
+	}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.pending) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, d.pending)
+	d.pending = d.pending[n:]
+	return n, nil
+}
+
+func (d *decryptReader) next() error {
+	n, err := io.ReadFull(d.src, d.chunk)
+	last := false
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		last = true
+	case err == io.EOF:
+		return ErrCorrupt
+	case err != nil:
+		return err
+	default:
+		_, peekErr := d.src.Peek(1)
+		last = peekErr == io.EOF
+	}
+	if n < tagSize {
+		return ErrCorrupt
+	}
+
+	plain, err := d.aead.Open(d.chunk[:0], chunkNonce(d.header.NoncePrefix, d.index), d.chunk[:n], chunkAAD(d.index, last))
+	if err != nil {
+		return ErrCorrupt
+	}
+
+	if d.skip > len(plain) {
+		return ErrCorrupt
+	}
+	d.pending = plain[d.skip:]
+	d.skip = 0
+	d.index++
+	d.done = last
+	return nil
+}
@@ -0,0 +1,160 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func testPlaintext(n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(i * 7)
+	}
+	return out
+}
+
+func encrypt(t *testing.T, key []byte, version uint32, plain []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewEncryptWriter(&buf, key, version)
+	if err != nil {
+		t.Fatalf("NewEncryptWriter: %v", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func decrypt(stored, key []byte) ([]byte, error) {
+	header, ok := ParseHeader(stored)
+	if !ok {
+		return nil, errors.New("no header")
+	}
+	r, err := NewDecryptReader(bytes.NewReader(stored[HeaderSize:]), key, header, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+	for _, n := range []int{0, 1, DefaultChunkSize - 1, DefaultChunkSize, DefaultChunkSize + 1, 3*DefaultChunkSize + 5} {
+		plain := testPlaintext(n)
+		stored := encrypt(t, key, 3, plain)
+		if got := int64(len(stored)); got != EncryptedSize(int64(n), DefaultChunkSize) {
+			t.Errorf("%d bytes stored as %d, EncryptedSize says %d", n, got, EncryptedSize(int64(n), DefaultChunkSize))
+		}
+		header, ok := ParseHeader(stored)
+		if !ok || header.KeyVersion != 3 || header.ChunkSize != DefaultChunkSize {
+			t.Fatalf("header = %+v, %v", header, ok)
+		}
+		got, err := decrypt(stored, key)
+		if err != nil {
+			t.Fatalf("decrypt %d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("%d bytes didn't round-trip", n)
+		}
+	}
+}
+
+func TestDecryptFromChunk(t *testing.T) {
+	key := testKey(t)
+	plain := testPlaintext(3*DefaultChunkSize + 100)
+	stored := encrypt(t, key, 1, plain)
+	header, _ := ParseHeader(stored)
+
+	for _, start := range []int64{0, 10, DefaultChunkSize, DefaultChunkSize + 1, 3*DefaultChunkSize + 99} {
+		index, offset := ChunkOffset(header, start)
+		skip := int(start - int64(index)*DefaultChunkSize)
+		r, err := NewDecryptReader(bytes.NewReader(stored[offset:]), key, header, index, skip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("from %d: %v", start, err)
+		}
+		if !bytes.Equal(got, plain[start:]) {
+			t.Errorf("from %d: got %d bytes, want %d", start, len(got), len(plain)-int(start))
+		}
+	}
+}
+
+func TestDecryptTampered(t *testing.T) {
+	key := testKey(t)
+	stored := encrypt(t, key, 1, testPlaintext(3*DefaultChunkSize+100))
+	chunk := DefaultChunkSize + tagSize
+
+	flipped := bytes.Clone(stored)
+	flipped[HeaderSize+chunk+5] ^= 1
+
+	// Dropping whole chunks off the end must not read as a shorter file
+	truncated := stored[:HeaderSize+2*chunk]
+
+	swapped := bytes.Clone(stored)
+	copy(swapped[HeaderSize:], stored[HeaderSize+chunk:HeaderSize+2*chunk])
+	copy(swapped[HeaderSize+chunk:], stored[HeaderSize:HeaderSize+chunk])
+
+	nonce := bytes.Clone(stored)
+	nonce[12] ^= 1
+
+	for name, data := range map[string][]byte{
+		"flipped byte":   flipped,
+		"truncated":      truncated,
+		"swapped chunks": swapped,
+		"changed nonce":  nonce,
+		"header only":    stored[:HeaderSize],
+		"short last tag": stored[:len(stored)-tagSize+1],
+		"trailing bytes": append(bytes.Clone(stored), 0),
+	} {
+		if _, err := decrypt(data, key); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: error = %v, want ErrCorrupt", name, err)
+		}
+	}
+	if _, err := decrypt(stored, testKey(t)); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("wrong key: error = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	header := func(chunkSize uint32) []byte {
+		buf := (Header{KeyVersion: 1, ChunkSize: chunkSize}).marshal()
+		binary.BigEndian.PutUint32(buf[20:24], chunkSize)
+		return buf
+	}
+	for _, c := range []struct {
+		name string
+		buf  []byte
+		ok   bool
+	}{
+		{"default chunks", header(DefaultChunkSize), true},
+		{"largest chunks", header(MaxChunkSize), true},
+		{"zero chunks", header(0), false},
+		{"huge chunks", header(1 << 31), false},
+		{"too short", header(DefaultChunkSize)[:HeaderSize-1], false},
+		{"plaintext", []byte("solid cube\nfacet normal 0 0 1\n"), false},
+	} {
+		if _, ok := ParseHeader(c.buf); ok != c.ok {
+			t.Errorf("%s: ok = %v, want %v", c.name, ok, c.ok)
+		}
+	}
+}
@@ -0,0 +1,312 @@
+// Package align finds the rigid transform that best overlays one mesh on
+// another, so re-exports with a different origin are not reported as
+// whole-part changes.
+package align
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/spatial"
+)
+
+const (
+	MethodPrincipal = "principal"
+	MethodICP       = "icp"
+
+	samplePoints  = 2000
+	maxIterations = 60
+	// Fraction of closest correspondences kept each ICP iteration, so
+	// genuinely edited regions don't drag the fit
+	inlierFraction = 0.9
+)
+
+type Options struct {
+	Method string
+}
+
+type Result struct {
+	Method              string             `json:"method"`
+	Transform           geometry.Transform `json:"transform"`
+	RotationDegrees     float64            `json:"rotation_degrees"`
+	TranslationDistance float64            `json:"translation_distance"`
+	RMSBefore           float64            `json:"rms_before"`
+	RMSAfter            float64            `json:"rms_after"`
+	Iterations          int                `json:"iterations"`
+}
+
+func ValidMethod(method string) bool {
+	return method == MethodPrincipal || method == MethodICP
+}
+
+// Align returns the transform that moves "moving" onto "reference"
+func Align(reference, moving *geometry.Mesh, opts Options) (*Result, error) {
+	if !ValidMethod(opts.Method) {
+		return nil, fmt.Errorf("unknown alignment method %q", opts.Method)
+	}
+
+	points := geometry.SamplePoints(moving, samplePoints)
+	if len(points) == 0 || len(reference.Triangles) == 0 {
+		return nil, fmt.Errorf("cannot align empty meshes")
+	}
+
+	bvh := spatial.Build(reference)
+	scale := reference.Bounds().Union(moving.Bounds()).Diagonal()
+
+	result := &Result{
+		Method:    opts.Method,
+		RMSBefore: rms(bvh, points, geometry.Identity()),
+	}
+
+	principal := principalAlignment(bvh, reference, points)
+
+	switch opts.Method {
+	case MethodPrincipal:
+		result.Transform = principal
+		result.RMSAfter = rms(bvh, points, principal)
+
+	case MethodICP:
+		// Refine from both the original placement and the principal-axes
+		// guess; small edits favour the former, large moves the latter
+		best := math.Inf(1)
+		for _, start := range []geometry.Transform{geometry.Identity(), principal} {
+			t, iterations := icp(bvh, points, start, scale)
+			if e := rms(bvh, points, t); e < best {
+				best = e
+				result.Transform = t
+				result.Iterations = iterations
+			}
+		}
+		result.RMSAfter = best
+	}
+
+	// Never report an alignment that fits worse than doing nothing
+	if result.RMSAfter > result.RMSBefore {
+		result.Transform = geometry.Identity()
+		result.RMSAfter = result.RMSBefore
+	}
+
+	result.RotationDegrees = result.Transform.RotationAngle()
+	result.TranslationDistance = result.Transform.T.Length()
+	return result, nil
+}
+
+// principalAlignment overlays centroids and principal axes. Axis directions
+// are ambiguous, so every proper rotation of signs is tried.
+func principalAlignment(bvh *spatial.BVH, reference *geometry.Mesh, points []geometry.Vec3) geometry.Transform {
+	refCentroid, refAxes := principalAxes(geometry.SamplePoints(reference, samplePoints))
+	movCentroid, movAxes := principalAxes(points)
+
+	best := geometry.Identity()
+	bestRMS := math.Inf(1)
+	for _, signs := range [][3]float64{{1, 1, 1}, {1, -1, -1}, {-1, 1, -1}, {-1, -1, 1}} {
+		// R = Σ sign_k · refAxis_k ⊗ movAxis_k maps moving axes onto reference axes
+		var r geometry.Transform
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				for k := 0; k < 3; k++ {
+					r.M[i][j] += signs[k] * refAxes[k].Axis(i) * movAxes[k].Axis(j)
+				}
+			}
+		}
+		if determinant(r.M) < 0 {
+			continue
+		}
+		r.T = refCentroid.Sub(rotate(r.M, movCentroid))
+
+		if e := rms(bvh, points, r); e < bestRMS {
+			bestRMS = e
+			best = r
+		}
+	}
+	return best
+}
+
+func principalAxes(points []geometry.Vec3) (geometry.Vec3, [3]geometry.Vec3) {
+	var centroid geometry.Vec3
+	for _, p := range points {
+		centroid = centroid.Add(p)
+	}
+	centroid = centroid.Scale(1 / float64(len(points)))
+
+	cov := [][]float64{make([]float64, 3), make([]float64, 3), make([]float64, 3)}
+	for _, p := range points {
+		d := p.Sub(centroid)
+		for i := 0; i < 3; i++ {
+			for j := 0; j < 3; j++ {
+				cov[i][j] += d.Axis(i) * d.Axis(j)
+			}
+		}
+	}
+
+	values, vecs := symmetricEigen(cov)
+	order := []int{0, 1, 2}
+	sort.Slice(order, func(i, j int) bool { return values[order[i]] > values[order[j]] })
+
+	var axes [3]geometry.Vec3
+	for k, col := range order {
+		axes[k] = geometry.Vec3{X: vecs[0][col], Y: vecs[1][col], Z: vecs[2][col]}
+	}
+	// Keep the frame right-handed
+	if axes[0].Cross(axes[1]).Dot(axes[2]) < 0 {
+		axes[2] = axes[2].Scale(-1)
+	}
+	return centroid, axes
+}
+
+// icp runs trimmed point-to-point ICP from an initial transform
+func icp(bvh *spatial.BVH, points []geometry.Vec3, start geometry.Transform, scale float64) (geometry.Transform, int) {
+	t := start
+	prev := math.Inf(1)
+
+	type pair struct {
+		from, to geometry.Vec3
+		dist     float64
+	}
+	pairs := make([]pair, 0, len(points))
+
+	for iteration := 1; iteration <= maxIterations; iteration++ {
+		pairs = pairs[:0]
+		for _, p := range points {
+			moved := t.Apply(p)
+			if hit, ok := bvh.Closest(moved); ok {
+				pairs = append(pairs, pair{moved, hit.Point, hit.Distance})
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i].dist < pairs[j].dist })
+		keep := int(float64(len(pairs)) * inlierFraction)
+		if keep < 3 {
+			return t, iteration
+		}
+
+		from := make([]geometry.Vec3, keep)
+		to := make([]geometry.Vec3, keep)
+		sumSq := 0.0
+		for i := 0; i < keep; i++ {
+			from[i], to[i] = pairs[i].from, pairs[i].to
+			sumSq += pairs[i].dist * pairs[i].dist
+		}
+
+		t = t.Then(bestRigid(from, to))
+
+		e := math.Sqrt(sumSq / float64(keep))
+		if math.Abs(prev-e) <= 1e-12*scale {
+			return t, iteration
+		}
+		prev = e
+	}
+	return t, maxIterations
+}
+
+// bestRigid solves for the rotation and translation taking from onto to in
+// the least-squares sense using Horn's quaternion method
+func bestRigid(from, to []geometry.Vec3) geometry.Transform {
+	var cf, ct geometry.Vec3
+	for i := range from {
+		cf = cf.Add(from[i])
+		ct = ct.Add(to[i])
+	}
+	n := float64(len(from))
+	cf = cf.Scale(1 / n)
+	ct = ct.Scale(1 / n)
+
+	var s [3][3]float64
+	for i := range from {
+		a := from[i].Sub(cf)
+		b := to[i].Sub(ct)
+		for r := 0; r < 3; r++ {
+			for c := 0; c < 3; c++ {
+				s[r][c] += a.Axis(r) * b.Axis(c)
+			}
+		}
+	}
+
+	sxx, sxy, sxz := s[0][0], s[0][1], s[0][2]
+	syx, syy, syz := s[1][0], s[1][1], s[1][2]
+	szx, szy, szz := s[2][0], s[2][1], s[2][2]
+	nm := [][]float64{
+		{sxx + syy + szz, syz - szy, szx - sxz, sxy - syx},
+		{syz - szy, sxx - syy - szz, sxy + syx, szx + sxz},
+		{szx - sxz, sxy + syx, -sxx + syy - szz, syz + szy},
+		{sxy - syx, szx + sxz, syz + szy, -sxx - syy + szz},
+	}
+
+	values, vecs := symmetricEigen(nm)
+	best := 0
+	for i := 1; i < 4; i++ {
+		if values[i] > values[best] {
+			best = i
+		}
+	}
+	w, x, y, z := vecs[0][best], vecs[1][best], vecs[2][best], vecs[3][best]
+
+	var t geometry.Transform
+	t.M = [3][3]float64{
+		{w*w + x*x - y*y - z*z, 2 * (x*y - w*z), 2 * (x*z + w*y)},
+		{2 * (x*y + w*z), w*w - x*x + y*y - z*z, 2 * (y*z - w*x)},
+		{2 * (x*z - w*y), 2 * (y*z + w*x), w*w - x*x - y*y + z*z},
+	}
+	t.T = ct.Sub(rotate(t.M, cf))
+	return t
+}
+
+func rms(bvh *spatial.BVH, points []geometry.Vec3, t geometry.Transform) float64 {
+	sumSq := 0.0
+	for _, p := range points {
+		if hit, ok := bvh.Closest(t.Apply(p)); ok {
+			sumSq += hit.Distance * hit.Distance
+		}
+	}
+	return math.Sqrt(sumSq / float64(len(points)))
+}
+
+func rotate(m [3][3]float64, p geometry.Vec3) geometry.Vec3 {
+	return geometry.Transform{M: m}.Apply(p)
+}
+
+func determinant(m [3][3]float64) float64 {
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
+
+// SnapVertices moves each vertex of m onto the nearest reference vertex
+// within tol. After alignment this removes floating-point residue so
+// untouched triangles match the reference exactly.
+func SnapVertices(m, reference *geometry.Mesh, tol float64) *geometry.Mesh {
+	type cell [3]int64
+	cellOf := func(v geometry.Vec3) cell {
+		return cell{int64(math.Floor(v.X / tol)), int64(math.Floor(v.Y / tol)), int64(math.Floor(v.Z / tol))}
+	}
+
+	grid := make(map[cell][]int)
+	for i, v := range reference.Vertices {
+		c := cellOf(v)
+		grid[c] = append(grid[c], i)
+	}
+
+	out := &geometry.Mesh{
+		Vertices:  make([]geometry.Vec3, len(m.Vertices)),
+		Triangles: m.Triangles,
+	}
+	for i, v := range m.Vertices {
+		out.Vertices[i] = v
+		c := cellOf(v)
+		best := tol
+		for dx := int64(-1); dx <= 1; dx++ {
+			for dy := int64(-1); dy <= 1; dy++ {
+				for dz := int64(-1); dz <= 1; dz++ {
+					for _, j := range grid[cell{c[0] + dx, c[1] + dy, c[2] + dz}] {
+						if d := reference.Vertices[j].Sub(v).Length(); d <= best {
+							best = d
+							out.Vertices[i] = reference.Vertices[j]
+						}
+					}
+				}
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,63 @@
+package align
+
+import "math"
+
+// symmetricEigen diagonalizes a small symmetric matrix with cyclic Jacobi
+// rotations. It returns eigenvalues and eigenvectors as columns of vecs.
+func symmetricEigen(a [][]float64) (values []float64, vecs [][]float64) {
+	n := len(a)
+	m := make([][]float64, n)
+	vecs = make([][]float64, n)
+	for i := range m {
+		m[i] = append([]float64(nil), a[i]...)
+		vecs[i] = make([]float64, n)
+		vecs[i][i] = 1
+	}
+
+	for sweep := 0; sweep < 100; sweep++ {
+		off := 0.0
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				off += m[p][q] * m[p][q]
+			}
+		}
+		if off < 1e-30 {
+			break
+		}
+
+		for p := 0; p < n; p++ {
+			for q := p + 1; q < n; q++ {
+				if math.Abs(m[p][q]) < 1e-300 {
+					continue
+				}
+
+				theta := (m[q][q] - m[p][p]) / (2 * m[p][q])
+				t := math.Copysign(1, theta) / (math.Abs(theta) + math.Sqrt(theta*theta+1))
+				c := 1 / math.Sqrt(t*t+1)
+				s := t * c
+
+				for k := 0; k < n; k++ {
+					mkp, mkq := m[k][p], m[k][q]
+					m[k][p] = c*mkp - s*mkq
+					m[k][q] = s*mkp + c*mkq
+				}
+				for k := 0; k < n; k++ {
+					mpk, mqk := m[p][k], m[q][k]
+					m[p][k] = c*mpk - s*mqk
+					m[q][k] = s*mpk + c*mqk
+				}
+				for k := 0; k < n; k++ {
+					vkp, vkq := vecs[k][p], vecs[k][q]
+					vecs[k][p] = c*vkp - s*vkq
+					vecs[k][q] = s*vkp + c*vkq
+				}
+			}
+		}
+	}
+
+	values = make([]float64, n)
+	for i := range values {
+		values[i] = m[i][i]
+	}
+	return values, vecs
+}
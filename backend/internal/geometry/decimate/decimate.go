@@ -0,0 +1,429 @@
+// Package decimate simplifies meshes by quadric edge collapse (Garland &
+// Heckbert): each vertex accumulates the planes of its faces, and the edge
+// whose collapse moves the surface least is merged first.
+package decimate
+
+import (
+	"math"
+	"slices"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+const (
+	// Boundary edges get a perpendicular plane this many times stiffer
+	// than a face so open borders and holes keep their outline
+	boundaryPenalty = 1000
+	// A collapse that turns a face by more than ~85° is rejected as a flip
+	minNormalDot = 0.1
+)
+
+// Decimate collapses edges until the mesh has at most target triangles, or
+// no collapse is left that keeps the surface manifold and unflipped.
+// Surviving triangles keep their relative order.
+func Decimate(m *geometry.Mesh, target int) *geometry.Mesh {
+	if target >= len(m.Triangles) {
+		return m
+	}
+
+	s := newState(m)
+	for s.live > target && len(s.queue) > 0 {
+		c := s.queue.pop()
+		if !s.current(c) {
+			continue
+		}
+		p, _ := s.placement(c.u, c.v)
+		if !s.linkCondition(c.u, c.v) || s.flips(c.u, c.v, p) || s.flips(c.v, c.u, p) {
+			continue
+		}
+		s.apply(c.u, c.v, p)
+	}
+	return s.mesh()
+}
+
+type quadric [10]float64
+
+func planeQuadric(n geometry.Vec3, d, w float64) quadric {
+	a, b, c := n.X, n.Y, n.Z
+	return quadric{a * a * w, a * b * w, a * c * w, a * d * w, b * b * w, b * c * w, b * d * w, c * c * w, c * d * w, d * d * w}
+}
+
+func (q quadric) add(o quadric) quadric {
+	for i := range q {
+		q[i] += o[i]
+	}
+	return q
+}
+
+func (q quadric) eval(p geometry.Vec3) float64 {
+	x, y, z := p.X, p.Y, p.Z
+	return q[0]*x*x + 2*q[1]*x*y + 2*q[2]*x*z + 2*q[3]*x +
+		q[4]*y*y + 2*q[5]*y*z + 2*q[6]*y +
+		q[7]*z*z + 2*q[8]*z + q[9]
+}
+
+// optimum solves for the point minimizing the quadric, failing when the
+// planes don't pin down a single point (flat or straight regions)
+func (q quadric) optimum() (geometry.Vec3, bool) {
+	a00, a01, a02 := q[0], q[1], q[2]
+	a11, a12, a22 := q[4], q[5], q[7]
+	b0, b1, b2 := -q[3], -q[6], -q[8]
+
+	det := a00*(a11*a22-a12*a12) - a01*(a01*a22-a12*a02) + a02*(a01*a12-a11*a02)
+	trace := a00 + a11 + a22
+	if trace == 0 || math.Abs(det) < 1e-9*trace*trace*trace {
+		return geometry.Vec3{}, false
+	}
+
+	x := (b0*(a11*a22-a12*a12) - a01*(b1*a22-a12*b2) + a02*(b1*a12-a11*b2)) / det
+	y := (a00*(b1*a22-b2*a12) - b0*(a01*a22-a12*a02) + a02*(a01*b2-b1*a02)) / det
+	z := (a00*(a11*b2-a12*b1) - a01*(a01*b2-b1*a02) + b0*(a01*a12-a11*a02)) / det
+	return geometry.Vec3{X: x, Y: y, Z: z}, true
+}
+
+// collapse is a queued edge; the merged position is recomputed when it's
+// popped so the queue stays small
+type collapse struct {
+	cost   float64
+	u, v   int32
+	su, sv uint32
+}
+
+// collapseQueue is a 4-ary min-heap on cost. It's written out rather than
+// using container/heap because queue traffic dominates on large scans, and
+// the wider nodes touch fewer cache lines per pop.
+type collapseQueue []collapse
+
+func (q *collapseQueue) push(c collapse) {
+	*q = append(*q, c)
+	h := *q
+	i := len(h) - 1
+	for i > 0 {
+		parent := (i - 1) / 4
+		if h[parent].cost <= c.cost {
+			break
+		}
+		h[i] = h[parent]
+		i = parent
+	}
+	h[i] = c
+}
+
+func (q *collapseQueue) pop() collapse {
+	h := *q
+	top := h[0]
+	last := len(h) - 1
+	*q = h[:last]
+	if last > 0 {
+		h[:last].down(0, h[last])
+	}
+	return top
+}
+
+// down sinks c from slot i to where it belongs
+func (h collapseQueue) down(i int, c collapse) {
+	for {
+		first := 4*i + 1
+		if first >= len(h) {
+			break
+		}
+		smallest := first
+		for j := first + 1; j < first+4 && j < len(h); j++ {
+			if h[j].cost < h[smallest].cost {
+				smallest = j
+			}
+		}
+		if h[smallest].cost >= c.cost {
+			break
+		}
+		h[i] = h[smallest]
+		i = smallest
+	}
+	h[i] = c
+}
+
+func (q collapseQueue) init() {
+	// Division truncates toward zero, so an empty queue would start at 0
+	if len(q) < 2 {
+		return
+	}
+	for i := (len(q) - 2) / 4; i >= 0; i-- {
+		q.down(i, q[i])
+	}
+}
+
+type state struct {
+	positions []geometry.Vec3
+	quadrics  []quadric
+	// stamp changes whenever a vertex moves, invalidating queued collapses
+	stamp    []uint32
+	alive    []bool
+	faces    [][]int32
+	tris     [][3]int32
+	faceLive []bool
+	live     int
+	queue    collapseQueue
+	scratch  []int32
+}
+
+func newState(m *geometry.Mesh) *state {
+	s := &state{
+		positions: slices.Clone(m.Vertices),
+		quadrics:  make([]quadric, len(m.Vertices)),
+		stamp:     make([]uint32, len(m.Vertices)),
+		alive:     make([]bool, len(m.Vertices)),
+		faces:     make([][]int32, len(m.Vertices)),
+		tris:      make([][3]int32, len(m.Triangles)),
+		faceLive:  make([]bool, len(m.Triangles)),
+	}
+
+	edges := make([]uint64, 0, 3*len(m.Triangles))
+	for i, t := range m.Triangles {
+		if t[0] == t[1] || t[1] == t[2] || t[0] == t[2] {
+			continue // already degenerate
+		}
+		s.tris[i] = [3]int32{int32(t[0]), int32(t[1]), int32(t[2])}
+		s.faceLive[i] = true
+		s.live++
+
+		a, b, c := m.Triangle(i)
+		cross := b.Sub(a).Cross(c.Sub(a))
+		area := cross.Length() / 2
+		if area > 0 {
+			n := cross.Scale(1 / (2 * area))
+			q := planeQuadric(n, -n.Dot(a), area)
+			for _, v := range t {
+				s.quadrics[v] = s.quadrics[v].add(q)
+			}
+		}
+
+		for k := 0; k < 3; k++ {
+			v := t[k]
+			s.faces[v] = append(s.faces[v], int32(i))
+			s.alive[v] = true
+			edges = append(edges, edgeKey(t[k], t[(k+1)%3]))
+		}
+	}
+
+	// Each interior edge appears twice; boundary edges once
+	slices.Sort(edges)
+	unique := edges[:0]
+	for i := 0; i < len(edges); {
+		j := i
+		for j < len(edges) && edges[j] == edges[i] {
+			j++
+		}
+		if j-i == 1 {
+			s.addBoundaryPlane(edges[i])
+		}
+		unique = append(unique, edges[i])
+		i = j
+	}
+
+	s.queue = make(collapseQueue, 0, len(unique))
+	for _, e := range unique {
+		s.queue = append(s.queue, s.evaluate(int32(e>>32), int32(e&0xffffffff)))
+	}
+	s.queue.init()
+	return s
+}
+
+func edgeKey(a, b int) uint64 {
+	if a > b {
+		a, b = b, a
+	}
+	return uint64(a)<<32 | uint64(b)
+}
+
+// addBoundaryPlane constrains an open edge to stay on the plane through it
+// perpendicular to its one face
+func (s *state) addBoundaryPlane(e uint64) {
+	u, v := int32(e>>32), int32(e&0xffffffff)
+	for _, f := range s.faces[u] {
+		t := s.tris[f]
+		if t[0] != v && t[1] != v && t[2] != v {
+			continue
+		}
+		a, b, c := s.positions[t[0]], s.positions[t[1]], s.positions[t[2]]
+		normal := geometry.TriangleNormal(a, b, c)
+		edge := s.positions[v].Sub(s.positions[u])
+		n := edge.Cross(normal).Normalize()
+		if n.Length() == 0 {
+			return
+		}
+		q := planeQuadric(n, -n.Dot(s.positions[u]), boundaryPenalty*edge.Dot(edge))
+		s.quadrics[u] = s.quadrics[u].add(q)
+		s.quadrics[v] = s.quadrics[v].add(q)
+		return
+	}
+}
+
+// placement picks where the merged vertex should go and what it costs
+func (s *state) placement(u, v int32) (geometry.Vec3, float64) {
+	q := s.quadrics[u].add(s.quadrics[v])
+	pu, pv := s.positions[u], s.positions[v]
+	mid := pu.Add(pv).Scale(0.5)
+
+	best, cost := pu, q.eval(pu)
+	candidates := [3]geometry.Vec3{pv, mid, mid}
+	// Ill-conditioned solves can land far off the surface
+	if p, ok := q.optimum(); ok && p.Sub(mid).Length() <= pu.Sub(pv).Length() {
+		candidates[2] = p
+	}
+	for _, p := range candidates {
+		if c := q.eval(p); c < cost {
+			best, cost = p, c
+		}
+	}
+	return best, math.Max(0, cost)
+}
+
+func (s *state) evaluate(u, v int32) collapse {
+	_, cost := s.placement(u, v)
+	return collapse{cost: cost, u: u, v: v, su: s.stamp[u], sv: s.stamp[v]}
+}
+
+// current reports whether neither endpoint has changed since c was queued
+func (s *state) current(c collapse) bool {
+	return s.alive[c.u] && s.alive[c.v] && s.stamp[c.u] == c.su && s.stamp[c.v] == c.sv
+}
+
+// linkCondition keeps the result manifold: the endpoints may share only
+// the vertices opposite the edge's own faces
+func (s *state) linkCondition(u, v int32) bool {
+	s.scratch = s.neighbours(u, s.scratch[:0])
+	around := len(s.scratch)
+	s.scratch = s.neighbours(v, s.scratch)
+
+	edgeFaces := 0
+	for _, f := range s.faces[v] {
+		t := s.tris[f]
+		if s.faceLive[f] && (t[0] == u || t[1] == u || t[2] == u) {
+			edgeFaces++
+		}
+	}
+
+	shared := 0
+	for _, w := range s.scratch[around:] {
+		if w != u && slices.Contains(s.scratch[:around], w) {
+			shared++
+		}
+	}
+	return shared == edgeFaces
+}
+
+// neighbours appends the distinct vertices sharing a live face with v
+func (s *state) neighbours(v int32, out []int32) []int32 {
+	start := len(out)
+	for _, f := range s.faces[v] {
+		if !s.faceLive[f] {
+			continue
+		}
+		for _, w := range s.tris[f] {
+			if w != v && !slices.Contains(out[start:], w) {
+				out = append(out, w)
+			}
+		}
+	}
+	return out
+}
+
+// flips reports whether moving from to p would turn any face around from
+// (other than those on the collapsing edge) inside out or to nothing
+func (s *state) flips(from, other int32, p geometry.Vec3) bool {
+	for _, f := range s.faces[from] {
+		if !s.faceLive[f] {
+			continue
+		}
+		t := s.tris[f]
+		if t[0] == other || t[1] == other || t[2] == other {
+			continue
+		}
+
+		var before, after [3]geometry.Vec3
+		for k, w := range t {
+			before[k] = s.positions[w]
+			after[k] = before[k]
+			if w == from {
+				after[k] = p
+			}
+		}
+		n0 := before[1].Sub(before[0]).Cross(before[2].Sub(before[0]))
+		n1 := after[1].Sub(after[0]).Cross(after[2].Sub(after[0]))
+		if n1.Length() == 0 || n0.Dot(n1) < minNormalDot*n0.Length()*n1.Length() {
+			return true
+		}
+	}
+	return false
+}
+
+// apply merges v into u at p and requeues u's edges
+func (s *state) apply(u, v int32, p geometry.Vec3) {
+	s.positions[u] = p
+	s.quadrics[u] = s.quadrics[u].add(s.quadrics[v])
+	s.alive[v] = false
+	s.stamp[u]++
+
+	merged := make([]int32, 0, len(s.faces[u])+len(s.faces[v]))
+	for _, f := range s.faces[u] {
+		if s.faceLive[f] {
+			merged = append(merged, f)
+		}
+	}
+	for _, f := range s.faces[v] {
+		if !s.faceLive[f] {
+			continue
+		}
+		t := &s.tris[f]
+		if t[0] == u || t[1] == u || t[2] == u {
+			s.faceLive[f] = false
+			s.live--
+			continue
+		}
+		for k := range t {
+			if t[k] == v {
+				t[k] = u
+			}
+		}
+		merged = append(merged, f)
+	}
+	s.faces[v] = nil
+
+	live := merged[:0]
+	for _, f := range merged {
+		if s.faceLive[f] {
+			live = append(live, f)
+		}
+	}
+	s.faces[u] = live
+
+	s.scratch = s.neighbours(u, s.scratch[:0])
+	for _, w := range s.scratch {
+		s.queue.push(s.evaluate(u, w))
+	}
+}
+
+// mesh compacts the surviving vertices and faces
+func (s *state) mesh() *geometry.Mesh {
+	out := &geometry.Mesh{}
+	index := make([]int, len(s.positions))
+	for i := range index {
+		index[i] = -1
+	}
+
+	for f, t := range s.tris {
+		if !s.faceLive[f] {
+			continue
+		}
+		var tri [3]int
+		for k, v := range t {
+			if index[v] < 0 {
+				index[v] = len(out.Vertices)
+				out.Vertices = append(out.Vertices, s.positions[v])
+			}
+			tri[k] = index[v]
+		}
+		out.Triangles = append(out.Triangles, tri)
+	}
+	return out
+}
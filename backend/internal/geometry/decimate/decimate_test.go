@@ -0,0 +1,145 @@
+package decimate
+
+import (
+	"math"
+	"testing"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/validate"
+)
+
+// subdividedCube is an n-unit cube with each face split into n×n quads.
+// Coordinates are whole numbers so the faces' shared edges weld exactly.
+// With round set, every vertex is pushed out onto a sphere of radius n
+// around the origin instead.
+func subdividedCube(n int, round bool) *geometry.Mesh {
+	quads := [6][4][3]float64{
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+	}
+	size := float64(n)
+	center := geometry.Vec3{X: size / 2, Y: size / 2, Z: size / 2}
+	b := geometry.NewMeshBuilder()
+	for _, q := range quads {
+		corner := func(k int) geometry.Vec3 {
+			return geometry.Vec3{X: q[k][0] * size, Y: q[k][1] * size, Z: q[k][2] * size}
+		}
+		du := corner(1).Sub(corner(0)).Scale(1 / size)
+		dv := corner(3).Sub(corner(0)).Scale(1 / size)
+		at := func(i, j int) geometry.Vec3 {
+			p := corner(0).Add(du.Scale(float64(i))).Add(dv.Scale(float64(j)))
+			if round {
+				p = p.Sub(center).Normalize().Scale(size)
+			}
+			return p
+		}
+		for i := range n {
+			for j := range n {
+				b.AddTriangle(at(i, j), at(i+1, j), at(i+1, j+1))
+				b.AddTriangle(at(i, j), at(i+1, j+1), at(i, j+1))
+			}
+		}
+	}
+	return b.Mesh()
+}
+
+func TestDecimateUnderTarget(t *testing.T) {
+	m := subdividedCube(2, false)
+	if got := Decimate(m, len(m.Triangles)); got != m {
+		t.Error("mesh already within the target was rebuilt")
+	}
+}
+
+// Flat faces collapse to almost nothing, and the result is still a
+// closed, consistently wound cube of the same size
+func TestDecimateCube(t *testing.T) {
+	m := subdividedCube(8, false)
+	out := Decimate(m, 12)
+	if len(out.Triangles) > 24 {
+		t.Errorf("%d triangles left of %d, target 12", len(out.Triangles), len(m.Triangles))
+	}
+	if out.Bounds() != m.Bounds() {
+		t.Errorf("bounds moved from %+v to %+v", m.Bounds(), out.Bounds())
+	}
+	if r := validate.Check(out); !r.Passed {
+		t.Errorf("decimated cube fails validation: %+v", r.Findings)
+	}
+}
+
+func TestDecimateSphere(t *testing.T) {
+	const radius = 10
+	m := subdividedCube(radius, true)
+	target := len(m.Triangles) / 4
+	out := Decimate(m, target)
+	if len(out.Triangles) > target {
+		t.Errorf("%d triangles left, target %d", len(out.Triangles), target)
+	}
+	if r := validate.Check(out); !r.Passed {
+		t.Errorf("decimated sphere fails validation: %+v", r.Findings)
+	}
+	for _, v := range out.Vertices {
+		if d := math.Abs(v.Length() - radius); d > 0.5 {
+			t.Fatalf("vertex %+v is %v off the sphere", v, d)
+		}
+	}
+}
+
+// An open sheet keeps its outline, since boundary edges are stiff
+func TestDecimateKeepsBoundary(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	for i := range 10 {
+		for j := range 10 {
+			x, y := float64(i), float64(j)
+			b.AddTriangle(geometry.Vec3{X: x, Y: y}, geometry.Vec3{X: x + 1, Y: y}, geometry.Vec3{X: x + 1, Y: y + 1})
+			b.AddTriangle(geometry.Vec3{X: x, Y: y}, geometry.Vec3{X: x + 1, Y: y + 1}, geometry.Vec3{X: x, Y: y + 1})
+		}
+	}
+	m := b.Mesh()
+	out := Decimate(m, 20)
+	if len(out.Triangles) > 20 {
+		t.Errorf("%d triangles left, target 20", len(out.Triangles))
+	}
+	if out.Bounds() != m.Bounds() {
+		t.Errorf("bounds moved from %+v to %+v", m.Bounds(), out.Bounds())
+	}
+	for i := range out.Triangles {
+		if n := geometry.TriangleNormal(out.Triangle(i)); n.Z <= 0 {
+			t.Fatalf("triangle %d flipped: normal %+v", i, n)
+		}
+	}
+}
+
+// Degenerate, duplicated and non-manifold input decimates as far as it
+// safely can without panicking
+func TestDecimateMalformed(t *testing.T) {
+	m := subdividedCube(3, false)
+	m.Triangles = append(m.Triangles,
+		[3]int{0, 0, 1},
+		m.Triangles[0],
+		m.Triangles[5],
+		[3]int{m.Triangles[7][0], m.Triangles[7][1], m.Triangles[20][2]},
+	)
+	m.Vertices = append(m.Vertices, geometry.Vec3{X: 1, Y: 1, Z: 1})
+
+	for _, target := range []int{0, 1, 10, len(m.Triangles) - 1} {
+		if out := Decimate(m, target); len(out.Triangles) >= len(m.Triangles) {
+			t.Errorf("target %d: %d triangles left of %d", target, len(out.Triangles), len(m.Triangles))
+		}
+	}
+	if out := Decimate(&geometry.Mesh{}, 0); len(out.Triangles) != 0 {
+		t.Error("empty mesh gained triangles")
+	}
+
+	// Only degenerate faces leave no edges to collapse
+	flat := &geometry.Mesh{
+		Vertices:  []geometry.Vec3{{}, {X: 1}},
+		Triangles: [][3]int{{0, 0, 1}, {1, 1, 0}, {0, 0, 0}},
+	}
+	if out := Decimate(flat, 1); len(out.Triangles) != 0 {
+		t.Errorf("degenerate mesh kept %d triangles", len(out.Triangles))
+	}
+}
@@ -0,0 +1,126 @@
+// Package deviation measures how far one mesh surface lies from another.
+package deviation
+
+import (
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/spatial"
+)
+
+const (
+	DefaultSamples = 10000
+	MaxSamples     = 200000
+	DefaultBins    = 20
+)
+
+type Options struct {
+	Samples int
+	Bins    int
+}
+
+// Distances summarizes point-to-surface distances in one direction
+type Distances struct {
+	Samples int     `json:"samples"`
+	Max     float64 `json:"max"`
+	Mean    float64 `json:"mean"`
+	RMS     float64 `json:"rms"`
+}
+
+type Bin struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+type Result struct {
+	// Forward samples the first mesh against the second; Backward the reverse
+	Forward   Distances `json:"forward"`
+	Backward  Distances `json:"backward"`
+	Hausdorff float64   `json:"hausdorff"`
+	Mean      float64   `json:"mean"`
+	RMS       float64   `json:"rms"`
+	Histogram []Bin     `json:"histogram"`
+}
+
+// Compare samples both surfaces and measures the distance from each sample
+// to the other surface. Sampling is seeded so results are reproducible and
+// safe to cache.
+func Compare(a, b *geometry.Mesh, opts Options) *Result {
+	if opts.Samples <= 0 {
+		opts.Samples = DefaultSamples
+	}
+	if opts.Samples > MaxSamples {
+		opts.Samples = MaxSamples
+	}
+	if opts.Bins <= 0 {
+		opts.Bins = DefaultBins
+	}
+
+	forward := distances(a, spatial.Build(b), opts.Samples)
+	backward := distances(b, spatial.Build(a), opts.Samples)
+
+	result := &Result{
+		Forward:  summarize(forward),
+		Backward: summarize(backward),
+	}
+
+	all := append(forward, backward...)
+	combined := summarize(all)
+	result.Hausdorff = combined.Max
+	result.Mean = combined.Mean
+	result.RMS = combined.RMS
+	result.Histogram = histogram(all, combined.Max, opts.Bins)
+
+	return result
+}
+
+func distances(from *geometry.Mesh, to *spatial.BVH, n int) []float64 {
+	points := geometry.SamplePoints(from, n)
+	out := make([]float64, 0, len(points))
+	for _, p := range points {
+		if hit, ok := to.Closest(p); ok {
+			out = append(out, hit.Distance)
+		}
+	}
+	return out
+}
+
+func summarize(ds []float64) Distances {
+	s := Distances{Samples: len(ds)}
+	if len(ds) == 0 {
+		return s
+	}
+
+	var sum, sumSq float64
+	for _, d := range ds {
+		sum += d
+		sumSq += d * d
+		s.Max = math.Max(s.Max, d)
+	}
+	s.Mean = sum / float64(len(ds))
+	s.RMS = math.Sqrt(sumSq / float64(len(ds)))
+	return s
+}
+
+func histogram(ds []float64, max float64, bins int) []Bin {
+	out := make([]Bin, bins)
+	width := max / float64(bins)
+	for i := range out {
+		out[i].From = width * float64(i)
+		out[i].To = width * float64(i+1)
+	}
+	if width == 0 {
+		out[0].Count = len(ds)
+		return out
+	}
+
+	for _, d := range ds {
+		i := int(d / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		out[i].Count++
+	}
+	return out
+}
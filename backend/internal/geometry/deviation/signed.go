@@ -0,0 +1,112 @@
+package deviation
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/spatial"
+)
+
+// SignedVertexDistances measures each vertex of m against the surface of
+// against. Positive values lie outside it (material added), negative inside
+// (material removed). The sign uses the interpolated vertex normals at the
+// closest point, which stays stable when that point is on an edge or corner.
+func SignedVertexDistances(m, against *geometry.Mesh) []float64 {
+	bvh := spatial.Build(against)
+	normals := against.VertexNormals()
+
+	out := make([]float64, len(m.Vertices))
+	for i, p := range m.Vertices {
+		hit, ok := bvh.Closest(p)
+		if !ok {
+			continue
+		}
+
+		t := against.Triangles[hit.Triangle]
+		a, b, c := against.Triangle(hit.Triangle)
+		u, v, w := barycentric(hit.Point, a, b, c)
+		n := normals[t[0]].Scale(u).Add(normals[t[1]].Scale(v)).Add(normals[t[2]].Scale(w))
+		if n.Length() == 0 {
+			n = geometry.TriangleNormal(a, b, c)
+		}
+
+		d := hit.Distance
+		if p.Sub(hit.Point).Dot(n) < 0 {
+			d = -d
+		}
+		out[i] = d
+	}
+	return out
+}
+
+// CornerValues expands per-vertex values to one value per triangle corner
+// in file order, the layout of a non-indexed buffer such as three.js builds
+// from an STL
+func CornerValues(m *geometry.Mesh, perVertex []float64) []float32 {
+	out := make([]float32, 0, len(m.Triangles)*3)
+	for _, t := range m.Triangles {
+		for _, v := range t {
+			out = append(out, float32(perVertex[v]))
+		}
+	}
+	return out
+}
+
+func barycentric(p, a, b, c geometry.Vec3) (float64, float64, float64) {
+	v0, v1, v2 := b.Sub(a), c.Sub(a), p.Sub(a)
+	d00, d01, d11 := v0.Dot(v0), v0.Dot(v1), v1.Dot(v1)
+	d20, d21 := v2.Dot(v0), v2.Dot(v1)
+	denom := d00*d11 - d01*d01
+	if denom == 0 {
+		return 1.0 / 3, 1.0 / 3, 1.0 / 3
+	}
+	v := (d11*d20 - d01*d21) / denom
+	w := (d00*d21 - d01*d20) / denom
+	return 1 - v - w, v, w
+}
+
+type ColorStop struct {
+	Value float64 `json:"value"`
+	Color string  `json:"color"`
+}
+
+// ColorScale is a suggested diverging scale for signed deviation. Range is
+// symmetric around zero and clamps at the 95th percentile of |deviation| so
+// a few outliers don't wash out the rest of the part.
+type ColorScale struct {
+	Min   float64     `json:"min"`
+	Max   float64     `json:"max"`
+	Range float64     `json:"range"`
+	Stops []ColorStop `json:"stops"`
+}
+
+// Diverging blue-white-red (ColorBrewer RdBu), removed to added
+var scaleColors = []string{"#2166ac", "#67a9cf", "#f7f7f7", "#ef8a62", "#b2182b"}
+
+func SuggestColorScale(values []float32) ColorScale {
+	scale := ColorScale{}
+	if len(values) == 0 {
+		return scale
+	}
+
+	abs := make([]float64, len(values))
+	scale.Min, scale.Max = math.Inf(1), math.Inf(-1)
+	for i, v := range values {
+		f := float64(v)
+		scale.Min = math.Min(scale.Min, f)
+		scale.Max = math.Max(scale.Max, f)
+		abs[i] = math.Abs(f)
+	}
+	sort.Float64s(abs)
+	scale.Range = abs[int(float64(len(abs)-1)*0.95)]
+	if scale.Range == 0 {
+		scale.Range = math.Max(math.Abs(scale.Min), math.Abs(scale.Max))
+	}
+
+	for i, color := range scaleColors {
+		fraction := float64(i)/float64(len(scaleColors)-1)*2 - 1
+		scale.Stops = append(scale.Stops, ColorStop{Value: fraction * scale.Range, Color: color})
+	}
+	return scale
+}
@@ -0,0 +1,242 @@
+// Package diff compares two meshes triangle by triangle.
+package diff
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// Face classifications, in the order the DiffViewer legend expects
+const (
+	FaceUnchanged = "unchanged"
+	FaceAdded     = "added"
+	FaceRemoved   = "removed"
+)
+
+const maxRegions = 100
+
+type Options struct {
+	// Tolerance is the distance under which two vertices are considered the
+	// same. Zero picks a tolerance relative to the meshes' size.
+	Tolerance float64
+}
+
+type Region struct {
+	BoundingBox      geometry.BoundingBox `json:"bounding_box"`
+	AddedTriangles   int                  `json:"added_triangles"`
+	RemovedTriangles int                  `json:"removed_triangles"`
+}
+
+type Result struct {
+	Tolerance          float64  `json:"tolerance"`
+	TrianglesAdded     int      `json:"triangles_added"`
+	TrianglesRemoved   int      `json:"triangles_removed"`
+	TrianglesUnchanged int      `json:"triangles_unchanged"`
+	VolumeDelta        float64  `json:"volume_delta"`
+	SurfaceAreaDelta   float64  `json:"surface_area_delta"`
+	ChangedRegions     []Region `json:"changed_regions"`
+	// Indices of changed faces, in file order, so the viewer can color them.
+	// Every other face is unchanged.
+	RemovedFaces []int `json:"removed_faces"`
+	AddedFaces   []int `json:"added_faces"`
+}
+
+// DefaultTolerance is a millionth of the larger bounding box diagonal
+func DefaultTolerance(a, b *geometry.Mesh) float64 {
+	diag := a.Bounds().Union(b.Bounds()).Diagonal()
+	if diag == 0 || math.IsInf(diag, 0) || math.IsNaN(diag) {
+		return 1e-9
+	}
+	return diag * 1e-6
+}
+
+// Compare reports how the "to" mesh differs from the "from" mesh.
+// Triangles are matched by their quantized corners, independent of
+// their position in the file and of which corner is listed first.
+func Compare(from, to *geometry.Mesh, opts Options) *Result {
+	tol := opts.Tolerance
+	if tol <= 0 {
+		tol = DefaultTolerance(from, to)
+	}
+	q := quantizer(tol)
+
+	fromStats, toStats := from.Stats(), to.Stats()
+	result := &Result{
+		Tolerance:        tol,
+		VolumeDelta:      toStats.Volume - fromStats.Volume,
+		SurfaceAreaDelta: toStats.SurfaceArea - fromStats.SurfaceArea,
+		RemovedFaces:     []int{},
+		AddedFaces:       []int{},
+		ChangedRegions:   []Region{},
+	}
+
+	fromKeys := triangleKeys(from, q)
+	toKeys := triangleKeys(to, q)
+
+	available := make(map[triangleKey]int, len(fromKeys))
+	for _, k := range fromKeys {
+		available[k]++
+	}
+
+	matched := make(map[triangleKey]int, len(toKeys))
+	for i, k := range toKeys {
+		if available[k] > 0 {
+			available[k]--
+			matched[k]++
+			result.TrianglesUnchanged++
+		} else {
+			result.AddedFaces = append(result.AddedFaces, i)
+		}
+	}
+
+	for i, k := range fromKeys {
+		if matched[k] > 0 {
+			matched[k]--
+		} else {
+			result.RemovedFaces = append(result.RemovedFaces, i)
+		}
+	}
+
+	result.TrianglesAdded = len(result.AddedFaces)
+	result.TrianglesRemoved = len(result.RemovedFaces)
+	result.ChangedRegions = changedRegions(from, to, result.RemovedFaces, result.AddedFaces, q)
+
+	return result
+}
+
+type gridPoint [3]int64
+
+// triangleKey is a triangle's corners rotated so the smallest comes first,
+// preserving winding so a flipped face counts as a change
+type triangleKey [3]gridPoint
+
+func quantizer(tol float64) func(geometry.Vec3) gridPoint {
+	return func(v geometry.Vec3) gridPoint {
+		return gridPoint{
+			int64(math.Round(v.X / tol)),
+			int64(math.Round(v.Y / tol)),
+			int64(math.Round(v.Z / tol)),
+		}
+	}
+}
+
+func lessPoint(a, b gridPoint) bool {
+	for i := 0; i < 3; i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return false
+}
+
+func triangleKeys(m *geometry.Mesh, q func(geometry.Vec3) gridPoint) []triangleKey {
+	keys := make([]triangleKey, len(m.Triangles))
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		p := [3]gridPoint{q(a), q(b), q(c)}
+
+		first := 0
+		for j := 1; j < 3; j++ {
+			if lessPoint(p[j], p[first]) {
+				first = j
+			}
+		}
+		keys[i] = triangleKey{p[first], p[(first+1)%3], p[(first+2)%3]}
+	}
+	return keys
+}
+
+// changedRegions groups changed faces from both meshes that touch each other
+// into connected regions and reports each region's extent
+func changedRegions(from, to *geometry.Mesh, removed, added []int, q func(geometry.Vec3) gridPoint) []Region {
+	type changedFace struct {
+		mesh  *geometry.Mesh
+		index int
+		added bool
+	}
+
+	faces := make([]changedFace, 0, len(removed)+len(added))
+	for _, i := range removed {
+		faces = append(faces, changedFace{from, i, false})
+	}
+	for _, i := range added {
+		faces = append(faces, changedFace{to, i, true})
+	}
+	if len(faces) == 0 {
+		return []Region{}
+	}
+
+	uf := newUnionFind(len(faces))
+	owner := make(map[gridPoint]int)
+	for fi, f := range faces {
+		a, b, c := f.mesh.Triangle(f.index)
+		for _, v := range []geometry.Vec3{a, b, c} {
+			p := q(v)
+			if other, ok := owner[p]; ok {
+				uf.union(fi, other)
+			} else {
+				owner[p] = fi
+			}
+		}
+	}
+
+	byRoot := make(map[int]*Region)
+	for fi, f := range faces {
+		root := uf.find(fi)
+		region, ok := byRoot[root]
+		if !ok {
+			region = &Region{BoundingBox: geometry.EmptyBox()}
+			byRoot[root] = region
+		}
+
+		a, b, c := f.mesh.Triangle(f.index)
+		region.BoundingBox = region.BoundingBox.Extend(a).Extend(b).Extend(c)
+		if f.added {
+			region.AddedTriangles++
+		} else {
+			region.RemovedTriangles++
+		}
+	}
+
+	regions := make([]Region, 0, len(byRoot))
+	for _, r := range byRoot {
+		regions = append(regions, *r)
+	}
+	sort.Slice(regions, func(i, j int) bool {
+		return regions[i].AddedTriangles+regions[i].RemovedTriangles >
+			regions[j].AddedTriangles+regions[j].RemovedTriangles
+	})
+	if len(regions) > maxRegions {
+		regions = regions[:maxRegions]
+	}
+	return regions
+}
+
+type unionFind struct {
+	parent []int
+}
+
+func newUnionFind(n int) *unionFind {
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	return &unionFind{parent: parent}
+}
+
+func (u *unionFind) find(i int) int {
+	for u.parent[i] != i {
+		u.parent[i] = u.parent[u.parent[i]]
+		i = u.parent[i]
+	}
+	return i
+}
+
+func (u *unionFind) union(a, b int) {
+	ra, rb := u.find(a), u.find(b)
+	if ra != rb {
+		u.parent[ra] = rb
+	}
+}
@@ -0,0 +1,90 @@
+package diff
+
+import (
+	"errors"
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// ErrOverlap means both sides edited the same part of the mesh, so the
+// merge needs a person to decide
+var ErrOverlap = errors.New("edits overlap")
+
+type MergeResult struct {
+	Mesh *geometry.Mesh
+	// Ours and Theirs are each side's changes relative to the base
+	Ours   *Result
+	Theirs *Result
+}
+
+// Merge3 applies both sides' edits to the base mesh. Edits may only be
+// combined when they touch no common vertex and their changed regions don't
+// overlap; otherwise ErrOverlap is returned. Base triangles keep their
+// order, followed by triangles added by ours and then by theirs.
+func Merge3(base, ours, theirs *geometry.Mesh, opts Options) (*MergeResult, error) {
+	tol := opts.Tolerance
+	if tol <= 0 {
+		tol = math.Max(DefaultTolerance(base, ours), DefaultTolerance(base, theirs))
+	}
+	q := quantizer(tol)
+
+	result := &MergeResult{
+		Ours:   Compare(base, ours, Options{Tolerance: tol}),
+		Theirs: Compare(base, theirs, Options{Tolerance: tol}),
+	}
+
+	ourPoints := changedPoints(base, ours, result.Ours, q)
+	for p := range changedPoints(base, theirs, result.Theirs, q) {
+		if ourPoints[p] {
+			return nil, ErrOverlap
+		}
+	}
+	for _, a := range result.Ours.ChangedRegions {
+		for _, b := range result.Theirs.ChangedRegions {
+			if a.BoundingBox.Overlaps(b.BoundingBox) {
+				return nil, ErrOverlap
+			}
+		}
+	}
+
+	removed := make(map[int]bool)
+	for _, i := range result.Ours.RemovedFaces {
+		removed[i] = true
+	}
+	for _, i := range result.Theirs.RemovedFaces {
+		removed[i] = true
+	}
+
+	b := geometry.NewMeshBuilder()
+	for i := range base.Triangles {
+		if !removed[i] {
+			b.AddTriangle(base.Triangle(i))
+		}
+	}
+	for _, i := range result.Ours.AddedFaces {
+		b.AddTriangle(ours.Triangle(i))
+	}
+	for _, i := range result.Theirs.AddedFaces {
+		b.AddTriangle(theirs.Triangle(i))
+	}
+
+	result.Mesh = b.Mesh()
+	return result, nil
+}
+
+// changedPoints is the set of quantized vertices touched by one side's edit
+func changedPoints(base, edited *geometry.Mesh, r *Result, q func(geometry.Vec3) gridPoint) map[gridPoint]bool {
+	points := make(map[gridPoint]bool)
+	add := func(m *geometry.Mesh, faces []int) {
+		for _, i := range faces {
+			a, b, c := m.Triangle(i)
+			points[q(a)] = true
+			points[q(b)] = true
+			points[q(c)] = true
+		}
+	}
+	add(base, r.RemovedFaces)
+	add(edited, r.AddedFaces)
+	return points
+}
@@ -0,0 +1,105 @@
+package diff
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// tetra adds a tetrahedron with its base corner at origin and its apex
+// height above it
+func tetra(b *geometry.MeshBuilder, origin geometry.Vec3, height float64) {
+	p0 := origin
+	p1 := origin.Add(geometry.Vec3{X: 10})
+	p2 := origin.Add(geometry.Vec3{Y: 10})
+	apex := origin.Add(geometry.Vec3{Z: height})
+	b.AddTriangle(p0, p2, p1)
+	b.AddTriangle(p0, p1, apex)
+	b.AddTriangle(p1, p2, apex)
+	b.AddTriangle(p2, p0, apex)
+}
+
+// parts builds a mesh of two tetrahedra far enough apart that editing one
+// never touches the other
+func parts(heightA, heightB float64) *geometry.Mesh {
+	b := geometry.NewMeshBuilder()
+	tetra(b, geometry.Vec3{}, heightA)
+	tetra(b, geometry.Vec3{X: 100}, heightB)
+	return b.Mesh()
+}
+
+func assertSameMesh(t *testing.T, got, want *geometry.Mesh) {
+	t.Helper()
+	r := Compare(want, got, Options{})
+	if r.TrianglesAdded != 0 || r.TrianglesRemoved != 0 {
+		t.Fatalf("merged mesh differs: %d triangles added, %d removed", r.TrianglesAdded, r.TrianglesRemoved)
+	}
+}
+
+func TestMerge3Disjoint(t *testing.T) {
+	base := parts(10, 10)
+	ours := parts(12, 10)
+	theirs := parts(10, 15)
+
+	result, err := Merge3(base, ours, theirs, Options{})
+	if err != nil {
+		t.Fatalf("Merge3: %v", err)
+	}
+	assertSameMesh(t, result.Mesh, parts(12, 15))
+
+	if got := result.Ours.TrianglesAdded; got != 3 {
+		t.Errorf("ours added %d triangles, want 3", got)
+	}
+	if got := result.Theirs.TrianglesAdded; got != 3 {
+		t.Errorf("theirs added %d triangles, want 3", got)
+	}
+}
+
+func TestMerge3OneSideUnchanged(t *testing.T) {
+	base := parts(10, 10)
+	theirs := parts(10, 15)
+
+	result, err := Merge3(base, base, theirs, Options{})
+	if err != nil {
+		t.Fatalf("Merge3: %v", err)
+	}
+	assertSameMesh(t, result.Mesh, theirs)
+}
+
+func TestMerge3Overlapping(t *testing.T) {
+	base := parts(10, 10)
+	ours := parts(12, 10)
+	theirs := parts(14, 10)
+
+	if _, err := Merge3(base, ours, theirs, Options{}); !errors.Is(err, ErrOverlap) {
+		t.Fatalf("Merge3 error = %v, want ErrOverlap", err)
+	}
+}
+
+// After a merge the source head is the merge base, so the next merge
+// only sees what changed since
+func TestMerge3Remerge(t *testing.T) {
+	base := parts(10, 10)
+	ours := parts(12, 10)
+	theirs := parts(10, 15)
+
+	first, err := Merge3(base, ours, theirs, Options{})
+	if err != nil {
+		t.Fatalf("first Merge3: %v", err)
+	}
+
+	// The source edits the same part again after the merge
+	again := parts(13, 10)
+	second, err := Merge3(ours, again, first.Mesh, Options{})
+	if err != nil {
+		t.Fatalf("second Merge3: %v", err)
+	}
+	assertSameMesh(t, second.Mesh, parts(13, 15))
+
+	// Against the original base both sides touched the first part, which
+	// is the conflict a stale merge base brings back
+	if _, err := Merge3(base, again, first.Mesh, Options{}); !errors.Is(err, ErrOverlap) {
+		t.Fatalf("Merge3 against the old base error = %v, want ErrOverlap", err)
+	}
+}
@@ -0,0 +1,259 @@
+package dxf
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// maxListed caps the entities listed per kind of change; a drawing
+// re-exported from another tool can change every entity
+const maxListed = 500
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// CountChange is a change in the number of entities of a type or on a layer
+type CountChange struct {
+	Name  string `json:"name"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Delta int    `json:"delta"`
+}
+
+// EntityChange is an entity whose handle is on both sides but whose
+// geometry, layer or properties differ
+type EntityChange struct {
+	Handle string `json:"handle"`
+	From   Entity `json:"from"`
+	To     Entity `json:"to"`
+}
+
+type Diff struct {
+	HeaderChanges []FieldChange `json:"header_changes"`
+	LayersAdded   []Layer       `json:"layers_added"`
+	LayersRemoved []Layer       `json:"layers_removed"`
+	// LayerChanges are color, linetype and visibility changes, with Field
+	// as "layer.property"
+	LayerChanges []FieldChange `json:"layer_changes"`
+	// Entity types and layers whose counts changed, largest change first
+	EntityCounts []CountChange `json:"entity_counts"`
+	LayerCounts  []CountChange `json:"layer_counts"`
+	ExtentsFrom  Extents       `json:"extents_from"`
+	ExtentsTo    Extents       `json:"extents_to"`
+
+	Unchanged int            `json:"unchanged"`
+	Added     []Entity       `json:"added"`
+	Removed   []Entity       `json:"removed"`
+	Modified  []EntityChange `json:"modified"`
+	// Counts of each kind of change; the lists stop at maxListed entries
+	AddedCount    int  `json:"added_count"`
+	RemovedCount  int  `json:"removed_count"`
+	ModifiedCount int  `json:"modified_count"`
+	Truncated     bool `json:"truncated"`
+}
+
+// Compare reports how the "to" drawing differs from the "from" drawing.
+// Entities are matched on their content first, ignoring handles, so a
+// drawing saved by a different tool still lines up; entities left over on
+// both sides with the same handle were modified, and the rest were added
+// or removed. Block definitions aren't compared, only their placements.
+func Compare(from, to *File) *Diff {
+	d := &Diff{
+		HeaderChanges: []FieldChange{},
+		LayersAdded:   []Layer{},
+		LayersRemoved: []Layer{},
+		LayerChanges:  []FieldChange{},
+		EntityCounts:  counts(from.EntityCounts, to.EntityCounts),
+		LayerCounts:   counts(layerCounts(from), layerCounts(to)),
+		ExtentsFrom:   from.Extents,
+		ExtentsTo:     to.Extents,
+		Added:         []Entity{},
+		Removed:       []Entity{},
+		Modified:      []EntityChange{},
+	}
+
+	header := func(field, a, b string) {
+		if a != b {
+			d.HeaderChanges = append(d.HeaderChanges, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+	header("version", from.Header.Version, to.Header.Version)
+	header("units", from.Header.Units, to.Header.Units)
+
+	before := make(map[string]Layer, len(from.Layers))
+	for _, l := range from.Layers {
+		before[l.Name] = l
+	}
+	after := make(map[string]bool, len(to.Layers))
+	for _, l := range to.Layers {
+		after[l.Name] = true
+		old, ok := before[l.Name]
+		if !ok {
+			d.LayersAdded = append(d.LayersAdded, l)
+			continue
+		}
+		layer := func(property, a, b string) {
+			if a != b {
+				d.LayerChanges = append(d.LayerChanges, FieldChange{Field: l.Name + "." + property, From: a, To: b})
+			}
+		}
+		layer("color", strconv.Itoa(old.Color), strconv.Itoa(l.Color))
+		layer("linetype", old.Linetype, l.Linetype)
+		layer("frozen", strconv.FormatBool(old.Frozen), strconv.FormatBool(l.Frozen))
+		layer("off", strconv.FormatBool(old.Off), strconv.FormatBool(l.Off))
+	}
+	for _, l := range from.Layers {
+		if !after[l.Name] {
+			d.LayersRemoved = append(d.LayersRemoved, l)
+		}
+	}
+
+	// Match identical entities, then pair the leftovers by handle
+	unmatched := make(map[string][]int)
+	for i, e := range from.Entities {
+		k := e.key()
+		unmatched[k] = append(unmatched[k], i)
+	}
+	matched := make([]bool, len(from.Entities))
+	var added []Entity
+	for _, e := range to.Entities {
+		k := e.key()
+		if idx := unmatched[k]; len(idx) > 0 {
+			matched[idx[0]] = true
+			unmatched[k] = idx[1:]
+			d.Unchanged++
+			continue
+		}
+		added = append(added, e)
+	}
+
+	removedByHandle := make(map[string]int)
+	for i, e := range from.Entities {
+		if !matched[i] && e.Handle != "" {
+			removedByHandle[e.Handle] = i
+		}
+	}
+	for _, e := range added {
+		if i, ok := removedByHandle[e.Handle]; ok && e.Handle != "" {
+			matched[i] = true
+			delete(removedByHandle, e.Handle)
+			d.ModifiedCount++
+			if len(d.Modified) < maxListed {
+				d.Modified = append(d.Modified, EntityChange{Handle: e.Handle, From: from.Entities[i], To: e})
+			}
+			continue
+		}
+		d.AddedCount++
+		if len(d.Added) < maxListed {
+			d.Added = append(d.Added, e)
+		}
+	}
+	for i, e := range from.Entities {
+		if matched[i] {
+			continue
+		}
+		d.RemovedCount++
+		if len(d.Removed) < maxListed {
+			d.Removed = append(d.Removed, e)
+		}
+	}
+	d.Truncated = d.AddedCount > maxListed || d.RemovedCount > maxListed || d.ModifiedCount > maxListed
+
+	return d
+}
+
+// key identifies an entity's content, leaving out its handle. Coordinates
+// are rounded so float formatting differences between writers don't count.
+func (e Entity) key() string {
+	var b strings.Builder
+	b.WriteString(e.Type)
+	b.WriteByte('|')
+	b.WriteString(e.Layer)
+	b.WriteByte('|')
+	b.WriteString(strconv.Itoa(e.Color))
+	b.WriteByte('|')
+	if e.PaperSpace {
+		b.WriteString("paper")
+	}
+	b.WriteByte('|')
+	for _, p := range e.Points {
+		writeRounded(&b, p[0])
+		writeRounded(&b, p[1])
+	}
+	b.WriteByte('|')
+	for _, v := range e.Bulges {
+		writeRounded(&b, v)
+	}
+	for _, v := range e.Knots {
+		writeRounded(&b, v)
+	}
+	for _, v := range e.Weights {
+		writeRounded(&b, v)
+	}
+	b.WriteByte('|')
+	for _, v := range []float64{e.Radius, e.StartAngle, e.EndAngle, e.Ratio, e.Height, e.Rotation, e.Scale[0], e.Scale[1], e.Measurement} {
+		writeRounded(&b, v)
+	}
+	b.WriteByte('|')
+	b.WriteString(strconv.FormatBool(e.Closed))
+	b.WriteByte('|')
+	b.WriteString(strconv.Itoa(e.Degree))
+	b.WriteByte('|')
+	b.WriteString(e.Block)
+	b.WriteByte('|')
+	b.WriteString(e.Text)
+	return b.String()
+}
+
+func writeRounded(b *strings.Builder, v float64) {
+	s := strconv.FormatFloat(v, 'f', 6, 64)
+	if s == "-0.000000" {
+		s = "0.000000"
+	}
+	b.WriteString(s)
+	b.WriteByte(',')
+}
+
+func layerCounts(f *File) map[string]int {
+	out := make(map[string]int, len(f.Layers))
+	for _, l := range f.Layers {
+		out[l.Name] = l.Entities
+	}
+	return out
+}
+
+func counts(from, to map[string]int) []CountChange {
+	names := make(map[string]bool)
+	for n := range from {
+		names[n] = true
+	}
+	for n := range to {
+		names[n] = true
+	}
+	out := []CountChange{}
+	for n := range names {
+		a, b := from[n], to[n]
+		if a != b {
+			out = append(out, CountChange{Name: n, From: a, To: b, Delta: b - a})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		a, b := abs(out[i].Delta), abs(out[j].Delta)
+		if a != b {
+			return a > b
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,572 @@
+// Package dxf reads ASCII DXF drawings: the header, layers, block
+// definitions and 2D entities, with enough geometry to compute extents,
+// draw an SVG preview and diff two drawings entity by entity.
+package dxf
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+)
+
+var (
+	ErrNotDXF = errors.New("file is not a DXF drawing")
+	// Binary DXF is rare in practice and not supported
+	ErrBinary = errors.New("binary DXF is not supported")
+)
+
+const binaryMagic = "AutoCAD Binary DXF"
+
+// Color numbers with special meaning; 1-255 index the AutoCAD color table
+const (
+	ColorByBlock = 0
+	ColorByLayer = 256
+)
+
+// Point is a 2D drawing coordinate; Z is ignored
+type Point [2]float64
+
+type Header struct {
+	// Version is the $ACADVER code, e.g. AC1015; Release the matching
+	// AutoCAD release
+	Version string `json:"version"`
+	Release string `json:"release,omitempty"`
+	// Units is $INSUNITS as a unit name, or empty when unitless
+	Units string `json:"units,omitempty"`
+}
+
+type Layer struct {
+	Name     string `json:"name"`
+	Color    int    `json:"color"`
+	Linetype string `json:"linetype,omitempty"`
+	Frozen   bool   `json:"frozen,omitempty"`
+	// Off layers have a negative color in the table
+	Off bool `json:"off,omitempty"`
+	// Entities counts the top-level entities on the layer
+	Entities int `json:"entities"`
+}
+
+// Entity is one drawing entity. Which fields are set depends on Type:
+//
+//	LINE        Points (start, end)
+//	CIRCLE      Points (center), Radius
+//	ARC         Points (center), Radius, StartAngle, EndAngle in degrees CCW
+//	LWPOLYLINE  Points, Bulges, Closed (POLYLINE is read into the same form)
+//	ELLIPSE     Points (center, major axis endpoint relative to center),
+//	            Ratio, StartAngle, EndAngle as parameters in radians
+//	SPLINE      Points (control points, or fit points when there are no
+//	            control points), Knots, Weights, Degree, Closed
+//	TEXT, MTEXT Points (insertion), Text, Height, Rotation
+//	DIMENSION   Points (definition points), Block, Text, Measurement
+//	INSERT      Points (insertion), Block, Scale, Rotation
+//	POINT       Points
+//
+// Other types (HATCH, SOLID, ...) are kept with only their common fields
+// so they are still counted and diffed by handle.
+type Entity struct {
+	Type   string `json:"type"`
+	Handle string `json:"handle,omitempty"`
+	Layer  string `json:"layer"`
+	// Color is 0 for BYBLOCK, 256 (or unset) for BYLAYER
+	Color      int       `json:"color,omitempty"`
+	PaperSpace bool      `json:"paper_space,omitempty"`
+	Points     []Point   `json:"points,omitempty"`
+	Bulges     []float64 `json:"bulges,omitempty"`
+	Closed     bool      `json:"closed,omitempty"`
+	Radius     float64   `json:"radius,omitempty"`
+	StartAngle float64   `json:"start_angle,omitempty"`
+	EndAngle   float64   `json:"end_angle,omitempty"`
+	Ratio      float64   `json:"ratio,omitempty"`
+	Degree     int       `json:"degree,omitempty"`
+	Knots      []float64 `json:"knots,omitempty"`
+	Weights    []float64 `json:"weights,omitempty"`
+	Text       string    `json:"text,omitempty"`
+	Height     float64   `json:"height,omitempty"`
+	Rotation   float64   `json:"rotation,omitempty"`
+	Block      string    `json:"block,omitempty"`
+	Scale      Point     `json:"scale,omitzero"`
+	// Measurement is the value a DIMENSION measures
+	Measurement float64 `json:"measurement,omitempty"`
+}
+
+// Block is a named group of entities placed by INSERT and drawn by
+// DIMENSION, positioned relative to Base
+type Block struct {
+	Name     string
+	Base     Point
+	Entities []Entity
+}
+
+// Extents bound the model-space geometry. Empty drawings have zero extents.
+type Extents struct {
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+}
+
+type File struct {
+	Header       Header         `json:"header"`
+	Layers       []Layer        `json:"layers"`
+	EntityCounts map[string]int `json:"entity_counts"`
+	EntityTotal  int            `json:"entity_total"`
+	Extents      Extents        `json:"extents"`
+	// Entities are model and paper space, in file order. They and the
+	// block definitions are left out of the stored summary.
+	Entities []Entity          `json:"-"`
+	Blocks   map[string]*Block `json:"-"`
+}
+
+func IsDXF(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".dxf")
+}
+
+var releases = map[string]string{
+	"AC1009": "R12",
+	"AC1012": "R13",
+	"AC1014": "R14",
+	"AC1015": "2000",
+	"AC1018": "2004",
+	"AC1021": "2007",
+	"AC1024": "2010",
+	"AC1027": "2013",
+	"AC1032": "2018",
+}
+
+// $INSUNITS codes for the units the units package knows
+var insUnits = map[int]string{
+	1:  units.Inch,
+	2:  units.Foot,
+	4:  units.Millimeter,
+	5:  units.Centimeter,
+	6:  units.Meter,
+	13: units.Micron,
+}
+
+type group struct {
+	code  int
+	value string
+}
+
+// record is an entity or table entry: its type and the groups up to the
+// next 0 group
+type record struct {
+	kind   string
+	groups []group
+}
+
+func ParseBytes(data []byte) (*File, error) {
+	if bytes.HasPrefix(data, []byte(binaryMagic)) {
+		return nil, ErrBinary
+	}
+	records, err := readRecords(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 || records[0].kind != "SECTION" {
+		return nil, ErrNotDXF
+	}
+
+	f := &File{
+		Layers:       []Layer{},
+		EntityCounts: make(map[string]int),
+		Blocks:       make(map[string]*Block),
+	}
+
+	var section string
+	var block *Block
+	for i := 0; i < len(records); i++ {
+		rec := records[i]
+		switch rec.kind {
+		case "SECTION":
+			section = rec.str(2)
+			// Header variables have no 0 groups of their own, so they
+			// arrive in the SECTION record
+			if section == "HEADER" {
+				f.Header.read(rec)
+			}
+			continue
+		case "ENDSEC":
+			section = ""
+			continue
+		case "EOF":
+			i = len(records)
+			continue
+		}
+
+		switch section {
+		case "HEADER":
+			f.Header.read(rec)
+		case "TABLES":
+			if rec.kind == "LAYER" {
+				f.Layers = append(f.Layers, readLayer(rec))
+			}
+		case "BLOCKS":
+			switch rec.kind {
+			case "BLOCK":
+				block = &Block{Name: rec.str(2), Base: rec.point(10)}
+				f.Blocks[block.Name] = block
+			case "ENDBLK":
+				block = nil
+			default:
+				if block != nil {
+					e, next, err := readEntity(records, i)
+					if err != nil {
+						return nil, err
+					}
+					i = next
+					block.Entities = append(block.Entities, e)
+				}
+			}
+		case "ENTITIES":
+			e, next, err := readEntity(records, i)
+			if err != nil {
+				return nil, err
+			}
+			i = next
+			f.Entities = append(f.Entities, e)
+		}
+	}
+
+	counts := make(map[string]int)
+	for _, e := range f.Entities {
+		f.EntityCounts[e.Type]++
+		f.EntityTotal++
+		counts[e.Layer]++
+	}
+	for i := range f.Layers {
+		f.Layers[i].Entities = counts[f.Layers[i].Name]
+		delete(counts, f.Layers[i].Name)
+	}
+	// Entities may sit on layers missing from the table; those are created
+	// implicitly with default settings
+	for _, e := range f.Entities {
+		if n, ok := counts[e.Layer]; ok {
+			f.Layers = append(f.Layers, Layer{Name: e.Layer, Color: 7, Entities: n})
+			delete(counts, e.Layer)
+		}
+	}
+	f.Extents = f.extents()
+
+	return f, nil
+}
+
+// readRecords splits the group code/value line pairs into records
+func readRecords(data []byte) ([]record, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	var records []record
+	for scanner.Scan() {
+		codeLine := strings.TrimSpace(scanner.Text())
+		if codeLine == "" && len(records) == 0 {
+			continue
+		}
+		code, err := strconv.Atoi(codeLine)
+		if err != nil {
+			if len(records) == 0 {
+				return nil, ErrNotDXF
+			}
+			return nil, fmt.Errorf("invalid group code %q", codeLine)
+		}
+		if !scanner.Scan() {
+			break
+		}
+		value := strings.TrimRight(scanner.Text(), " \r")
+
+		if code == 0 {
+			records = append(records, record{kind: strings.TrimSpace(value)})
+			continue
+		}
+		if len(records) == 0 {
+			return nil, ErrNotDXF
+		}
+		last := &records[len(records)-1]
+		last.groups = append(last.groups, group{code: code, value: value})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read DXF: %w", err)
+	}
+	return records, nil
+}
+
+func (r record) str(code int) string {
+	for _, g := range r.groups {
+		if g.code == code {
+			return strings.TrimSpace(g.value)
+		}
+	}
+	return ""
+}
+
+func (r record) float(code int, fallback float64) float64 {
+	for _, g := range r.groups {
+		if g.code == code {
+			if v, err := strconv.ParseFloat(strings.TrimSpace(g.value), 64); err == nil && !math.IsNaN(v) && !math.IsInf(v, 0) {
+				return v
+			}
+		}
+	}
+	return fallback
+}
+
+func (r record) int(code int, fallback int) int {
+	for _, g := range r.groups {
+		if g.code == code {
+			if v, err := strconv.Atoi(strings.TrimSpace(g.value)); err == nil {
+				return v
+			}
+		}
+	}
+	return fallback
+}
+
+func (r record) has(code int) bool {
+	for _, g := range r.groups {
+		if g.code == code {
+			return true
+		}
+	}
+	return false
+}
+
+// point reads an X/Y pair from code and code+10
+func (r record) point(code int) Point {
+	return Point{r.float(code, 0), r.float(code+10, 0)}
+}
+
+// floats reads every value of a repeated group
+func (r record) floats(code int) []float64 {
+	var out []float64
+	for _, g := range r.groups {
+		if g.code == code {
+			v, _ := strconv.ParseFloat(strings.TrimSpace(g.value), 64)
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// points reads repeated X/Y pairs in order
+func (r record) points(code int) []Point {
+	var out []Point
+	for _, g := range r.groups {
+		v, _ := strconv.ParseFloat(strings.TrimSpace(g.value), 64)
+		switch g.code {
+		case code:
+			out = append(out, Point{v, 0})
+		case code + 10:
+			if len(out) > 0 {
+				out[len(out)-1][1] = v
+			}
+		}
+	}
+	return out
+}
+
+// Header variables are a 9 group naming the variable followed by its values
+func (h *Header) read(rec record) {
+	var name string
+	for _, g := range rec.groups {
+		if g.code == 9 {
+			name = strings.TrimSpace(g.value)
+			continue
+		}
+		switch {
+		case name == "$ACADVER" && g.code == 1:
+			h.Version = strings.TrimSpace(g.value)
+			h.Release = releases[h.Version]
+		case name == "$INSUNITS" && g.code == 70:
+			code, _ := strconv.Atoi(strings.TrimSpace(g.value))
+			h.Units = insUnits[code]
+		}
+	}
+}
+
+func readLayer(rec record) Layer {
+	color := rec.int(62, 7)
+	l := Layer{
+		Name:     rec.str(2),
+		Color:    color,
+		Linetype: rec.str(6),
+		Frozen:   rec.int(70, 0)&1 != 0,
+		Off:      color < 0,
+	}
+	if l.Off {
+		l.Color = -color
+	}
+	return l
+}
+
+// readEntity reads the entity at records[i], returning the index of its
+// last record. Old-style POLYLINEs span their VERTEX records up to SEQEND.
+func readEntity(records []record, i int) (Entity, int, error) {
+	rec := records[i]
+	e := Entity{
+		Type:       rec.kind,
+		Handle:     rec.str(5),
+		Layer:      rec.str(8),
+		Color:      rec.int(62, ColorByLayer),
+		PaperSpace: rec.int(67, 0) == 1,
+	}
+	if e.Layer == "" {
+		e.Layer = "0"
+	}
+
+	switch rec.kind {
+	case "LINE":
+		e.Points = []Point{rec.point(10), rec.point(11)}
+	case "POINT":
+		e.Points = []Point{rec.point(10)}
+	case "CIRCLE":
+		e.Points = []Point{rec.point(10)}
+		e.Radius = rec.float(40, 0)
+	case "ARC":
+		e.Points = []Point{rec.point(10)}
+		e.Radius = rec.float(40, 0)
+		e.StartAngle = rec.float(50, 0)
+		e.EndAngle = rec.float(51, 360)
+		if math.Abs(e.StartAngle) > maxAngleDegrees || math.Abs(e.EndAngle) > maxAngleDegrees {
+			return e, i, fmt.Errorf("ARC %s: angle out of range", e.Handle)
+		}
+	case "LWPOLYLINE":
+		e.Closed = rec.int(70, 0)&1 != 0
+		// Bulges follow the vertex they start from
+		for _, g := range rec.groups {
+			v, _ := strconv.ParseFloat(strings.TrimSpace(g.value), 64)
+			switch g.code {
+			case 10:
+				e.Points = append(e.Points, Point{v, 0})
+				e.Bulges = append(e.Bulges, 0)
+			case 20:
+				if n := len(e.Points); n > 0 {
+					e.Points[n-1][1] = v
+				}
+			case 42:
+				if n := len(e.Bulges); n > 0 {
+					e.Bulges[n-1] = v
+				}
+			}
+		}
+	case "POLYLINE":
+		e.Type = "LWPOLYLINE"
+		e.Closed = rec.int(70, 0)&1 != 0
+		for i+1 < len(records) && records[i+1].kind == "VERTEX" {
+			i++
+			vertex := records[i]
+			e.Points = append(e.Points, vertex.point(10))
+			e.Bulges = append(e.Bulges, vertex.float(42, 0))
+		}
+		if i+1 < len(records) && records[i+1].kind == "SEQEND" {
+			i++
+		}
+	case "ELLIPSE":
+		e.Points = []Point{rec.point(10), rec.point(11)}
+		e.Ratio = rec.float(40, 1)
+		e.StartAngle = rec.float(41, 0)
+		e.EndAngle = rec.float(42, 2*math.Pi)
+		if limit := maxAngleDegrees * math.Pi / 180; math.Abs(e.StartAngle) > limit || math.Abs(e.EndAngle) > limit {
+			return e, i, fmt.Errorf("ELLIPSE %s: angle out of range", e.Handle)
+		}
+	case "SPLINE":
+		e.Closed = rec.int(70, 0)&1 != 0
+		e.Degree = rec.int(71, 3)
+		e.Knots = rec.floats(40)
+		e.Weights = rec.floats(41)
+		e.Points = rec.points(10)
+		if len(e.Points) == 0 {
+			e.Points = rec.points(11)
+			e.Knots, e.Weights = nil, nil
+		}
+	case "TEXT":
+		e.Points = []Point{rec.point(10)}
+		e.Text = rec.str(1)
+		e.Height = rec.float(40, 0)
+		e.Rotation = rec.float(50, 0)
+	case "MTEXT":
+		e.Points = []Point{rec.point(10)}
+		e.Text = mtextPlain(rec)
+		e.Height = rec.float(40, 0)
+		e.Rotation = rec.float(50, 0)
+		if !rec.has(50) && rec.has(11) {
+			// Direction vector instead of an angle
+			dir := rec.point(11)
+			e.Rotation = math.Atan2(dir[1], dir[0]) * 180 / math.Pi
+		}
+	case "DIMENSION":
+		e.Points = []Point{rec.point(10), rec.point(13), rec.point(14)}
+		e.Block = rec.str(2)
+		e.Text = rec.str(1)
+		e.Measurement = rec.float(42, 0)
+	case "INSERT":
+		e.Points = []Point{rec.point(10)}
+		e.Block = rec.str(2)
+		e.Scale = Point{rec.float(41, 1), rec.float(42, 1)}
+		e.Rotation = rec.float(50, 0)
+	}
+
+	// An extrusion of (0, 0, -1) mirrors the entity's coordinate system in X,
+	// which some CAD exports use for arcs and polylines in flat patterns
+	if rec.float(230, 1) < 0 {
+		switch e.Type {
+		case "CIRCLE", "ARC", "LWPOLYLINE":
+			for i := range e.Points {
+				e.Points[i][0] = -e.Points[i][0]
+			}
+			for i := range e.Bulges {
+				e.Bulges[i] = -e.Bulges[i]
+			}
+			if e.Type == "ARC" {
+				e.StartAngle, e.EndAngle = 180-e.EndAngle, 180-e.StartAngle
+			}
+		}
+	}
+
+	return e, i, nil
+}
+
+// mtextPlain joins MTEXT's text chunks and strips inline formatting
+func mtextPlain(rec record) string {
+	var raw strings.Builder
+	for _, g := range rec.groups {
+		if g.code == 3 {
+			raw.WriteString(g.value)
+		}
+	}
+	raw.WriteString(rec.str(1))
+
+	s := raw.String()
+	var out strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '{', '}':
+		case '\\':
+			if i+1 >= len(s) {
+				continue
+			}
+			i++
+			switch s[i] {
+			case 'P', 'X':
+				out.WriteByte('\n')
+			case '~':
+				out.WriteByte(' ')
+			case '\\', '{', '}':
+				out.WriteByte(s[i])
+			case 'L', 'l', 'O', 'o', 'K', 'k':
+			default:
+				// Codes with arguments (\fArial|b0;, \H2.5x;, ...) run to ';'
+				if end := strings.IndexByte(s[i:], ';'); end >= 0 {
+					i += end
+				}
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(out.String())
+}
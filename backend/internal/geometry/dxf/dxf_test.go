@@ -0,0 +1,82 @@
+package dxf
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+// arcDXF is a drawing holding one unit arc at the origin
+func arcDXF(start, end string) []byte {
+	return fmt.Appendf(nil, "0\nSECTION\n2\nENTITIES\n0\nARC\n5\nA1\n10\n0\n20\n0\n40\n1\n50\n%s\n51\n%s\n0\nENDSEC\n0\nEOF\n", start, end)
+}
+
+func assertNear(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestParseArcAngleOutOfRange(t *testing.T) {
+	for _, angles := range [][2]string{
+		{"0", "1e13"},
+		{"1e19", "0"},
+		{"-1e300", "90"},
+		{"0", "36001"},
+	} {
+		if _, err := ParseBytes(arcDXF(angles[0], angles[1])); err == nil {
+			t.Errorf("ParseBytes with angles %s, %s succeeded, want an error", angles[0], angles[1])
+		}
+	}
+}
+
+func TestParseArcWrapsAngles(t *testing.T) {
+	// 350 to 10 sweeps through 0, so only the right of the circle is drawn
+	f, err := ParseBytes(arcDXF("350", "10"))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	assertNear(t, "max x", f.Extents.Max[0], 1)
+	if f.Extents.Min[0] < math.Cos(10*math.Pi/180)-1e-6 {
+		t.Errorf("min x = %v, want the arc to stay right of the centre", f.Extents.Min[0])
+	}
+
+	// Whole turns either way are the same arc
+	g, err := ParseBytes(arcDXF("-1090", "730"))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	assertNear(t, "min x", g.Extents.Min[0], f.Extents.Min[0])
+	assertNear(t, "max y", g.Extents.Max[1], f.Extents.Max[1])
+}
+
+func TestParseArcFallbackAngles(t *testing.T) {
+	// Unreadable angles fall back to a full circle
+	f, err := ParseBytes(arcDXF("NaN", "Inf"))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	assertNear(t, "min x", f.Extents.Min[0], -1)
+	assertNear(t, "max x", f.Extents.Max[0], 1)
+}
+
+func TestParseEllipseAngleOutOfRange(t *testing.T) {
+	data := []byte("0\nSECTION\n2\nENTITIES\n0\nELLIPSE\n5\nE1\n10\n0\n20\n0\n11\n2\n21\n0\n40\n0.5\n41\n0\n42\n1e15\n0\nENDSEC\n0\nEOF\n")
+	if _, err := ParseBytes(data); err == nil {
+		t.Fatal("ParseBytes succeeded, want an error")
+	}
+}
+
+func TestSweep(t *testing.T) {
+	for _, c := range []struct{ start, end, want float64 }{
+		{0, 90, 90},
+		{90, 0, 270},
+		{350, 10, 20},
+		{45, 45, 360},
+		{0, 360, 360},
+		{-720, 90, 90},
+	} {
+		assertNear(t, fmt.Sprintf("sweep(%v, %v)", c.start, c.end), sweep(c.start, c.end, 360), c.want)
+	}
+}
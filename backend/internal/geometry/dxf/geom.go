@@ -0,0 +1,309 @@
+package dxf
+
+import (
+	"math"
+)
+
+const (
+	// Arcs are flattened to segments of at most this many degrees
+	arcStepDegrees = 5
+	// Nested block references deeper than this are ignored, which also
+	// stops blocks that reference themselves
+	maxBlockDepth = 8
+	// Rough character width as a fraction of text height, for extents
+	textAspect = 0.6
+	// Arc angles past this many degrees, a hundred turns, are malformed
+	maxAngleDegrees = 36000
+)
+
+// sweep is the counter-clockwise angle from start to end, in (0, period].
+// Equal angles sweep a full turn.
+func sweep(start, end, period float64) float64 {
+	s := math.Mod(end-start, period)
+	if s <= 0 {
+		s += period
+	}
+	return s
+}
+
+// affine maps block coordinates into the drawing: x' = a·x + c·y + e,
+// y' = b·x + d·y + f
+type affine [6]float64
+
+var identity = affine{1, 0, 0, 1, 0, 0}
+
+func (t affine) apply(p Point) Point {
+	return Point{t[0]*p[0] + t[2]*p[1] + t[4], t[1]*p[0] + t[3]*p[1] + t[5]}
+}
+
+// then returns the transform applying t first, then next
+func (t affine) then(next affine) affine {
+	return affine{
+		next[0]*t[0] + next[2]*t[1],
+		next[1]*t[0] + next[3]*t[1],
+		next[0]*t[2] + next[2]*t[3],
+		next[1]*t[2] + next[3]*t[3],
+		next[0]*t[4] + next[2]*t[5] + next[4],
+		next[1]*t[4] + next[3]*t[5] + next[5],
+	}
+}
+
+// placement is the transform an INSERT applies to its block: move the base
+// point to the origin, scale, rotate, then move to the insertion point
+func placement(e Entity, base Point) affine {
+	rad := e.Rotation * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	sx, sy := e.Scale[0], e.Scale[1]
+	if sx == 0 {
+		sx = 1
+	}
+	if sy == 0 {
+		sy = 1
+	}
+	at := e.Points[0]
+	return affine{1, 0, 0, 1, -base[0], -base[1]}.then(affine{
+		cos * sx, sin * sx,
+		-sin * sy, cos * sy,
+		at[0], at[1],
+	})
+}
+
+// walk calls fn for every drawable entity, expanding INSERTs and the
+// blocks DIMENSIONs draw into their placed entities
+func (f *File) walk(entities []Entity, t affine, depth int, fn func(e Entity, t affine)) {
+	for _, e := range entities {
+		if e.PaperSpace {
+			continue
+		}
+		if block := f.reference(e); block != nil {
+			if depth < maxBlockDepth {
+				bt := identity
+				if e.Type == "INSERT" {
+					bt = placement(e, block.Base)
+				}
+				f.walk(block.Entities, bt.then(t), depth+1, fn)
+			}
+			continue
+		}
+		fn(e, t)
+	}
+}
+
+// reference returns the block an INSERT places or a DIMENSION draws with,
+// or nil if there isn't one
+func (f *File) reference(e Entity) *Block {
+	if e.Block == "" || (e.Type != "INSERT" && e.Type != "DIMENSION") {
+		return nil
+	}
+	if e.Type == "INSERT" && len(e.Points) == 0 {
+		return nil
+	}
+	return f.Blocks[e.Block]
+}
+
+// Flatten approximates an entity by polylines in its own coordinates: arcs,
+// bulges, ellipses and splines become short segments. Text, points and
+// unsupported types have no outline.
+func (e Entity) Flatten() [][]Point {
+	switch e.Type {
+	case "LINE":
+		if len(e.Points) == 2 {
+			return [][]Point{e.Points}
+		}
+	case "CIRCLE":
+		if len(e.Points) == 1 {
+			return [][]Point{arcPoints(e.Points[0], e.Radius, 0, 360)}
+		}
+	case "ARC":
+		if len(e.Points) == 1 {
+			return [][]Point{arcPoints(e.Points[0], e.Radius, e.StartAngle, e.EndAngle)}
+		}
+	case "LWPOLYLINE":
+		return [][]Point{polylinePoints(e)}
+	case "ELLIPSE":
+		if len(e.Points) == 2 {
+			return [][]Point{ellipsePoints(e)}
+		}
+	case "SPLINE":
+		return [][]Point{splinePoints(e)}
+	}
+	return nil
+}
+
+func arcPoints(center Point, r, start, end float64) []Point {
+	arc := sweep(start, end, 360)
+	start = math.Mod(start, 360)
+	steps := max(int(math.Ceil(arc/arcStepDegrees)), 2)
+	out := make([]Point, steps+1)
+	for i := range out {
+		a := (start + arc*float64(i)/float64(steps)) * math.Pi / 180
+		out[i] = Point{center[0] + r*math.Cos(a), center[1] + r*math.Sin(a)}
+	}
+	return out
+}
+
+// bulgeArc describes the arc between two polyline vertices. A bulge is the
+// tangent of a quarter of the included angle, positive counter-clockwise.
+func bulgeArc(p0, p1 Point, bulge float64) (center Point, r, start, sweep float64) {
+	theta := 4 * math.Atan(bulge)
+	dx, dy := p1[0]-p0[0], p1[1]-p0[1]
+	chord := math.Hypot(dx, dy)
+	h := chord / 2 / math.Tan(theta/2)
+	center = Point{(p0[0]+p1[0])/2 - dy/chord*h, (p0[1]+p1[1])/2 + dx/chord*h}
+	r = math.Hypot(p0[0]-center[0], p0[1]-center[1])
+	start = math.Atan2(p0[1]-center[1], p0[0]-center[0])
+	return center, r, start, theta
+}
+
+func polylinePoints(e Entity) []Point {
+	n := len(e.Points)
+	if n == 0 {
+		return nil
+	}
+	out := []Point{e.Points[0]}
+	segments := n - 1
+	if e.Closed {
+		segments = n
+	}
+	for i := 0; i < segments; i++ {
+		p0, p1 := e.Points[i], e.Points[(i+1)%n]
+		if i < len(e.Bulges) && e.Bulges[i] != 0 && p0 != p1 {
+			center, r, start, sweep := bulgeArc(p0, p1, e.Bulges[i])
+			steps := max(int(math.Ceil(math.Abs(sweep)*180/math.Pi/arcStepDegrees)), 2)
+			for k := 1; k < steps; k++ {
+				a := start + sweep*float64(k)/float64(steps)
+				out = append(out, Point{center[0] + r*math.Cos(a), center[1] + r*math.Sin(a)})
+			}
+		}
+		out = append(out, p1)
+	}
+	return out
+}
+
+func ellipsePoints(e Entity) []Point {
+	center, major := e.Points[0], e.Points[1]
+	minor := Point{-major[1] * e.Ratio, major[0] * e.Ratio}
+	arc := sweep(e.StartAngle, e.EndAngle, 2*math.Pi)
+	start := math.Mod(e.StartAngle, 2*math.Pi)
+	steps := max(int(math.Ceil(arc*180/math.Pi/arcStepDegrees)), 2)
+	out := make([]Point, steps+1)
+	for i := range out {
+		t := start + arc*float64(i)/float64(steps)
+		c, s := math.Cos(t), math.Sin(t)
+		out[i] = Point{center[0] + major[0]*c + minor[0]*s, center[1] + major[1]*c + minor[1]*s}
+	}
+	return out
+}
+
+// splinePoints evaluates a (possibly rational) B-spline with de Boor's
+// algorithm. Fit-point splines and splines with inconsistent knots fall
+// back to joining their points.
+func splinePoints(e Entity) []Point {
+	n, p := len(e.Points), e.Degree
+	if n < 2 || p < 1 || len(e.Knots) != n+p+1 {
+		return e.Points
+	}
+	weights := e.Weights
+	if len(weights) != n {
+		weights = nil
+	}
+
+	lo, hi := e.Knots[p], e.Knots[n]
+	if hi <= lo {
+		return e.Points
+	}
+	steps := min(max(16, 8*n), 2000)
+	out := make([]Point, 0, steps+1)
+	d := make([][3]float64, p+1)
+	for i := 0; i <= steps; i++ {
+		u := lo + (hi-lo)*float64(i)/float64(steps)
+
+		// Knot span k with knots[k] <= u < knots[k+1], clamped at the end
+		k := p
+		for k < n-1 && e.Knots[k+1] <= u {
+			k++
+		}
+
+		for j := 0; j <= p; j++ {
+			w := 1.0
+			if weights != nil {
+				w = weights[k-p+j]
+			}
+			pt := e.Points[k-p+j]
+			d[j] = [3]float64{pt[0] * w, pt[1] * w, w}
+		}
+		for r := 1; r <= p; r++ {
+			for j := p; j >= r; j-- {
+				left, right := e.Knots[j+k-p], e.Knots[j+1+k-r]
+				alpha := 0.0
+				if right > left {
+					alpha = (u - left) / (right - left)
+				}
+				for c := range 3 {
+					d[j][c] = (1-alpha)*d[j-1][c] + alpha*d[j][c]
+				}
+			}
+		}
+		if d[p][2] != 0 {
+			out = append(out, Point{d[p][0] / d[p][2], d[p][1] / d[p][2]})
+		}
+	}
+	return out
+}
+
+// textCorners roughly outlines a TEXT or MTEXT entity for extents
+func textCorners(e Entity) []Point {
+	if len(e.Points) == 0 {
+		return nil
+	}
+	longest := 0
+	for _, line := range splitLines(e.Text) {
+		longest = max(longest, len([]rune(line)))
+	}
+	w := float64(longest) * e.Height * textAspect
+	h := e.Height * float64(len(splitLines(e.Text)))
+	rad := e.Rotation * math.Pi / 180
+	cos, sin := math.Cos(rad), math.Sin(rad)
+	at := e.Points[0]
+	corner := func(x, y float64) Point {
+		return Point{at[0] + x*cos - y*sin, at[1] + x*sin + y*cos}
+	}
+	if e.Type == "MTEXT" {
+		// MTEXT's default attachment is the top left corner
+		return []Point{corner(0, 0), corner(w, 0), corner(w, -h), corner(0, -h)}
+	}
+	return []Point{corner(0, 0), corner(w, 0), corner(w, h), corner(0, h)}
+}
+
+// extents bounds the model-space drawing, with blocks placed
+func (f *File) extents() Extents {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	add := func(p Point) {
+		minX, minY = math.Min(minX, p[0]), math.Min(minY, p[1])
+		maxX, maxY = math.Max(maxX, p[0]), math.Max(maxY, p[1])
+	}
+
+	f.walk(f.Entities, identity, 0, func(e Entity, t affine) {
+		var points []Point
+		switch e.Type {
+		case "TEXT", "MTEXT":
+			points = textCorners(e)
+		case "POINT", "DIMENSION", "INSERT":
+			// Dimensions and inserts whose block is missing
+			points = e.Points
+		default:
+			for _, line := range e.Flatten() {
+				points = append(points, line...)
+			}
+		}
+		for _, p := range points {
+			add(t.apply(p))
+		}
+	})
+
+	if math.IsInf(minX, 1) {
+		return Extents{}
+	}
+	return Extents{Min: Point{minX, minY}, Max: Point{maxX, maxY}}
+}
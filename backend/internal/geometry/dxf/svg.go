@@ -0,0 +1,296 @@
+package dxf
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	svgMaxSize = 1024
+	// Margin around the extents, as a fraction of the larger side
+	svgMargin = 0.02
+)
+
+// aciColors are the standard colors of the AutoCAD color index. 7 is
+// white on a dark background, drawn black here on white.
+var aciColors = map[int]string{
+	1: "#ff0000",
+	2: "#ffff00",
+	3: "#00ff00",
+	4: "#00ffff",
+	5: "#0000ff",
+	6: "#ff00ff",
+	7: "#000000",
+	8: "#808080",
+	9: "#c0c0c0",
+}
+
+func aciColor(index int) string {
+	if c, ok := aciColors[index]; ok {
+		return c
+	}
+	return "#404040"
+}
+
+// SVG draws the model space on a white background, one group per layer
+// (with a data-layer attribute) so clients can toggle layers. Frozen and
+// off layers are left out. Blocks are defined once and placed with <use>.
+func (f *File) SVG() []byte {
+	ext := f.Extents
+	w, h := ext.Max[0]-ext.Min[0], ext.Max[1]-ext.Min[1]
+	side := math.Max(w, h)
+	if side == 0 {
+		side = 1
+	}
+	margin := side * svgMargin
+	w, h = w+2*margin, h+2*margin
+	scale := svgMaxSize / math.Max(w, h)
+
+	s := &svgWriter{file: f, blockIDs: make(map[string]string)}
+	for _, e := range f.Entities {
+		s.collectBlocks(e, 0)
+	}
+
+	fmt.Fprintf(&s.buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		num(math.Ceil(w*scale)), num(math.Ceil(h*scale)),
+		num(ext.Min[0]-margin), num(-ext.Max[1]-margin), num(w), num(h))
+	s.buf.WriteString("<style>line,circle,path{vector-effect:non-scaling-stroke}</style>\n")
+	fmt.Fprintf(&s.buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="#ffffff"/>`+"\n",
+		num(ext.Min[0]-margin), num(-ext.Max[1]-margin), num(w), num(h))
+
+	if len(s.blockOrder) > 0 {
+		s.buf.WriteString("<defs>\n")
+		for _, name := range s.blockOrder {
+			block := f.Blocks[name]
+			fmt.Fprintf(&s.buf, "<g id=\"%s\">\n", s.blockIDs[name])
+			for _, e := range block.Entities {
+				s.entity(e, true)
+			}
+			s.buf.WriteString("</g>\n")
+		}
+		s.buf.WriteString("</defs>\n")
+	}
+
+	// Y points up in drawings and down in SVG
+	s.buf.WriteString(`<g transform="scale(1,-1)" fill="none" stroke-width="1" stroke-linecap="round">` + "\n")
+	for _, layer := range f.Layers {
+		if layer.Frozen || layer.Off || layer.Entities == 0 {
+			continue
+		}
+		fmt.Fprintf(&s.buf, "<g data-layer=\"%s\"%s>\n", html.EscapeString(layer.Name), paint(aciColor(layer.Color)))
+		for _, e := range f.Entities {
+			if e.Layer == layer.Name && !e.PaperSpace {
+				s.entity(e, false)
+			}
+		}
+		s.buf.WriteString("</g>\n")
+	}
+	s.buf.WriteString("</g>\n</svg>\n")
+	return s.buf.Bytes()
+}
+
+type svgWriter struct {
+	file       *File
+	buf        bytes.Buffer
+	blockIDs   map[string]string
+	blockOrder []string
+}
+
+// collectBlocks finds the blocks the drawing uses, nested ones first so
+// each definition only references earlier ones
+func (s *svgWriter) collectBlocks(e Entity, depth int) {
+	block := s.file.reference(e)
+	if block == nil || depth >= maxBlockDepth {
+		return
+	}
+	if _, ok := s.blockIDs[block.Name]; ok {
+		return
+	}
+	// Reserve the name first so a block referencing itself stops here
+	s.blockIDs[block.Name] = ""
+	for _, inner := range block.Entities {
+		s.collectBlocks(inner, depth+1)
+	}
+	s.blockIDs[block.Name] = fmt.Sprintf("block%d", len(s.blockOrder))
+	s.blockOrder = append(s.blockOrder, block.Name)
+}
+
+// color is an entity's own color, or empty when it inherits one. Layer
+// groups set the layer color, so BYLAYER entities need none; inside
+// blocks, BYBLOCK entities and BYLAYER ones on layer 0 inherit from the
+// placing <use>.
+func (s *svgWriter) color(e Entity, inBlock bool) string {
+	switch {
+	case e.Color > 0 && e.Color < ColorByLayer:
+		return aciColor(e.Color)
+	case inBlock && e.Color == ColorByLayer && e.Layer != "0":
+		if l := s.file.layer(e.Layer); l != nil {
+			return aciColor(l.Color)
+		}
+	}
+	return ""
+}
+
+// paint sets both stroke and color, which text fills with
+func paint(color string) string {
+	if color == "" {
+		return ""
+	}
+	return fmt.Sprintf(` stroke="%s" color="%s"`, color, color)
+}
+
+func (s *svgWriter) entity(e Entity, inBlock bool) {
+	if inBlock {
+		if l := s.file.layer(e.Layer); l != nil && (l.Frozen || l.Off) {
+			return
+		}
+	}
+	color := s.color(e, inBlock)
+	stroke := paint(color)
+
+	if block := s.file.reference(e); block != nil {
+		id := s.blockIDs[block.Name]
+		if id == "" {
+			return
+		}
+		t := identity
+		if e.Type == "INSERT" {
+			t = placement(e, block.Base)
+		}
+		fmt.Fprintf(&s.buf, "<use xlink:href=\"#%s\" transform=\"matrix(%s %s %s %s %s %s)\"%s/>\n",
+			id, num(t[0]), num(t[1]), num(t[2]), num(t[3]), num(t[4]), num(t[5]), stroke)
+		return
+	}
+
+	switch e.Type {
+	case "LINE":
+		if len(e.Points) == 2 {
+			fmt.Fprintf(&s.buf, "<line x1=\"%s\" y1=\"%s\" x2=\"%s\" y2=\"%s\"%s/>\n",
+				num(e.Points[0][0]), num(e.Points[0][1]), num(e.Points[1][0]), num(e.Points[1][1]), stroke)
+		}
+	case "CIRCLE":
+		if len(e.Points) == 1 {
+			fmt.Fprintf(&s.buf, "<circle cx=\"%s\" cy=\"%s\" r=\"%s\"%s/>\n",
+				num(e.Points[0][0]), num(e.Points[0][1]), num(e.Radius), stroke)
+		}
+	case "ARC":
+		if len(e.Points) == 1 {
+			c, r := e.Points[0], e.Radius
+			arc := sweep(e.StartAngle, e.EndAngle, 360)
+			start := math.Mod(e.StartAngle, 360)
+			end := start + arc
+			if arc >= 360 {
+				// An SVG arc can't start and end at the same point
+				fmt.Fprintf(&s.buf, "<circle cx=\"%s\" cy=\"%s\" r=\"%s\"%s/>\n", num(c[0]), num(c[1]), num(r), stroke)
+				return
+			}
+			p0 := Point{c[0] + r*math.Cos(start*math.Pi/180), c[1] + r*math.Sin(start*math.Pi/180)}
+			p1 := Point{c[0] + r*math.Cos(end*math.Pi/180), c[1] + r*math.Sin(end*math.Pi/180)}
+			fmt.Fprintf(&s.buf, "<path d=\"M%s %s A%s %s 0 %d 1 %s %s\"%s/>\n",
+				num(p0[0]), num(p0[1]), num(r), num(r), flag(arc > 180), num(p1[0]), num(p1[1]), stroke)
+		}
+	case "LWPOLYLINE":
+		if len(e.Points) > 1 {
+			fmt.Fprintf(&s.buf, "<path d=\"%s\"%s/>\n", polylinePath(e), stroke)
+		}
+	case "ELLIPSE", "SPLINE":
+		for _, line := range e.Flatten() {
+			if len(line) > 1 {
+				fmt.Fprintf(&s.buf, "<path d=\"%s\"%s/>\n", pointsPath(line), stroke)
+			}
+		}
+	case "TEXT", "MTEXT":
+		s.text(e, color)
+	}
+}
+
+// text is drawn unflipped at the insertion point. TEXT's insertion point
+// is the baseline start; MTEXT's is the top left.
+func (s *svgWriter) text(e Entity, color string) {
+	if len(e.Points) == 0 || e.Text == "" || e.Height <= 0 {
+		return
+	}
+	if color != "" {
+		color = fmt.Sprintf(` color="%s"`, color)
+	}
+	at := e.Points[0]
+	fmt.Fprintf(&s.buf, "<text transform=\"translate(%s %s) scale(1 -1) rotate(%s)\" font-family=\"sans-serif\" font-size=\"%s\" stroke=\"none\" fill=\"currentColor\"%s>",
+		num(at[0]), num(at[1]), num(-e.Rotation), num(e.Height), color)
+	for i, line := range splitLines(e.Text) {
+		dy := e.Height * 1.4
+		if i == 0 {
+			dy = 0
+			if e.Type == "MTEXT" {
+				dy = e.Height
+			}
+		}
+		fmt.Fprintf(&s.buf, "<tspan x=\"0\" dy=\"%s\">%s</tspan>", num(dy), html.EscapeString(line))
+	}
+	s.buf.WriteString("</text>\n")
+}
+
+func polylinePath(e Entity) string {
+	var d strings.Builder
+	n := len(e.Points)
+	fmt.Fprintf(&d, "M%s %s", num(e.Points[0][0]), num(e.Points[0][1]))
+	segments := n - 1
+	if e.Closed {
+		segments = n
+	}
+	for i := 0; i < segments; i++ {
+		p0, p1 := e.Points[i], e.Points[(i+1)%n]
+		if i < len(e.Bulges) && e.Bulges[i] != 0 && p0 != p1 {
+			_, r, _, sweep := bulgeArc(p0, p1, e.Bulges[i])
+			fmt.Fprintf(&d, " A%s %s 0 %d %d %s %s", num(r), num(r), flag(math.Abs(sweep) > math.Pi), flag(sweep > 0), num(p1[0]), num(p1[1]))
+			continue
+		}
+		fmt.Fprintf(&d, " L%s %s", num(p1[0]), num(p1[1]))
+	}
+	if e.Closed {
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+func pointsPath(points []Point) string {
+	var d strings.Builder
+	for i, p := range points {
+		if i == 0 {
+			d.WriteByte('M')
+		} else {
+			d.WriteString(" L")
+		}
+		d.WriteString(num(p[0]))
+		d.WriteByte(' ')
+		d.WriteString(num(p[1]))
+	}
+	return d.String()
+}
+
+func (f *File) layer(name string) *Layer {
+	for i := range f.Layers {
+		if f.Layers[i].Name == name {
+			return &f.Layers[i]
+		}
+	}
+	return nil
+}
+
+func splitLines(text string) []string {
+	return strings.Split(text, "\n")
+}
+
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func num(x float64) string {
+	return strconv.FormatFloat(x, 'g', 9, 64)
+}
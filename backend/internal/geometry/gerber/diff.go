@@ -0,0 +1,154 @@
+package gerber
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// diffSize is the raster resolution, in pixels on the longer side, at
+// which drawn areas are compared
+const diffSize = 2048
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type CountChange struct {
+	Name  string `json:"name"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Delta int    `json:"delta"`
+}
+
+// ApertureChange is an aperture whose flash or draw count changed.
+// Apertures are matched by shape and size rather than D code or tool
+// number, which CAM tools renumber freely.
+type ApertureChange struct {
+	Aperture    string `json:"aperture"`
+	FlashesFrom int    `json:"flashes_from"`
+	FlashesTo   int    `json:"flashes_to"`
+	DrawsFrom   int    `json:"draws_from"`
+	DrawsTo     int    `json:"draws_to"`
+}
+
+type Diff struct {
+	// Format, function and unit changes
+	Changes []FieldChange `json:"changes"`
+	// Changes in the flash, draw, arc and region totals
+	Counts      []CountChange    `json:"counts"`
+	Apertures   []ApertureChange `json:"apertures"`
+	ExtentsFrom Extents          `json:"extents_from"`
+	ExtentsTo   Extents          `json:"extents_to"`
+
+	// Drawn areas in mm², measured on a common grid with cells of
+	// Resolution mm, and the areas only one version covers
+	AreaFrom    float64 `json:"area_from"`
+	AreaTo      float64 `json:"area_to"`
+	AddedArea   float64 `json:"added_area"`
+	RemovedArea float64 `json:"removed_area"`
+	Resolution  float64 `json:"resolution"`
+}
+
+// Compare reports how the "to" layer differs from the "from" layer: its
+// counts per aperture and in total, and what it draws, pixel by pixel
+func Compare(from, to *File) *Diff {
+	d := &Diff{
+		Changes:     []FieldChange{},
+		Counts:      []CountChange{},
+		Apertures:   []ApertureChange{},
+		ExtentsFrom: from.Extents,
+		ExtentsTo:   to.Extents,
+	}
+
+	field := func(name, a, b string) {
+		if a != b {
+			d.Changes = append(d.Changes, FieldChange{Field: name, From: a, To: b})
+		}
+	}
+	field("format", from.Format, to.Format)
+	field("function", from.Function, to.Function)
+	field("units", from.Units, to.Units)
+
+	count := func(name string, a, b int) {
+		if a != b {
+			d.Counts = append(d.Counts, CountChange{Name: name, From: a, To: b, Delta: b - a})
+		}
+	}
+	count("flashes", from.Counts.Flashes, to.Counts.Flashes)
+	count("draws", from.Counts.Draws, to.Counts.Draws)
+	count("arcs", from.Counts.Arcs, to.Counts.Arcs)
+	count("regions", from.Counts.Regions, to.Counts.Regions)
+
+	before, after := apertureUse(from), apertureUse(to)
+	for name, b := range before {
+		a := after[name]
+		if a != b {
+			d.Apertures = append(d.Apertures, ApertureChange{
+				Aperture: name, FlashesFrom: b[0], FlashesTo: a[0], DrawsFrom: b[1], DrawsTo: a[1],
+			})
+		}
+	}
+	for name, a := range after {
+		if _, ok := before[name]; !ok {
+			d.Apertures = append(d.Apertures, ApertureChange{Aperture: name, FlashesTo: a[0], DrawsTo: a[1]})
+		}
+	}
+	sort.Slice(d.Apertures, func(i, j int) bool { return d.Apertures[i].Aperture < d.Apertures[j].Aperture })
+
+	v := newView(union(from.Extents, to.Extents), diffSize)
+	a, b := from.samples(v), to.samples(v)
+	cell := 1 / (v.scale * v.scale)
+	for i := range a {
+		switch {
+		case a[i] && b[i]:
+			d.AreaFrom += cell
+			d.AreaTo += cell
+		case a[i]:
+			d.AreaFrom += cell
+			d.RemovedArea += cell
+		case b[i]:
+			d.AreaTo += cell
+			d.AddedArea += cell
+		}
+	}
+	d.Resolution = 1 / v.scale
+	return d
+}
+
+// apertureUse totals flashes and draws per aperture description, unused
+// apertures left out
+func apertureUse(f *File) map[string][2]int {
+	out := make(map[string][2]int)
+	for _, a := range f.Apertures {
+		if a.Flashes == 0 && a.Draws == 0 {
+			continue
+		}
+		name := a.Describe()
+		use := out[name]
+		out[name] = [2]int{use[0] + a.Flashes, use[1] + a.Draws}
+	}
+	return out
+}
+
+// Describe names an aperture by shape and size in millimeters, e.g.
+// "circle 0.8" or "rectangle 1.5x0.6"; macros by name and modifiers
+func (a Aperture) Describe() string {
+	params := make([]string, len(a.Params))
+	for i, p := range a.Params {
+		params[i] = strconv.FormatFloat(p, 'f', -1, 64)
+		if a.Shape != ShapeMacro {
+			params[i] = num(p)
+		}
+	}
+	if a.Shape == ShapeMacro {
+		return fmt.Sprintf("%s(%s)", a.Macro, strings.Join(params, ","))
+	}
+	if len(params) == 0 {
+		return a.Shape
+	}
+	return a.Shape + " " + strings.Join(params, "x")
+}
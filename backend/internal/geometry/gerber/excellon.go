@@ -0,0 +1,283 @@
+package gerber
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+)
+
+// excellonParser reads NC drill files: tools defined in the M48 header,
+// then hits, G85 slots and routed paths. Hits become flashes and slots and
+// routes draws, with the tool as a round aperture.
+type excellonParser struct {
+	f    *File
+	unit string
+	// Coordinates without a decimal point have whole and decimal digits;
+	// keepLeading means leading zeros are written and trailing ones left
+	// out (the LZ option)
+	whole, decimals int
+	keepLeading     bool
+	tools           map[int]int
+	current         int
+	at              Point
+
+	routing  bool
+	toolDown bool
+}
+
+func parseExcellon(data []byte) (*File, error) {
+	p := &excellonParser{
+		f:       &File{Format: FormatExcellon, Apertures: []Aperture{}},
+		unit:    units.Inch,
+		tools:   make(map[int]int),
+		current: -1,
+	}
+
+	recognized, header := false, false
+lines:
+	for _, raw := range bytes.Split(data, []byte("\n")) {
+		line := strings.TrimSpace(string(raw))
+		if line == "" {
+			continue
+		}
+		if line[0] == ';' {
+			p.comment(strings.TrimSpace(line[1:]))
+			continue
+		}
+
+		switch {
+		case line == "M48":
+			recognized, header = true, true
+		case line == "%" || line == "M95":
+			header = false
+		case line == "M30" || line == "M00":
+			break lines
+		case strings.HasPrefix(line, "METRIC"):
+			p.setUnits(units.Millimeter, line[len("METRIC"):])
+		case strings.HasPrefix(line, "INCH"):
+			p.setUnits(units.Inch, line[len("INCH"):])
+		case line == "M71":
+			p.unit = units.Millimeter
+		case line == "M72":
+			p.unit = units.Inch
+		case strings.HasPrefix(line, "T"):
+			if err := p.tool(line, header); err != nil {
+				return nil, err
+			}
+			recognized = true
+		case line == "M15":
+			p.toolDown = true
+		case line == "M16" || line == "M17":
+			p.toolDown = false
+		case strings.HasPrefix(line, "G00"):
+			p.routing, p.toolDown = true, false
+			if err := p.move(line[3:], false); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "G01"):
+			p.routing = true
+			if err := p.move(line[3:], p.toolDown); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(line, "G02") || strings.HasPrefix(line, "G03"):
+			p.f.warn("routed arcs are drawn as straight lines")
+			p.routing = true
+			end, _, _ := strings.Cut(line[3:], "A")
+			end, _, _ = strings.Cut(end, "I")
+			if err := p.move(end, p.toolDown); err != nil {
+				return nil, err
+			}
+		case line == "G05" || line == "G81":
+			p.routing = false
+		case strings.Contains(line, "G85"):
+			if err := p.slot(line); err != nil {
+				return nil, err
+			}
+		case line[0] == 'X' || line[0] == 'Y':
+			if p.routing {
+				if err := p.move(line, p.toolDown); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			at, err := p.coordinates(line)
+			if err != nil {
+				return nil, err
+			}
+			p.at = at
+			p.f.add(Primitive{Kind: KindFlash, Aperture: p.current, Points: []Point{at}})
+		}
+		// Everything else (feeds, speeds, FMAT, VER, G90, ...) doesn't
+		// change what is drilled
+	}
+
+	if !recognized {
+		return nil, ErrNotGerber
+	}
+	p.f.Units = p.unit
+	return p.f, nil
+}
+
+// comment picks up the number format and X2-style attributes that drill
+// writers put in comments
+func (p *excellonParser) comment(text string) {
+	if spec, ok := strings.CutPrefix(text, "FILE_FORMAT="); ok {
+		whole, decimals, _ := strings.Cut(spec, ":")
+		p.whole, _ = strconv.Atoi(strings.TrimSpace(whole))
+		p.decimals, _ = strconv.Atoi(strings.TrimSpace(decimals))
+		return
+	}
+	text = strings.TrimSpace(strings.TrimPrefix(text, "#@!"))
+	if function, ok := strings.CutPrefix(text, "TF.FileFunction,"); ok {
+		p.f.Function = function
+	}
+}
+
+// setUnits reads the options after METRIC or INCH, e.g. ",LZ" or ",TZ,000.000"
+func (p *excellonParser) setUnits(unit, options string) {
+	p.unit = unit
+	for _, opt := range strings.Split(options, ",") {
+		switch opt = strings.TrimSpace(opt); {
+		case opt == "LZ":
+			p.keepLeading = true
+		case opt == "TZ":
+			p.keepLeading = false
+		case strings.Contains(opt, "."):
+			whole, decimals, _ := strings.Cut(opt, ".")
+			p.whole, p.decimals = len(whole), len(decimals)
+		}
+	}
+}
+
+// tool defines (T01C0.8) or selects (T01) a tool; T0 unloads. Definitions
+// in the body also select the tool.
+func (p *excellonParser) tool(line string, header bool) error {
+	end := 1
+	for end < len(line) && line[end] >= '0' && line[end] <= '9' {
+		end++
+	}
+	if end == 1 {
+		return nil
+	}
+	n, err := strconv.Atoi(line[1:end])
+	if err != nil {
+		return fmt.Errorf("invalid tool %q", line)
+	}
+	if n == 0 {
+		p.current = -1
+		return nil
+	}
+
+	diameter := -1.0
+	for _, w := range splitWords(line[end:]) {
+		if w[0] == 'C' {
+			if diameter, err = strconv.ParseFloat(w[1:], 64); err != nil {
+				return fmt.Errorf("invalid tool diameter %q", line)
+			}
+		}
+	}
+
+	i, ok := p.tools[n]
+	if !ok {
+		i = len(p.f.Apertures)
+		p.tools[n] = i
+		p.f.Apertures = append(p.f.Apertures, Aperture{Code: fmt.Sprintf("T%02d", n), Shape: ShapeCircle, Params: []float64{0}})
+	}
+	if diameter >= 0 {
+		a := &p.f.Apertures[i]
+		a.Params = []float64{diameter * millimeters(p.unit)}
+		// Only polygons can be rejected
+		a.shapes, _ = standardShapes(ShapeCircle, a.Params)
+		if header {
+			return nil
+		}
+	} else if len(p.f.Apertures[i].shapes) == 0 {
+		p.f.warn(fmt.Sprintf("tool %s is used but not defined", p.f.Apertures[i].Code))
+	}
+	p.current = i
+	return nil
+}
+
+// move goes to a position, routing a slot on the way when the tool is down
+func (p *excellonParser) move(coords string, cutting bool) error {
+	to, err := p.coordinates(coords)
+	if err != nil {
+		return err
+	}
+	if cutting && to != p.at {
+		p.f.add(Primitive{Kind: KindDraw, Aperture: p.current, Points: []Point{p.at, to}})
+	}
+	p.at = to
+	return nil
+}
+
+// slot reads a canned G85 slot, e.g. X1.0Y2.0G85X3.0Y2.0
+func (p *excellonParser) slot(line string) error {
+	start, end, _ := strings.Cut(line, "G85")
+	from, err := p.coordinates(start)
+	if err != nil {
+		return err
+	}
+	p.at = from
+	to, err := p.coordinates(end)
+	if err != nil {
+		return err
+	}
+	p.at = to
+	p.f.add(Primitive{Kind: KindDraw, Aperture: p.current, Points: []Point{from, to}})
+	return nil
+}
+
+// coordinates reads X and Y, keeping the current value of an axis that's
+// left out
+func (p *excellonParser) coordinates(s string) (Point, error) {
+	out := p.at
+	for _, w := range splitWords(s) {
+		axis := strings.IndexByte("XY", w[0])
+		if axis < 0 {
+			continue
+		}
+		v, err := p.number(w[1:])
+		if err != nil {
+			return out, err
+		}
+		out[axis] = v * millimeters(p.unit)
+	}
+	return out, nil
+}
+
+func (p *excellonParser) number(s string) (float64, error) {
+	if strings.ContainsRune(s, '.') {
+		return strconv.ParseFloat(s, 64)
+	}
+	whole, decimals := p.whole, p.decimals
+	if whole == 0 && decimals == 0 {
+		// The common defaults: 2.4 for inches and 3.3 for millimeters
+		whole, decimals = 2, 4
+		if p.unit == units.Millimeter {
+			whole, decimals = 3, 3
+		}
+	}
+
+	sign := 1.0
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	if p.keepLeading {
+		for len(s) < whole+decimals {
+			s += "0"
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid drill coordinate %q", s)
+	}
+	return sign * float64(n) / math.Pow10(decimals), nil
+}
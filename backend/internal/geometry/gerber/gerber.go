@@ -0,0 +1,246 @@
+// Package gerber reads PCB fabrication files: RS-274X (extended Gerber)
+// layers and Excellon drill files. Both are reduced to the same ordered list
+// of flashes, draws, arcs and regions in millimeters, with per-aperture
+// counts, so a layer can be rendered to SVG or PNG and two versions compared.
+package gerber
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+)
+
+var ErrNotGerber = errors.New("file is not a Gerber or Excellon file")
+
+const (
+	FormatGerber   = "gerber"
+	FormatExcellon = "excellon"
+)
+
+// Primitive kinds
+const (
+	KindFlash  = "flash"
+	KindDraw   = "draw"
+	KindArc    = "arc"
+	KindRegion = "region"
+)
+
+// Aperture shapes; apertures defined by a macro have ShapeMacro
+const (
+	ShapeCircle    = "circle"
+	ShapeRectangle = "rectangle"
+	ShapeObround   = "obround"
+	ShapePolygon   = "polygon"
+	ShapeMacro     = "macro"
+)
+
+// Point is a board coordinate in millimeters
+type Point [2]float64
+
+// Aperture is a Gerber aperture or an Excellon tool
+type Aperture struct {
+	// Code is the D code, e.g. "D10", or the tool, e.g. "T01"
+	Code  string `json:"code"`
+	Shape string `json:"shape"`
+	Macro string `json:"macro,omitempty"`
+	// Params are the standard template's modifiers with lengths in
+	// millimeters: circle diameter; rectangle and obround width and height;
+	// polygon diameter, vertices and rotation; each optionally followed by
+	// a hole diameter. Macro modifiers are kept as written.
+	Params  []float64 `json:"params"`
+	Flashes int       `json:"flashes"`
+	// Draws counts straight and arc strokes, and Excellon slots
+	Draws int `json:"draws"`
+
+	shapes []shape
+}
+
+// Primitive is one graphics object, in file order
+type Primitive struct {
+	Kind string `json:"kind"`
+	// Aperture indexes File.Apertures; regions have none and use -1
+	Aperture int `json:"aperture"`
+	// Points are a flash's position, a draw's or arc's start and end, or a
+	// region's contour with arcs flattened
+	Points    []Point `json:"points"`
+	Center    Point   `json:"center,omitzero"`
+	Clockwise bool    `json:"clockwise,omitempty"`
+	// Clear primitives erase what was drawn before them (LPC polarity)
+	Clear bool `json:"clear,omitempty"`
+}
+
+type Counts struct {
+	Flashes int `json:"flashes"`
+	Draws   int `json:"draws"`
+	Arcs    int `json:"arcs"`
+	Regions int `json:"regions"`
+}
+
+// Extents bound everything drawn, including aperture sizes. Empty files
+// have zero extents.
+type Extents struct {
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+}
+
+func (e Extents) Width() float64  { return e.Max[0] - e.Min[0] }
+func (e Extents) Height() float64 { return e.Max[1] - e.Min[1] }
+
+type File struct {
+	Format string `json:"format"`
+	// Function is the layer's role, from its .FileFunction attribute when
+	// present or else guessed from the file extension, e.g. "Copper,Top",
+	// "Soldermask,Bot", "Profile" or "Drill"
+	Function string `json:"function,omitempty"`
+	// Units is the unit the file was written in; everything here has been
+	// converted to millimeters
+	Units     string     `json:"units"`
+	Apertures []Aperture `json:"apertures"`
+	Counts    Counts     `json:"counts"`
+	Extents   Extents    `json:"extents"`
+	// Warnings list features that were read but not rendered exactly
+	Warnings []string `json:"warnings,omitempty"`
+
+	Primitives []Primitive `json:"-"`
+}
+
+// Layer names of the common Protel-style extensions
+var extensionFunctions = map[string]string{
+	".gtl": "Copper,Top",
+	".gbl": "Copper,Bot",
+	".gts": "Soldermask,Top",
+	".gbs": "Soldermask,Bot",
+	".gto": "Legend,Top",
+	".gbo": "Legend,Bot",
+	".gtp": "Paste,Top",
+	".gbp": "Paste,Bot",
+	".gko": "Profile",
+	".gml": "Profile",
+	".gm1": "Profile",
+	".gbr": "",
+	".ger": "",
+	".pho": "",
+	".art": "",
+}
+
+var drillExtensions = map[string]bool{
+	".drl": true,
+	".xln": true,
+	".exc": true,
+	".drd": true,
+}
+
+// IsGerber reports whether a file is a Gerber layer or Excellon drill file
+// by its extension, including inner copper layers .g1 to .g99
+func IsGerber(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	if _, ok := extensionFunctions[ext]; ok {
+		return true
+	}
+	return drillExtensions[ext] || innerLayer(ext)
+}
+
+func innerLayer(ext string) bool {
+	digits := strings.TrimPrefix(ext, ".g")
+	if digits == ext || digits == "" || len(digits) > 2 {
+		return false
+	}
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// functionFromName guesses a layer's function from its extension
+func functionFromName(filename string) string {
+	ext := strings.ToLower(filepath.Ext(filename))
+	switch {
+	case drillExtensions[ext]:
+		return "Drill"
+	case innerLayer(ext):
+		return "Copper,Inr"
+	}
+	return extensionFunctions[ext]
+}
+
+// ParseBytes reads either format, telling them apart by content. The
+// filename names the layer's function when the file doesn't.
+func ParseBytes(filename string, data []byte) (*File, error) {
+	var f *File
+	var err error
+	if isExcellon(data) {
+		f, err = parseExcellon(data)
+	} else {
+		f, err = parseRS274X(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Function == "" {
+		f.Function = functionFromName(filename)
+	}
+	f.Extents = f.extents()
+	return f, nil
+}
+
+// isExcellon looks for the M48 header after any leading comments, or a
+// drill file's tool selections and end-of-program code without any Gerber
+// parameter blocks
+func isExcellon(data []byte) bool {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == ';' {
+			continue
+		}
+		if bytes.HasPrefix(line, []byte("M48")) {
+			return true
+		}
+		break
+	}
+	return !bytes.Contains(data, []byte("%FS")) && !bytes.Contains(data, []byte("%MO")) &&
+		bytes.Contains(data, []byte("M30")) && bytes.Contains(data, []byte("T0"))
+}
+
+// millimeters converts file units; only inch and millimeter occur
+func millimeters(unit string) float64 {
+	if unit == units.Inch {
+		return 25.4
+	}
+	return 1
+}
+
+func (f *File) warn(msg string) {
+	for _, w := range f.Warnings {
+		if w == msg {
+			return
+		}
+	}
+	f.Warnings = append(f.Warnings, msg)
+}
+
+// add appends a primitive, counting it against its aperture and the totals
+func (f *File) add(p Primitive) {
+	f.Primitives = append(f.Primitives, p)
+	switch p.Kind {
+	case KindFlash:
+		f.Counts.Flashes++
+	case KindDraw:
+		f.Counts.Draws++
+	case KindArc:
+		f.Counts.Arcs++
+	case KindRegion:
+		f.Counts.Regions++
+	}
+	if p.Aperture >= 0 && p.Aperture < len(f.Apertures) {
+		if p.Kind == KindFlash {
+			f.Apertures[p.Aperture].Flashes++
+		} else {
+			f.Apertures[p.Aperture].Draws++
+		}
+	}
+}
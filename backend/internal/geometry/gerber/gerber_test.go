@@ -0,0 +1,170 @@
+package gerber
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// layer wraps commands in a millimeter RS-274X header with one 0.1 mm
+// round aperture selected
+func layer(body string) []byte {
+	return []byte("%FSLAX26Y26*%\n%MOMM*%\n%ADD10C,0.1*%\nD10*\n" + body + "M02*\n")
+}
+
+func parse(t *testing.T, data []byte) *File {
+	t.Helper()
+	f, err := ParseBytes("top.gtl", data)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	return f
+}
+
+func assertNear(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-6 {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestParseRS274X(t *testing.T) {
+	f := parse(t, layer("X0Y0D02*\nX2000000Y0D01*\nX1000000Y1000000D03*\n"))
+	if f.Format != FormatGerber || f.Function != "Copper,Top" {
+		t.Errorf("format %q function %q, want gerber Copper,Top", f.Format, f.Function)
+	}
+	if f.Counts.Draws != 1 || f.Counts.Flashes != 1 {
+		t.Errorf("counts = %+v, want 1 draw and 1 flash", f.Counts)
+	}
+	assertNear(t, "width", f.Extents.Width(), 2.1)
+	assertNear(t, "height", f.Extents.Height(), 1.1)
+}
+
+func TestParseStepRepeat(t *testing.T) {
+	f := parse(t, layer("%SRX3Y2I5.0J4.0*%\nX0Y0D03*\n%SR*%\n"))
+	if f.Counts.Flashes != 6 {
+		t.Errorf("flashes = %d, want 6", f.Counts.Flashes)
+	}
+	assertNear(t, "width", f.Extents.Width(), 10.1)
+	assertNear(t, "height", f.Extents.Height(), 4.1)
+}
+
+func TestParseStepRepeatTooLarge(t *testing.T) {
+	for _, spec := range []string{
+		"X100000Y100000I1J1",
+		"X3000Y3000I1J1",
+		"X1e300Y1I1J1",
+		"X-5Y2I1J1",
+		"XNaNY2I1J1",
+	} {
+		if _, err := ParseBytes("top.gtl", layer("%SR"+spec+"*%\nX0Y0D03*\n%SR*%\n")); err == nil {
+			t.Errorf("step and repeat %s parsed, want an error", spec)
+		}
+	}
+}
+
+func TestParsePolygonVertices(t *testing.T) {
+	f := parse(t, layer("%ADD11P,1X6*%\n%ADD12P,1X100000000000*%\n%ADD13P,1X2*%\n"))
+	if got := len(f.Apertures[1].shapes); got != 1 {
+		t.Errorf("hexagon has %d shapes, want 1", got)
+	}
+	for _, a := range f.Apertures[2:] {
+		if len(a.shapes) != 0 {
+			t.Errorf("aperture %s has an outline, want none", a.Code)
+		}
+	}
+	if len(f.Warnings) != 2 {
+		t.Errorf("warnings = %q, want one per bad polygon", f.Warnings)
+	}
+}
+
+func TestParseMacroPolygonVertices(t *testing.T) {
+	f := parse(t, layer("%AMBIG*5,1,$1,0,0,1,0*%\n%ADD11BIG,8*%\n%ADD12BIG,1000000000*%\n"))
+	if got := len(f.Apertures[1].shapes); got != 1 {
+		t.Errorf("octagon has %d shapes, want 1", got)
+	}
+	if got := len(f.Apertures[2].shapes); got != 0 {
+		t.Errorf("billion-sided polygon has %d shapes, want none", got)
+	}
+	if len(f.Warnings) != 1 {
+		t.Errorf("warnings = %q, want one", f.Warnings)
+	}
+}
+
+func TestParseExcellon(t *testing.T) {
+	data := []byte("M48\nMETRIC,TZ\nT1C0.8\nT2C3.0\n%\nT1\nX1.0Y1.0\nX3.0Y1.0\nT2\nX2.0Y5.0\nG85X4.0Y5.0\nM30\n")
+	f, err := ParseBytes("board.drl", data)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if f.Format != FormatExcellon || f.Function != "Drill" {
+		t.Errorf("format %q function %q, want excellon Drill", f.Format, f.Function)
+	}
+	if len(f.Apertures) != 2 {
+		t.Fatalf("apertures = %d, want 2", len(f.Apertures))
+	}
+	assertNear(t, "T1 diameter", f.Apertures[0].Params[0], 0.8)
+	if f.Apertures[0].Flashes != 2 || f.Apertures[1].Flashes != 1 || f.Apertures[1].Draws != 1 {
+		t.Errorf("T1 %d flashes, T2 %d flashes and %d draws, want 2, 1 and 1",
+			f.Apertures[0].Flashes, f.Apertures[1].Flashes, f.Apertures[1].Draws)
+	}
+}
+
+func TestParseExcellonInches(t *testing.T) {
+	data := []byte("M48\nINCH,LZ\nT1C0.0100\n%\nT1\nX01000Y02000\nM30\n")
+	f, err := ParseBytes("board.drl", data)
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if len(f.Primitives) != 1 {
+		t.Fatalf("primitives = %d, want 1", len(f.Primitives))
+	}
+	at := f.Primitives[0].Points[0]
+	assertNear(t, "x", at[0], 25.4)
+	assertNear(t, "y", at[1], 50.8)
+}
+
+func TestEvaluate(t *testing.T) {
+	vars := map[int]float64{1: 2, 2: 0.5}
+	for _, c := range []struct {
+		expr string
+		want float64
+	}{
+		{"1.5", 1.5},
+		{"$1", 2},
+		{"$3", 0},
+		{"1+2x3", 7},
+		{"(1+2)x3", 9},
+		{"$1/$2-1", 3},
+		{"-$1", -2},
+		{"--1", 1},
+		{"1 + 2 X 3", 7},
+	} {
+		got, err := evaluate(c.expr, vars)
+		if err != nil {
+			t.Errorf("evaluate(%q): %v", c.expr, err)
+			continue
+		}
+		assertNear(t, fmt.Sprintf("evaluate(%q)", c.expr), got, c.want)
+	}
+}
+
+func TestEvaluateInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"1+",
+		"(1+2",
+		"1)",
+		"$",
+		"1/0",
+		"1/($1-2)",
+		"2y3",
+		strings.Repeat("(", 100000) + "1" + strings.Repeat(")", 100000),
+		strings.Repeat("-", 100000) + "1",
+	} {
+		if _, err := evaluate(expr, map[int]float64{1: 2}); err == nil {
+			t.Errorf("evaluate(%.20q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package gerber
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// macro is an aperture macro (%AM): its statements are evaluated with the
+// modifiers of each aperture that uses it
+type macro struct {
+	name       string
+	statements []string
+}
+
+// Macro primitive codes
+const (
+	macroComment    = 0
+	macroCircle     = 1
+	macroVectorLine = 20
+	macroCenterLine = 21
+	macroOutline    = 4
+	macroPolygon    = 5
+	macroMoire      = 6
+	macroThermal    = 7
+)
+
+// shapes evaluates the macro into outlines in millimeters; scale converts
+// the file's unit. Primitives that can't be read are skipped and reported.
+func (m *macro) shapes(args []float64, scale float64) ([]shape, error) {
+	vars := make(map[int]float64, len(args))
+	for i, v := range args {
+		vars[i+1] = v
+	}
+
+	var out []shape
+	for _, statement := range m.statements {
+		statement = strings.TrimSpace(statement)
+		if statement == "" {
+			continue
+		}
+
+		if strings.HasPrefix(statement, "$") {
+			name, expr, ok := strings.Cut(statement[1:], "=")
+			n, err := strconv.Atoi(name)
+			if !ok || err != nil {
+				return out, fmt.Errorf("invalid macro variable %q", statement)
+			}
+			v, err := evaluate(expr, vars)
+			if err != nil {
+				return out, err
+			}
+			vars[n] = v
+			continue
+		}
+
+		fields := strings.Split(statement, ",")
+		code, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return out, fmt.Errorf("invalid macro primitive %q", statement)
+		}
+		if code == macroComment {
+			continue
+		}
+		mods := make([]float64, len(fields)-1)
+		for i, field := range fields[1:] {
+			if mods[i], err = evaluate(field, vars); err != nil {
+				return out, err
+			}
+		}
+
+		s, err := macroPrimitive(code, mods, scale)
+		if err != nil {
+			return out, err
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+func macroPrimitive(code int, mods []float64, scale float64) (shape, error) {
+	mod := func(i int) float64 {
+		if i < len(mods) {
+			return mods[i]
+		}
+		return 0
+	}
+	length := func(i int) float64 { return mod(i) * scale }
+	point := func(i int) Point { return Point{length(i), length(i + 1)} }
+
+	var ring []Point
+	var rings [][]Point
+	var rotation float64
+	// Exposure 0 is off; 1 and the deprecated 2 draw
+	clear := mod(0) == 0
+
+	switch code {
+	case macroCircle:
+		ring = circle(point(2), length(1)/2)
+		rotation = mod(4)
+	case macroVectorLine:
+		from, to := point(2), point(4)
+		half := length(1) / 2
+		dx, dy := to[0]-from[0], to[1]-from[1]
+		d := math.Hypot(dx, dy)
+		if d == 0 {
+			return shape{}, fmt.Errorf("zero-length vector line in macro")
+		}
+		nx, ny := -dy/d*half, dx/d*half
+		ring = []Point{
+			{from[0] + nx, from[1] + ny},
+			{from[0] - nx, from[1] - ny},
+			{to[0] - nx, to[1] - ny},
+			{to[0] + nx, to[1] + ny},
+		}
+		rotation = mod(6)
+	case macroCenterLine:
+		ring = rectangle(point(3), length(1), length(2))
+		rotation = mod(5)
+	case macroOutline:
+		n := int(mod(1))
+		if n < 1 || len(mods) < 2+2*(n+1) {
+			return shape{}, fmt.Errorf("outline macro primitive has %d modifiers for %d points", len(mods), n)
+		}
+		// The last point repeats the first
+		for i := 0; i < n; i++ {
+			ring = append(ring, point(2+2*i))
+		}
+		rotation = mod(2 + 2*(n+1))
+	case macroPolygon:
+		vertices := mod(1)
+		if !(vertices >= minPolygonVertices && vertices <= maxPolygonVertices) {
+			return shape{}, fmt.Errorf("polygon macro primitive has %v vertices, want %d to %d", vertices, minPolygonVertices, maxPolygonVertices)
+		}
+		ring = regularPolygon(point(2), length(4), int(vertices), 0)
+		rotation = mod(5)
+	case macroMoire:
+		// Deprecated; drawn as its outer circle
+		clear = false
+		ring = circle(point(0), length(2)/2)
+		rotation = mod(8)
+	case macroThermal:
+		clear = false
+		rings = thermal(point(0), length(2)/2, length(3)/2, length(4)/2)
+		rotation = mod(5)
+	default:
+		return shape{}, fmt.Errorf("unsupported macro primitive %d", code)
+	}
+
+	if ring != nil {
+		rings = [][]Point{ring}
+	}
+	if rotation != 0 {
+		// Primitives rotate about the macro's origin, not their own center
+		sin, cos := math.Sincos(rotation * math.Pi / 180)
+		for _, r := range rings {
+			for i, p := range r {
+				r[i] = Point{p[0]*cos - p[1]*sin, p[0]*sin + p[1]*cos}
+			}
+		}
+	}
+	// Thermal quarters don't overlap, so one even-odd shape holds them all
+	return shape{rings: rings, clear: clear}, nil
+}
+
+// thermal is an annulus cut into four pieces by a cross of the given half
+// gap, one ring per quarter. Each piece's ends are straight because both
+// end points lie on the gap's edge.
+func thermal(c Point, outer, inner, gap float64) [][]Point {
+	if outer <= gap || outer <= inner {
+		return nil
+	}
+	outerStart := math.Asin(gap / outer)
+	innerStart := 0.0
+	if inner > gap {
+		innerStart = math.Asin(gap / inner)
+	}
+
+	steps := circleSegments / 4
+	var out [][]Point
+	for q := range 4 {
+		base := float64(q) * math.Pi / 2
+		var ring []Point
+		for i := 0; i <= steps; i++ {
+			a := base + outerStart + (math.Pi/2-2*outerStart)*float64(i)/float64(steps)
+			ring = append(ring, Point{c[0] + outer*math.Cos(a), c[1] + outer*math.Sin(a)})
+		}
+		if inner > gap {
+			for i := steps; i >= 0; i-- {
+				a := base + innerStart + (math.Pi/2-2*innerStart)*float64(i)/float64(steps)
+				ring = append(ring, Point{c[0] + inner*math.Cos(a), c[1] + inner*math.Sin(a)})
+			}
+		} else {
+			// The gap swallows the inner circle; the piece's corner sits
+			// where the gap's edges meet
+			sin, cos := math.Sincos(base)
+			ring = append(ring, Point{c[0] + gap*(cos-sin), c[1] + gap*(sin+cos)})
+		}
+		out = append(out, ring)
+	}
+	return out
+}
+
+// evaluate computes a macro arithmetic expression: numbers, $n variables,
+// unary signs, + - x / and parentheses, where x multiplies
+func evaluate(expr string, vars map[int]float64) (float64, error) {
+	p := &exprParser{s: strings.ReplaceAll(strings.TrimSpace(expr), " ", ""), vars: vars}
+	v, err := p.sum()
+	if err != nil {
+		return 0, err
+	}
+	if p.pos != len(p.s) {
+		return 0, fmt.Errorf("invalid macro expression %q", expr)
+	}
+	return v, nil
+}
+
+// Nesting deeper than this, in parentheses or unary signs, is rejected
+// rather than recursed into
+const maxExprDepth = 64
+
+type exprParser struct {
+	s     string
+	pos   int
+	vars  map[int]float64
+	depth int
+}
+
+func (p *exprParser) peek() byte {
+	if p.pos < len(p.s) {
+		return p.s[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) sum() (float64, error) {
+	v, err := p.product()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case '+':
+			p.pos++
+			w, err := p.product()
+			if err != nil {
+				return 0, err
+			}
+			v += w
+		case '-':
+			p.pos++
+			w, err := p.product()
+			if err != nil {
+				return 0, err
+			}
+			v -= w
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *exprParser) product() (float64, error) {
+	v, err := p.factor()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.peek() {
+		case 'x', 'X':
+			p.pos++
+			w, err := p.factor()
+			if err != nil {
+				return 0, err
+			}
+			v *= w
+		case '/':
+			p.pos++
+			w, err := p.factor()
+			if err != nil {
+				return 0, err
+			}
+			if w == 0 {
+				return 0, fmt.Errorf("division by zero in macro expression %q", p.s)
+			}
+			v /= w
+		default:
+			return v, nil
+		}
+	}
+}
+
+func (p *exprParser) factor() (float64, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxExprDepth {
+		return 0, fmt.Errorf("macro expression %q is nested too deeply", p.s)
+	}
+
+	switch c := p.peek(); {
+	case c == '+':
+		p.pos++
+		return p.factor()
+	case c == '-':
+		p.pos++
+		v, err := p.factor()
+		return -v, err
+	case c == '(':
+		p.pos++
+		v, err := p.sum()
+		if err != nil {
+			return 0, err
+		}
+		if p.peek() != ')' {
+			return 0, fmt.Errorf("unbalanced parentheses in macro expression %q", p.s)
+		}
+		p.pos++
+		return v, nil
+	case c == '$':
+		p.pos++
+		start := p.pos
+		for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		n, err := strconv.Atoi(p.s[start:p.pos])
+		if err != nil {
+			return 0, fmt.Errorf("invalid macro variable in %q", p.s)
+		}
+		// Undefined variables are zero
+		return p.vars[n], nil
+	default:
+		start := p.pos
+		for p.pos < len(p.s) && (p.s[p.pos] == '.' || (p.s[p.pos] >= '0' && p.s[p.pos] <= '9')) {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.s[start:p.pos], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number in macro expression %q", p.s)
+		}
+		return v, nil
+	}
+}
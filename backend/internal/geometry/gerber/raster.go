@@ -0,0 +1,174 @@
+package gerber
+
+import (
+	"image"
+	"math"
+	"sort"
+	"strconv"
+)
+
+const (
+	DefaultPNGSize = 1024
+	MaxPNGSize     = 4096
+
+	// Each output pixel averages supersample² samples to smooth edges
+	supersample = 2
+	// Unchanged areas in a PNG overlay
+	unchangedColor = "#9ca3af"
+)
+
+// view maps board millimeters onto a pixel grid. Rasterizing two versions
+// with the same view lines them up pixel for pixel.
+type view struct {
+	left, top float64
+	// scale is samples per millimeter
+	scale         float64
+	width, height int
+}
+
+// newView fits the extents, plus a margin, into size pixels on the longer
+// side
+func newView(ext Extents, size int) view {
+	w, h := ext.Width(), ext.Height()
+	side := math.Max(w, h)
+	if side == 0 {
+		side = 1
+	}
+	margin := side * svgMargin
+	w, h = w+2*margin, h+2*margin
+	scale := float64(size) / math.Max(w, h)
+	return view{
+		left:   ext.Min[0] - margin,
+		top:    ext.Max[1] + margin,
+		scale:  scale * supersample,
+		width:  max(int(math.Ceil(w*scale)), 1),
+		height: max(int(math.Ceil(h*scale)), 1),
+	}
+}
+
+// samples rasterizes the layer in file order: dark objects set samples and
+// clear objects reset them
+func (f *File) samples(v view) []bool {
+	sw, sh := v.width*supersample, v.height*supersample
+	out := make([]bool, sw*sh)
+	var xs []float64
+	for _, p := range f.Primitives {
+		for _, s := range f.outlines(p) {
+			xs = fill(out, sw, sh, v, s, xs)
+		}
+	}
+	return out
+}
+
+// fill sets the samples whose centers are inside the shape, even-odd, to
+// the shape's polarity. xs is scratch space, returned for reuse.
+func fill(samples []bool, sw, sh int, v view, s shape, xs []float64) []float64 {
+	value := !s.clear
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	rings := make([][]Point, len(s.rings))
+	for i, ring := range s.rings {
+		rings[i] = make([]Point, len(ring))
+		for j, p := range ring {
+			q := Point{(p[0] - v.left) * v.scale, (v.top - p[1]) * v.scale}
+			rings[i][j] = q
+			minY, maxY = math.Min(minY, q[1]), math.Max(maxY, q[1])
+		}
+	}
+
+	first := max(int(math.Floor(minY)), 0)
+	last := min(int(math.Ceil(maxY)), sh-1)
+	for row := first; row <= last; row++ {
+		y := float64(row) + 0.5
+		xs = xs[:0]
+		for _, ring := range rings {
+			for i := range ring {
+				a, b := ring[i], ring[(i+1)%len(ring)]
+				if (a[1] <= y) != (b[1] <= y) {
+					xs = append(xs, a[0]+(y-a[1])*(b[0]-a[0])/(b[1]-a[1]))
+				}
+			}
+		}
+		sort.Float64s(xs)
+		for i := 0; i+1 < len(xs); i += 2 {
+			start := max(int(math.Ceil(xs[i]-0.5)), 0)
+			end := min(int(math.Ceil(xs[i+1]-0.5)), sw)
+			for x := start; x < end; x++ {
+				samples[row*sw+x] = value
+			}
+		}
+	}
+	return xs
+}
+
+// coverage is the fraction of each pixel's samples that are set
+func coverage(samples []bool, v view) []float64 {
+	sw := v.width * supersample
+	out := make([]float64, v.width*v.height)
+	for y := 0; y < v.height; y++ {
+		for x := 0; x < v.width; x++ {
+			n := 0
+			for dy := range supersample {
+				for dx := range supersample {
+					if samples[(y*supersample+dy)*sw+x*supersample+dx] {
+						n++
+					}
+				}
+			}
+			out[y*v.width+x] = float64(n) / (supersample * supersample)
+		}
+	}
+	return out
+}
+
+// Render draws the layer in its usual color on the board background, size
+// pixels on the longer side
+func Render(f *File, size int) *image.NRGBA {
+	v := newView(f.Extents, size)
+	cover := coverage(f.samples(v), v)
+	bg, fg := hexColor(background), hexColor(layerColor(f.Function))
+
+	img := image.NewNRGBA(image.Rect(0, 0, v.width, v.height))
+	for i, a := range cover {
+		for c := range 3 {
+			img.Pix[4*i+c] = channel((1-a)*bg[c] + a*fg[c])
+		}
+		img.Pix[4*i+3] = 255
+	}
+	return img
+}
+
+// Overlay draws two versions of a layer at a common scale: areas in both
+// are gray, areas only in the older version red and only in the newer one
+// green
+func Overlay(from, to *File, size int) *image.NRGBA {
+	v := newView(union(from.Extents, to.Extents), size)
+	a := coverage(from.samples(v), v)
+	b := coverage(to.samples(v), v)
+	bg, same := hexColor(background), hexColor(unchangedColor)
+	removed, added := hexColor(fromColor), hexColor(toColor)
+
+	img := image.NewNRGBA(image.Rect(0, 0, v.width, v.height))
+	for i := range a {
+		both := math.Min(a[i], b[i])
+		weights := [4]float64{1 - math.Max(a[i], b[i]), both, a[i] - both, b[i] - both}
+		colors := [4][3]float64{bg, same, removed, added}
+		for c := range 3 {
+			var sum float64
+			for k, w := range weights {
+				sum += w * colors[k][c]
+			}
+			img.Pix[4*i+c] = channel(sum)
+		}
+		img.Pix[4*i+3] = 255
+	}
+	return img
+}
+
+func hexColor(hex string) [3]float64 {
+	v, _ := strconv.ParseUint(hex[1:], 16, 32)
+	return [3]float64{float64(v >> 16 & 0xff), float64(v >> 8 & 0xff), float64(v & 0xff)}
+}
+
+func channel(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(255, v))))
+}
@@ -0,0 +1,592 @@
+package gerber
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+)
+
+// coordinateFormat is the %FS number format: integer and decimal digits
+// per axis, which zeros are left out, and absolute or incremental notation
+type coordinateFormat struct {
+	// trailing is set when trailing rather than leading zeros are omitted
+	trailing    bool
+	incremental bool
+	digits      [2][2]int
+}
+
+// Legacy files without %FS are usually 2.4 inch
+var defaultFormat = coordinateFormat{digits: [2][2]int{{2, 4}, {2, 4}}}
+
+// value reads a coordinate for axis 0 (X, I) or 1 (Y, J) in file units
+func (cf coordinateFormat) value(s string, axis int) (float64, error) {
+	if strings.ContainsRune(s, '.') {
+		return strconv.ParseFloat(s, 64)
+	}
+	sign := 1.0
+	switch {
+	case strings.HasPrefix(s, "-"):
+		sign, s = -1, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+	whole, decimals := cf.digits[axis][0], cf.digits[axis][1]
+	if cf.trailing {
+		for len(s) < whole+decimals {
+			s += "0"
+		}
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid coordinate %q", s)
+	}
+	return sign * float64(n) / math.Pow10(decimals), nil
+}
+
+type stepRepeat struct {
+	x, y  int
+	i, j  float64
+	start int
+}
+
+type gerberParser struct {
+	f         *File
+	format    coordinateFormat
+	formatSet bool
+	unit      string
+	macros    map[string]*macro
+	// apertures maps D codes to indexes into f.Apertures
+	apertures map[int]int
+	current   int
+
+	at             Point
+	interpolation  int
+	singleQuadrant bool
+	clear          bool
+	region         bool
+	contour        []Point
+	lastOperation  int
+	repeat         *stepRepeat
+	// recognized is set once anything Gerber-specific has been read
+	recognized bool
+}
+
+// Interpolation modes
+const (
+	linear           = 1
+	clockwise        = 2
+	counterClockwise = 3
+)
+
+// Step and repeat may grow a file to at most this many primitives; a tiny
+// file can otherwise ask for billions of copies
+const maxPrimitives = 5_000_000
+
+func parseRS274X(data []byte) (*File, error) {
+	p := &gerberParser{
+		f:             &File{Format: FormatGerber, Apertures: []Aperture{}},
+		format:        defaultFormat,
+		macros:        make(map[string]*macro),
+		apertures:     make(map[int]int),
+		current:       -1,
+		interpolation: linear,
+	}
+
+	for i := 0; i < len(data); {
+		switch c := data[i]; {
+		case c == '%':
+			end := bytes.IndexByte(data[i+1:], '%')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated extended command")
+			}
+			if err := p.extended(string(data[i+1 : i+1+end])); err != nil {
+				return nil, err
+			}
+			i += end + 2
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			i++
+		default:
+			end := bytes.IndexByte(data[i:], '*')
+			if end < 0 {
+				i = len(data)
+				continue
+			}
+			word := strings.Join(strings.Fields(string(data[i:i+end])), "")
+			if strings.HasPrefix(word, "G04") {
+				// Comments keep their spaces but we don't need them
+				word = "G04"
+			}
+			i += end + 1
+			done, err := p.word(word)
+			if err != nil {
+				return nil, err
+			}
+			if done {
+				i = len(data)
+			}
+		}
+	}
+
+	p.closeContour()
+	if err := p.closeRepeat(); err != nil {
+		return nil, err
+	}
+	if !p.recognized {
+		return nil, ErrNotGerber
+	}
+	p.f.Units = p.fileUnit()
+	return p.f, nil
+}
+
+// fileUnit is the unit set by %MO or G70/G71; files without one are
+// assumed to be in inches, the legacy default
+func (p *gerberParser) fileUnit() string {
+	if p.unit == "" {
+		p.f.warn("no unit set; assumed inches")
+		p.unit = units.Inch
+	}
+	return p.unit
+}
+
+func (p *gerberParser) scale() float64 {
+	return millimeters(p.fileUnit())
+}
+
+// extended handles a %...% parameter block. Aperture macros span the whole
+// block; other blocks may hold several commands.
+func (p *gerberParser) extended(block string) error {
+	block = strings.TrimSpace(block)
+	if strings.HasPrefix(block, "AM") {
+		statements := strings.Split(block, "*")
+		name := strings.TrimSpace(statements[0][2:])
+		var body []string
+		for _, s := range statements[1:] {
+			// Statements may wrap across lines
+			if s = strings.Join(strings.Fields(s), ""); s != "" {
+				body = append(body, s)
+			}
+		}
+		p.macros[name] = &macro{name: name, statements: body}
+		p.recognized = true
+		return nil
+	}
+
+	for _, cmd := range strings.Split(block, "*") {
+		cmd = strings.TrimSpace(cmd)
+		if len(cmd) < 2 {
+			continue
+		}
+		if err := p.parameter(cmd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *gerberParser) parameter(cmd string) error {
+	switch cmd[:2] {
+	case "FS":
+		return p.coordinateFormat(cmd[2:])
+	case "MO":
+		switch cmd[2:] {
+		case "MM":
+			p.unit = units.Millimeter
+		case "IN":
+			p.unit = units.Inch
+		default:
+			return fmt.Errorf("unknown unit %q", cmd[2:])
+		}
+		p.recognized = true
+	case "AD":
+		return p.defineAperture(cmd[2:])
+	case "LP":
+		p.clear = cmd[2:] == "C"
+	case "SR":
+		if err := p.closeRepeat(); err != nil {
+			return err
+		}
+		return p.openRepeat(cmd[2:])
+	case "TF":
+		if function, ok := strings.CutPrefix(cmd[2:], ".FileFunction,"); ok {
+			p.f.Function = function
+		}
+	case "LM", "LR", "LS":
+		if cmd != "LMN" && cmd != "LR0" && cmd != "LS1" {
+			p.f.warn("aperture mirroring, rotation and scaling (LM, LR, LS) are ignored")
+		}
+	case "AB":
+		p.f.warn("aperture blocks (AB) are not supported")
+	case "IP":
+		if cmd == "IPNEG" {
+			p.f.warn("negative image polarity (IPNEG) is ignored")
+		}
+	case "OF", "SF", "MI", "IR":
+		switch cmd {
+		case "OFA0B0", "OFA0.0B0.0", "SFA1B1", "SFA1.0B1.0", "MIA0B0", "IR0":
+		default:
+			p.f.warn("deprecated image transformations (OF, SF, MI, IR) are ignored")
+		}
+	}
+	// Attributes (TA, TO, TD) and other deprecated parameters don't
+	// change the image
+	return nil
+}
+
+// coordinateFormat reads %FS, e.g. LAX36Y36
+func (p *gerberParser) coordinateFormat(spec string) error {
+	if len(spec) < 2 {
+		return fmt.Errorf("invalid coordinate format %q", spec)
+	}
+	cf := coordinateFormat{trailing: spec[0] == 'T', incremental: spec[1] == 'I'}
+	for axis, letter := range []byte{'X', 'Y'} {
+		at := strings.IndexByte(spec, letter)
+		if at < 0 || at+2 >= len(spec) {
+			return fmt.Errorf("invalid coordinate format %q", spec)
+		}
+		whole, err1 := strconv.Atoi(spec[at+1 : at+2])
+		decimals, err2 := strconv.Atoi(spec[at+2 : at+3])
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("invalid coordinate format %q", spec)
+		}
+		cf.digits[axis] = [2]int{whole, decimals}
+	}
+	p.format, p.formatSet = cf, true
+	p.recognized = true
+	return nil
+}
+
+// defineAperture reads %AD, e.g. D10C,0.5 or D11RoundRect,0.1X0.5X0.3
+func (p *gerberParser) defineAperture(spec string) error {
+	if !strings.HasPrefix(spec, "D") {
+		return fmt.Errorf("invalid aperture definition %q", spec)
+	}
+	end := 1
+	for end < len(spec) && spec[end] >= '0' && spec[end] <= '9' {
+		end++
+	}
+	code, err := strconv.Atoi(spec[1:end])
+	if err != nil {
+		return fmt.Errorf("invalid aperture definition %q", spec)
+	}
+	template, modifiers, _ := strings.Cut(spec[end:], ",")
+
+	var params []float64
+	if modifiers != "" {
+		for _, m := range strings.Split(modifiers, "X") {
+			v, err := strconv.ParseFloat(strings.TrimSpace(m), 64)
+			if err != nil {
+				return fmt.Errorf("invalid aperture modifier %q in D%d", m, code)
+			}
+			params = append(params, v)
+		}
+	}
+
+	a := Aperture{Code: fmt.Sprintf("D%d", code), Params: params}
+	scale := p.scale()
+	switch template {
+	case "C", "R", "O", "P":
+		a.Shape = map[string]string{"C": ShapeCircle, "R": ShapeRectangle, "O": ShapeObround, "P": ShapePolygon}[template]
+		// Polygon vertices and rotation aren't lengths
+		for i := range a.Params {
+			if template != "P" || i == 0 || i == 3 {
+				a.Params[i] *= scale
+			}
+		}
+		a.shapes, err = standardShapes(a.Shape, a.Params)
+		if err != nil {
+			p.f.warn(fmt.Sprintf("aperture %s: %v", a.Code, err))
+		}
+	default:
+		m, ok := p.macros[template]
+		if !ok {
+			p.f.warn(fmt.Sprintf("aperture %s uses undefined macro %s", a.Code, template))
+			break
+		}
+		a.Shape, a.Macro = ShapeMacro, template
+		a.shapes, err = m.shapes(params, scale)
+		if err != nil {
+			p.f.warn(fmt.Sprintf("macro %s: %v", template, err))
+		}
+	}
+	if a.Params == nil {
+		a.Params = []float64{}
+	}
+
+	// Redefining a D code replaces it from here on; earlier primitives
+	// keep the old shape
+	p.apertures[code] = len(p.f.Apertures)
+	p.f.Apertures = append(p.f.Apertures, a)
+	p.recognized = true
+	return nil
+}
+
+// openRepeat reads %SR, e.g. X3Y2I5.0J4.0; a bare %SR* just closes
+func (p *gerberParser) openRepeat(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	r := &stepRepeat{x: 1, y: 1, start: len(p.f.Primitives)}
+	for _, field := range splitWords(spec) {
+		v, err := strconv.ParseFloat(field[1:], 64)
+		if err != nil {
+			return fmt.Errorf("invalid step and repeat %q", spec)
+		}
+		switch field[0] {
+		case 'X', 'Y':
+			if !(v >= 1 && v <= maxPrimitives) {
+				return fmt.Errorf("invalid step and repeat %q", spec)
+			}
+			if field[0] == 'X' {
+				r.x = int(v)
+			} else {
+				r.y = int(v)
+			}
+		case 'I':
+			r.i = v * p.scale()
+		case 'J':
+			r.j = v * p.scale()
+		}
+	}
+	if r.x > 1 || r.y > 1 {
+		p.repeat = r
+	}
+	return nil
+}
+
+// closeRepeat copies the block drawn since %SR to the rest of its grid
+func (p *gerberParser) closeRepeat() error {
+	r := p.repeat
+	if r == nil {
+		return nil
+	}
+	p.repeat = nil
+	block := append([]Primitive(nil), p.f.Primitives[r.start:]...)
+	// x and y are each at most maxPrimitives, so their product can't overflow
+	if copies := r.x*r.y - 1; len(block) > 0 && copies > (maxPrimitives-len(p.f.Primitives))/len(block) {
+		return fmt.Errorf("step and repeat of %d by %d copies of %d primitives is too large", r.x, r.y, len(block))
+	}
+	for ix := range r.x {
+		for iy := range r.y {
+			if ix == 0 && iy == 0 {
+				continue
+			}
+			offset := Point{float64(ix) * r.i, float64(iy) * r.j}
+			for _, prim := range block {
+				prim.Points = translate(prim.Points, offset)
+				if prim.Kind == KindArc {
+					prim.Center = Point{prim.Center[0] + offset[0], prim.Center[1] + offset[1]}
+				}
+				p.f.add(prim)
+			}
+		}
+	}
+	return nil
+}
+
+// splitWords splits a command into a letter followed by its number, e.g.
+// G01X100Y-20D01 into G01, X100, Y-20 and D01
+func splitWords(s string) []string {
+	var out []string
+	start := -1
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			if start >= 0 {
+				out = append(out, s[start:i])
+			}
+			start = i
+		}
+	}
+	if start >= 0 {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// word handles one *-terminated data block, reporting whether it ends the
+// file
+func (p *gerberParser) word(word string) (bool, error) {
+	if word == "" || word == "G04" {
+		return false, nil
+	}
+
+	var coords [4]string
+	var hasCoords [4]bool
+	operation := 0
+	for _, w := range splitWords(word) {
+		if len(w) < 2 {
+			continue
+		}
+		switch w[0] {
+		case 'G':
+			code, err := strconv.Atoi(w[1:])
+			if err != nil {
+				return false, fmt.Errorf("invalid G code %q", w)
+			}
+			p.gcode(code)
+		case 'M':
+			// M02 ends the file; the long deprecated M00 also stops
+			if w == "M02" || w == "M2" || w == "M00" || w == "M0" {
+				return true, nil
+			}
+		case 'D':
+			code, err := strconv.Atoi(w[1:])
+			if err != nil {
+				return false, fmt.Errorf("invalid D code %q", w)
+			}
+			if code >= 10 {
+				i, ok := p.apertures[code]
+				if !ok {
+					p.f.warn(fmt.Sprintf("aperture D%d is used but not defined", code))
+					i = -1
+				}
+				p.current = i
+				continue
+			}
+			operation = code
+		case 'X', 'Y', 'I', 'J':
+			axis := strings.IndexByte("XYIJ", w[0])
+			coords[axis], hasCoords[axis] = w[1:], true
+		}
+	}
+
+	if operation == 0 && (hasCoords[0] || hasCoords[1]) {
+		// Coordinates alone repeat the last operation (deprecated)
+		operation = p.lastOperation
+	}
+	if operation == 0 {
+		return false, nil
+	}
+	p.lastOperation = operation
+	p.recognized = true
+
+	target, offset := p.at, Point{}
+	for axis := range 4 {
+		if !hasCoords[axis] {
+			continue
+		}
+		v, err := p.format.value(coords[axis], axis%2)
+		if err != nil {
+			return false, err
+		}
+		v *= p.scale()
+		switch {
+		case axis >= 2:
+			offset[axis-2] = v
+		case p.format.incremental:
+			target[axis] += v
+		default:
+			target[axis] = v
+		}
+	}
+	if !p.formatSet {
+		p.f.warn("no coordinate format set; assumed 2.4")
+		p.formatSet = true
+	}
+
+	switch operation {
+	case 1:
+		p.interpolate(target, offset)
+	case 2:
+		p.closeContour()
+	case 3:
+		if p.region {
+			break
+		}
+		p.f.add(Primitive{Kind: KindFlash, Aperture: p.current, Points: []Point{target}, Clear: p.clear})
+	}
+	p.at = target
+	return false, nil
+}
+
+func (p *gerberParser) gcode(code int) {
+	switch code {
+	case 1, 2, 3:
+		p.interpolation = code
+	case 36:
+		p.region = true
+		p.contour = nil
+	case 37:
+		p.closeContour()
+		p.region = false
+	case 74:
+		p.singleQuadrant = true
+	case 75:
+		p.singleQuadrant = false
+	case 70:
+		p.unit = units.Inch
+	case 71:
+		p.unit = units.Millimeter
+	case 90:
+		p.format.incremental = false
+	case 91:
+		p.format.incremental = true
+	}
+}
+
+// interpolate draws from the current point, or extends the region contour
+func (p *gerberParser) interpolate(target, offset Point) {
+	from := p.at
+	arc := p.interpolation == clockwise || p.interpolation == counterClockwise
+	cw := p.interpolation == clockwise
+	var center Point
+	if arc {
+		center = p.arcCenter(from, target, offset, cw)
+	}
+
+	if p.region {
+		if len(p.contour) == 0 {
+			p.contour = append(p.contour, from)
+		}
+		if arc {
+			p.contour = append(p.contour, arcPoints(from, target, center, cw)[1:]...)
+		} else {
+			p.contour = append(p.contour, target)
+		}
+		return
+	}
+
+	if p.current < 0 {
+		p.f.warn("draw without an aperture selected")
+		return
+	}
+	prim := Primitive{Kind: KindDraw, Aperture: p.current, Points: []Point{from, target}, Clear: p.clear}
+	if arc {
+		prim.Kind, prim.Center, prim.Clockwise = KindArc, center, cw
+	}
+	p.f.add(prim)
+}
+
+// arcCenter places an arc's center. In single-quadrant mode the offsets
+// are unsigned, so the center is whichever of the four candidates gives a
+// consistent radius with a sweep of at most 90°.
+func (p *gerberParser) arcCenter(from, to, offset Point, cw bool) Point {
+	if !p.singleQuadrant {
+		return Point{from[0] + offset[0], from[1] + offset[1]}
+	}
+
+	i, j := math.Abs(offset[0]), math.Abs(offset[1])
+	best, bestErr := Point{from[0] + i, from[1] + j}, math.Inf(1)
+	for _, sign := range [4][2]float64{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}} {
+		c := Point{from[0] + sign[0]*i, from[1] + sign[1]*j}
+		if math.Abs(sweep(from, to, c, cw)) > math.Pi/2+1e-9 {
+			continue
+		}
+		err := math.Abs(math.Hypot(from[0]-c[0], from[1]-c[1]) - math.Hypot(to[0]-c[0], to[1]-c[1]))
+		if err < bestErr {
+			best, bestErr = c, err
+		}
+	}
+	return best
+}
+
+func (p *gerberParser) closeContour() {
+	if p.region && len(p.contour) >= 3 {
+		p.f.add(Primitive{Kind: KindRegion, Aperture: -1, Points: p.contour, Clear: p.clear})
+	}
+	p.contour = nil
+}
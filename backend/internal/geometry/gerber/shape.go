@@ -0,0 +1,283 @@
+package gerber
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+const (
+	// Circles and round ends are drawn as polygons with this many sides
+	circleSegments = 32
+	// Arcs are flattened to segments of at most this many degrees
+	arcStepDegrees = 5
+	// Regular polygons, standard or macro, have this many vertices
+	minPolygonVertices = 3
+	maxPolygonVertices = 12
+)
+
+// shape is a filled outline in millimeters. Its rings are filled even-odd,
+// so a ring inside another is a hole.
+type shape struct {
+	rings [][]Point
+	// clear parts of a macro aperture erase instead of draw
+	clear bool
+}
+
+func circle(c Point, r float64) []Point {
+	out := make([]Point, circleSegments)
+	for i := range out {
+		a := 2 * math.Pi * float64(i) / circleSegments
+		out[i] = Point{c[0] + r*math.Cos(a), c[1] + r*math.Sin(a)}
+	}
+	return out
+}
+
+func rectangle(c Point, w, h float64) []Point {
+	return []Point{
+		{c[0] - w/2, c[1] - h/2},
+		{c[0] + w/2, c[1] - h/2},
+		{c[0] + w/2, c[1] + h/2},
+		{c[0] - w/2, c[1] + h/2},
+	}
+}
+
+// capsule is a stadium: the segment p0-p1 widened by r with round ends
+func capsule(p0, p1 Point, r float64) []Point {
+	a := math.Atan2(p1[1]-p0[1], p1[0]-p0[0])
+	half := circleSegments / 2
+	out := make([]Point, 0, circleSegments+2)
+	for i := 0; i <= half; i++ {
+		t := a - math.Pi/2 + math.Pi*float64(i)/float64(half)
+		out = append(out, Point{p1[0] + r*math.Cos(t), p1[1] + r*math.Sin(t)})
+	}
+	for i := 0; i <= half; i++ {
+		t := a + math.Pi/2 + math.Pi*float64(i)/float64(half)
+		out = append(out, Point{p0[0] + r*math.Cos(t), p0[1] + r*math.Sin(t)})
+	}
+	return out
+}
+
+func regularPolygon(c Point, d float64, vertices int, rotation float64) []Point {
+	out := make([]Point, vertices)
+	for i := range out {
+		a := (rotation + 360*float64(i)/float64(vertices)) * math.Pi / 180
+		out[i] = Point{c[0] + d/2*math.Cos(a), c[1] + d/2*math.Sin(a)}
+	}
+	return out
+}
+
+// standardShapes outlines the C, R, O and P aperture templates. params are
+// already in millimeters.
+func standardShapes(template string, params []float64) ([]shape, error) {
+	param := func(i int) float64 {
+		if i < len(params) {
+			return params[i]
+		}
+		return 0
+	}
+
+	var outer []Point
+	holeAt := 2
+	switch template {
+	case ShapeCircle:
+		outer = circle(Point{}, param(0)/2)
+		holeAt = 1
+	case ShapeRectangle:
+		outer = rectangle(Point{}, param(0), param(1))
+	case ShapeObround:
+		w, h := param(0), param(1)
+		if w >= h {
+			outer = capsule(Point{-(w - h) / 2, 0}, Point{(w - h) / 2, 0}, h/2)
+		} else {
+			outer = capsule(Point{0, -(h - w) / 2}, Point{0, (h - w) / 2}, w/2)
+		}
+	case ShapePolygon:
+		vertices := param(1)
+		if !(vertices >= minPolygonVertices && vertices <= maxPolygonVertices) {
+			return nil, fmt.Errorf("polygon has %v vertices, want %d to %d", vertices, minPolygonVertices, maxPolygonVertices)
+		}
+		outer = regularPolygon(Point{}, param(0), int(vertices), param(2))
+		holeAt = 3
+	default:
+		return nil, nil
+	}
+
+	s := shape{rings: [][]Point{outer}}
+	if hole := param(holeAt); hole > 0 {
+		s.rings = append(s.rings, circle(Point{}, hole/2))
+	}
+	return []shape{s}, nil
+}
+
+// pen is the convex outline an aperture sweeps along a draw. The spec only
+// allows solid circles (and, deprecated, rectangles) to draw; anything else
+// is approximated by its hull.
+func (a *Aperture) pen() []Point {
+	var points []Point
+	for _, s := range a.shapes {
+		if s.clear || len(s.rings) == 0 {
+			continue
+		}
+		points = append(points, s.rings[0]...)
+	}
+	return hull(points)
+}
+
+// outlines is what a primitive covers, as shapes in board coordinates
+func (f *File) outlines(p Primitive) []shape {
+	var aperture *Aperture
+	if p.Aperture >= 0 && p.Aperture < len(f.Apertures) {
+		aperture = &f.Apertures[p.Aperture]
+	}
+
+	var out []shape
+	switch p.Kind {
+	case KindFlash:
+		if aperture == nil || len(p.Points) == 0 {
+			return nil
+		}
+		at := p.Points[0]
+		for _, s := range aperture.shapes {
+			if p.Clear && s.clear {
+				// A clear aperture's own clear parts have nothing to erase
+				continue
+			}
+			moved := shape{clear: s.clear || p.Clear, rings: make([][]Point, len(s.rings))}
+			for i, ring := range s.rings {
+				moved.rings[i] = translate(ring, at)
+			}
+			out = append(out, moved)
+		}
+	case KindDraw:
+		if aperture == nil || len(p.Points) < 2 {
+			return nil
+		}
+		out = append(out, stroke(aperture.pen(), p.Points[0], p.Points[1], p.Clear))
+	case KindArc:
+		if aperture == nil || len(p.Points) < 2 {
+			return nil
+		}
+		pen := aperture.pen()
+		points := arcPoints(p.Points[0], p.Points[1], p.Center, p.Clockwise)
+		for i := 1; i < len(points); i++ {
+			out = append(out, stroke(pen, points[i-1], points[i], p.Clear))
+		}
+	case KindRegion:
+		if len(p.Points) >= 3 {
+			out = append(out, shape{rings: [][]Point{p.Points}, clear: p.Clear})
+		}
+	}
+	return out
+}
+
+// stroke is the area a pen covers moving in a straight line
+func stroke(pen []Point, from, to Point, clear bool) shape {
+	points := make([]Point, 0, 2*len(pen))
+	points = append(points, translate(pen, from)...)
+	points = append(points, translate(pen, to)...)
+	return shape{rings: [][]Point{hull(points)}, clear: clear}
+}
+
+func translate(ring []Point, by Point) []Point {
+	out := make([]Point, len(ring))
+	for i, p := range ring {
+		out[i] = Point{p[0] + by[0], p[1] + by[1]}
+	}
+	return out
+}
+
+// sweep is the signed angle an arc turns through, negative clockwise.
+// Equal start and end points make a full circle.
+func sweep(from, to, center Point, clockwise bool) float64 {
+	if from == to {
+		if clockwise {
+			return -2 * math.Pi
+		}
+		return 2 * math.Pi
+	}
+	start := math.Atan2(from[1]-center[1], from[0]-center[0])
+	end := math.Atan2(to[1]-center[1], to[0]-center[0])
+	s := end - start
+	if clockwise {
+		for s >= 0 {
+			s -= 2 * math.Pi
+		}
+	} else {
+		for s <= 0 {
+			s += 2 * math.Pi
+		}
+	}
+	return s
+}
+
+// arcPoints flattens an arc around center, from and to included
+func arcPoints(from, to, center Point, clockwise bool) []Point {
+	r := math.Hypot(from[0]-center[0], from[1]-center[1])
+	start := math.Atan2(from[1]-center[1], from[0]-center[0])
+	sweep := sweep(from, to, center, clockwise)
+
+	steps := max(int(math.Ceil(math.Abs(sweep)*180/math.Pi/arcStepDegrees)), 2)
+	out := make([]Point, steps+1)
+	for i := range out {
+		a := start + sweep*float64(i)/float64(steps)
+		out[i] = Point{center[0] + r*math.Cos(a), center[1] + r*math.Sin(a)}
+	}
+	out[0], out[steps] = from, to
+	return out
+}
+
+// hull is the convex hull by Andrew's monotone chain, counter-clockwise
+func hull(points []Point) []Point {
+	if len(points) < 3 {
+		return points
+	}
+	sorted := make([]Point, len(points))
+	copy(sorted, points)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i][0] != sorted[j][0] {
+			return sorted[i][0] < sorted[j][0]
+		}
+		return sorted[i][1] < sorted[j][1]
+	})
+
+	cross := func(o, a, b Point) float64 {
+		return (a[0]-o[0])*(b[1]-o[1]) - (a[1]-o[1])*(b[0]-o[0])
+	}
+	out := make([]Point, 0, 2*len(sorted))
+	for _, p := range sorted {
+		for len(out) >= 2 && cross(out[len(out)-2], out[len(out)-1], p) <= 0 {
+			out = out[:len(out)-1]
+		}
+		out = append(out, p)
+	}
+	lower := len(out) + 1
+	for i := len(sorted) - 2; i >= 0; i-- {
+		p := sorted[i]
+		for len(out) >= lower && cross(out[len(out)-2], out[len(out)-1], p) <= 0 {
+			out = out[:len(out)-1]
+		}
+		out = append(out, p)
+	}
+	return out[:len(out)-1]
+}
+
+// extents bounds every primitive's outline
+func (f *File) extents() Extents {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, p := range f.Primitives {
+		for _, s := range f.outlines(p) {
+			for _, ring := range s.rings {
+				for _, q := range ring {
+					minX, minY = math.Min(minX, q[0]), math.Min(minY, q[1])
+					maxX, maxY = math.Max(maxX, q[0]), math.Max(maxY, q[1])
+				}
+			}
+		}
+	}
+	if math.IsInf(minX, 1) {
+		return Extents{}
+	}
+	return Extents{Min: Point{minX, minY}, Max: Point{maxX, maxY}}
+}
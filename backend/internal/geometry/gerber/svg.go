@@ -0,0 +1,223 @@
+package gerber
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	svgMaxSize = 1024
+	// Margin around the extents, as a fraction of the larger side
+	svgMargin = 0.02
+
+	// background is the board color behind every layer. Clear (LPC)
+	// objects are painted in it.
+	background = "#1f2933"
+	// Overlays draw the older version in red and the newer in green
+	fromColor = "#ef4444"
+	toColor   = "#22c55e"
+)
+
+// layerColor is the usual color of a layer with the given function
+func layerColor(function string) string {
+	kind, _, _ := strings.Cut(strings.ToLower(function), ",")
+	switch kind {
+	case "soldermask":
+		return "#2f9e44"
+	case "legend":
+		return "#f8f9fa"
+	case "paste":
+		return "#adb5bd"
+	case "profile":
+		return "#ffd43b"
+	case "drill", "plated", "nonplated":
+		return "#e9ecef"
+	}
+	return "#c87533"
+}
+
+// SVG draws the layer in its usual color on the board background
+func (f *File) SVG() []byte {
+	return svg(f.Extents, []svgLayer{{file: f, color: layerColor(f.Function), opacity: 1}})
+}
+
+// OverlaySVG draws two versions of a layer over each other at a common
+// scale, half transparent, so unchanged copper looks mixed and changes
+// show in one version's color. Clear objects of one version also cover the
+// other; the PNG overlay is exact.
+func OverlaySVG(from, to *File) []byte {
+	return svg(union(from.Extents, to.Extents), []svgLayer{
+		{file: from, color: fromColor, opacity: 0.6},
+		{file: to, color: toColor, opacity: 0.6},
+	})
+}
+
+type svgLayer struct {
+	file    *File
+	color   string
+	opacity float64
+}
+
+func union(a, b Extents) Extents {
+	if a == (Extents{}) {
+		return b
+	}
+	if b == (Extents{}) {
+		return a
+	}
+	return Extents{
+		Min: Point{math.Min(a.Min[0], b.Min[0]), math.Min(a.Min[1], b.Min[1])},
+		Max: Point{math.Max(a.Max[0], b.Max[0]), math.Max(a.Max[1], b.Max[1])},
+	}
+}
+
+func svg(ext Extents, layers []svgLayer) []byte {
+	w, h := ext.Width(), ext.Height()
+	side := math.Max(w, h)
+	if side == 0 {
+		side = 1
+	}
+	margin := side * svgMargin
+	w, h = w+2*margin, h+2*margin
+	scale := svgMaxSize / math.Max(w, h)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" xmlns:xlink="http://www.w3.org/1999/xlink" width="%s" height="%s" viewBox="%s %s %s %s">`+"\n",
+		num(math.Ceil(w*scale)), num(math.Ceil(h*scale)),
+		num(ext.Min[0]-margin), num(-ext.Max[1]-margin), num(w), num(h))
+	fmt.Fprintf(&buf, `<rect x="%s" y="%s" width="%s" height="%s" fill="%s"/>`+"\n",
+		num(ext.Min[0]-margin), num(-ext.Max[1]-margin), num(w), num(h), background)
+
+	// Apertures are defined once per layer and flashed with <use>
+	buf.WriteString("<defs>\n")
+	for l, layer := range layers {
+		used := make([]bool, len(layer.file.Apertures))
+		for _, p := range layer.file.Primitives {
+			if p.Kind == KindFlash && p.Aperture >= 0 {
+				used[p.Aperture] = true
+			}
+		}
+		for i, a := range layer.file.Apertures {
+			if !used[i] {
+				continue
+			}
+			fmt.Fprintf(&buf, "<g id=\"l%da%d\">", l, i)
+			for _, s := range a.shapes {
+				fill := ""
+				if s.clear {
+					fill = ` fill="` + background + `"`
+				}
+				fmt.Fprintf(&buf, `<path d="%s"%s/>`, ringsPath(s.rings), fill)
+			}
+			buf.WriteString("</g>\n")
+		}
+	}
+	buf.WriteString("</defs>\n")
+
+	// Y points up on boards and down in SVG
+	buf.WriteString(`<g transform="scale(1,-1)" fill-rule="evenodd" stroke-linecap="round" stroke-linejoin="round">` + "\n")
+	for l, layer := range layers {
+		fmt.Fprintf(&buf, "<g fill=\"%s\" stroke=\"none\" opacity=\"%s\">\n", layer.color, num(layer.opacity))
+		for _, p := range layer.file.Primitives {
+			writePrimitive(&buf, layer.file, l, p, layer.color)
+		}
+		buf.WriteString("</g>\n")
+	}
+	buf.WriteString("</g>\n</svg>\n")
+	return buf.Bytes()
+}
+
+func writePrimitive(buf *bytes.Buffer, f *File, layer int, p Primitive, color string) {
+	paint := color
+	if p.Clear {
+		paint = background
+	}
+
+	switch p.Kind {
+	case KindFlash:
+		if p.Aperture < 0 || len(p.Points) == 0 {
+			return
+		}
+		fill := ""
+		if p.Clear {
+			fill = ` fill="` + background + `"`
+		}
+		fmt.Fprintf(buf, "<use xlink:href=\"#l%da%d\" x=\"%s\" y=\"%s\"%s/>\n",
+			layer, p.Aperture, num(p.Points[0][0]), num(p.Points[0][1]), fill)
+	case KindDraw, KindArc:
+		if p.Aperture < 0 || len(p.Points) < 2 {
+			return
+		}
+		a := &f.Apertures[p.Aperture]
+		if a.Shape != ShapeCircle || len(a.Params) == 0 {
+			// Only round apertures stroke cleanly; others are swept hulls
+			for _, s := range f.outlines(p) {
+				fmt.Fprintf(buf, "<path d=\"%s\" fill=\"%s\"/>\n", ringsPath(s.rings), paint)
+			}
+			return
+		}
+		from, to := p.Points[0], p.Points[1]
+		d := fmt.Sprintf("M%s %s L%s %s", num(from[0]), num(from[1]), num(to[0]), num(to[1]))
+		if p.Kind == KindArc {
+			d = arcPath(from, to, p.Center, p.Clockwise)
+		}
+		fmt.Fprintf(buf, "<path d=\"%s\" fill=\"none\" stroke=\"%s\" stroke-width=\"%s\"/>\n", d, paint, num(a.Params[0]))
+	case KindRegion:
+		fmt.Fprintf(buf, "<path d=\"%s\" fill=\"%s\"/>\n", ringsPath([][]Point{p.Points}), paint)
+	}
+}
+
+// arcPath draws an arc with SVG arc commands, as two halves when it's a
+// full circle. Positive angles are counter-clockwise in board coordinates.
+func arcPath(from, to, center Point, clockwise bool) string {
+	r := math.Hypot(from[0]-center[0], from[1]-center[1])
+	s := sweep(from, to, center, clockwise)
+	dir := flag(!clockwise)
+	if math.Abs(s) >= 2*math.Pi-1e-9 {
+		opposite := Point{2*center[0] - from[0], 2*center[1] - from[1]}
+		return fmt.Sprintf("M%s %s A%s %s 0 0 %d %s %s A%s %s 0 0 %d %s %s",
+			num(from[0]), num(from[1]),
+			num(r), num(r), dir, num(opposite[0]), num(opposite[1]),
+			num(r), num(r), dir, num(from[0]), num(from[1]))
+	}
+	return fmt.Sprintf("M%s %s A%s %s 0 %d %d %s %s",
+		num(from[0]), num(from[1]), num(r), num(r), flag(math.Abs(s) > math.Pi), dir, num(to[0]), num(to[1]))
+}
+
+func ringsPath(rings [][]Point) string {
+	var d strings.Builder
+	for _, ring := range rings {
+		for i, p := range ring {
+			if i == 0 {
+				d.WriteByte('M')
+			} else {
+				d.WriteString(" L")
+			}
+			d.WriteString(num(p[0]))
+			d.WriteByte(' ')
+			d.WriteString(num(p[1]))
+		}
+		d.WriteString(" Z")
+	}
+	return d.String()
+}
+
+func flag(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// num writes millimeters to a tenth of a micron
+func num(x float64) string {
+	s := strconv.FormatFloat(x, 'f', 4, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
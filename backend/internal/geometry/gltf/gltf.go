@@ -0,0 +1,251 @@
+// Package gltf writes meshes as binary glTF 2.0 (GLB) for the browser
+// viewer: indexed, and with positions quantized to 16 bits per axis via
+// KHR_mesh_quantization, which comes to a third or less of a binary STL.
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+const (
+	glbMagic   = 0x46546c67 // "glTF"
+	glbVersion = 2
+	chunkJSON  = 0x4e4f534a
+	chunkBIN   = 0x004e4942
+
+	componentUnsignedShort = 5123
+	componentUnsignedInt   = 5125
+	componentFloat         = 5126
+
+	targetArrayBuffer        = 34962
+	targetElementArrayBuffer = 34963
+
+	quantizationExtension = "KHR_mesh_quantization"
+	quantizedMax          = 65535
+)
+
+type Options struct {
+	// Quantize stores positions as uint16 with a dequantizing node
+	// transform; otherwise they're float32
+	Quantize bool
+}
+
+func DefaultOptions() Options {
+	return Options{Quantize: true}
+}
+
+// WriteGLB encodes the mesh as a single-primitive GLB. Triangle order is
+// preserved, so per-face diff indices still line up. A root node rotates
+// the Z-up CAD coordinates into glTF's Y-up convention.
+func WriteGLB(w io.Writer, m *geometry.Mesh, opts Options) error {
+	if len(m.Triangles) == 0 {
+		return fmt.Errorf("mesh has no triangles")
+	}
+
+	var bin bytes.Buffer
+	bounds := m.Bounds()
+
+	// Positions
+	var positionAccessor accessor
+	var meshNode node
+	if opts.Quantize {
+		scale := [3]float64{1, 1, 1}
+		extent := bounds.Max.Sub(bounds.Min)
+		for i, e := range []float64{extent.X, extent.Y, extent.Z} {
+			if e > 0 {
+				scale[i] = e / quantizedMax
+			}
+		}
+
+		lo, hi := [3]uint16{quantizedMax, quantizedMax, quantizedMax}, [3]uint16{}
+		for _, v := range m.Vertices {
+			q := [3]uint16{
+				quantize(v.X, bounds.Min.X, scale[0]),
+				quantize(v.Y, bounds.Min.Y, scale[1]),
+				quantize(v.Z, bounds.Min.Z, scale[2]),
+			}
+			for i := range q {
+				lo[i] = min(lo[i], q[i])
+				hi[i] = max(hi[i], q[i])
+			}
+			// Vertex attributes must be 4-byte aligned, so each uint16
+			// triple is padded to 8 bytes
+			binary.Write(&bin, binary.LittleEndian, [4]uint16{q[0], q[1], q[2], 0})
+		}
+
+		positionAccessor = accessor{
+			ComponentType: componentUnsignedShort,
+			Type:          "VEC3",
+			Min:           []float64{float64(lo[0]), float64(lo[1]), float64(lo[2])},
+			Max:           []float64{float64(hi[0]), float64(hi[1]), float64(hi[2])},
+		}
+		meshNode.Translation = []float64{bounds.Min.X, bounds.Min.Y, bounds.Min.Z}
+		meshNode.Scale = scale[:]
+	} else {
+		for _, v := range m.Vertices {
+			binary.Write(&bin, binary.LittleEndian, [3]float32{float32(v.X), float32(v.Y), float32(v.Z)})
+		}
+		positionAccessor = accessor{
+			ComponentType: componentFloat,
+			Type:          "VEC3",
+			Min:           []float64{float64(float32(bounds.Min.X)), float64(float32(bounds.Min.Y)), float64(float32(bounds.Min.Z))},
+			Max:           []float64{float64(float32(bounds.Max.X)), float64(float32(bounds.Max.Y)), float64(float32(bounds.Max.Z))},
+		}
+	}
+	positionAccessor.Count = len(m.Vertices)
+	positionView := bufferView{ByteLength: bin.Len(), Target: targetArrayBuffer}
+	if opts.Quantize {
+		positionView.ByteStride = 8
+	}
+
+	// Indices. The component type's maximum value is reserved for primitive
+	// restart, so uint16 only fits meshes with fewer than 65535 vertices.
+	indexOffset := bin.Len()
+	indexType := componentUnsignedInt
+	if len(m.Vertices) < math.MaxUint16 {
+		indexType = componentUnsignedShort
+	}
+	for _, t := range m.Triangles {
+		for _, v := range t {
+			if indexType == componentUnsignedShort {
+				binary.Write(&bin, binary.LittleEndian, uint16(v))
+			} else {
+				binary.Write(&bin, binary.LittleEndian, uint32(v))
+			}
+		}
+	}
+	indexView := bufferView{ByteOffset: indexOffset, ByteLength: bin.Len() - indexOffset, Target: targetElementArrayBuffer}
+	pad(&bin, 0)
+
+	meshNode.Mesh = new(int)
+	// -90° about X takes +Z up to +Y up
+	root := node{
+		Rotation: []float64{-math.Sqrt2 / 2, 0, 0, math.Sqrt2 / 2},
+		Children: []int{1},
+	}
+
+	doc := document{
+		Asset:  asset{Version: "2.0", Generator: "cad-version-control"},
+		Scene:  0,
+		Scenes: []scene{{Nodes: []int{0}}},
+		Nodes:  []node{root, meshNode},
+		Meshes: []mesh{{Primitives: []primitive{{
+			Attributes: map[string]int{"POSITION": 0},
+			Indices:    1,
+			Mode:       4,
+		}}}},
+		Accessors: []accessor{
+			positionAccessor,
+			{BufferView: 1, ComponentType: indexType, Count: 3 * len(m.Triangles), Type: "SCALAR"},
+		},
+		BufferViews: []bufferView{positionView, indexView},
+		Buffers:     []buffer{{ByteLength: bin.Len()}},
+	}
+	if opts.Quantize {
+		doc.ExtensionsUsed = []string{quantizationExtension}
+		doc.ExtensionsRequired = []string{quantizationExtension}
+	}
+
+	jsonChunk, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to encode glTF JSON: %w", err)
+	}
+	jsonBuf := bytes.NewBuffer(jsonChunk)
+	pad(jsonBuf, ' ')
+
+	total := 12 + 8 + jsonBuf.Len() + 8 + bin.Len()
+	header := []uint32{
+		glbMagic, glbVersion, uint32(total),
+		uint32(jsonBuf.Len()), chunkJSON,
+	}
+	if err := binary.Write(w, binary.LittleEndian, header); err != nil {
+		return err
+	}
+	if _, err := w.Write(jsonBuf.Bytes()); err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, []uint32{uint32(bin.Len()), chunkBIN}); err != nil {
+		return err
+	}
+	_, err = w.Write(bin.Bytes())
+	return err
+}
+
+func quantize(v, lo, scale float64) uint16 {
+	return uint16(math.Max(0, math.Min(quantizedMax, math.Round((v-lo)/scale))))
+}
+
+// pad extends a chunk to a 4-byte boundary as GLB requires
+func pad(b *bytes.Buffer, fill byte) {
+	for b.Len()%4 != 0 {
+		b.WriteByte(fill)
+	}
+}
+
+type document struct {
+	Asset              asset        `json:"asset"`
+	ExtensionsUsed     []string     `json:"extensionsUsed,omitempty"`
+	ExtensionsRequired []string     `json:"extensionsRequired,omitempty"`
+	Scene              int          `json:"scene"`
+	Scenes             []scene      `json:"scenes"`
+	Nodes              []node       `json:"nodes"`
+	Meshes             []mesh       `json:"meshes"`
+	Accessors          []accessor   `json:"accessors"`
+	BufferViews        []bufferView `json:"bufferViews"`
+	Buffers            []buffer     `json:"buffers"`
+}
+
+type asset struct {
+	Version   string `json:"version"`
+	Generator string `json:"generator"`
+}
+
+type scene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type node struct {
+	Mesh        *int      `json:"mesh,omitempty"`
+	Children    []int     `json:"children,omitempty"`
+	Rotation    []float64 `json:"rotation,omitempty"`
+	Translation []float64 `json:"translation,omitempty"`
+	Scale       []float64 `json:"scale,omitempty"`
+}
+
+type mesh struct {
+	Primitives []primitive `json:"primitives"`
+}
+
+type primitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Mode       int            `json:"mode"`
+}
+
+type accessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float64 `json:"min,omitempty"`
+	Max           []float64 `json:"max,omitempty"`
+}
+
+type bufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	ByteStride int `json:"byteStride,omitempty"`
+	Target     int `json:"target"`
+}
+
+type buffer struct {
+	ByteLength int `json:"byteLength"`
+}
@@ -0,0 +1,141 @@
+package gltf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+func grid(n int, z float64) *geometry.Mesh {
+	b := geometry.NewMeshBuilder()
+	for i := range n {
+		for j := range n {
+			x, y := float64(i), float64(j)
+			b.AddTriangle(geometry.Vec3{X: x, Y: y, Z: z}, geometry.Vec3{X: x + 1, Y: y, Z: z}, geometry.Vec3{X: x, Y: y + 1, Z: z + float64(i)})
+		}
+	}
+	return b.Mesh()
+}
+
+// decode splits a GLB into its JSON document and binary chunk, checking
+// the framing GLB readers rely on
+func decode(t *testing.T, data []byte) (document, []byte) {
+	t.Helper()
+	if len(data) < 20 || len(data)%4 != 0 {
+		t.Fatalf("GLB is %d bytes", len(data))
+	}
+	header := make([]uint32, 5)
+	binary.Read(bytes.NewReader(data), binary.LittleEndian, header)
+	if header[0] != glbMagic || header[1] != glbVersion || int(header[2]) != len(data) || header[4] != chunkJSON {
+		t.Fatalf("header = %x", header)
+	}
+	jsonEnd := 20 + int(header[3])
+	var doc document
+	if err := json.Unmarshal(data[20:jsonEnd], &doc); err != nil {
+		t.Fatalf("JSON chunk: %v", err)
+	}
+	binLen := binary.LittleEndian.Uint32(data[jsonEnd:])
+	if binary.LittleEndian.Uint32(data[jsonEnd+4:]) != chunkBIN || jsonEnd+8+int(binLen) != len(data) {
+		t.Fatal("malformed BIN chunk")
+	}
+	return doc, data[jsonEnd+8:]
+}
+
+func TestWriteGLBQuantized(t *testing.T) {
+	m := grid(4, 2)
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, m, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	doc, bin := decode(t, buf.Bytes())
+	if len(doc.ExtensionsRequired) != 1 || doc.ExtensionsRequired[0] != quantizationExtension {
+		t.Errorf("required extensions = %v", doc.ExtensionsRequired)
+	}
+	positions, indices := doc.Accessors[0], doc.Accessors[1]
+	if positions.Count != len(m.Vertices) || indices.Count != 3*len(m.Triangles) || indices.ComponentType != componentUnsignedShort {
+		t.Errorf("accessors = %+v", doc.Accessors)
+	}
+
+	// Dequantizing through the mesh node gives back the vertices
+	node := doc.Nodes[1]
+	tolerance := (m.Bounds().Max.X - m.Bounds().Min.X) / quantizedMax
+	for i, v := range m.Vertices {
+		var q [4]uint16
+		binary.Read(bytes.NewReader(bin[i*8:]), binary.LittleEndian, &q)
+		for axis, want := range []float64{v.X, v.Y, v.Z} {
+			got := node.Translation[axis] + float64(q[axis])*node.Scale[axis]
+			if math.Abs(got-want) > tolerance {
+				t.Fatalf("vertex %d axis %d = %v, want %v", i, axis, got, want)
+			}
+		}
+	}
+
+	view := doc.BufferViews[1]
+	for i, tri := range m.Triangles {
+		for c, want := range tri {
+			if got := binary.LittleEndian.Uint16(bin[view.ByteOffset+(i*3+c)*2:]); int(got) != want {
+				t.Fatalf("triangle %d corner %d = %d, want %d", i, c, got, want)
+			}
+		}
+	}
+}
+
+func TestWriteGLBFloat(t *testing.T) {
+	m := grid(2, -1)
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, m, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	doc, bin := decode(t, buf.Bytes())
+	if len(doc.ExtensionsUsed) != 0 || doc.Accessors[0].ComponentType != componentFloat {
+		t.Errorf("unquantized GLB uses %v, component type %d", doc.ExtensionsUsed, doc.Accessors[0].ComponentType)
+	}
+	var v [3]float32
+	binary.Read(bytes.NewReader(bin), binary.LittleEndian, &v)
+	if v != [3]float32{float32(m.Vertices[0].X), float32(m.Vertices[0].Y), float32(m.Vertices[0].Z)} {
+		t.Errorf("first position = %v, want %+v", v, m.Vertices[0])
+	}
+}
+
+// A mesh flat along an axis has no extent to divide by there
+func TestWriteGLBFlat(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	b.AddTriangle(geometry.Vec3{X: 0, Y: 0, Z: 5}, geometry.Vec3{X: 1, Y: 0, Z: 5}, geometry.Vec3{X: 0, Y: 1, Z: 5})
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, b.Mesh(), DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	doc, _ := decode(t, buf.Bytes())
+	if s := doc.Nodes[1].Scale; s[2] != 1 || math.IsNaN(s[0]) {
+		t.Errorf("scale = %v", s)
+	}
+}
+
+func TestWriteGLBLargeIndices(t *testing.T) {
+	m := grid(200, 0)
+	if len(m.Vertices) < math.MaxUint16 {
+		t.Fatalf("only %d vertices", len(m.Vertices))
+	}
+	var buf bytes.Buffer
+	if err := WriteGLB(&buf, m, DefaultOptions()); err != nil {
+		t.Fatal(err)
+	}
+	doc, bin := decode(t, buf.Bytes())
+	if doc.Accessors[1].ComponentType != componentUnsignedInt {
+		t.Fatalf("index component type = %d, want uint32", doc.Accessors[1].ComponentType)
+	}
+	last := m.Triangles[len(m.Triangles)-1][2]
+	if got := binary.LittleEndian.Uint32(bin[doc.BufferViews[1].ByteOffset+doc.BufferViews[1].ByteLength-4:]); int(got) != last {
+		t.Errorf("last index = %d, want %d", got, last)
+	}
+}
+
+func TestWriteGLBEmpty(t *testing.T) {
+	if err := WriteGLB(&bytes.Buffer{}, &geometry.Mesh{}, DefaultOptions()); err == nil {
+		t.Error("wrote a GLB for an empty mesh")
+	}
+}
@@ -0,0 +1,65 @@
+package geometry
+
+import (
+	"cmp"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"math"
+	"slices"
+)
+
+// CanonicalHash fingerprints the surface rather than the file. Coordinates
+// are normalized to float32, the precision binary STL stores, each
+// triangle starts at its smallest corner (keeping its winding) and
+// triangles are sorted. The same part saved as binary or full-precision
+// ASCII STL, OBJ or 3MF, indexed or not, or with faces reordered hashes
+// the same. Exports printed with fewer digits than float32 holds can still
+// differ; the diff's tolerance comparison catches those.
+func (m *Mesh) CanonicalHash() string {
+	type corner [3]uint32
+	snap := func(v Vec3) corner {
+		var c corner
+		for i := range c {
+			f := float32(v.Axis(i))
+			if f == 0 {
+				f = 0 // -0 and +0 are the same point
+			}
+			c[i] = math.Float32bits(f)
+		}
+		return c
+	}
+	compare := func(a, b corner) int {
+		return cmp.Or(cmp.Compare(a[0], b[0]), cmp.Compare(a[1], b[1]), cmp.Compare(a[2], b[2]))
+	}
+
+	tris := make([][3]corner, len(m.Triangles))
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		t := [3]corner{snap(a), snap(b), snap(c)}
+		// Rotating keeps the winding, so a flipped face still changes the hash
+		for compare(t[1], t[0]) < 0 || compare(t[2], t[0]) < 0 {
+			t = [3]corner{t[1], t[2], t[0]}
+		}
+		tris[i] = t
+	}
+	slices.SortFunc(tris, func(a, b [3]corner) int {
+		return cmp.Or(compare(a[0], b[0]), compare(a[1], b[1]), compare(a[2], b[2]))
+	})
+
+	h := sha256.New()
+	var buf []byte
+	for _, t := range tris {
+		for _, c := range t {
+			for _, x := range c {
+				buf = binary.LittleEndian.AppendUint32(buf, x)
+			}
+		}
+		if len(buf) >= 64*1024 {
+			h.Write(buf)
+			buf = buf[:0]
+		}
+	}
+	h.Write(buf)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,269 @@
+package kicad
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// ComponentChange lists what changed on a component found in both
+// versions under the same reference: value, footprint, library symbol,
+// user fields ("fields.MPN"), DNP and BOM flags, and placement
+type ComponentChange struct {
+	Reference string        `json:"reference"`
+	Changes   []FieldChange `json:"changes"`
+}
+
+// NetChange is a net in both versions whose pins changed. A net that was
+// renamed, e.g. by relabeling or because its generated name followed a
+// re-annotated pin, is matched by the pins it shares and records its old
+// name.
+type NetChange struct {
+	Name        string   `json:"name"`
+	RenamedFrom string   `json:"renamed_from,omitempty"`
+	PinsAdded   []string `json:"pins_added"`
+	PinsRemoved []string `json:"pins_removed"`
+}
+
+type Diff struct {
+	// Kind, format version and generator changes
+	Changes           []FieldChange     `json:"changes"`
+	ComponentsAdded   []Component       `json:"components_added"`
+	ComponentsRemoved []Component       `json:"components_removed"`
+	ComponentsChanged []ComponentChange `json:"components_changed"`
+	NetsAdded         []Net             `json:"nets_added"`
+	NetsRemoved       []Net             `json:"nets_removed"`
+	NetsChanged       []NetChange       `json:"nets_changed"`
+	// Track, via and zone totals of boards
+	Routing []FieldChange `json:"routing"`
+}
+
+// Empty reports whether nothing electrical or placed changed. Saving in a
+// newer KiCad rewrites UUIDs and the header but leaves a diff empty.
+func (d *Diff) Empty() bool {
+	return len(d.ComponentsAdded) == 0 && len(d.ComponentsRemoved) == 0 && len(d.ComponentsChanged) == 0 &&
+		len(d.NetsAdded) == 0 && len(d.NetsRemoved) == 0 && len(d.NetsChanged) == 0 && len(d.Routing) == 0
+}
+
+// Compare reports how the "to" design differs from the "from" design.
+// Components are matched by reference and nets by name, then by the pins
+// they share.
+func Compare(from, to *File) *Diff {
+	d := &Diff{
+		Changes:           []FieldChange{},
+		ComponentsAdded:   []Component{},
+		ComponentsRemoved: []Component{},
+		ComponentsChanged: []ComponentChange{},
+		NetsAdded:         []Net{},
+		NetsRemoved:       []Net{},
+		NetsChanged:       []NetChange{},
+		Routing:           []FieldChange{},
+	}
+	field := func(changes *[]FieldChange, name, a, b string) {
+		if a != b {
+			*changes = append(*changes, FieldChange{Field: name, From: a, To: b})
+		}
+	}
+	field(&d.Changes, "kind", from.Kind, to.Kind)
+	field(&d.Changes, "version", from.Version, to.Version)
+	field(&d.Changes, "generator", from.Generator, to.Generator)
+
+	before, after := componentKeys(from.Components), componentKeys(to.Components)
+	for k, a := range before {
+		b, ok := after[k]
+		if !ok {
+			d.ComponentsRemoved = append(d.ComponentsRemoved, a)
+			continue
+		}
+		if changes := compareComponents(a, b); len(changes) > 0 {
+			d.ComponentsChanged = append(d.ComponentsChanged, ComponentChange{Reference: a.Reference, Changes: changes})
+		}
+	}
+	for k, b := range after {
+		if _, ok := before[k]; !ok {
+			d.ComponentsAdded = append(d.ComponentsAdded, b)
+		}
+	}
+	sortComponents(d.ComponentsAdded)
+	sortComponents(d.ComponentsRemoved)
+	sort.Slice(d.ComponentsChanged, func(i, j int) bool {
+		return naturalLess(d.ComponentsChanged[i].Reference, d.ComponentsChanged[j].Reference)
+	})
+
+	compareNets(d, from.Nets, to.Nets)
+
+	if from.Routing != nil || to.Routing != nil {
+		a, b := Routing{}, Routing{}
+		if from.Routing != nil {
+			a = *from.Routing
+		}
+		if to.Routing != nil {
+			b = *to.Routing
+		}
+		field(&d.Routing, "tracks", strconv.Itoa(a.Tracks), strconv.Itoa(b.Tracks))
+		field(&d.Routing, "vias", strconv.Itoa(a.Vias), strconv.Itoa(b.Vias))
+		field(&d.Routing, "zones", strconv.Itoa(a.Zones), strconv.Itoa(b.Zones))
+		field(&d.Routing, "track_length", mm(a.TrackLength), mm(b.TrackLength))
+	}
+	return d
+}
+
+// componentKeys indexes components by reference; repeated unannotated
+// references like "R?" are told apart by their order
+func componentKeys(cs []Component) map[string]Component {
+	out := make(map[string]Component, len(cs))
+	seen := make(map[string]int)
+	for _, c := range cs {
+		seen[c.Reference]++
+		k := c.Reference
+		if n := seen[c.Reference]; n > 1 {
+			k = fmt.Sprintf("%s#%d", c.Reference, n)
+		}
+		out[k] = c
+	}
+	return out
+}
+
+func compareComponents(a, b Component) []FieldChange {
+	var changes []FieldChange
+	field := func(name, x, y string) {
+		if x != y {
+			changes = append(changes, FieldChange{Field: name, From: x, To: y})
+		}
+	}
+	field("value", a.Value, b.Value)
+	field("footprint", a.Footprint, b.Footprint)
+	field("lib_id", a.LibID, b.LibID)
+	field("dnp", strconv.FormatBool(a.DNP), strconv.FormatBool(b.DNP))
+	field("exclude_from_bom", strconv.FormatBool(a.ExcludeFromBOM), strconv.FormatBool(b.ExcludeFromBOM))
+
+	names := make(map[string]bool)
+	for k := range a.Fields {
+		names[k] = true
+	}
+	for k := range b.Fields {
+		names[k] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for k := range names {
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+	for _, k := range sorted {
+		field("fields."+k, a.Fields[k], b.Fields[k])
+	}
+
+	if a.Placement != nil && b.Placement != nil {
+		field("position", mm(a.Placement.X)+", "+mm(a.Placement.Y), mm(b.Placement.X)+", "+mm(b.Placement.Y))
+		field("rotation", mm(a.Placement.Rotation), mm(b.Placement.Rotation))
+		field("layer", a.Placement.Layer, b.Placement.Layer)
+	}
+	return changes
+}
+
+func compareNets(d *Diff, from, to []Net) {
+	after := make(map[string]Net, len(to))
+	for _, n := range to {
+		after[n.Name] = n
+	}
+	var removed []Net
+	matched := make(map[string]bool)
+	for _, a := range from {
+		b, ok := after[a.Name]
+		if !ok {
+			removed = append(removed, a)
+			continue
+		}
+		matched[b.Name] = true
+		if c, changed := netChange(a, b); changed {
+			d.NetsChanged = append(d.NetsChanged, c)
+		}
+	}
+	var added []Net
+	for _, b := range to {
+		if !matched[b.Name] {
+			added = append(added, b)
+		}
+	}
+
+	// Pair the remaining nets that share the most pins, best pairs first
+	type pair struct{ a, b, shared int }
+	var pairs []pair
+	for i, a := range removed {
+		pins := make(map[string]bool, len(a.Pins))
+		for _, p := range a.Pins {
+			pins[p] = true
+		}
+		for j, b := range added {
+			shared := 0
+			for _, p := range b.Pins {
+				if pins[p] {
+					shared++
+				}
+			}
+			if shared > 0 {
+				pairs = append(pairs, pair{i, j, shared})
+			}
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].shared > pairs[j].shared })
+	usedA, usedB := make([]bool, len(removed)), make([]bool, len(added))
+	for _, p := range pairs {
+		if usedA[p.a] || usedB[p.b] {
+			continue
+		}
+		usedA[p.a], usedB[p.b] = true, true
+		c, _ := netChange(removed[p.a], added[p.b])
+		c.RenamedFrom = removed[p.a].Name
+		d.NetsChanged = append(d.NetsChanged, c)
+	}
+	for i, n := range removed {
+		if !usedA[i] {
+			d.NetsRemoved = append(d.NetsRemoved, n)
+		}
+	}
+	for i, n := range added {
+		if !usedB[i] {
+			d.NetsAdded = append(d.NetsAdded, n)
+		}
+	}
+	sort.Slice(d.NetsChanged, func(i, j int) bool { return d.NetsChanged[i].Name < d.NetsChanged[j].Name })
+}
+
+func netChange(a, b Net) (NetChange, bool) {
+	c := NetChange{Name: b.Name, PinsAdded: []string{}, PinsRemoved: []string{}}
+	before := make(map[string]bool, len(a.Pins))
+	for _, p := range a.Pins {
+		before[p] = true
+	}
+	after := make(map[string]bool, len(b.Pins))
+	for _, p := range b.Pins {
+		after[p] = true
+		if !before[p] {
+			c.PinsAdded = append(c.PinsAdded, p)
+		}
+	}
+	for _, p := range a.Pins {
+		if !after[p] {
+			c.PinsRemoved = append(c.PinsRemoved, p)
+		}
+	}
+	return c, len(c.PinsAdded) > 0 || len(c.PinsRemoved) > 0
+}
+
+// mm writes a length or angle to a micron, trimmed
+func mm(x float64) string {
+	s := strconv.FormatFloat(x, 'f', 3, 64)
+	s = strings.TrimRight(strings.TrimRight(s, "0"), ".")
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
@@ -0,0 +1,200 @@
+// Package kicad reads KiCad 6+ schematics (.kicad_sch) and boards
+// (.kicad_pcb), which are S-expressions, into the components and nets they
+// describe, so two versions can be compared by what changed electrically
+// rather than byte for byte.
+package kicad
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var ErrNotKiCad = errors.New("file is not a KiCad schematic or board")
+
+const (
+	KindSchematic = "schematic"
+	KindPCB       = "pcb"
+)
+
+// Component is a schematic symbol or a board footprint. Symbols with
+// several units, e.g. the four gates of a quad op-amp, are one component.
+type Component struct {
+	Reference string `json:"reference"`
+	Value     string `json:"value"`
+	// Footprint is the library footprint, e.g.
+	// "Resistor_SMD:R_0603_1608Metric"
+	Footprint string `json:"footprint,omitempty"`
+	// LibID is a schematic symbol's library symbol, e.g. "Device:R"
+	LibID string `json:"lib_id,omitempty"`
+	// Fields are the remaining user properties, e.g. MPN or Manufacturer
+	Fields map[string]string `json:"fields,omitempty"`
+	// Placement is a footprint's position on the board
+	Placement *Placement `json:"placement,omitempty"`
+	// DNP marks parts that are not to be populated
+	DNP            bool `json:"dnp,omitempty"`
+	ExcludeFromBOM bool `json:"exclude_from_bom,omitempty"`
+}
+
+// Placement is in board millimeters, rotation in degrees counter-clockwise
+type Placement struct {
+	X        float64 `json:"x"`
+	Y        float64 `json:"y"`
+	Rotation float64 `json:"rotation"`
+	Layer    string  `json:"layer"`
+}
+
+// Net is a set of connected pins, each written "reference.pin", e.g. "R1.2"
+type Net struct {
+	Name string   `json:"name"`
+	Pins []string `json:"pins"`
+}
+
+// Routing totals a board's copper: track segments and arcs, vias, zones
+// and the summed track length in millimeters
+type Routing struct {
+	Tracks      int     `json:"tracks"`
+	Vias        int     `json:"vias"`
+	Zones       int     `json:"zones"`
+	TrackLength float64 `json:"track_length"`
+}
+
+type File struct {
+	Kind string `json:"kind"`
+	// Version is the file format version, a date such as 20230121
+	Version    string      `json:"version"`
+	Generator  string      `json:"generator,omitempty"`
+	Components []Component `json:"components"`
+	Nets       []Net       `json:"nets"`
+	Routing    *Routing    `json:"routing,omitempty"`
+	// Warnings list things that were read but not resolved, e.g. buses or
+	// sub-sheets whose connections live in other files
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+func IsKiCad(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".kicad_sch", ".kicad_pcb":
+		return true
+	}
+	return false
+}
+
+// ParseBytes reads a schematic or board, telling them apart by the root
+// list rather than the extension
+func ParseBytes(data []byte) (*File, error) {
+	root, err := ParseSExpr(data)
+	if err != nil {
+		if errors.Is(err, ErrNotKiCad) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to parse S-expression: %w", err)
+	}
+
+	var f *File
+	switch root.Head() {
+	case "kicad_sch":
+		f = parseSchematic(root)
+	case "kicad_pcb":
+		f = parsePCB(root)
+	default:
+		return nil, ErrNotKiCad
+	}
+	if v := root.Child("version"); v != nil {
+		f.Version = v.Arg(0)
+	}
+	if g := root.Child("generator"); g != nil {
+		f.Generator = g.Arg(0)
+	}
+	sortComponents(f.Components)
+	sort.Slice(f.Nets, func(i, j int) bool { return f.Nets[i].Name < f.Nets[j].Name })
+	return f, nil
+}
+
+func (f *File) warn(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	for _, w := range f.Warnings {
+		if w == msg {
+			return
+		}
+	}
+	f.Warnings = append(f.Warnings, msg)
+}
+
+// Properties KiCad itself uses; everything else is a user field
+var standardProperties = map[string]bool{
+	"Reference":   true,
+	"Value":       true,
+	"Footprint":   true,
+	"Datasheet":   true,
+	"Description": true,
+}
+
+// readProperties reads (property "Name" "value" ...) children into the
+// component, user fields included
+func readProperties(n *Node, c *Component) {
+	for _, p := range n.Children("property") {
+		name, value := p.Arg(0), p.Arg(1)
+		switch {
+		case name == "Reference":
+			c.Reference = value
+		case name == "Value":
+			c.Value = value
+		case name == "Footprint":
+			c.Footprint = value
+		case standardProperties[name], strings.HasPrefix(name, "ki_"), value == "" || value == "~":
+		default:
+			if c.Fields == nil {
+				c.Fields = make(map[string]string)
+			}
+			c.Fields[name] = value
+		}
+	}
+}
+
+// sortComponents orders references naturally, so R2 comes before R10
+func sortComponents(cs []Component) {
+	sort.SliceStable(cs, func(i, j int) bool { return naturalLess(cs[i].Reference, cs[j].Reference) })
+}
+
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := isDigit(a[0]), isDigit(b[0])
+		if da && db {
+			na, ra := splitNumber(a)
+			nb, rb := splitNumber(b)
+			// Compare numerically: shorter is smaller once zeros are gone
+			na, nb = strings.TrimLeft(na, "0"), strings.TrimLeft(nb, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = ra, rb
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func splitNumber(s string) (string, string) {
+	i := 0
+	for i < len(s) && isDigit(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// pinName joins a reference and pin number the way nets list them
+func pinName(reference, pin string) string {
+	return reference + "." + pin
+}
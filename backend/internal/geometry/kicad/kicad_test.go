@@ -0,0 +1,157 @@
+package kicad
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const schematic = `(kicad_sch (version 20230121) (generator eeschema)
+  (lib_symbols
+    (symbol "Device:R"
+      (symbol "R_1_1"
+        (pin passive line (at 0 3.81 270) (length 1.27) (name "~") (number "1"))
+        (pin passive line (at 0 -3.81 90) (length 1.27) (name "~") (number "2")))))
+  (symbol (lib_id "Device:R") (at 100 100 0) (unit 1)
+    (property "Reference" "R1") (property "Value" "10k")
+    (property "Footprint" "Resistor_SMD:R_0603_1608Metric") (property "MPN" "RC0603FR-0710KL"))
+  (symbol (lib_id "Device:R") (at 120 100 0) (unit 1) (dnp yes)
+    (property "Reference" "R2") (property "Value" "4k7"))
+  (symbol (lib_id "Device:R") (at 200 100 0) (unit 1)
+    (property "Reference" "R10") (property "Value" "1k"))
+  (wire (pts (xy 100 96.19) (xy 120 96.19)))
+  (wire (pts (xy 100 103.81) (xy 120 103.81)))
+  (label "VCC" (at 110 96.19 0))
+  (sheet (at 0 0) (property "Sheetname" "power")))
+`
+
+func TestParseSchematic(t *testing.T) {
+	f, err := ParseBytes([]byte(schematic))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if f.Kind != KindSchematic || f.Version != "20230121" || f.Generator != "eeschema" {
+		t.Errorf("kind %q version %q generator %q", f.Kind, f.Version, f.Generator)
+	}
+
+	var refs []string
+	for _, c := range f.Components {
+		refs = append(refs, c.Reference)
+	}
+	if !reflect.DeepEqual(refs, []string{"R1", "R2", "R10"}) {
+		t.Errorf("references = %v, want R1 R2 R10", refs)
+	}
+	r1 := f.Components[0]
+	if r1.Value != "10k" || r1.LibID != "Device:R" || r1.Fields["MPN"] != "RC0603FR-0710KL" {
+		t.Errorf("R1 = %+v", r1)
+	}
+	if !f.Components[1].DNP {
+		t.Error("R2 isn't marked DNP")
+	}
+
+	want := []Net{
+		{Name: "Net-(R1-Pad2)", Pins: []string{"R1.2", "R2.2"}},
+		{Name: "VCC", Pins: []string{"R1.1", "R2.1"}},
+	}
+	if !reflect.DeepEqual(f.Nets, want) {
+		t.Errorf("nets = %+v, want %+v", f.Nets, want)
+	}
+	if len(f.Warnings) != 1 || !strings.Contains(f.Warnings[0], `"power"`) {
+		t.Errorf("warnings = %v, want one about the power sub-sheet", f.Warnings)
+	}
+}
+
+const board = `(kicad_pcb (version 20221018) (generator pcbnew)
+  (net 0 "") (net 1 "GND") (net 2 "VCC")
+  (footprint "Resistor_SMD:R_0603_1608Metric" (layer "F.Cu") (at 10 20 90)
+    (property "Reference" "R1") (property "Value" "10k")
+    (pad "1" smd rect (net 2 "VCC")) (pad "2" smd rect (net 1 "GND")))
+  (module "Capacitor_SMD:C_0402" (layer "B.Cu") (at 30 20)
+    (fp_text reference "C1") (fp_text value "100n")
+    (attr smd exclude_from_bom)
+    (pad 1 smd rect (net 2)) (pad 2 smd rect (net 1)))
+  (segment (start 0 0) (end 3 4) (width 0.25) (net 1))
+  (arc (start 0 1) (mid 1 0) (end 0 -1) (width 0.25) (net 1))
+  (via (at 5 5) (net 1))
+  (zone (net 1) (net_name "GND")))
+`
+
+func TestParsePCB(t *testing.T) {
+	f, err := ParseBytes([]byte(board))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if f.Kind != KindPCB || len(f.Components) != 2 {
+		t.Fatalf("kind %q with %d components", f.Kind, len(f.Components))
+	}
+	c1, r1 := f.Components[0], f.Components[1]
+	if c1.Reference != "C1" || c1.Value != "100n" || !c1.ExcludeFromBOM || c1.Placement.Layer != "B.Cu" {
+		t.Errorf("C1 = %+v", c1)
+	}
+	if r1.Reference != "R1" || *r1.Placement != (Placement{X: 10, Y: 20, Rotation: 90, Layer: "F.Cu"}) {
+		t.Errorf("R1 = %+v, placement %+v", r1, r1.Placement)
+	}
+
+	want := []Net{
+		{Name: "GND", Pins: []string{"C1.2", "R1.2"}},
+		{Name: "VCC", Pins: []string{"C1.1", "R1.1"}},
+	}
+	if !reflect.DeepEqual(f.Nets, want) {
+		t.Errorf("nets = %+v, want %+v", f.Nets, want)
+	}
+	// A 3-4-5 segment plus a half circle of radius 1
+	if r := f.Routing; r.Tracks != 2 || r.Vias != 1 || r.Zones != 1 || r.TrackLength != 8.142 {
+		t.Errorf("routing = %+v", r)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"   ",
+		"kicad_sch",
+		"(",
+		"(kicad_sch (version 1)",
+		`(kicad_sch (property "Reference)`,
+		`(kicad_sch (property "R1\`,
+		")",
+		strings.Repeat("(", maxDepth+2) + strings.Repeat(")", maxDepth+2),
+	} {
+		f, err := ParseBytes([]byte(input))
+		if err == nil {
+			t.Errorf("%.40q parsed as %+v", input, f)
+		}
+	}
+}
+
+func TestParseNotKiCad(t *testing.T) {
+	for _, input := range []string{
+		"solid cube\nendsolid cube\n",
+		"()",
+		"(kicad_symbol_lib (version 20220914))",
+		"((kicad_sch))",
+	} {
+		if _, err := ParseBytes([]byte(input)); !errors.Is(err, ErrNotKiCad) {
+			t.Errorf("%q: error = %v, want ErrNotKiCad", input, err)
+		}
+	}
+}
+
+// Structures missing their usual children, or with lists where atoms
+// belong, parse without panicking
+func TestParseSparse(t *testing.T) {
+	for _, input := range []string{
+		"(kicad_sch (symbol) (wire) (wire (pts)) (wire (pts (xy))) (junction) (label) (sheet))",
+		"(kicad_sch (lib_symbols (symbol) (symbol (x) (symbol (pin)))) (symbol (lib_id) (at)))",
+		`(kicad_sch (lib_symbols (symbol "A" (power) (symbol "A_1_1" (pin power_in line (at) (number "1") hide))))
+		  (symbol (lib_id "A") (at (1) 2 3) (unit x) (mirror y) (property "Value" "+5V")))`,
+		"(kicad_pcb (net) (footprint) (footprint (pad) (pad 1 (net)) (attr)) (segment) (arc) (via) (zone))",
+		"(kicad_pcb (module (fp_text) (at a b c) (pad (1) (net (2)))))",
+		"(kicad_sch (version (20230121)) (generator))",
+	} {
+		if _, err := ParseBytes([]byte(input)); err != nil {
+			t.Errorf("%.40q: %v", input, err)
+		}
+	}
+}
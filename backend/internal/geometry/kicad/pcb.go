@@ -0,0 +1,146 @@
+package kicad
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// parsePCB reads footprints and the nets their pads are on. Boards list
+// connectivity explicitly, so nets come straight from the pads.
+func parsePCB(root *Node) *File {
+	f := &File{Kind: KindPCB, Components: []Component{}, Nets: []Net{}, Routing: &Routing{}}
+
+	// Pads name their net by number in older files and by name in newer
+	netNames := make(map[string]string)
+	for _, n := range root.Children("net") {
+		netNames[n.Arg(0)] = n.Arg(1)
+	}
+	padNet := func(pad *Node) string {
+		n := pad.Child("net")
+		if n == nil {
+			return ""
+		}
+		if name := n.Arg(1); name != "" {
+			return name
+		}
+		if name, ok := netNames[n.Arg(0)]; ok {
+			return name
+		}
+		if _, err := strconv.Atoi(n.Arg(0)); err != nil {
+			return n.Arg(0)
+		}
+		return ""
+	}
+
+	pins := make(map[string]map[string]bool)
+	for _, fp := range root.List {
+		// KiCad 5 boards call footprints modules
+		if fp.Head() != "footprint" && fp.Head() != "module" {
+			continue
+		}
+		c := Component{Footprint: fp.Arg(0), Placement: &Placement{}}
+		if l := fp.Child("layer"); l != nil {
+			c.Placement.Layer = l.Arg(0)
+		}
+		if at := fp.Child("at"); at != nil {
+			c.Placement.X, c.Placement.Y, c.Placement.Rotation = at.Float(0), at.Float(1), at.Float(2)
+		}
+		readProperties(fp, &c)
+		// Before KiCad 7 reference and value were text items
+		for _, t := range fp.Children("fp_text") {
+			switch t.Arg(0) {
+			case "reference":
+				c.Reference = t.Arg(1)
+			case "value":
+				c.Value = t.Arg(1)
+			}
+		}
+		if attr := fp.Child("attr"); attr != nil {
+			c.DNP = attr.Has("dnp")
+			c.ExcludeFromBOM = attr.Has("exclude_from_bom")
+		}
+		f.Components = append(f.Components, c)
+
+		for _, pad := range fp.Children("pad") {
+			number, net := pad.Arg(0), padNet(pad)
+			if number == "" || net == "" || c.Reference == "" {
+				continue
+			}
+			if pins[net] == nil {
+				pins[net] = make(map[string]bool)
+			}
+			pins[net][pinName(c.Reference, number)] = true
+		}
+	}
+
+	for name, members := range pins {
+		f.Nets = append(f.Nets, Net{Name: name, Pins: sortedPins(members)})
+	}
+
+	r := f.Routing
+	for _, n := range root.List {
+		switch n.Head() {
+		case "segment":
+			r.Tracks++
+			r.TrackLength += distance(point(n.Child("start")), point(n.Child("end")))
+		case "arc":
+			r.Tracks++
+			r.TrackLength += arcLength(point(n.Child("start")), point(n.Child("mid")), point(n.Child("end")))
+		case "via":
+			r.Vias++
+		case "zone":
+			r.Zones++
+		}
+	}
+	r.TrackLength = math.Round(r.TrackLength*1000) / 1000
+	return f
+}
+
+func sortedPins(set map[string]bool) []string {
+	out := make([]string, 0, len(set))
+	for p := range set {
+		out = append(out, p)
+	}
+	sort.Slice(out, func(i, j int) bool { return naturalLess(out[i], out[j]) })
+	return out
+}
+
+type xy [2]float64
+
+func point(n *Node) xy {
+	if n == nil {
+		return xy{}
+	}
+	return xy{n.Float(0), n.Float(1)}
+}
+
+func distance(a, b xy) float64 {
+	return math.Hypot(b[0]-a[0], b[1]-a[1])
+}
+
+// arcLength measures the arc through three points, falling back to the
+// chord when they're collinear
+func arcLength(a, m, b xy) float64 {
+	ax, ay := a[0]-m[0], a[1]-m[1]
+	bx, by := b[0]-m[0], b[1]-m[1]
+	d := 2 * (ax*by - ay*bx)
+	if math.Abs(d) < 1e-12 {
+		return distance(a, b)
+	}
+	// Circle center relative to the mid point
+	cx := (by*(ax*ax+ay*ay) - ay*(bx*bx+by*by)) / d
+	cy := (ax*(bx*bx+by*by) - bx*(ax*ax+ay*ay)) / d
+	r := math.Hypot(cx, cy)
+	bearing := func(p xy) float64 { return math.Atan2(p[1]-cy, p[0]-cx) }
+	// The mid point halves the arc, so each half sweeps at most half a turn
+	between := func(from, to float64) float64 {
+		s := math.Abs(to - from)
+		if s > math.Pi {
+			s = 2*math.Pi - s
+		}
+		return s
+	}
+	ta, tm, tb := bearing(xy{ax, ay}), bearing(xy{}), bearing(xy{bx, by})
+	return r * (between(ta, tm) + between(tm, tb))
+}
@@ -0,0 +1,360 @@
+package kicad
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Schematics don't list connectivity; it's drawn. Nets are worked out the
+// way eeschema does on a single sheet: wires connect their end points, and
+// anything ending on a wire's middle, pins touching pins, labels with the
+// same text, power symbols with the same value and hidden power pins with
+// the same name are all connected.
+
+type libPin struct {
+	number, name string
+	at           xy
+	unit, style  int
+	// Hidden power input pins of older libraries join the global net of
+	// their name
+	hiddenPower bool
+}
+
+type libSymbol struct {
+	power bool
+	pins  []libPin
+}
+
+// Label kinds in order of precedence when a net has several names
+const (
+	labelPower = iota
+	labelGlobal
+	labelHierarchical
+	labelLocal
+)
+
+type label struct {
+	text string
+	kind int
+	at   xy
+}
+
+type symbolPin struct {
+	reference, number string
+	at                xy
+}
+
+type segment struct{ a, b xy }
+
+func parseSchematic(root *Node) *File {
+	f := &File{Kind: KindSchematic, Components: []Component{}, Nets: []Net{}}
+
+	libs := make(map[string]*libSymbol)
+	if ls := root.Child("lib_symbols"); ls != nil {
+		for _, s := range ls.Children("symbol") {
+			libs[s.Arg(0)] = readLibSymbol(s)
+		}
+	}
+
+	var wires []segment
+	var points []xy
+	var labels []label
+	var pins []symbolPin
+	components := make(map[string]int)
+
+	for _, n := range root.List {
+		switch n.Head() {
+		case "wire":
+			if pts := n.Child("pts"); pts != nil {
+				xys := pts.Children("xy")
+				for i := 0; i+1 < len(xys); i++ {
+					wires = append(wires, segment{point(xys[i]), point(xys[i+1])})
+				}
+			}
+		case "junction":
+			points = append(points, point(n.Child("at")))
+		case "label":
+			labels = append(labels, label{text: n.Arg(0), kind: labelLocal, at: point(n.Child("at"))})
+		case "global_label":
+			labels = append(labels, label{text: n.Arg(0), kind: labelGlobal, at: point(n.Child("at"))})
+		case "hierarchical_label":
+			labels = append(labels, label{text: n.Arg(0), kind: labelHierarchical, at: point(n.Child("at"))})
+		case "bus", "bus_entry":
+			f.warn("buses are not followed; nets through them are incomplete")
+		case "sheet":
+			name := "sub-sheet"
+			for _, p := range n.Children("property") {
+				if p.Arg(0) == "Sheetname" || p.Arg(0) == "Sheet name" {
+					name = fmt.Sprintf("sub-sheet %q", p.Arg(1))
+				}
+			}
+			f.warn("%s is in another file; its components and nets are not included", name)
+		case "symbol":
+			c, lib := readSymbol(n, libs)
+			if lib == nil {
+				f.warn("symbol %s has no library definition; its pins are not connected", c.LibID)
+			}
+			power := lib != nil && lib.power
+			if !power && !strings.HasPrefix(c.Reference, "#") {
+				f.addComponent(c, components)
+			}
+			if lib == nil {
+				continue
+			}
+			for _, p := range symbolPins(n, lib) {
+				switch {
+				case power:
+					labels = append(labels, label{text: c.Value, kind: labelPower, at: p.at})
+				case p.hiddenPower:
+					labels = append(labels, label{text: p.name, kind: labelPower, at: p.at})
+					fallthrough
+				default:
+					pins = append(pins, symbolPin{reference: c.Reference, number: p.number, at: p.at})
+				}
+			}
+		}
+	}
+
+	u := newUnionFind()
+	for _, w := range wires {
+		u.union(key(w.a), key(w.b))
+	}
+	// Wire ends, junctions and labels on a wire's middle join it; pins only
+	// connect at wire ends
+	var touching []xy
+	for _, w := range wires {
+		touching = append(touching, w.a, w.b)
+	}
+	touching = append(touching, points...)
+	for _, l := range labels {
+		touching = append(touching, l.at)
+	}
+	for _, p := range touching {
+		for _, w := range wires {
+			if onSegment(p, w) {
+				u.union(key(p), key(w.a))
+			}
+		}
+	}
+	for _, p := range pins {
+		u.find(key(p.at))
+	}
+
+	byName := make(map[string]pointKey)
+	for _, l := range labels {
+		if first, ok := byName[l.text]; ok {
+			u.union(first, key(l.at))
+		} else {
+			byName[l.text] = key(l.at)
+		}
+	}
+
+	names := make(map[pointKey]label)
+	for _, l := range labels {
+		r := u.find(key(l.at))
+		if best, ok := names[r]; !ok || l.kind < best.kind || (l.kind == best.kind && l.text < best.text) {
+			names[r] = l
+		}
+	}
+	members := make(map[pointKey]map[string]bool)
+	for _, p := range pins {
+		r := u.find(key(p.at))
+		if members[r] == nil {
+			members[r] = make(map[string]bool)
+		}
+		members[r][pinName(p.reference, p.number)] = true
+	}
+
+	for r, set := range members {
+		connected := sortedPins(set)
+		name := names[r].text
+		if name == "" {
+			// A lone pin with nothing attached isn't a net
+			if len(connected) < 2 {
+				continue
+			}
+			ref, pin, _ := strings.Cut(connected[0], ".")
+			name = fmt.Sprintf("Net-(%s-Pad%s)", ref, pin)
+		}
+		f.Nets = append(f.Nets, Net{Name: name, Pins: connected})
+	}
+	return f
+}
+
+func readLibSymbol(n *Node) *libSymbol {
+	lib := &libSymbol{power: n.Has("power")}
+	for _, unit := range n.Children("symbol") {
+		// Units are named <symbol>_<unit>_<body style>; 0 means all
+		parts := strings.Split(unit.Arg(0), "_")
+		u, s := 0, 0
+		if len(parts) >= 3 {
+			u, _ = strconv.Atoi(parts[len(parts)-2])
+			s, _ = strconv.Atoi(parts[len(parts)-1])
+		}
+		for _, p := range unit.Children("pin") {
+			pin := libPin{unit: u, style: s, at: point(p.Child("at"))}
+			if num := p.Child("number"); num != nil {
+				pin.number = num.Arg(0)
+			}
+			if name := p.Child("name"); name != nil {
+				pin.name = name.Arg(0)
+			}
+			pin.hiddenPower = p.Arg(0) == "power_in" && p.Flag("hide")
+			lib.pins = append(lib.pins, pin)
+		}
+	}
+	return lib
+}
+
+func readSymbol(n *Node, libs map[string]*libSymbol) (Component, *libSymbol) {
+	c := Component{}
+	if id := n.Child("lib_id"); id != nil {
+		c.LibID = id.Arg(0)
+	}
+	readProperties(n, &c)
+	// Annotation may only be in the instance data
+	if strings.HasSuffix(c.Reference, "?") || c.Reference == "" {
+		if inst := n.Child("instances"); inst != nil {
+			for _, project := range inst.Children("project") {
+				for _, path := range project.Children("path") {
+					if ref := path.Child("reference"); ref != nil && ref.Arg(0) != "" {
+						c.Reference = ref.Arg(0)
+					}
+				}
+			}
+		}
+	}
+	c.DNP = n.Flag("dnp")
+	if n.Child("in_bom") != nil {
+		c.ExcludeFromBOM = !n.Flag("in_bom")
+	}
+
+	// The cached definition is keyed by lib_name when the symbol was
+	// edited in the schematic
+	name := c.LibID
+	if ln := n.Child("lib_name"); ln != nil {
+		name = ln.Arg(0)
+	}
+	return c, libs[name]
+}
+
+// addComponent adds a symbol, merging further units of a multi-unit part
+// into the first. Unannotated references like "R?" are never merged.
+func (f *File) addComponent(c Component, seen map[string]int) {
+	if i, ok := seen[c.Reference]; ok && !strings.HasSuffix(c.Reference, "?") {
+		existing := &f.Components[i]
+		for k, v := range c.Fields {
+			if existing.Fields == nil {
+				existing.Fields = make(map[string]string)
+			}
+			if _, ok := existing.Fields[k]; !ok {
+				existing.Fields[k] = v
+			}
+		}
+		return
+	}
+	seen[c.Reference] = len(f.Components)
+	f.Components = append(f.Components, c)
+}
+
+// symbolPins places the pins of the symbol's unit and body style on the
+// sheet. Library Y points up and sheet Y down; the symbol is rotated
+// counter-clockwise on the sheet, then mirrored.
+func symbolPins(n *Node, lib *libSymbol) []libPin {
+	at := n.Child("at")
+	origin, angle := point(at), 0.0
+	if at != nil {
+		angle = at.Float(2) * math.Pi / 180
+	}
+	unit, style := 1, 1
+	if u := n.Child("unit"); u != nil {
+		unit, _ = strconv.Atoi(u.Arg(0))
+	}
+	for _, head := range []string{"convert", "body_style"} {
+		if s := n.Child(head); s != nil {
+			style, _ = strconv.Atoi(s.Arg(0))
+		}
+	}
+	mirror := ""
+	if m := n.Child("mirror"); m != nil {
+		mirror = m.Arg(0)
+	}
+
+	cos, sin := math.Round(math.Cos(angle)), math.Round(math.Sin(angle))
+	var out []libPin
+	for _, p := range lib.pins {
+		if (p.unit != 0 && p.unit != unit) || (p.style != 0 && p.style != style) {
+			continue
+		}
+		sx, sy := p.at[0], -p.at[1]
+		x, y := sx*cos+sy*sin, -sx*sin+sy*cos
+		switch mirror {
+		case "x":
+			y = -y
+		case "y":
+			x = -x
+		}
+		p.at = xy{origin[0] + x, origin[1] + y}
+		out = append(out, p)
+	}
+	return out
+}
+
+// pointKey is a sheet position rounded to KiCad's schematic resolution of
+// 100 nm, so positions written slightly differently still meet
+type pointKey [2]int64
+
+func key(p xy) pointKey {
+	return pointKey{int64(math.Round(p[0] * 1e4)), int64(math.Round(p[1] * 1e4))}
+}
+
+// onSegment reports whether p lies on the wire, ends included
+func onSegment(p xy, w segment) bool {
+	const tolerance = 1e-4
+	dx, dy := w.b[0]-w.a[0], w.b[1]-w.a[1]
+	length := math.Hypot(dx, dy)
+	if length == 0 {
+		return false
+	}
+	if math.Abs((p[0]-w.a[0])*dy-(p[1]-w.a[1])*dx)/length > tolerance {
+		return false
+	}
+	t := ((p[0]-w.a[0])*dx + (p[1]-w.a[1])*dy) / (length * length)
+	return t >= -tolerance/length && t <= 1+tolerance/length
+}
+
+type unionFind struct {
+	parent map[pointKey]pointKey
+}
+
+func newUnionFind() *unionFind {
+	return &unionFind{parent: make(map[pointKey]pointKey)}
+}
+
+func (u *unionFind) find(k pointKey) pointKey {
+	p, ok := u.parent[k]
+	if !ok {
+		u.parent[k] = k
+		return k
+	}
+	if p == k {
+		return k
+	}
+	r := u.find(p)
+	u.parent[k] = r
+	return r
+}
+
+func (u *unionFind) union(a, b pointKey) {
+	ra, rb := u.find(a), u.find(b)
+	if ra == rb {
+		return
+	}
+	// Keep roots deterministic so net naming doesn't depend on order
+	if rb[0] < ra[0] || (rb[0] == ra[0] && rb[1] < ra[1]) {
+		ra, rb = rb, ra
+	}
+	u.parent[rb] = ra
+}
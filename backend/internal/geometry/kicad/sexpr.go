@@ -0,0 +1,183 @@
+package kicad
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node is an S-expression: an atom, quoted or not, or a list. KiCad lists
+// start with a symbol naming them, e.g. (at 10 20 90).
+type Node struct {
+	Atom   string
+	Quoted bool
+	List   []*Node
+	IsList bool
+}
+
+// Head is the symbol a list starts with, or empty
+func (n *Node) Head() string {
+	if !n.IsList || len(n.List) == 0 || n.List[0].IsList {
+		return ""
+	}
+	return n.List[0].Atom
+}
+
+// Arg is the i-th atom after the head, or empty
+func (n *Node) Arg(i int) string {
+	if !n.IsList || i+1 >= len(n.List) || n.List[i+1].IsList {
+		return ""
+	}
+	return n.List[i+1].Atom
+}
+
+// Float is the i-th atom after the head as a number, or 0
+func (n *Node) Float(i int) float64 {
+	v, _ := strconv.ParseFloat(n.Arg(i), 64)
+	return v
+}
+
+// Child is the first child list with the given head, or nil
+func (n *Node) Child(head string) *Node {
+	for _, c := range n.List {
+		if c.Head() == head {
+			return c
+		}
+	}
+	return nil
+}
+
+// Children are the child lists with the given head
+func (n *Node) Children(head string) []*Node {
+	var out []*Node
+	for _, c := range n.List {
+		if c.Head() == head {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// Has reports whether a bare atom, e.g. the hide in (pin ... hide), or a
+// child list with that head is present
+func (n *Node) Has(name string) bool {
+	for _, c := range n.List[1:] {
+		if (!c.IsList && !c.Quoted && c.Atom == name) || c.Head() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Flag reads a yes/no child such as (in_bom yes), or a bare flag atom
+func (n *Node) Flag(name string) bool {
+	if c := n.Child(name); c != nil {
+		v := c.Arg(0)
+		return v == "" || v == "yes" || v == "true"
+	}
+	return n.Has(name)
+}
+
+// ParseSExpr reads one S-expression. Strings are double-quoted with
+// backslash escapes; everything else up to whitespace or a parenthesis is
+// an atom.
+func ParseSExpr(data []byte) (*Node, error) {
+	p := &sexprParser{data: data}
+	p.skipSpace()
+	if p.pos >= len(p.data) || p.data[p.pos] != '(' {
+		return nil, ErrNotKiCad
+	}
+	n, err := p.node(0)
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// maxDepth bounds nesting so a malformed file can't exhaust the stack
+const maxDepth = 256
+
+type sexprParser struct {
+	data []byte
+	pos  int
+}
+
+func (p *sexprParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\r', '\n':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *sexprParser) node(depth int) (*Node, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("S-expression nested deeper than %d", maxDepth)
+	}
+	p.skipSpace()
+	if p.pos >= len(p.data) {
+		return nil, fmt.Errorf("unexpected end of file")
+	}
+
+	switch p.data[p.pos] {
+	case '(':
+		p.pos++
+		n := &Node{IsList: true}
+		for {
+			p.skipSpace()
+			if p.pos >= len(p.data) {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			if p.data[p.pos] == ')' {
+				p.pos++
+				return n, nil
+			}
+			child, err := p.node(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			n.List = append(n.List, child)
+		}
+	case ')':
+		return nil, fmt.Errorf("unexpected ) at byte %d", p.pos)
+	case '"':
+		p.pos++
+		var b strings.Builder
+		for p.pos < len(p.data) {
+			c := p.data[p.pos]
+			p.pos++
+			switch c {
+			case '"':
+				return &Node{Atom: b.String(), Quoted: true}, nil
+			case '\\':
+				if p.pos < len(p.data) {
+					switch e := p.data[p.pos]; e {
+					case 'n':
+						b.WriteByte('\n')
+					case 't':
+						b.WriteByte('\t')
+					default:
+						b.WriteByte(e)
+					}
+					p.pos++
+				}
+			default:
+				b.WriteByte(c)
+			}
+		}
+		return nil, fmt.Errorf("unterminated string")
+	default:
+		start := p.pos
+		for p.pos < len(p.data) {
+			c := p.data[p.pos]
+			if c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '(' || c == ')' {
+				break
+			}
+			p.pos++
+		}
+		return &Node{Atom: string(p.data[start:p.pos])}, nil
+	}
+}
@@ -0,0 +1,137 @@
+package geometry
+
+import "math"
+
+// Mesh is an indexed triangle mesh. Vertices that share a position are
+// stored once, so Triangles reference shared indices.
+type Mesh struct {
+	Vertices  []Vec3
+	Triangles [][3]int
+}
+
+// Triangle returns the corner positions of triangle i
+func (m *Mesh) Triangle(i int) (Vec3, Vec3, Vec3) {
+	t := m.Triangles[i]
+	return m.Vertices[t[0]], m.Vertices[t[1]], m.Vertices[t[2]]
+}
+
+func (m *Mesh) Bounds() BoundingBox {
+	box := EmptyBox()
+	for _, v := range m.Vertices {
+		box = box.Extend(v)
+	}
+	return box
+}
+
+// TriangleNormal is the unit normal following the right-hand winding rule
+func TriangleNormal(a, b, c Vec3) Vec3 {
+	return b.Sub(a).Cross(c.Sub(a)).Normalize()
+}
+
+func TriangleArea(a, b, c Vec3) float64 {
+	return b.Sub(a).Cross(c.Sub(a)).Length() / 2
+}
+
+type Stats struct {
+	TriangleCount int         `json:"triangle_count"`
+	VertexCount   int         `json:"vertex_count"`
+	BoundingBox   BoundingBox `json:"bounding_box"`
+	SurfaceArea   float64     `json:"surface_area"`
+	Volume        float64     `json:"volume"`
+	Centroid      Vec3        `json:"centroid"`
+}
+
+// Stats computes summary statistics. Volume uses the divergence theorem and
+// is only meaningful for closed meshes; for open or flat meshes the centroid
+// falls back to the area-weighted surface centroid.
+func (m *Mesh) Stats() Stats {
+	stats := Stats{
+		TriangleCount: len(m.Triangles),
+		VertexCount:   len(m.Vertices),
+		BoundingBox:   m.Bounds(),
+	}
+	if stats.BoundingBox.IsEmpty() {
+		stats.BoundingBox = BoundingBox{}
+	}
+
+	var signedVolume float64
+	var volumeMoment, areaMoment Vec3
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+
+		area := TriangleArea(a, b, c)
+		stats.SurfaceArea += area
+		areaMoment = areaMoment.Add(a.Add(b).Add(c).Scale(area / 3))
+
+		// Signed volume of the tetrahedron formed with the origin
+		v := a.Dot(b.Cross(c)) / 6
+		signedVolume += v
+		volumeMoment = volumeMoment.Add(a.Add(b).Add(c).Scale(v / 4))
+	}
+
+	stats.Volume = math.Abs(signedVolume)
+
+	scale := stats.BoundingBox.Diagonal()
+	switch {
+	case stats.Volume > 1e-9*scale*scale*scale:
+		stats.Centroid = volumeMoment.Scale(1 / signedVolume)
+	case stats.SurfaceArea > 0:
+		stats.Centroid = areaMoment.Scale(1 / stats.SurfaceArea)
+	default:
+		stats.Centroid = stats.BoundingBox.Center()
+	}
+
+	return stats
+}
+
+// MeshBuilder welds coincident vertices while triangles are added
+type MeshBuilder struct {
+	mesh  *Mesh
+	index map[Vec3]int
+}
+
+func NewMeshBuilder() *MeshBuilder {
+	return &MeshBuilder{
+		mesh:  &Mesh{},
+		index: make(map[Vec3]int),
+	}
+}
+
+func (b *MeshBuilder) AddVertex(p Vec3) int {
+	if i, ok := b.index[p]; ok {
+		return i
+	}
+	i := len(b.mesh.Vertices)
+	b.mesh.Vertices = append(b.mesh.Vertices, p)
+	b.index[p] = i
+	return i
+}
+
+func (b *MeshBuilder) AddTriangle(p0, p1, p2 Vec3) {
+	b.mesh.Triangles = append(b.mesh.Triangles, [3]int{
+		b.AddVertex(p0),
+		b.AddVertex(p1),
+		b.AddVertex(p2),
+	})
+}
+
+func (b *MeshBuilder) Mesh() *Mesh {
+	return b.mesh
+}
+
+// VertexNormals returns area-weighted unit normals for each vertex
+func (m *Mesh) VertexNormals() []Vec3 {
+	normals := make([]Vec3, len(m.Vertices))
+	for i, t := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		// The unnormalized cross product is twice the area, weighting for free
+		n := b.Sub(a).Cross(c.Sub(a))
+		for _, v := range t {
+			normals[v] = normals[v].Add(n)
+		}
+	}
+	for i := range normals {
+		normals[i] = normals[i].Normalize()
+	}
+	return normals
+}
@@ -0,0 +1,199 @@
+// Package obj reads Wavefront OBJ geometry and the file references in OBJ
+// and MTL files.
+package obj
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+var ErrNoFaces = errors.New("OBJ has no faces")
+
+func IsOBJ(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".obj")
+}
+
+func IsMTL(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".mtl")
+}
+
+func Parse(r io.Reader) (*geometry.Mesh, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OBJ: %w", err)
+	}
+	return ParseBytes(data)
+}
+
+// ParseBytes reads vertices and faces. Polygons are fan-triangulated;
+// texture coordinates, normals, groups and materials are ignored.
+func ParseBytes(data []byte) (*geometry.Mesh, error) {
+	builder := geometry.NewMeshBuilder()
+	var vertices []geometry.Vec3
+
+	line := 0
+	err := eachStatement(data, func(fields []string, lineNo int) error {
+		line = lineNo
+		switch fields[0] {
+		case "v":
+			if len(fields) < 4 {
+				return fmt.Errorf("line %d: malformed vertex", line)
+			}
+			var p [3]float64
+			for i := 0; i < 3; i++ {
+				v, err := strconv.ParseFloat(fields[i+1], 64)
+				if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+					return fmt.Errorf("line %d: invalid coordinate %q", line, fields[i+1])
+				}
+				p[i] = v
+			}
+			vertices = append(vertices, geometry.Vec3{X: p[0], Y: p[1], Z: p[2]})
+
+		case "f":
+			if len(fields) < 4 {
+				return fmt.Errorf("line %d: face needs at least three vertices", line)
+			}
+			corners := make([]geometry.Vec3, 0, len(fields)-1)
+			for _, ref := range fields[1:] {
+				idx, err := vertexIndex(ref, len(vertices))
+				if err != nil {
+					return fmt.Errorf("line %d: %w", line, err)
+				}
+				corners = append(corners, vertices[idx])
+			}
+			for i := 1; i+1 < len(corners); i++ {
+				builder.AddTriangle(corners[0], corners[i], corners[i+1])
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	mesh := builder.Mesh()
+	if len(mesh.Triangles) == 0 {
+		return nil, ErrNoFaces
+	}
+	return mesh, nil
+}
+
+// vertexIndex resolves the position part of a face corner such as "3",
+// "3/1", "3//2" or "-1". Negative indices count back from the latest vertex.
+func vertexIndex(ref string, count int) (int, error) {
+	if slash := strings.IndexByte(ref, '/'); slash >= 0 {
+		ref = ref[:slash]
+	}
+	n, err := strconv.Atoi(ref)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid vertex reference %q", ref)
+	}
+
+	idx := n - 1
+	if n < 0 {
+		idx = count + n
+	}
+	if idx < 0 || idx >= count {
+		return 0, fmt.Errorf("vertex reference %q out of range", ref)
+	}
+	return idx, nil
+}
+
+// Write encodes a mesh as indexed OBJ with a leading comment line
+func Write(w io.Writer, m *geometry.Mesh, comment string) error {
+	bw := bufio.NewWriter(w)
+	if comment != "" {
+		fmt.Fprintf(bw, "# %s\n", comment)
+	}
+	for _, v := range m.Vertices {
+		fmt.Fprintf(bw, "v %s %s %s\n", formatFloat(v.X), formatFloat(v.Y), formatFloat(v.Z))
+	}
+	for _, t := range m.Triangles {
+		fmt.Fprintf(bw, "f %d %d %d\n", t[0]+1, t[1]+1, t[2]+1)
+	}
+	return bw.Flush()
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// MaterialLibraries lists the MTL files an OBJ loads with mtllib
+func MaterialLibraries(data []byte) []string {
+	var libs []string
+	eachStatement(data, func(fields []string, _ int) error {
+		if fields[0] == "mtllib" {
+			libs = append(libs, fields[1:]...)
+		}
+		return nil
+	})
+	return libs
+}
+
+// textureStatements are the MTL statements whose last argument is an image
+var textureStatements = map[string]bool{
+	"map_Ka": true, "map_Kd": true, "map_Ks": true, "map_Ke": true, "map_Ns": true,
+	"map_d": true, "map_bump": true, "bump": true, "disp": true, "decal": true,
+	"refl": true, "norm": true, "map_Pr": true, "map_Pm": true, "map_Ps": true,
+}
+
+// Textures lists the image files an MTL refers to. Map options such as
+// "-s 1 1 1" precede the filename, so the last argument is taken.
+func Textures(data []byte) []string {
+	seen := make(map[string]bool)
+	var textures []string
+	eachStatement(data, func(fields []string, _ int) error {
+		if !textureStatements[fields[0]] || len(fields) < 2 {
+			return nil
+		}
+		name := fields[len(fields)-1]
+		if !seen[name] {
+			seen[name] = true
+			textures = append(textures, name)
+		}
+		return nil
+	})
+	return textures
+}
+
+// eachStatement calls fn with the fields of every non-empty, non-comment
+// statement, joining lines continued with a trailing backslash
+func eachStatement(data []byte, fn func(fields []string, line int) error) error {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var pending string
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		if strings.HasSuffix(strings.TrimRight(text, " \t\r"), "\\") {
+			pending += strings.TrimSuffix(strings.TrimRight(text, " \t\r"), "\\") + " "
+			continue
+		}
+		fields := strings.Fields(pending + text)
+		pending = ""
+		if len(fields) == 0 {
+			continue
+		}
+		if err := fn(fields, line); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package obj
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const square = `# unit square, split into a quad and its triangles
+mtllib square.mtl other.mtl
+o square
+v 0 0 0
+v 1 0 0
+v 1 1 0
+v 0 1 0
+vt 0 0
+vn 0 0 1
+usemtl paint
+f 1/1/1 2/1/1 3/1/1 4/1/1
+f -4//1 \
+  -3//1 -2//1
+`
+
+func TestParse(t *testing.T) {
+	m, err := ParseBytes([]byte(square))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if len(m.Triangles) != 3 {
+		t.Errorf("got %d triangles, want 3", len(m.Triangles))
+	}
+	if len(m.Vertices) != 4 {
+		t.Errorf("got %d vertices, want 4", len(m.Vertices))
+	}
+	if b := m.Bounds(); b.Max.X != 1 || b.Max.Y != 1 || b.Min.X != 0 {
+		t.Errorf("bounds = %+v", b)
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	m, err := ParseBytes([]byte(square))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Write(&buf, m, "converted"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "# converted\n") {
+		t.Errorf("output starts %q", buf.String()[:20])
+	}
+	again, err := ParseBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("reparsing: %v", err)
+	}
+	if !reflect.DeepEqual(again.Vertices, m.Vertices) || !reflect.DeepEqual(again.Triangles, m.Triangles) {
+		t.Error("mesh changed through Write and ParseBytes")
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	vertices := "v 0 0 0\nv 1 0 0\nv 0 1 0\n"
+	for _, c := range []struct {
+		name, input string
+	}{
+		{"short vertex", "v 1 2\nf 1 1 1\n"},
+		{"bad coordinate", "v 1 x 2\n"},
+		{"NaN coordinate", "v NaN 0 0\n"},
+		{"infinite coordinate", "v 0 Inf 0\n"},
+		{"two-corner face", vertices + "f 1 2\n"},
+		{"zero index", vertices + "f 0 1 2\n"},
+		{"index past end", vertices + "f 1 2 4\n"},
+		{"negative index past start", vertices + "f -1 -2 -4\n"},
+		{"forward reference", "v 0 0 0\nf 1 2 3\nv 1 0 0\nv 0 1 0\n"},
+		{"non-numeric index", vertices + "f a b c\n"},
+		{"empty index", vertices + "f /1 2 3\n"},
+		{"huge index", vertices + "f 1 2 99999999999999999999\n"},
+		{"line too long", "v 0 0 0 " + strings.Repeat("0", 2<<20) + "\n"},
+	} {
+		if _, err := ParseBytes([]byte(c.input)); err == nil {
+			t.Errorf("%s: parsed without error", c.name)
+		}
+	}
+
+	for _, input := range []string{"", "# nothing\n", "v 0 0 0\nv 1 0 0\n"} {
+		if _, err := ParseBytes([]byte(input)); !errors.Is(err, ErrNoFaces) {
+			t.Errorf("%q: error = %v, want ErrNoFaces", input, err)
+		}
+	}
+}
+
+func TestReferences(t *testing.T) {
+	if libs := MaterialLibraries([]byte(square)); !reflect.DeepEqual(libs, []string{"square.mtl", "other.mtl"}) {
+		t.Errorf("material libraries = %v", libs)
+	}
+
+	mtl := `newmtl paint
+Kd 1 0 0
+map_Kd -s 1 1 1 textures/red.png
+map_bump textures/bump.png
+bump textures/bump.png
+# map_Ks commented.png
+map_d
+`
+	want := []string{"textures/red.png", "textures/bump.png"}
+	if got := Textures([]byte(mtl)); !reflect.DeepEqual(got, want) {
+		t.Errorf("textures = %v, want %v", got, want)
+	}
+}
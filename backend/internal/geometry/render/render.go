@@ -0,0 +1,204 @@
+// Package render draws shaded preview images of meshes with a small
+// software rasterizer, so thumbnails need no GPU or native libraries.
+package render
+
+import (
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+const (
+	DefaultSize      = 256
+	MaxSize          = 1024
+	DefaultAzimuth   = 45
+	DefaultElevation = 30
+
+	// Each output pixel averages supersample² samples to smooth edges
+	supersample = 2
+	margin      = 1.05
+)
+
+var baseColor = [3]float64{0.55, 0.65, 0.80}
+
+type Options struct {
+	Width  int
+	Height int
+	// Azimuth is measured in degrees counter-clockwise from +X around the
+	// Z (up) axis; elevation in degrees above the XY plane
+	Azimuth   float64
+	Elevation float64
+}
+
+// Views are the named camera positions accepted alongside explicit angles
+var Views = map[string][2]float64{
+	"iso":    {DefaultAzimuth, DefaultElevation},
+	"front":  {-90, 0},
+	"back":   {90, 0},
+	"right":  {0, 0},
+	"left":   {180, 0},
+	"top":    {-90, 90},
+	"bottom": {-90, -90},
+}
+
+type camera struct {
+	center          geometry.Vec3
+	right, up, back geometry.Vec3
+	scale           float64
+	width, height   int
+}
+
+func newCamera(m *geometry.Mesh, width, height int, azimuth, elevation float64) camera {
+	az := azimuth * math.Pi / 180
+	el := elevation * math.Pi / 180
+	back := geometry.Vec3{X: math.Cos(el) * math.Cos(az), Y: math.Cos(el) * math.Sin(az), Z: math.Sin(el)}
+
+	// Looking straight up or down, keep +Y pointing up the image
+	worldUp := geometry.Vec3{Z: 1}
+	if math.Abs(back.Z) > 0.999 {
+		worldUp = geometry.Vec3{Y: 1}
+	}
+	right := worldUp.Cross(back).Normalize()
+	up := back.Cross(right)
+
+	bounds := m.Bounds()
+	radius := bounds.Diagonal() / 2
+	if radius == 0 || math.IsInf(radius, 0) {
+		radius = 1
+	}
+
+	return camera{
+		center: bounds.Center(),
+		right:  right,
+		up:     up,
+		back:   back,
+		scale:  float64(min(width, height)) / (2 * radius * margin),
+		width:  width,
+		height: height,
+	}
+}
+
+// project returns screen x, y and a depth that grows towards the viewer
+func (c camera) project(p geometry.Vec3) (float64, float64, float64) {
+	d := p.Sub(c.center)
+	return float64(c.width)/2 + d.Dot(c.right)*c.scale,
+		float64(c.height)/2 - d.Dot(c.up)*c.scale,
+		d.Dot(c.back)
+}
+
+// Render draws the mesh with an orthographic camera fitted to its bounding
+// sphere, on a transparent background
+func Render(m *geometry.Mesh, opts Options) *image.NRGBA {
+	if opts.Width <= 0 {
+		opts.Width = DefaultSize
+	}
+	if opts.Height <= 0 {
+		opts.Height = opts.Width
+	}
+
+	w, h := opts.Width*supersample, opts.Height*supersample
+	cam := newCamera(m, w, h, opts.Azimuth, opts.Elevation)
+
+	// Key light above and to the left of the camera
+	light := cam.back.Add(cam.up.Scale(0.6)).Sub(cam.right.Scale(0.4)).Normalize()
+
+	depth := make([]float64, w*h)
+	for i := range depth {
+		depth[i] = math.Inf(-1)
+	}
+	shade := make([]float64, w*h)
+	covered := make([]bool, w*h)
+
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		n := geometry.TriangleNormal(a, b, c)
+		// Lit from both sides so inconsistently wound files still read well
+		if n.Dot(cam.back) < 0 {
+			n = n.Scale(-1)
+		}
+		intensity := 0.25 + 0.75*math.Max(0, n.Dot(light))
+
+		ax, ay, az := cam.project(a)
+		bx, by, bz := cam.project(b)
+		cx, cy, cz := cam.project(c)
+
+		area := edge(ax, ay, bx, by, cx, cy)
+		if area == 0 {
+			continue
+		}
+
+		minX := max(0, int(math.Floor(math.Min(ax, math.Min(bx, cx)))))
+		maxX := min(w-1, int(math.Ceil(math.Max(ax, math.Max(bx, cx)))))
+		minY := max(0, int(math.Floor(math.Min(ay, math.Min(by, cy)))))
+		maxY := min(h-1, int(math.Ceil(math.Max(ay, math.Max(by, cy)))))
+
+		for y := minY; y <= maxY; y++ {
+			py := float64(y) + 0.5
+			for x := minX; x <= maxX; x++ {
+				px := float64(x) + 0.5
+				w0 := edge(bx, by, cx, cy, px, py) / area
+				w1 := edge(cx, cy, ax, ay, px, py) / area
+				w2 := edge(ax, ay, bx, by, px, py) / area
+				if w0 < 0 || w1 < 0 || w2 < 0 {
+					continue
+				}
+
+				z := w0*az + w1*bz + w2*cz
+				idx := y*w + x
+				if z > depth[idx] {
+					depth[idx] = z
+					shade[idx] = intensity
+					covered[idx] = true
+				}
+			}
+		}
+	}
+
+	return downsample(shade, covered, opts.Width, opts.Height)
+}
+
+func edge(ax, ay, bx, by, px, py float64) float64 {
+	return (bx-ax)*(py-ay) - (by-ay)*(px-ax)
+}
+
+// downsample box-filters the supersampled buffer, premultiplying by
+// coverage so silhouettes blend into the transparent background
+func downsample(shade []float64, covered []bool, width, height int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	stride := width * supersample
+	samples := float64(supersample * supersample)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			var sum float64
+			var count int
+			for sy := 0; sy < supersample; sy++ {
+				for sx := 0; sx < supersample; sx++ {
+					idx := (y*supersample+sy)*stride + x*supersample + sx
+					if covered[idx] {
+						sum += shade[idx]
+						count++
+					}
+				}
+			}
+			if count == 0 {
+				continue
+			}
+
+			s := sum / float64(count)
+			img.SetNRGBA(x, y, color.NRGBA{
+				R: channel(baseColor[0] * s),
+				G: channel(baseColor[1] * s),
+				B: channel(baseColor[2] * s),
+				A: channel(float64(count) / samples),
+			})
+		}
+	}
+	return img
+}
+
+func channel(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
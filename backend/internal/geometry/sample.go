@@ -0,0 +1,41 @@
+package geometry
+
+import (
+	"math"
+	"math/rand/v2"
+	"sort"
+)
+
+// SamplePoints draws n points uniformly by area over the mesh surface. The
+// generator is seeded so the same mesh always yields the same samples.
+func SamplePoints(m *Mesh, n int) []Vec3 {
+	if len(m.Triangles) == 0 || n <= 0 {
+		return nil
+	}
+
+	cumulative := make([]float64, len(m.Triangles))
+	total := 0.0
+	for i := range m.Triangles {
+		total += TriangleArea(m.Triangle(i))
+		cumulative[i] = total
+	}
+	if total == 0 {
+		return nil
+	}
+
+	rng := rand.New(rand.NewPCG(1, 2))
+	points := make([]Vec3, n)
+	for i := range points {
+		t := sort.SearchFloat64s(cumulative, rng.Float64()*total)
+		if t >= len(cumulative) {
+			t = len(cumulative) - 1
+		}
+		a, b, c := m.Triangle(t)
+
+		// Uniform barycentric sample (Osada et al.)
+		r1 := math.Sqrt(rng.Float64())
+		r2 := rng.Float64()
+		points[i] = a.Scale(1 - r1).Add(b.Scale(r1 * (1 - r2))).Add(c.Scale(r1 * r2))
+	}
+	return points
+}
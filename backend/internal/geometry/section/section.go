@@ -0,0 +1,299 @@
+// Package section cuts meshes with a plane and returns the 2D contour, for
+// reviewing wall thicknesses and profiles between versions.
+package section
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// Plane is the set of points p with p·Normal = Offset. Normal is unit length.
+type Plane struct {
+	Normal geometry.Vec3 `json:"normal"`
+	Offset float64       `json:"offset"`
+}
+
+var axes = map[string]geometry.Vec3{
+	"x": {X: 1},
+	"y": {Y: 1},
+	"z": {Z: 1},
+}
+
+// ParsePlane reads "axis:offset" (e.g. "z:12.5") or "nx,ny,nz:offset".
+// The offset may be left off ("z"), in which case offsetSet is false and the
+// caller picks one, usually through the middle of the part.
+func ParsePlane(spec string) (plane Plane, offsetSet bool, err error) {
+	normalSpec, offsetSpec, hasOffset := strings.Cut(strings.TrimSpace(spec), ":")
+
+	if axis, ok := axes[strings.ToLower(normalSpec)]; ok {
+		plane.Normal = axis
+	} else {
+		parts := strings.Split(normalSpec, ",")
+		if len(parts) != 3 {
+			return plane, false, fmt.Errorf("plane must be x, y, z or nx,ny,nz, optionally followed by :offset")
+		}
+		var n [3]float64
+		for i, p := range parts {
+			n[i], err = strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil {
+				return plane, false, fmt.Errorf("invalid plane normal %q", normalSpec)
+			}
+		}
+		normal := geometry.Vec3{X: n[0], Y: n[1], Z: n[2]}
+		if !normal.IsFinite() || normal.Length() == 0 {
+			return plane, false, fmt.Errorf("invalid plane normal %q", normalSpec)
+		}
+		plane.Normal = normal.Normalize()
+	}
+
+	if hasOffset {
+		plane.Offset, err = strconv.ParseFloat(strings.TrimSpace(offsetSpec), 64)
+		if err != nil || math.IsNaN(plane.Offset) || math.IsInf(plane.Offset, 0) {
+			return plane, false, fmt.Errorf("invalid plane offset %q", offsetSpec)
+		}
+	}
+	return plane, hasOffset, nil
+}
+
+// Through moves the plane, keeping its normal, so it passes through p
+func (p Plane) Through(point geometry.Vec3) Plane {
+	p.Offset = point.Dot(p.Normal)
+	return p
+}
+
+func (p Plane) distance(v geometry.Vec3) float64 {
+	return v.Dot(p.Normal) - p.Offset
+}
+
+// Basis maps 3D points in the plane to 2D: origin + x·U + y·V. Axis planes
+// use the axes a drawing would (YZ for x, XZ for y, XY for z); other planes
+// keep +Z pointing up where they can.
+func (p Plane) Basis() (origin, u, v geometry.Vec3) {
+	origin = p.Normal.Scale(p.Offset)
+	switch p.Normal {
+	case axes["x"]:
+		return origin, geometry.Vec3{Y: 1}, geometry.Vec3{Z: 1}
+	case axes["y"]:
+		return origin, geometry.Vec3{X: 1}, geometry.Vec3{Z: 1}
+	case axes["z"]:
+		return origin, geometry.Vec3{X: 1}, geometry.Vec3{Y: 1}
+	}
+
+	up := geometry.Vec3{Z: 1}
+	if math.Abs(p.Normal.Z) > 0.99 {
+		up = geometry.Vec3{Y: 1}
+	}
+	v = up.Sub(p.Normal.Scale(up.Dot(p.Normal))).Normalize()
+	u = v.Cross(p.Normal)
+	return origin, u, v
+}
+
+// Point is a position in the section plane's 2D coordinates
+type Point [2]float64
+
+type Polyline struct {
+	Points []Point `json:"points"`
+	// Closed loops of a closed mesh run counter-clockwise around material
+	// and clockwise around holes, so Area is positive for outer boundaries
+	Closed bool    `json:"closed"`
+	Length float64 `json:"length"`
+	Area   float64 `json:"area,omitempty"`
+}
+
+type Section struct {
+	Plane  Plane         `json:"plane"`
+	Origin geometry.Vec3 `json:"origin"`
+	U      geometry.Vec3 `json:"u"`
+	V      geometry.Vec3 `json:"v"`
+	// Min and Max bound the polylines in 2D; both are zero when the plane
+	// misses the mesh
+	Min       Point      `json:"min"`
+	Max       Point      `json:"max"`
+	Polylines []Polyline `json:"polylines"`
+	// Area is the net area of material in the cut (outer loops minus holes)
+	Area   float64 `json:"area"`
+	Length float64 `json:"length"`
+}
+
+// segment joins the points where the plane crosses two mesh edges, oriented
+// so material lies to its left
+type segment struct {
+	from, to uint64
+}
+
+// Cut intersects the mesh with the plane. Crossing points are identified by
+// the mesh edge they lie on, so loops join exactly without a tolerance.
+// Vertices lying on the plane count as above it, so a plane through a flat
+// face cuts just below it.
+func Cut(m *geometry.Mesh, plane Plane) *Section {
+	origin, u, v := plane.Basis()
+	s := &Section{Plane: plane, Origin: origin, U: u, V: v, Polylines: []Polyline{}}
+
+	dist := make([]float64, len(m.Vertices))
+	for i, p := range m.Vertices {
+		dist[i] = plane.distance(p)
+	}
+
+	points := make(map[uint64]Point)
+	crossing := func(a, b int) uint64 {
+		key := edgeKey(a, b)
+		if _, ok := points[key]; !ok {
+			// Interpolate from the lower index so both triangles sharing the
+			// edge get exactly the same point
+			if a > b {
+				a, b = b, a
+			}
+			t := dist[a] / (dist[a] - dist[b])
+			p := m.Vertices[a].Add(m.Vertices[b].Sub(m.Vertices[a]).Scale(t)).Sub(origin)
+			points[key] = Point{p.Dot(u), p.Dot(v)}
+		}
+		return key
+	}
+
+	var segments []segment
+	for i, tri := range m.Triangles {
+		// The vertex alone on its side forms a crossing edge with each of
+		// the other two
+		lone := -1
+		for k := range 3 {
+			a, b, c := tri[k], tri[(k+1)%3], tri[(k+2)%3]
+			if (dist[a] < 0) != (dist[b] < 0) && (dist[a] < 0) != (dist[c] < 0) {
+				lone = k
+				break
+			}
+		}
+		if lone < 0 {
+			continue
+		}
+		a, b, c := tri[lone], tri[(lone+1)%3], tri[(lone+2)%3]
+		seg := segment{crossing(a, b), crossing(a, c)}
+
+		// Walking along plane normal × face normal keeps material on the left
+		p0, p1, p2 := m.Triangle(i)
+		dir := plane.Normal.Cross(geometry.TriangleNormal(p0, p1, p2))
+		from, to := points[seg.from], points[seg.to]
+		if (to[0]-from[0])*dir.Dot(u)+(to[1]-from[1])*dir.Dot(v) < 0 {
+			seg.from, seg.to = seg.to, seg.from
+		}
+		segments = append(segments, seg)
+	}
+
+	for _, chain := range chains(segments) {
+		line := Polyline{Points: make([]Point, 0, len(chain.keys))}
+		for _, key := range chain.keys {
+			p := points[key]
+			if n := len(line.Points); n > 0 && line.Points[n-1] == p {
+				continue
+			}
+			line.Points = append(line.Points, p)
+		}
+		line.Closed = chain.closed
+		if line.Closed && len(line.Points) > 1 && line.Points[0] == line.Points[len(line.Points)-1] {
+			line.Points = line.Points[:len(line.Points)-1]
+		}
+		if len(line.Points) < 2 {
+			continue
+		}
+		line.Length = length(line.Points, line.Closed)
+		if line.Closed {
+			line.Area = area(line.Points)
+		}
+		s.Polylines = append(s.Polylines, line)
+		s.Length += line.Length
+		s.Area += line.Area
+	}
+
+	for i, line := range s.Polylines {
+		for j, p := range line.Points {
+			if i == 0 && j == 0 {
+				s.Min, s.Max = p, p
+			}
+			s.Min = Point{math.Min(s.Min[0], p[0]), math.Min(s.Min[1], p[1])}
+			s.Max = Point{math.Max(s.Max[0], p[0]), math.Max(s.Max[1], p[1])}
+		}
+	}
+	return s
+}
+
+type chain struct {
+	keys   []uint64
+	closed bool
+}
+
+// chains links segments end to start. A closed manifold mesh gives closed
+// loops; open chains come from holes in the mesh and are walked back to
+// their first segment so each is reported once.
+func chains(segments []segment) []chain {
+	next := make(map[uint64]int, len(segments))
+	prev := make(map[uint64]int, len(segments))
+	for i, seg := range segments {
+		next[seg.from] = i
+		prev[seg.to] = i
+	}
+
+	used := make([]bool, len(segments))
+	var out []chain
+	for i := range segments {
+		if used[i] {
+			continue
+		}
+
+		// Back up to the start of an open chain. Non-manifold edges can
+		// make cycles that never return to i, so the walk is bounded.
+		start := i
+		for range segments {
+			j, ok := prev[segments[start].from]
+			if !ok || used[j] || j == i {
+				break
+			}
+			start = j
+		}
+
+		c := chain{keys: []uint64{segments[start].from}}
+		for j := start; ; {
+			used[j] = true
+			c.keys = append(c.keys, segments[j].to)
+			k, ok := next[segments[j].to]
+			if !ok || used[k] {
+				c.closed = ok && k == start
+				break
+			}
+			j = k
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func length(points []Point, closed bool) float64 {
+	var total float64
+	for i := 1; i < len(points); i++ {
+		total += math.Hypot(points[i][0]-points[i-1][0], points[i][1]-points[i-1][1])
+	}
+	if closed {
+		last := points[len(points)-1]
+		total += math.Hypot(points[0][0]-last[0], points[0][1]-last[1])
+	}
+	return total
+}
+
+// area is the shoelace signed area, positive counter-clockwise
+func area(points []Point) float64 {
+	var sum float64
+	for i, p := range points {
+		q := points[(i+1)%len(points)]
+		sum += p[0]*q[1] - q[0]*p[1]
+	}
+	return sum / 2
+}
+
+func edgeKey(a, b int) uint64 {
+	if a > b {
+		a, b = b, a
+	}
+	return uint64(a)<<32 | uint64(b)
+}
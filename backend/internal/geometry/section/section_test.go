@@ -0,0 +1,205 @@
+package section
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// box adds an axis-aligned box with outward-facing triangles, or inward
+// ones for a cavity
+func box(b *geometry.MeshBuilder, min geometry.Vec3, size float64, inward bool) {
+	corner := func(x, y, z float64) geometry.Vec3 {
+		return min.Add(geometry.Vec3{X: x * size, Y: y * size, Z: z * size})
+	}
+	quads := [6][4][3]float64{
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+	}
+	for _, q := range quads {
+		var p [4]geometry.Vec3
+		for i, c := range q {
+			p[i] = corner(c[0], c[1], c[2])
+		}
+		if inward {
+			b.AddTriangle(p[0], p[2], p[1])
+			b.AddTriangle(p[0], p[3], p[2])
+		} else {
+			b.AddTriangle(p[0], p[1], p[2])
+			b.AddTriangle(p[0], p[2], p[3])
+		}
+	}
+}
+
+func cube() *geometry.Mesh {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10, false)
+	return b.Mesh()
+}
+
+func plane(t *testing.T, spec string) Plane {
+	t.Helper()
+	p, _, err := ParsePlane(spec)
+	if err != nil {
+		t.Fatalf("ParsePlane(%q): %v", spec, err)
+	}
+	return p
+}
+
+func assertNear(t *testing.T, name string, got, want float64) {
+	t.Helper()
+	if math.Abs(got-want) > 1e-9 {
+		t.Errorf("%s = %v, want %v", name, got, want)
+	}
+}
+
+func TestCutCube(t *testing.T) {
+	// Through the middle and exactly through the top face
+	for _, spec := range []string{"z:5", "z:10"} {
+		s := Cut(cube(), plane(t, spec))
+		if len(s.Polylines) != 1 || !s.Polylines[0].Closed {
+			t.Fatalf("%s: polylines = %+v", spec, s.Polylines)
+		}
+		assertNear(t, spec+" area", s.Area, 100)
+		assertNear(t, spec+" length", s.Length, 40)
+		if s.Min != (Point{0, 0}) || s.Max != (Point{10, 10}) {
+			t.Errorf("%s: bounds %v-%v", spec, s.Min, s.Max)
+		}
+	}
+}
+
+func TestCutCavity(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10, false)
+	box(b, geometry.Vec3{X: 2, Y: 2, Z: 2}, 6, true)
+
+	s := Cut(b.Mesh(), plane(t, "x:5"))
+	if len(s.Polylines) != 2 {
+		t.Fatalf("got %d polylines, want 2", len(s.Polylines))
+	}
+	assertNear(t, "net area", s.Area, 100-36)
+	assertNear(t, "length", s.Length, 40+24)
+	if a, b := s.Polylines[0].Area, s.Polylines[1].Area; a*b >= 0 {
+		t.Errorf("outer and hole loop areas %v and %v should differ in sign", a, b)
+	}
+}
+
+// A plane perpendicular to the cube's diagonal through its center cuts a
+// regular hexagon
+func TestCutOblique(t *testing.T) {
+	p := plane(t, "1,1,1").Through(geometry.Vec3{X: 5, Y: 5, Z: 5})
+	s := Cut(cube(), p)
+	if len(s.Polylines) != 1 || !s.Polylines[0].Closed {
+		t.Fatalf("polylines = %+v", s.Polylines)
+	}
+	assertNear(t, "area", s.Area, 3*math.Sqrt(3)/4*100)
+	assertNear(t, "length", s.Length, 6*10/math.Sqrt2)
+
+	assertNear(t, "|u|", s.U.Length(), 1)
+	assertNear(t, "|v|", s.V.Length(), 1)
+	assertNear(t, "u·v", s.U.Dot(s.V), 0)
+	assertNear(t, "u·n", s.U.Dot(p.Normal), 0)
+	assertNear(t, "v·n", s.V.Dot(p.Normal), 0)
+}
+
+func TestCutMisses(t *testing.T) {
+	s := Cut(cube(), plane(t, "y:-1"))
+	if len(s.Polylines) != 0 || s.Area != 0 || s.Min != (Point{}) || s.Max != (Point{}) {
+		t.Errorf("section = %+v, want empty", s)
+	}
+	if s := Cut(&geometry.Mesh{}, plane(t, "z")); len(s.Polylines) != 0 {
+		t.Errorf("empty mesh section = %+v", s)
+	}
+}
+
+// Holes in a mesh leave open chains rather than failing
+func TestCutOpenMesh(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	b.AddTriangle(geometry.Vec3{}, geometry.Vec3{X: 10}, geometry.Vec3{X: 5, Z: 10})
+	b.AddTriangle(geometry.Vec3{X: 10}, geometry.Vec3{X: 20}, geometry.Vec3{X: 15, Z: 10})
+	s := Cut(b.Mesh(), plane(t, "z:5"))
+	if len(s.Polylines) != 2 {
+		t.Fatalf("polylines = %+v", s.Polylines)
+	}
+	for _, line := range s.Polylines {
+		if line.Closed || line.Area != 0 || len(line.Points) != 2 {
+			t.Errorf("polyline = %+v, want one open segment", line)
+		}
+	}
+	assertNear(t, "length", s.Length, 10)
+}
+
+func TestParsePlane(t *testing.T) {
+	for _, c := range []struct {
+		spec      string
+		normal    geometry.Vec3
+		offset    float64
+		offsetSet bool
+	}{
+		{"z:12.5", geometry.Vec3{Z: 1}, 12.5, true},
+		{" X ", geometry.Vec3{X: 1}, 0, false},
+		{"y:-3", geometry.Vec3{Y: 1}, -3, true},
+		{"0, 0, 2:1", geometry.Vec3{Z: 1}, 1, true},
+		{"3,4,0", geometry.Vec3{X: 0.6, Y: 0.8}, 0, false},
+	} {
+		p, set, err := ParsePlane(c.spec)
+		if err != nil {
+			t.Errorf("ParsePlane(%q): %v", c.spec, err)
+			continue
+		}
+		if p.Normal.Sub(c.normal).Length() > 1e-12 || p.Offset != c.offset || set != c.offsetSet {
+			t.Errorf("ParsePlane(%q) = %+v, %v", c.spec, p, set)
+		}
+	}
+
+	for _, spec := range []string{
+		"", "w", "xy:1", "1,2", "1,2,3,4", "1,x,0", "0,0,0", "NaN,0,1", "Inf,0,0",
+		"z:", "z:abc", "z:NaN", "z:-Inf", "z:1e999",
+	} {
+		if p, _, err := ParsePlane(spec); err == nil {
+			t.Errorf("ParsePlane(%q) = %+v, want an error", spec, p)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	before := Cut(cube(), plane(t, "z:5"))
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10, false)
+	box(b, geometry.Vec3{X: 2, Y: 2, Z: 2}, 6, true)
+	after := Cut(b.Mesh(), plane(t, "z:5"))
+	empty := Cut(cube(), plane(t, "z:50"))
+
+	out := SVG(
+		Layer{Section: before, Label: `v1 <"before"> & co`, Color: "#2563eb"},
+		Layer{Section: after, Label: "v2", Color: `"red"`},
+		Layer{Section: empty, Label: "v3", Color: "green"},
+	)
+	decoder := xml.NewDecoder(bytes.NewReader(out))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("SVG is not well-formed: %v\n%s", err, out)
+		}
+	}
+	// The cavity's loop is cut out of the same path as the outer one
+	if strings.Count(string(out), "Z") != 3 {
+		t.Errorf("want 3 closed loops in\n%s", out)
+	}
+
+	if _, err := xml.NewDecoder(bytes.NewReader(SVG(Layer{Section: empty}))).Token(); err != nil {
+		t.Errorf("empty SVG: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+package section
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"strconv"
+)
+
+const (
+	svgSize    = 800
+	svgPadding = 24
+	svgLegend  = 20
+)
+
+// Layer is one section drawn into an SVG, e.g. each version in a comparison
+type Layer struct {
+	Section *Section
+	Label   string
+	// Color is any SVG color, e.g. "#2563eb"
+	Color string
+}
+
+// SVG draws sections over each other at a common scale, with +V up. Closed
+// loops are filled even-odd so holes show through; open chains are stroked
+// only.
+func SVG(layers ...Layer) []byte {
+	minX, minY := math.Inf(1), math.Inf(1)
+	maxX, maxY := math.Inf(-1), math.Inf(-1)
+	for _, l := range layers {
+		if len(l.Section.Polylines) == 0 {
+			continue
+		}
+		minX, minY = math.Min(minX, l.Section.Min[0]), math.Min(minY, l.Section.Min[1])
+		maxX, maxY = math.Max(maxX, l.Section.Max[0]), math.Max(maxY, l.Section.Max[1])
+	}
+	if math.IsInf(minX, 1) {
+		minX, minY, maxX, maxY = 0, 0, 1, 1
+	}
+
+	// Fit the larger extent to the drawing, keeping the aspect ratio
+	extent := math.Max(maxX-minX, maxY-minY)
+	if extent == 0 {
+		extent = 1
+	}
+	scale := (svgSize - 2*svgPadding) / extent
+	width := math.Ceil((maxX-minX)*scale) + 2*svgPadding
+	height := math.Ceil((maxY-minY)*scale) + 2*svgPadding
+	legend := 0.0
+	if len(layers) > 1 {
+		legend = float64(len(layers)) * svgLegend
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%g" height="%g" viewBox="0 0 %g %g">`+"\n",
+		width, height+legend, width, height+legend)
+	for _, l := range layers {
+		fmt.Fprintf(&buf, `<g stroke="%s" fill="%s" fill-opacity="0.15" fill-rule="evenodd" stroke-width="1.5" stroke-linejoin="round">`+"\n",
+			html.EscapeString(l.Color), html.EscapeString(l.Color))
+		if l.Label != "" {
+			fmt.Fprintf(&buf, "<title>%s</title>\n", html.EscapeString(l.Label))
+		}
+
+		// Closed loops share one path so even-odd filling cuts out holes
+		var closed bytes.Buffer
+		for _, line := range l.Section.Polylines {
+			var path bytes.Buffer
+			for i, p := range line.Points {
+				if i == 0 {
+					path.WriteByte('M')
+				} else {
+					path.WriteByte('L')
+				}
+				path.WriteString(coord((p[0]-minX)*scale + svgPadding))
+				path.WriteByte(' ')
+				path.WriteString(coord((maxY-p[1])*scale + svgPadding))
+			}
+			if line.Closed {
+				closed.Write(path.Bytes())
+				closed.WriteByte('Z')
+			} else {
+				fmt.Fprintf(&buf, "<path fill=\"none\" d=\"%s\"/>\n", path.Bytes())
+			}
+		}
+		if closed.Len() > 0 {
+			fmt.Fprintf(&buf, "<path d=\"%s\"/>\n", closed.Bytes())
+		}
+		buf.WriteString("</g>\n")
+	}
+
+	if len(layers) > 1 {
+		for i, l := range layers {
+			y := height + float64(i)*svgLegend
+			fmt.Fprintf(&buf, `<rect x="%d" y="%g" width="12" height="12" fill="%s"/>`+"\n",
+				svgPadding, y+2, html.EscapeString(l.Color))
+			fmt.Fprintf(&buf, `<text x="%d" y="%g" font-family="sans-serif" font-size="12">%s</text>`+"\n",
+				svgPadding+18, y+12, html.EscapeString(l.Label))
+		}
+	}
+	buf.WriteString("</svg>\n")
+	return buf.Bytes()
+}
+
+func coord(x float64) string {
+	return strconv.FormatFloat(x, 'f', 2, 64)
+}
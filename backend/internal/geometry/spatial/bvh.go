@@ -0,0 +1,212 @@
+// Package spatial provides a bounding volume hierarchy over mesh triangles
+// for nearest-surface queries.
+package spatial
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+const leafSize = 4
+
+type node struct {
+	box         geometry.BoundingBox
+	left, right int // child node indices, -1 for leaves
+	start, end  int // triangle range in BVH.order for leaves
+}
+
+type BVH struct {
+	mesh  *geometry.Mesh
+	nodes []node
+	order []int
+}
+
+// Hit is the closest point on the mesh surface to a query point
+type Hit struct {
+	Triangle int
+	Point    geometry.Vec3
+	Distance float64
+}
+
+func Build(mesh *geometry.Mesh) *BVH {
+	b := &BVH{
+		mesh:  mesh,
+		order: make([]int, len(mesh.Triangles)),
+	}
+	for i := range b.order {
+		b.order[i] = i
+	}
+
+	centroids := make([]geometry.Vec3, len(mesh.Triangles))
+	boxes := make([]geometry.BoundingBox, len(mesh.Triangles))
+	for i := range mesh.Triangles {
+		p0, p1, p2 := mesh.Triangle(i)
+		centroids[i] = p0.Add(p1).Add(p2).Scale(1.0 / 3)
+		boxes[i] = geometry.EmptyBox().Extend(p0).Extend(p1).Extend(p2)
+	}
+
+	if len(mesh.Triangles) > 0 {
+		b.build(0, len(b.order), centroids, boxes)
+	}
+	return b
+}
+
+func (b *BVH) build(start, end int, centroids []geometry.Vec3, boxes []geometry.BoundingBox) int {
+	box := geometry.EmptyBox()
+	centroidBox := geometry.EmptyBox()
+	for _, t := range b.order[start:end] {
+		box = box.Union(boxes[t])
+		centroidBox = centroidBox.Extend(centroids[t])
+	}
+
+	idx := len(b.nodes)
+	b.nodes = append(b.nodes, node{box: box, left: -1, right: -1, start: start, end: end})
+	if end-start <= leafSize {
+		return idx
+	}
+
+	// Median split along the axis where the centroids spread most
+	size := centroidBox.Size()
+	axis := 0
+	if size.Y > size.Axis(axis) {
+		axis = 1
+	}
+	if size.Z > size.Axis(axis) {
+		axis = 2
+	}
+
+	span := b.order[start:end]
+	sort.Slice(span, func(i, j int) bool {
+		return centroids[span[i]].Axis(axis) < centroids[span[j]].Axis(axis)
+	})
+	mid := (start + end) / 2
+
+	left := b.build(start, mid, centroids, boxes)
+	right := b.build(mid, end, centroids, boxes)
+	b.nodes[idx].left = left
+	b.nodes[idx].right = right
+	return idx
+}
+
+// Closest finds the nearest point on the mesh surface to p. ok is false for
+// an empty mesh.
+func (b *BVH) Closest(p geometry.Vec3) (hit Hit, ok bool) {
+	if len(b.nodes) == 0 {
+		return Hit{}, false
+	}
+
+	hit.Distance = math.Inf(1)
+	stack := []int{0}
+	for len(stack) > 0 {
+		n := b.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		if boxDistance(n.box, p) >= hit.Distance {
+			continue
+		}
+
+		if n.left < 0 {
+			for _, t := range b.order[n.start:n.end] {
+				a, bb, c := b.mesh.Triangle(t)
+				q := ClosestPointOnTriangle(p, a, bb, c)
+				if d := q.Sub(p).Length(); d < hit.Distance {
+					hit = Hit{Triangle: t, Point: q, Distance: d}
+				}
+			}
+			continue
+		}
+
+		// Visit the nearer child first so the far one is more likely pruned
+		l, r := b.nodes[n.left], b.nodes[n.right]
+		if boxDistance(l.box, p) < boxDistance(r.box, p) {
+			stack = append(stack, n.right, n.left)
+		} else {
+			stack = append(stack, n.left, n.right)
+		}
+	}
+
+	return hit, true
+}
+
+// Query calls fn for every triangle whose bounds overlap box
+func (b *BVH) Query(box geometry.BoundingBox, fn func(triangle int)) {
+	if len(b.nodes) == 0 {
+		return
+	}
+
+	stack := []int{0}
+	for len(stack) > 0 {
+		n := b.nodes[stack[len(stack)-1]]
+		stack = stack[:len(stack)-1]
+
+		if !n.box.Overlaps(box) {
+			continue
+		}
+		if n.left < 0 {
+			for _, t := range b.order[n.start:n.end] {
+				fn(t)
+			}
+			continue
+		}
+		stack = append(stack, n.left, n.right)
+	}
+}
+
+func boxDistance(box geometry.BoundingBox, p geometry.Vec3) float64 {
+	dx := math.Max(0, math.Max(box.Min.X-p.X, p.X-box.Max.X))
+	dy := math.Max(0, math.Max(box.Min.Y-p.Y, p.Y-box.Max.Y))
+	dz := math.Max(0, math.Max(box.Min.Z-p.Z, p.Z-box.Max.Z))
+	return math.Sqrt(dx*dx + dy*dy + dz*dz)
+}
+
+// ClosestPointOnTriangle is from Ericson, Real-Time Collision Detection 5.1.5
+func ClosestPointOnTriangle(p, a, b, c geometry.Vec3) geometry.Vec3 {
+	ab := b.Sub(a)
+	ac := c.Sub(a)
+	ap := p.Sub(a)
+
+	d1 := ab.Dot(ap)
+	d2 := ac.Dot(ap)
+	if d1 <= 0 && d2 <= 0 {
+		return a
+	}
+
+	bp := p.Sub(b)
+	d3 := ab.Dot(bp)
+	d4 := ac.Dot(bp)
+	if d3 >= 0 && d4 <= d3 {
+		return b
+	}
+
+	vc := d1*d4 - d3*d2
+	if vc <= 0 && d1 >= 0 && d3 <= 0 {
+		v := d1 / (d1 - d3)
+		return a.Add(ab.Scale(v))
+	}
+
+	cp := p.Sub(c)
+	d5 := ab.Dot(cp)
+	d6 := ac.Dot(cp)
+	if d6 >= 0 && d5 <= d6 {
+		return c
+	}
+
+	vb := d5*d2 - d1*d6
+	if vb <= 0 && d2 >= 0 && d6 <= 0 {
+		w := d2 / (d2 - d6)
+		return a.Add(ac.Scale(w))
+	}
+
+	va := d3*d6 - d5*d4
+	if va <= 0 && (d4-d3) >= 0 && (d5-d6) >= 0 {
+		w := (d4 - d3) / ((d4 - d3) + (d5 - d6))
+		return b.Add(c.Sub(b).Scale(w))
+	}
+
+	denom := 1 / (va + vb + vc)
+	v := vb * denom
+	w := vc * denom
+	return a.Add(ab.Scale(v)).Add(ac.Scale(w))
+}
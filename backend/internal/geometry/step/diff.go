@@ -0,0 +1,140 @@
+package step
+
+import (
+	"sort"
+	"strings"
+)
+
+type FieldChange struct {
+	Field string `json:"field"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+type CountChange struct {
+	Type  string `json:"type"`
+	From  int    `json:"from"`
+	To    int    `json:"to"`
+	Delta int    `json:"delta"`
+}
+
+// UsageChange is an assembly edge whose quantity changed; zero means the
+// edge is absent on that side
+type UsageChange struct {
+	Parent string `json:"parent"`
+	Child  string `json:"child"`
+	From   int    `json:"from"`
+	To     int    `json:"to"`
+}
+
+type Diff struct {
+	HeaderChanges    []FieldChange `json:"header_changes"`
+	EntityTotalDelta int           `json:"entity_total_delta"`
+	// Entity types whose count changed, largest change first
+	EntityCounts     []CountChange `json:"entity_counts"`
+	ProductsAdded    []Product     `json:"products_added"`
+	ProductsRemoved  []Product     `json:"products_removed"`
+	ProductsRenamed  []FieldChange `json:"products_renamed"`
+	StructureChanges []UsageChange `json:"structure_changes"`
+}
+
+// Compare reports how the "to" file differs from the "from" file
+func Compare(from, to *File) *Diff {
+	d := &Diff{
+		HeaderChanges:    []FieldChange{},
+		EntityTotalDelta: to.EntityTotal - from.EntityTotal,
+		EntityCounts:     []CountChange{},
+		ProductsAdded:    []Product{},
+		ProductsRemoved:  []Product{},
+		ProductsRenamed:  []FieldChange{},
+		StructureChanges: []UsageChange{},
+	}
+
+	header := func(field, a, b string) {
+		if a != b {
+			d.HeaderChanges = append(d.HeaderChanges, FieldChange{Field: field, From: a, To: b})
+		}
+	}
+	header("file_name", from.Header.FileName, to.Header.FileName)
+	header("timestamp", from.Header.Timestamp, to.Header.Timestamp)
+	header("authors", strings.Join(from.Header.Authors, ", "), strings.Join(to.Header.Authors, ", "))
+	header("organizations", strings.Join(from.Header.Organizations, ", "), strings.Join(to.Header.Organizations, ", "))
+	header("preprocessor", from.Header.Preprocessor, to.Header.Preprocessor)
+	header("originating_system", from.Header.OriginatingSystem, to.Header.OriginatingSystem)
+	header("schemas", strings.Join(from.Header.Schemas, ", "), strings.Join(to.Header.Schemas, ", "))
+
+	types := make(map[string]bool)
+	for t := range from.EntityCounts {
+		types[t] = true
+	}
+	for t := range to.EntityCounts {
+		types[t] = true
+	}
+	for t := range types {
+		a, b := from.EntityCounts[t], to.EntityCounts[t]
+		if a != b {
+			d.EntityCounts = append(d.EntityCounts, CountChange{Type: t, From: a, To: b, Delta: b - a})
+		}
+	}
+	sort.Slice(d.EntityCounts, func(i, j int) bool {
+		a, b := abs(d.EntityCounts[i].Delta), abs(d.EntityCounts[j].Delta)
+		if a != b {
+			return a > b
+		}
+		return d.EntityCounts[i].Type < d.EntityCounts[j].Type
+	})
+
+	before := make(map[string]Product, len(from.Products))
+	for _, p := range from.Products {
+		before[p.Key()] = p
+	}
+	after := make(map[string]Product, len(to.Products))
+	for _, p := range to.Products {
+		after[p.Key()] = p
+		old, ok := before[p.Key()]
+		switch {
+		case !ok:
+			d.ProductsAdded = append(d.ProductsAdded, p)
+		case old.Name != p.Name:
+			d.ProductsRenamed = append(d.ProductsRenamed, FieldChange{Field: p.Key(), From: old.Name, To: p.Name})
+		}
+	}
+	for _, p := range from.Products {
+		if _, ok := after[p.Key()]; !ok {
+			d.ProductsRemoved = append(d.ProductsRemoved, p)
+		}
+	}
+
+	edges := make(map[[2]string][2]int)
+	for _, u := range from.Structure {
+		e := edges[[2]string{u.Parent, u.Child}]
+		e[0] = u.Quantity
+		edges[[2]string{u.Parent, u.Child}] = e
+	}
+	for _, u := range to.Structure {
+		e := edges[[2]string{u.Parent, u.Child}]
+		e[1] = u.Quantity
+		edges[[2]string{u.Parent, u.Child}] = e
+	}
+	for key, q := range edges {
+		if q[0] != q[1] {
+			d.StructureChanges = append(d.StructureChanges, UsageChange{Parent: key[0], Child: key[1], From: q[0], To: q[1]})
+		}
+	}
+	sort.Slice(d.StructureChanges, func(i, j int) bool {
+		a, b := d.StructureChanges[i], d.StructureChanges[j]
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		return a.Child < b.Child
+	})
+
+	return d
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
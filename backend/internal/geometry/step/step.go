@@ -0,0 +1,578 @@
+// Package step reads the exchange structure of ISO 10303-21 (STEP Part 21)
+// files: the header, entity counts and the product structure. It doesn't
+// evaluate geometry, which would need a B-rep kernel.
+package step
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+const magic = "ISO-10303-21"
+
+var ErrNotStep = errors.New("file is not ISO 10303-21")
+
+type Header struct {
+	Description       []string `json:"description"`
+	FileName          string   `json:"file_name"`
+	Timestamp         string   `json:"timestamp"`
+	Authors           []string `json:"authors"`
+	Organizations     []string `json:"organizations"`
+	Preprocessor      string   `json:"preprocessor"`
+	OriginatingSystem string   `json:"originating_system"`
+	Authorization     string   `json:"authorization"`
+	Schemas           []string `json:"schemas"`
+}
+
+type Product struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// File names the STEP file holding the product's geometry when the
+	// assembly references it externally rather than embedding it
+	File string `json:"file,omitempty"`
+}
+
+// Usage is one parent→child edge of the assembly tree. Quantity counts the
+// NEXT_ASSEMBLY_USAGE_OCCURRENCE instances placing the child in the parent.
+type Usage struct {
+	Parent   string `json:"parent"`
+	Child    string `json:"child"`
+	Quantity int    `json:"quantity"`
+}
+
+type File struct {
+	Header       Header         `json:"header"`
+	Products     []Product      `json:"products"`
+	Structure    []Usage        `json:"structure"`
+	EntityCounts map[string]int `json:"entity_counts"`
+	EntityTotal  int            `json:"entity_total"`
+}
+
+func IsSTEP(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".step", ".stp", ".p21":
+		return true
+	}
+	return false
+}
+
+func Parse(r io.Reader) (*File, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read STEP: %w", err)
+	}
+	return ParseBytes(data)
+}
+
+func ParseBytes(data []byte) (*File, error) {
+	statements := splitStatements(data)
+	if len(statements) == 0 || statements[0] != magic {
+		return nil, ErrNotStep
+	}
+
+	f := &File{
+		Products:     []Product{},
+		Structure:    []Usage{},
+		EntityCounts: make(map[string]int),
+	}
+
+	// Product structure entities are kept until the end, since instances
+	// may refer forward
+	products := make(map[int]Product)
+	formations := make(map[int]int)   // formation → product
+	definitions := make(map[int]int)  // definition → formation
+	var usages [][2]int               // relating, related definition
+	documents := make(map[int]string) // document file → file name
+	var documentRefs [][2]int         // document file, product definition
+
+	section := ""
+	for _, stmt := range statements[1:] {
+		switch stmt {
+		case "HEADER", "DATA":
+			section = stmt
+			continue
+		case "ENDSEC":
+			section = ""
+			continue
+		}
+		if strings.HasPrefix(stmt, "DATA") {
+			// DATA may carry a section name, e.g. DATA('part', ('schema'))
+			section = "DATA"
+			continue
+		}
+
+		switch section {
+		case "HEADER":
+			name, args, err := splitRecord(stmt)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.Header.read(name, args); err != nil {
+				return nil, err
+			}
+
+		case "DATA":
+			id, types, args, err := splitInstance(stmt)
+			if err != nil {
+				return nil, err
+			}
+			f.EntityTotal++
+			for _, t := range types {
+				f.EntityCounts[t]++
+			}
+			if len(types) != 1 {
+				continue
+			}
+
+			switch types[0] {
+			case "PRODUCT":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				products[id] = Product{ID: params.str(0), Name: params.str(1), Description: params.str(2)}
+			case "PRODUCT_DEFINITION_FORMATION", "PRODUCT_DEFINITION_FORMATION_WITH_SPECIFIED_SOURCE":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				formations[id] = params.ref(2)
+			case "PRODUCT_DEFINITION", "PRODUCT_DEFINITION_WITH_ASSOCIATED_DOCUMENTS":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				definitions[id] = params.ref(2)
+			case "NEXT_ASSEMBLY_USAGE_OCCURRENCE":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				usages = append(usages, [2]int{params.ref(3), params.ref(4)})
+			case "DOCUMENT_FILE":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				name := params.str(0)
+				if name == "" {
+					name = params.str(1)
+				}
+				documents[id] = name
+			case "APPLIED_DOCUMENT_REFERENCE":
+				params, err := parseParams(args)
+				if err != nil {
+					return nil, fmt.Errorf("#%d: %w", id, err)
+				}
+				for _, item := range params.refs(2) {
+					documentRefs = append(documentRefs, [2]int{params.ref(0), item})
+				}
+			}
+		}
+	}
+
+	// External references tie a document file to the definition of the
+	// product it holds
+	for _, ref := range documentRefs {
+		name, ok := documents[ref[0]]
+		product := formations[definitions[ref[1]]]
+		if p, exists := products[product]; ok && exists && name != "" {
+			p.File = name
+			products[product] = p
+		}
+	}
+
+	ids := make([]int, 0, len(products))
+	for id := range products {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	for _, id := range ids {
+		f.Products = append(f.Products, products[id])
+	}
+
+	productOf := func(definition int) (Product, bool) {
+		p, ok := products[formations[definitions[definition]]]
+		return p, ok
+	}
+	edges := make(map[[2]string]int)
+	for _, u := range usages {
+		parent, ok := productOf(u[0])
+		child, ok2 := productOf(u[1])
+		if ok && ok2 {
+			edges[[2]string{parent.Key(), child.Key()}]++
+		}
+	}
+	for edge, n := range edges {
+		f.Structure = append(f.Structure, Usage{Parent: edge[0], Child: edge[1], Quantity: n})
+	}
+	sort.Slice(f.Structure, func(i, j int) bool {
+		a, b := f.Structure[i], f.Structure[j]
+		if a.Parent != b.Parent {
+			return a.Parent < b.Parent
+		}
+		return a.Child < b.Child
+	})
+
+	return f, nil
+}
+
+// Key identifies a product across versions: its ID (usually the part
+// number), or its name when the exporter leaves the ID empty
+func (p Product) Key() string {
+	if p.ID != "" {
+		return p.ID
+	}
+	return p.Name
+}
+
+func (h *Header) read(name, args string) error {
+	params, err := parseParams(args)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+
+	switch name {
+	case "FILE_DESCRIPTION":
+		h.Description = params.strs(0)
+	case "FILE_NAME":
+		h.FileName = params.str(0)
+		h.Timestamp = params.str(1)
+		h.Authors = params.strs(2)
+		h.Organizations = params.strs(3)
+		h.Preprocessor = params.str(4)
+		h.OriginatingSystem = params.str(5)
+		h.Authorization = params.str(6)
+	case "FILE_SCHEMA":
+		h.Schemas = params.strs(0)
+	}
+	return nil
+}
+
+// splitStatements splits on semicolons outside strings, dropping comments
+// and collapsing whitespace outside strings
+func splitStatements(data []byte) []string {
+	var statements []string
+	var b strings.Builder
+	inString := false
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		if inString {
+			b.WriteByte(c)
+			if c == '\'' {
+				if i+1 < len(data) && data[i+1] == '\'' {
+					b.WriteByte('\'')
+					i++
+				} else {
+					inString = false
+				}
+			}
+			continue
+		}
+
+		switch {
+		case c == '\'':
+			inString = true
+			b.WriteByte(c)
+		case c == '/' && i+1 < len(data) && data[i+1] == '*':
+			end := bytes.Index(data[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(data)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			statements = append(statements, strings.TrimSpace(b.String()))
+			b.Reset()
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			// Whitespace is insignificant outside strings
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return statements
+}
+
+// splitRecord splits "NAME(args)" into the keyword and its raw arguments
+func splitRecord(stmt string) (string, string, error) {
+	open := strings.IndexByte(stmt, '(')
+	if open <= 0 || !strings.HasSuffix(stmt, ")") {
+		return "", "", fmt.Errorf("malformed record %.40q", stmt)
+	}
+	return stmt[:open], stmt[open+1 : len(stmt)-1], nil
+}
+
+// splitInstance reads "#12=NAME(args)" or the complex form
+// "#12=(NAME1(args)NAME2(args))", returning every entity type named
+func splitInstance(stmt string) (int, []string, string, error) {
+	eq := strings.IndexByte(stmt, '=')
+	if !strings.HasPrefix(stmt, "#") || eq < 0 {
+		return 0, nil, "", fmt.Errorf("malformed instance %.40q", stmt)
+	}
+	id, err := strconv.Atoi(stmt[1:eq])
+	if err != nil {
+		return 0, nil, "", fmt.Errorf("malformed instance id %.40q", stmt)
+	}
+
+	body := stmt[eq+1:]
+	if !strings.HasPrefix(body, "(") {
+		name, args, err := splitRecord(body)
+		if err != nil {
+			return 0, nil, "", fmt.Errorf("#%d: %w", id, err)
+		}
+		return id, []string{name}, args, nil
+	}
+
+	// Complex instance: a list of partial records
+	if len(body) < 2 || !strings.HasSuffix(body, ")") {
+		return 0, nil, "", fmt.Errorf("#%d: malformed complex instance", id)
+	}
+	var types []string
+	inner := body[1 : len(body)-1]
+	for len(inner) > 0 {
+		open := strings.IndexByte(inner, '(')
+		if open <= 0 {
+			return 0, nil, "", fmt.Errorf("#%d: malformed complex instance", id)
+		}
+		types = append(types, inner[:open])
+		end := matchingParen(inner, open)
+		if end < 0 {
+			return 0, nil, "", fmt.Errorf("#%d: unbalanced parentheses", id)
+		}
+		inner = inner[end+1:]
+	}
+	if len(types) == 0 {
+		return 0, nil, "", fmt.Errorf("#%d: empty complex instance", id)
+	}
+	return id, types, "", nil
+}
+
+// matchingParen returns the index of the parenthesis closing s[open]
+func matchingParen(s string, open int) int {
+	depth := 0
+	inString := false
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case inString:
+			if c == '\'' {
+				if i+1 < len(s) && s[i+1] == '\'' {
+					i++
+				} else {
+					inString = false
+				}
+			}
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// param is one parsed argument. Only the kinds we read are distinguished;
+// numbers, enumerations and typed values are kept as raw text.
+type param struct {
+	kind  byte // 's' string, 'r' reference, 'l' list, '$' unset, 'o' other
+	text  string
+	ref   int
+	items params
+}
+
+type params []param
+
+func (p params) str(i int) string {
+	if i < len(p) && p[i].kind == 's' {
+		return p[i].text
+	}
+	return ""
+}
+
+func (p params) ref(i int) int {
+	if i < len(p) && p[i].kind == 'r' {
+		return p[i].ref
+	}
+	return 0
+}
+
+func (p params) refs(i int) []int {
+	var out []int
+	if i < len(p) && p[i].kind == 'l' {
+		for _, item := range p[i].items {
+			if item.kind == 'r' {
+				out = append(out, item.ref)
+			}
+		}
+	}
+	return out
+}
+
+func (p params) strs(i int) []string {
+	out := []string{}
+	if i < len(p) && p[i].kind == 'l' {
+		for _, item := range p[i].items {
+			if item.kind == 's' {
+				out = append(out, item.text)
+			}
+		}
+	}
+	return out
+}
+
+func parseParams(s string) (params, error) {
+	out, rest, err := parseList(s)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %.20q after arguments", rest)
+	}
+	return out, nil
+}
+
+// parseList reads comma-separated params up to an unmatched ')' or the end
+func parseList(s string) (params, string, error) {
+	var out params
+	for {
+		if s == "" || s[0] == ')' {
+			return out, s, nil
+		}
+
+		p, rest, err := parseParam(s)
+		if err != nil {
+			return nil, "", err
+		}
+		out = append(out, p)
+		s = rest
+		if strings.HasPrefix(s, ",") {
+			s = s[1:]
+		}
+	}
+}
+
+func parseParam(s string) (param, string, error) {
+	switch s[0] {
+	case '\'':
+		end := 1
+		for ; end < len(s); end++ {
+			if s[end] == '\'' {
+				if end+1 < len(s) && s[end+1] == '\'' {
+					end++
+					continue
+				}
+				break
+			}
+		}
+		if end >= len(s) {
+			return param{}, "", errors.New("unterminated string")
+		}
+		raw := strings.ReplaceAll(s[1:end], "''", "'")
+		return param{kind: 's', text: decodeString(raw)}, s[end+1:], nil
+
+	case '#':
+		end := 1
+		for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+			end++
+		}
+		id, err := strconv.Atoi(s[1:end])
+		if err != nil {
+			return param{}, "", fmt.Errorf("invalid reference %.20q", s)
+		}
+		return param{kind: 'r', ref: id}, s[end:], nil
+
+	case '(':
+		items, rest, err := parseList(s[1:])
+		if err != nil {
+			return param{}, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return param{}, "", errors.New("unterminated list")
+		}
+		return param{kind: 'l', items: items}, rest[1:], nil
+
+	case '$':
+		return param{kind: '$'}, s[1:], nil
+	}
+
+	// Number, enumeration, '*' or a typed value such as LENGTH_MEASURE(2.)
+	end := 0
+	for end < len(s) && s[end] != ',' && s[end] != ')' {
+		if s[end] == '(' {
+			close := matchingParen(s, end)
+			if close < 0 {
+				return param{}, "", errors.New("unbalanced parentheses")
+			}
+			end = close
+		}
+		end++
+	}
+	return param{kind: 'o', text: s[:end]}, s[end:], nil
+}
+
+// decodeString expands Part 21 control directives: \X2\…\X0\ and
+// \X4\…\X0\ hex-encoded UCS-2/UCS-4, \X\hh single bytes and \\
+func decodeString(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		switch {
+		case strings.HasPrefix(s[i:], "\\X2\\") || strings.HasPrefix(s[i:], "\\X4\\"):
+			width := 4
+			if s[i+2] == '4' {
+				width = 8
+			}
+			end := strings.Index(s[i+4:], "\\X0\\")
+			if end < 0 {
+				b.WriteString(s[i:])
+				return b.String()
+			}
+			hex := s[i+4 : i+4+end]
+			var units []uint16
+			for j := 0; j+width <= len(hex); j += width {
+				v, err := strconv.ParseUint(hex[j:j+width], 16, 32)
+				if err != nil {
+					continue
+				}
+				if width == 8 {
+					b.WriteRune(rune(v))
+				} else {
+					units = append(units, uint16(v))
+				}
+			}
+			b.WriteString(string(utf16.Decode(units)))
+			i += 4 + end + 4
+		case strings.HasPrefix(s[i:], "\\X\\") && i+5 <= len(s):
+			if v, err := strconv.ParseUint(s[i+3:i+5], 16, 8); err == nil {
+				b.WriteRune(rune(v))
+				i += 5
+			} else {
+				b.WriteByte(s[i])
+				i++
+			}
+		case strings.HasPrefix(s[i:], "\\\\"):
+			b.WriteByte('\\')
+			i += 2
+		default:
+			b.WriteByte(s[i])
+			i++
+		}
+	}
+	return b.String()
+}
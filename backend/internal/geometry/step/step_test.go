@@ -0,0 +1,80 @@
+package step
+
+import (
+	"errors"
+	"testing"
+)
+
+const assemblySTEP = `ISO-10303-21;
+HEADER;
+FILE_DESCRIPTION(('assembly'),'2;1');
+FILE_NAME('asm.step','2024-01-01T00:00:00',('Ann'),('Acme'),'pre','CAD','');
+FILE_SCHEMA(('AP214'));
+ENDSEC;
+DATA;
+#1=PRODUCT('ASM','Assembly','',(#99));
+#2=PRODUCT_DEFINITION_FORMATION('','',#1);
+#3=PRODUCT_DEFINITION('design','',#2,#98);
+#4=PRODUCT('BOLT','Bolt','M3 bolt',(#99));
+#5=PRODUCT_DEFINITION_FORMATION('','',#4);
+#6=PRODUCT_DEFINITION('design','',#5,#98);
+#7=NEXT_ASSEMBLY_USAGE_OCCURRENCE('1','','',#3,#6,$);
+#8=NEXT_ASSEMBLY_USAGE_OCCURRENCE('2','','',#3,#6,$);
+#9=DOCUMENT_FILE('bolt.step','',$,#97,'',$);
+#10=APPLIED_DOCUMENT_REFERENCE(#9,'',(#6));
+#11=(LENGTH_UNIT()NAMED_UNIT(*)SI_UNIT(.MILLI.,.METRE.));
+ENDSEC;
+END-ISO-10303-21;
+`
+
+func TestParseAssembly(t *testing.T) {
+	f, err := ParseBytes([]byte(assemblySTEP))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if f.Header.FileName != "asm.step" || len(f.Header.Authors) != 1 || f.Header.Authors[0] != "Ann" {
+		t.Errorf("header = %+v", f.Header)
+	}
+	if len(f.Products) != 2 {
+		t.Fatalf("products = %+v, want 2", f.Products)
+	}
+	if bolt := f.Products[1]; bolt.ID != "BOLT" || bolt.Description != "M3 bolt" || bolt.File != "bolt.step" {
+		t.Errorf("bolt = %+v", bolt)
+	}
+	if len(f.Structure) != 1 || f.Structure[0] != (Usage{Parent: "ASM", Child: "BOLT", Quantity: 2}) {
+		t.Errorf("structure = %+v, want ASM using 2 BOLT", f.Structure)
+	}
+	if f.EntityTotal != 11 || f.EntityCounts["SI_UNIT"] != 1 {
+		t.Errorf("entity total %d, counts %v", f.EntityTotal, f.EntityCounts)
+	}
+}
+
+func TestParseNotStep(t *testing.T) {
+	for _, data := range []string{"", "solid cube\nendsolid\n", "HEADER;"} {
+		if _, err := ParseBytes([]byte(data)); !errors.Is(err, ErrNotStep) {
+			t.Errorf("ParseBytes(%q) error = %v, want ErrNotStep", data, err)
+		}
+	}
+}
+
+// Each of these once panicked or must fail cleanly rather than parse
+func TestParseMalformed(t *testing.T) {
+	for _, data := range []string{
+		"ISO-10303-21;000000;DATA;#0=(;",
+		"ISO-10303-21;DATA;#1=(;ENDSEC;",
+		"ISO-10303-21;DATA;#1=();ENDSEC;",
+		"ISO-10303-21;DATA;#1=(A(;ENDSEC;",
+		"ISO-10303-21;DATA;#1=((B());ENDSEC;",
+		"ISO-10303-21;DATA;#=PRODUCT();ENDSEC;",
+		"ISO-10303-21;DATA;#1;ENDSEC;",
+		"ISO-10303-21;DATA;#1=PRODUCT((;ENDSEC;",
+		"ISO-10303-21;DATA;#1=PRODUCT(#x);ENDSEC;",
+		"ISO-10303-21;DATA;#1=PRODUCT('a')x);ENDSEC;",
+		"ISO-10303-21;HEADER;FILE_NAME(;ENDSEC;",
+		"ISO-10303-21;HEADER;(;ENDSEC;",
+	} {
+		if _, err := ParseBytes([]byte(data)); err == nil {
+			t.Errorf("ParseBytes(%q) succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+// Package stl reads ASCII and binary STL files into indexed meshes.
+package stl
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+var ErrNotSTL = errors.New("not an STL file")
+
+const (
+	binaryHeaderSize   = 80
+	binaryTriangleSize = 50
+)
+
+// IsSTL reports whether a filename has an STL extension
+func IsSTL(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".stl")
+}
+
+func Parse(r io.Reader) (*geometry.Mesh, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read STL: %w", err)
+	}
+	return ParseBytes(data)
+}
+
+// ParseBytes detects the encoding and parses an STL. Binary files are
+// recognised by their triangle count matching the file size, since many
+// exporters also start binary headers with "solid".
+func ParseBytes(data []byte) (*geometry.Mesh, error) {
+	if isBinary(data) {
+		return parseBinary(data)
+	}
+	if bytes.HasPrefix(bytes.TrimLeft(data, " \t\r\n"), []byte("solid")) {
+		return parseASCII(data)
+	}
+	return nil, ErrNotSTL
+}
+
+func isBinary(data []byte) bool {
+	if len(data) < binaryHeaderSize+4 {
+		return false
+	}
+	count := binary.LittleEndian.Uint32(data[binaryHeaderSize:])
+	return int64(len(data)) == binaryHeaderSize+4+int64(count)*binaryTriangleSize
+}
+
+func parseBinary(data []byte) (*geometry.Mesh, error) {
+	count := int(binary.LittleEndian.Uint32(data[binaryHeaderSize:]))
+	builder := geometry.NewMeshBuilder()
+
+	offset := binaryHeaderSize + 4
+	for i := 0; i < count; i++ {
+		// Skip the 12-byte facet normal; it is recomputed from the winding
+		rec := data[offset+12 : offset+binaryTriangleSize]
+
+		var corners [3]geometry.Vec3
+		for c := 0; c < 3; c++ {
+			corners[c] = geometry.Vec3{
+				X: float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[c*12:]))),
+				Y: float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[c*12+4:]))),
+				Z: float64(math.Float32frombits(binary.LittleEndian.Uint32(rec[c*12+8:]))),
+			}
+			if !corners[c].IsFinite() {
+				return nil, fmt.Errorf("triangle %d has a non-finite vertex", i)
+			}
+		}
+
+		builder.AddTriangle(corners[0], corners[1], corners[2])
+		offset += binaryTriangleSize
+	}
+
+	return builder.Mesh(), nil
+}
+
+func parseASCII(data []byte) (*geometry.Mesh, error) {
+	builder := geometry.NewMeshBuilder()
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var corners []geometry.Vec3
+	line := 0
+	for scanner.Scan() {
+		line++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "vertex") {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: malformed vertex", line)
+		}
+
+		var p [3]float64
+		for i := 0; i < 3; i++ {
+			v, err := strconv.ParseFloat(fields[i+1], 64)
+			if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, fmt.Errorf("line %d: invalid coordinate %q", line, fields[i+1])
+			}
+			// Match binary STL precision so both encodings weld identically
+			p[i] = float64(float32(v))
+		}
+
+		corners = append(corners, geometry.Vec3{X: p[0], Y: p[1], Z: p[2]})
+		if len(corners) == 3 {
+			builder.AddTriangle(corners[0], corners[1], corners[2])
+			corners = corners[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read STL: %w", err)
+	}
+	if len(corners) != 0 {
+		return nil, fmt.Errorf("incomplete facet at end of file")
+	}
+
+	return builder.Mesh(), nil
+}
+
+// WriteBinary encodes the mesh as a binary STL with computed facet normals
+func WriteBinary(w io.Writer, m *geometry.Mesh, header string) error {
+	buf := make([]byte, binaryHeaderSize+4+len(m.Triangles)*binaryTriangleSize)
+	copy(buf[:binaryHeaderSize], header)
+	binary.LittleEndian.PutUint32(buf[binaryHeaderSize:], uint32(len(m.Triangles)))
+
+	off := binaryHeaderSize + 4
+	put := func(v geometry.Vec3) {
+		binary.LittleEndian.PutUint32(buf[off:], math.Float32bits(float32(v.X)))
+		binary.LittleEndian.PutUint32(buf[off+4:], math.Float32bits(float32(v.Y)))
+		binary.LittleEndian.PutUint32(buf[off+8:], math.Float32bits(float32(v.Z)))
+		off += 12
+	}
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		put(geometry.TriangleNormal(a, b, c))
+		put(a)
+		put(b)
+		put(c)
+		off += 2 // attribute byte count
+	}
+
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,128 @@
+package stl
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const tetraASCII = `solid tetra
+  facet normal 0 0 -1
+    outer loop
+      vertex 0 0 0
+      vertex 0 1 0
+      vertex 1 0 0
+    endloop
+  endfacet
+  facet normal 0 -1 0
+    outer loop
+      vertex 0 0 0
+      vertex 1 0 0
+      vertex 0 0 1
+    endloop
+  endfacet
+  facet normal -1 0 0
+    outer loop
+      vertex 0 0 0
+      vertex 0 0 1
+      vertex 0 1 0
+    endloop
+  endfacet
+  facet normal 1 1 1
+    outer loop
+      VERTEX 1 0 0
+      VERTEX 0 1 0
+      VERTEX 0 0 1e0
+    endloop
+  endfacet
+endsolid tetra
+`
+
+func TestParseASCII(t *testing.T) {
+	m, err := ParseBytes([]byte(tetraASCII))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if len(m.Triangles) != 4 || len(m.Vertices) != 4 {
+		t.Errorf("got %d triangles over %d vertices, want 4 over 4", len(m.Triangles), len(m.Vertices))
+	}
+}
+
+// Both encodings of a mesh parse to the same vertices and triangles
+func TestBinaryRoundTrip(t *testing.T) {
+	ascii, err := ParseBytes([]byte(tetraASCII))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	// Binary headers starting with "solid" must still be read as binary
+	if err := WriteBinary(&buf, ascii, "solid exported by a careless tool"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != binaryHeaderSize+4+4*binaryTriangleSize {
+		t.Errorf("binary STL is %d bytes", buf.Len())
+	}
+	bin, err := ParseBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("parsing binary: %v", err)
+	}
+	if !reflect.DeepEqual(bin.Vertices, ascii.Vertices) || !reflect.DeepEqual(bin.Triangles, ascii.Triangles) {
+		t.Error("binary and ASCII meshes differ")
+	}
+}
+
+func binarySTL(triangles ...[9]float32) []byte {
+	buf := make([]byte, binaryHeaderSize+4+len(triangles)*binaryTriangleSize)
+	binary.LittleEndian.PutUint32(buf[binaryHeaderSize:], uint32(len(triangles)))
+	for i, tri := range triangles {
+		off := binaryHeaderSize + 4 + i*binaryTriangleSize + 12
+		for j, v := range tri {
+			binary.LittleEndian.PutUint32(buf[off+j*4:], math.Float32bits(v))
+		}
+	}
+	return buf
+}
+
+func TestParseMalformed(t *testing.T) {
+	nan := float32(math.NaN())
+	inf := float32(math.Inf(1))
+	for _, c := range []struct {
+		name  string
+		input []byte
+	}{
+		{"binary NaN vertex", binarySTL([9]float32{0, 0, 0, 1, 0, 0, 0, nan, 0})},
+		{"binary infinite vertex", binarySTL([9]float32{0, 0, 0, 1, 0, 0, 0, 1, inf})},
+		{"short vertex", []byte("solid x\nvertex 0 0\n")},
+		{"long vertex", []byte("solid x\nvertex 0 0 0 0\n")},
+		{"bad coordinate", []byte("solid x\nvertex 0 zero 0\n")},
+		{"NaN coordinate", []byte("solid x\nvertex 0 NaN 0\n")},
+		{"overflowing coordinate", []byte("solid x\nvertex 0 1e999 0\n")},
+		{"incomplete facet", []byte("solid x\nvertex 0 0 0\nvertex 1 0 0\nendsolid\n")},
+		{"line too long", []byte("solid x\nvertex 0 0 " + strings.Repeat("0", 2<<20) + "\n")},
+	} {
+		if _, err := ParseBytes(c.input); err == nil {
+			t.Errorf("%s: parsed without error", c.name)
+		}
+	}
+
+	// Binary files whose size doesn't match their count aren't STL, unless
+	// they happen to start like ASCII
+	truncated := binarySTL([9]float32{0, 0, 0, 1, 0, 0, 0, 1, 0})
+	for _, input := range [][]byte{truncated[:len(truncated)-1], append(truncated, 0), nil, []byte("OFF\n3 1 0\n")} {
+		if _, err := ParseBytes(input); !errors.Is(err, ErrNotSTL) {
+			t.Errorf("%d bytes: error = %v, want ErrNotSTL", len(input), err)
+		}
+	}
+
+	// A count claiming billions of triangles is a size mismatch, not an
+	// allocation
+	huge := binarySTL()
+	binary.LittleEndian.PutUint32(huge[binaryHeaderSize:], math.MaxUint32)
+	if _, err := ParseBytes(huge); !errors.Is(err, ErrNotSTL) {
+		t.Errorf("huge count: error = %v, want ErrNotSTL", err)
+	}
+}
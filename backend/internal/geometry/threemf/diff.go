@@ -0,0 +1,120 @@
+package threemf
+
+import (
+	"math"
+	"sort"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry/diff"
+)
+
+const (
+	ObjectAdded     = "added"
+	ObjectRemoved   = "removed"
+	ObjectChanged   = "changed"
+	ObjectUnchanged = "unchanged"
+
+	// Placement differences below this are export rounding, not a move
+	transformTolerance = 1e-6
+)
+
+type ObjectChange struct {
+	Key    string `json:"key"`
+	Status string `json:"status"`
+	// TransformChanged is set when the build item was moved or rotated on
+	// the plate, whether or not its mesh changed
+	TransformChanged bool         `json:"transform_changed"`
+	Geometry         *diff.Result `json:"geometry,omitempty"`
+}
+
+type MetadataChange struct {
+	Name string `json:"name"`
+	From string `json:"from,omitempty"`
+	To   string `json:"to,omitempty"`
+}
+
+type Diff struct {
+	FromUnit  string           `json:"from_unit"`
+	ToUnit    string           `json:"to_unit"`
+	Metadata  []MetadataChange `json:"metadata_changes"`
+	Objects   []ObjectChange   `json:"objects"`
+	Added     int              `json:"objects_added"`
+	Removed   int              `json:"objects_removed"`
+	Changed   int              `json:"objects_changed"`
+	Unchanged int              `json:"objects_unchanged"`
+}
+
+// Compare matches objects by key and diffs each pair in object coordinates,
+// so moving an item on the build plate doesn't mark every triangle changed
+func Compare(from, to *Package, opts diff.Options) *Diff {
+	d := &Diff{
+		FromUnit: from.Unit,
+		ToUnit:   to.Unit,
+		Metadata: []MetadataChange{},
+		Objects:  []ObjectChange{},
+	}
+
+	names := make(map[string]bool)
+	for name := range from.Metadata {
+		names[name] = true
+	}
+	for name := range to.Metadata {
+		names[name] = true
+	}
+	for name := range names {
+		if from.Metadata[name] != to.Metadata[name] {
+			d.Metadata = append(d.Metadata, MetadataChange{Name: name, From: from.Metadata[name], To: to.Metadata[name]})
+		}
+	}
+	sort.Slice(d.Metadata, func(i, j int) bool { return d.Metadata[i].Name < d.Metadata[j].Name })
+
+	before := make(map[string]*Object, len(from.Objects))
+	for i := range from.Objects {
+		before[from.Objects[i].Key] = &from.Objects[i]
+	}
+
+	seen := make(map[string]bool)
+	for i := range to.Objects {
+		after := &to.Objects[i]
+		seen[after.Key] = true
+
+		old, ok := before[after.Key]
+		if !ok {
+			d.Objects = append(d.Objects, ObjectChange{Key: after.Key, Status: ObjectAdded})
+			d.Added++
+			continue
+		}
+
+		change := ObjectChange{
+			Key:              after.Key,
+			Status:           ObjectUnchanged,
+			TransformChanged: !sameTransform(old, after),
+			Geometry:         diff.Compare(old.Mesh, after.Mesh, opts),
+		}
+		if change.TransformChanged || change.Geometry.TrianglesAdded > 0 || change.Geometry.TrianglesRemoved > 0 {
+			change.Status = ObjectChanged
+			d.Changed++
+		} else {
+			d.Unchanged++
+		}
+		d.Objects = append(d.Objects, change)
+	}
+
+	for _, o := range from.Objects {
+		if !seen[o.Key] {
+			d.Objects = append(d.Objects, ObjectChange{Key: o.Key, Status: ObjectRemoved})
+			d.Removed++
+		}
+	}
+	return d
+}
+
+func sameTransform(a, b *Object) bool {
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(a.Transform.M[i][j]-b.Transform.M[i][j]) > transformTolerance {
+				return false
+			}
+		}
+	}
+	return a.Transform.T.Sub(b.Transform.T).Length() <= transformTolerance
+}
@@ -0,0 +1,541 @@
+// Package threemf reads 3MF packages: a ZIP of XML model parts holding
+// objects, the build items that place them, units and metadata.
+package threemf
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+const (
+	modelRelationship = "http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"
+	defaultModelPath  = "3D/3dmodel.model"
+	relsPath          = "_rels/.rels"
+	DefaultUnit       = "millimeter"
+
+	// Components may nest, but not this deep
+	maxComponentDepth = 32
+	// Components reuse objects, so a small file can expand into a huge
+	// mesh; this is well past any printable part
+	maxTriangles = 20_000_000
+)
+
+var (
+	ErrNoObjects = errors.New("3MF package has no build items")
+	// ErrTooManyTriangles means the build items expand, through their
+	// components, into more triangles than we'll build
+	ErrTooManyTriangles = fmt.Errorf("3MF package expands to more than %d triangles", maxTriangles)
+)
+
+// Package is a parsed 3MF file. Objects lists one entry per build item, in
+// build order, since those are what the slicer actually prints.
+type Package struct {
+	Unit     string            `json:"unit"`
+	Metadata map[string]string `json:"metadata"`
+	Objects  []Object          `json:"objects"`
+}
+
+// Object is a build item resolved to a single mesh in the object's own
+// coordinates; Transform places it on the build plate
+type Object struct {
+	// Key identifies the object across versions: its name, or its ID when
+	// unnamed, with a suffix when several items share one
+	Key        string             `json:"key"`
+	ObjectID   int                `json:"object_id"`
+	Name       string             `json:"name,omitempty"`
+	Type       string             `json:"type"`
+	PartNumber string             `json:"part_number,omitempty"`
+	Transform  geometry.Transform `json:"transform"`
+	Mesh       *geometry.Mesh     `json:"-"`
+}
+
+func Is3MF(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".3mf")
+}
+
+// Mesh combines every build item, transformed into build coordinates
+func (p *Package) Mesh() *geometry.Mesh {
+	builder := geometry.NewMeshBuilder()
+	for _, o := range p.Objects {
+		for i := range o.Mesh.Triangles {
+			a, b, c := o.Mesh.Triangle(i)
+			builder.AddTriangle(o.Transform.Apply(a), o.Transform.Apply(b), o.Transform.Apply(c))
+		}
+	}
+	return builder.Mesh()
+}
+
+func Parse(r io.Reader) (*Package, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read 3MF: %w", err)
+	}
+	return ParseBytes(data)
+}
+
+func ParseBytes(data []byte) (*Package, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("3MF is not a valid ZIP: %w", err)
+	}
+
+	r := &reader{
+		files:    make(map[string]*zip.File, len(archive.File)),
+		parts:    make(map[string]*part),
+		visiting: make(map[objectRef]bool),
+		counts:   make(map[objectRef]int),
+	}
+	for _, f := range archive.File {
+		r.files[strings.ToLower(strings.TrimPrefix(f.Name, "/"))] = f
+	}
+
+	rootPath, err := r.rootModelPath()
+	if err != nil {
+		return nil, err
+	}
+	root, err := r.part(rootPath)
+	if err != nil {
+		return nil, err
+	}
+
+	pkg := &Package{
+		Unit:     root.unit,
+		Metadata: root.metadata,
+		Objects:  []Object{},
+	}
+
+	keys := make(map[string]int)
+	for _, item := range root.items {
+		itemPath := rootPath
+		if item.path != "" {
+			itemPath = item.path
+		}
+		itemPart, err := r.part(itemPath)
+		if err != nil {
+			return nil, err
+		}
+		def, ok := itemPart.objects[item.objectID]
+		if !ok {
+			return nil, fmt.Errorf("build item references missing object %d", item.objectID)
+		}
+
+		// Counted before anything is built, so a package that expands past
+		// the limit fails fast
+		count, err := r.triangleCount(itemPath, item.objectID, 0)
+		if err != nil {
+			return nil, err
+		}
+		r.triangles += count
+		if r.triangles > maxTriangles {
+			return nil, ErrTooManyTriangles
+		}
+
+		builder := geometry.NewMeshBuilder()
+		if err := r.appendObject(builder, itemPath, item.objectID, geometry.Identity(), 0); err != nil {
+			return nil, err
+		}
+
+		key := def.name
+		if key == "" {
+			key = fmt.Sprintf("object %d", item.objectID)
+		}
+		keys[key]++
+		if keys[key] > 1 {
+			key = fmt.Sprintf("%s #%d", key, keys[key])
+		}
+
+		partNumber := item.partNumber
+		if partNumber == "" {
+			partNumber = def.partNumber
+		}
+		pkg.Objects = append(pkg.Objects, Object{
+			Key:        key,
+			ObjectID:   item.objectID,
+			Name:       def.name,
+			Type:       def.objectType,
+			PartNumber: partNumber,
+			Transform:  item.transform,
+			Mesh:       builder.Mesh(),
+		})
+	}
+
+	if len(pkg.Objects) == 0 {
+		return nil, ErrNoObjects
+	}
+	return pkg, nil
+}
+
+type reader struct {
+	files map[string]*zip.File
+	parts map[string]*part
+	// triangles counts what every build item expands to
+	triangles int
+	// visiting holds the objects on the current component chain
+	visiting map[objectRef]bool
+	// counts memoizes triangleCount per object
+	counts map[objectRef]int
+}
+
+type objectRef struct {
+	part string
+	id   int
+}
+
+// rootModelPath follows the package relationships to the 3D model part
+func (r *reader) rootModelPath() (string, error) {
+	if f, ok := r.files[relsPath]; ok {
+		rc, err := f.Open()
+		if err != nil {
+			return "", fmt.Errorf("failed to open relationships: %w", err)
+		}
+		defer rc.Close()
+
+		var rels struct {
+			Relationships []struct {
+				Target string `xml:"Target,attr"`
+				Type   string `xml:"Type,attr"`
+			} `xml:"Relationship"`
+		}
+		if err := xml.NewDecoder(rc).Decode(&rels); err != nil {
+			return "", fmt.Errorf("failed to parse relationships: %w", err)
+		}
+		for _, rel := range rels.Relationships {
+			if rel.Type == modelRelationship {
+				return rel.Target, nil
+			}
+		}
+	}
+	return defaultModelPath, nil
+}
+
+func (r *reader) part(name string) (*part, error) {
+	key := strings.ToLower(strings.TrimPrefix(path.Clean("/"+name), "/"))
+	if p, ok := r.parts[key]; ok {
+		return p, nil
+	}
+
+	f, ok := r.files[key]
+	if !ok {
+		return nil, fmt.Errorf("3MF model part %s not found", name)
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer rc.Close()
+
+	p, err := parsePart(rc)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	r.parts[key] = p
+	return p, nil
+}
+
+// appendObject adds an object's triangles, and those of its components, to
+// builder under the accumulated transform
+func (r *reader) appendObject(builder *geometry.MeshBuilder, partPath string, id int, t geometry.Transform, depth int) error {
+	if depth > maxComponentDepth {
+		return fmt.Errorf("object %d: components nest too deeply", id)
+	}
+
+	p, err := r.part(partPath)
+	if err != nil {
+		return err
+	}
+	def, ok := p.objects[id]
+	if !ok {
+		return fmt.Errorf("missing object %d in %s", id, partPath)
+	}
+
+	for _, tri := range def.triangles {
+		builder.AddTriangle(t.Apply(def.vertices[tri[0]]), t.Apply(def.vertices[tri[1]]), t.Apply(def.vertices[tri[2]]))
+	}
+	for _, c := range def.components {
+		componentPath := partPath
+		if c.path != "" {
+			componentPath = c.path
+		}
+		if err := r.appendObject(builder, componentPath, c.objectID, c.transform.Then(t), depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// triangleCount is how many triangles an object expands to through its
+// components. Counts are memoized per object, so an object shared by many
+// components is only walked once, and stop growing past maxTriangles.
+func (r *reader) triangleCount(partPath string, id int, depth int) (int, error) {
+	if depth > maxComponentDepth {
+		return 0, fmt.Errorf("object %d: components nest too deeply", id)
+	}
+
+	ref := objectRef{part: strings.ToLower(path.Clean("/" + partPath)), id: id}
+	if count, ok := r.counts[ref]; ok {
+		return count, nil
+	}
+	// Objects may be shared by several components, but not contain
+	// themselves
+	if r.visiting[ref] {
+		return 0, fmt.Errorf("object %d: components form a cycle", id)
+	}
+	r.visiting[ref] = true
+	defer delete(r.visiting, ref)
+
+	p, err := r.part(partPath)
+	if err != nil {
+		return 0, err
+	}
+	def, ok := p.objects[id]
+	if !ok {
+		return 0, fmt.Errorf("missing object %d in %s", id, partPath)
+	}
+
+	count := len(def.triangles)
+	for _, c := range def.components {
+		componentPath := partPath
+		if c.path != "" {
+			componentPath = c.path
+		}
+		n, err := r.triangleCount(componentPath, c.objectID, depth+1)
+		if err != nil {
+			return 0, err
+		}
+		count = min(count+n, maxTriangles+1)
+	}
+	r.counts[ref] = count
+	return count, nil
+}
+
+// part is one model XML file. Only the root part's unit, metadata and
+// build items are used.
+type part struct {
+	unit     string
+	metadata map[string]string
+	objects  map[int]*objectDef
+	items    []reference
+}
+
+type objectDef struct {
+	name       string
+	objectType string
+	partNumber string
+	vertices   []geometry.Vec3
+	triangles  [][3]int
+	components []reference
+}
+
+// reference is a build item or a component pointing at an object, possibly
+// in another model part (the production extension's path attribute)
+type reference struct {
+	objectID   int
+	path       string
+	partNumber string
+	transform  geometry.Transform
+}
+
+// parsePart streams a model part, since mesh-heavy parts can be hundreds of
+// megabytes of vertex elements
+func parsePart(r io.Reader) (*part, error) {
+	p := &part{
+		unit:     DefaultUnit,
+		metadata: make(map[string]string),
+		objects:  make(map[int]*objectDef),
+	}
+
+	decoder := xml.NewDecoder(r)
+	var stack []string
+	var current *objectDef
+	var metadataName string
+	var text strings.Builder
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid model XML: %w", err)
+		}
+
+		switch el := tok.(type) {
+		case xml.StartElement:
+			parent := ""
+			if len(stack) > 0 {
+				parent = stack[len(stack)-1]
+			}
+			stack = append(stack, el.Name.Local)
+
+			switch el.Name.Local {
+			case "model":
+				if unit := attr(el, "unit"); unit != "" {
+					p.unit = unit
+				}
+			case "metadata":
+				if parent == "model" {
+					metadataName = attr(el, "name")
+					text.Reset()
+				}
+			case "object":
+				id, err := strconv.Atoi(attr(el, "id"))
+				if err != nil {
+					return nil, fmt.Errorf("object has invalid id %q", attr(el, "id"))
+				}
+				objectType := attr(el, "type")
+				if objectType == "" {
+					objectType = "model"
+				}
+				current = &objectDef{
+					name:       attr(el, "name"),
+					objectType: objectType,
+					partNumber: attr(el, "partnumber"),
+				}
+				p.objects[id] = current
+			case "vertex":
+				if current == nil {
+					continue
+				}
+				v, err := parseVertex(el)
+				if err != nil {
+					return nil, err
+				}
+				current.vertices = append(current.vertices, v)
+			case "triangle":
+				if current == nil {
+					continue
+				}
+				tri, err := parseTriangle(el, len(current.vertices))
+				if err != nil {
+					return nil, err
+				}
+				current.triangles = append(current.triangles, tri)
+			case "component":
+				if current == nil {
+					continue
+				}
+				ref, err := parseReference(el)
+				if err != nil {
+					return nil, err
+				}
+				current.components = append(current.components, ref)
+			case "item":
+				ref, err := parseReference(el)
+				if err != nil {
+					return nil, err
+				}
+				p.items = append(p.items, ref)
+			}
+
+		case xml.CharData:
+			if metadataName != "" {
+				text.Write(el)
+			}
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			switch el.Name.Local {
+			case "metadata":
+				if metadataName != "" {
+					p.metadata[metadataName] = strings.TrimSpace(text.String())
+					metadataName = ""
+				}
+			case "object":
+				current = nil
+			}
+		}
+	}
+	return p, nil
+}
+
+func attr(el xml.StartElement, name string) string {
+	for _, a := range el.Attr {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+func parseVertex(el xml.StartElement) (geometry.Vec3, error) {
+	var p [3]float64
+	for i, name := range []string{"x", "y", "z"} {
+		v, err := strconv.ParseFloat(attr(el, name), 64)
+		if err != nil {
+			return geometry.Vec3{}, fmt.Errorf("vertex has invalid %s %q", name, attr(el, name))
+		}
+		p[i] = v
+	}
+	return geometry.Vec3{X: p[0], Y: p[1], Z: p[2]}, nil
+}
+
+// parseTriangle reads vertex indices, which 3MF requires to refer to
+// vertices already declared in the same object
+func parseTriangle(el xml.StartElement, count int) ([3]int, error) {
+	var t [3]int
+	for i, name := range []string{"v1", "v2", "v3"} {
+		v, err := strconv.Atoi(attr(el, name))
+		if err != nil || v < 0 || v >= count {
+			return t, fmt.Errorf("triangle has invalid %s %q", name, attr(el, name))
+		}
+		t[i] = v
+	}
+	return t, nil
+}
+
+func parseReference(el xml.StartElement) (reference, error) {
+	id, err := strconv.Atoi(attr(el, "objectid"))
+	if err != nil {
+		return reference{}, fmt.Errorf("%s has invalid objectid %q", el.Name.Local, attr(el, "objectid"))
+	}
+	t, err := parseTransform(attr(el, "transform"))
+	if err != nil {
+		return reference{}, err
+	}
+	return reference{
+		objectID:   id,
+		path:       attr(el, "path"),
+		partNumber: attr(el, "partnumber"),
+		transform:  t,
+	}, nil
+}
+
+// parseTransform reads 3MF's 3x4 matrix "m00 m01 m02 m10 ... m32", which
+// multiplies row vectors, into our column-vector Transform
+func parseTransform(s string) (geometry.Transform, error) {
+	if strings.TrimSpace(s) == "" {
+		return geometry.Identity(), nil
+	}
+
+	fields := strings.Fields(s)
+	if len(fields) != 12 {
+		return geometry.Transform{}, fmt.Errorf("transform %q needs 12 values", s)
+	}
+	var m [12]float64
+	for i, f := range fields {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return geometry.Transform{}, fmt.Errorf("invalid transform value %q", f)
+		}
+		m[i] = v
+	}
+
+	var t geometry.Transform
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			t.M[i][j] = m[j*3+i]
+		}
+	}
+	t.T = geometry.Vec3{X: m[9], Y: m[10], Z: m[11]}
+	return t, nil
+}
@@ -0,0 +1,183 @@
+package threemf
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// tetra is a four-triangle object with the given id and attributes
+func tetra(id int, attrs string) string {
+	return fmt.Sprintf(`<object id="%d" %s><mesh><vertices>
+<vertex x="0" y="0" z="0"/><vertex x="10" y="0" z="0"/><vertex x="0" y="10" z="0"/><vertex x="0" y="0" z="10"/>
+</vertices><triangles>
+<triangle v1="0" v2="2" v3="1"/><triangle v1="0" v2="1" v3="3"/><triangle v1="0" v2="3" v3="2"/><triangle v1="1" v2="2" v3="3"/>
+</triangles></mesh></object>`, id, attrs)
+}
+
+func model(resources, build string) string {
+	return `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="millimeter" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+<resources>` + resources + `</resources>
+<build>` + build + `</build>
+</model>`
+}
+
+// pack zips parts by name into a 3MF package
+func pack(t *testing.T, parts map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParsePackage(t *testing.T) {
+	root := `<?xml version="1.0" encoding="UTF-8"?>
+<model unit="inch" xmlns="http://schemas.microsoft.com/3dmanufacturing/core/2015/02">
+<metadata name="Title"> Bracket </metadata>
+<resources>` + tetra(1, `name="bracket" partnumber="BR-1"`) + `
+<object id="2" name="pair"><components>
+<component objectid="1"/><component objectid="1" transform="1 0 0 0 1 0 0 0 1 20 0 0"/>
+</components></object>
+</resources>
+<build>
+<item objectid="1" transform="1 0 0 0 1 0 0 0 1 5 6 7"/>
+<item objectid="1"/>
+<item objectid="2"/>
+</build>
+</model>`
+	rels := `<?xml version="1.0" encoding="UTF-8"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Target="/3D/part.model" Id="rel0" Type="http://schemas.microsoft.com/3dmanufacturing/2013/01/3dmodel"/>
+</Relationships>`
+
+	pkg, err := ParseBytes(pack(t, map[string]string{"_rels/.rels": rels, "3D/part.model": root}))
+	if err != nil {
+		t.Fatalf("ParseBytes: %v", err)
+	}
+	if pkg.Unit != "inch" || pkg.Metadata["Title"] != "Bracket" {
+		t.Errorf("unit %q metadata %v", pkg.Unit, pkg.Metadata)
+	}
+	if len(pkg.Objects) != 3 {
+		t.Fatalf("got %d objects, want 3", len(pkg.Objects))
+	}
+	for i, want := range []struct {
+		key   string
+		tris  int
+		partN string
+	}{
+		{"bracket", 4, "BR-1"},
+		{"bracket #2", 4, "BR-1"},
+		{"pair", 8, ""},
+	} {
+		o := pkg.Objects[i]
+		if o.Key != want.key || len(o.Mesh.Triangles) != want.tris || o.PartNumber != want.partN {
+			t.Errorf("object %d = %q with %d triangles, part %q; want %q with %d, part %q",
+				i, o.Key, len(o.Mesh.Triangles), o.PartNumber, want.key, want.tris, want.partN)
+		}
+	}
+	if tr := pkg.Objects[0].Transform.T; tr.X != 5 || tr.Y != 6 || tr.Z != 7 {
+		t.Errorf("translation = %+v, want 5 6 7", tr)
+	}
+	if b := pkg.Objects[2].Mesh.Bounds(); b.Max.X != 30 {
+		t.Errorf("component bounds max x = %v, want 30", b.Max.X)
+	}
+	if n := len(pkg.Mesh().Triangles); n != 16 {
+		t.Errorf("combined mesh has %d triangles, want 16", n)
+	}
+}
+
+func TestParseMalformed(t *testing.T) {
+	valid := tetra(1, "")
+	for _, c := range []struct {
+		name  string
+		parts map[string]string
+	}{
+		{"no model part", map[string]string{"other.txt": "x"}},
+		{"invalid XML", map[string]string{defaultModelPath: "<model><resources>"}},
+		{"no build items", map[string]string{defaultModelPath: model(valid, "")}},
+		{"missing object", map[string]string{defaultModelPath: model(valid, `<item objectid="7"/>`)}},
+		{"bad item id", map[string]string{defaultModelPath: model(valid, `<item objectid="one"/>`)}},
+		{"bad object id", map[string]string{defaultModelPath: model(`<object id="x"/>`, `<item objectid="1"/>`)}},
+		{"bad vertex", map[string]string{defaultModelPath: model(
+			`<object id="1"><mesh><vertices><vertex x="0" y="nope" z="0"/></vertices></mesh></object>`,
+			`<item objectid="1"/>`)}},
+		{"triangle index out of range", map[string]string{defaultModelPath: model(
+			`<object id="1"><mesh><vertices><vertex x="0" y="0" z="0"/></vertices>
+<triangles><triangle v1="0" v2="0" v3="5"/></triangles></mesh></object>`,
+			`<item objectid="1"/>`)}},
+		{"negative triangle index", map[string]string{defaultModelPath: model(
+			`<object id="1"><mesh><vertices><vertex x="0" y="0" z="0"/></vertices>
+<triangles><triangle v1="-1" v2="0" v3="0"/></triangles></mesh></object>`,
+			`<item objectid="1"/>`)}},
+		{"short transform", map[string]string{defaultModelPath: model(valid, `<item objectid="1" transform="1 0 0"/>`)}},
+		{"bad transform", map[string]string{defaultModelPath: model(valid, `<item objectid="1" transform="1 0 0 0 1 0 0 0 1 x 0 0"/>`)}},
+		{"component cycle", map[string]string{defaultModelPath: model(
+			`<object id="1"><components><component objectid="2"/></components></object>
+<object id="2"><components><component objectid="1"/></components></object>`,
+			`<item objectid="1"/>`)}},
+		{"self component", map[string]string{defaultModelPath: model(
+			`<object id="1"><components><component objectid="1"/></components></object>`,
+			`<item objectid="1"/>`)}},
+		{"missing component", map[string]string{defaultModelPath: model(
+			`<object id="1"><components><component objectid="9"/></components></object>`,
+			`<item objectid="1"/>`)}},
+		{"missing component part", map[string]string{defaultModelPath: model(
+			`<object id="1"><components><component objectid="1" path="/3D/other.model"/></components></object>`,
+			`<item objectid="1"/>`)}},
+		{"relationship to missing part", map[string]string{
+			relsPath: `<Relationships><Relationship Target="/3D/gone.model" Type="` + modelRelationship + `"/></Relationships>`,
+		}},
+	} {
+		if _, err := ParseBytes(pack(t, c.parts)); err == nil {
+			t.Errorf("%s: parsed without error", c.name)
+		}
+	}
+
+	if _, err := ParseBytes([]byte("solid cube\nendsolid\n")); err == nil {
+		t.Error("parsed a non-ZIP file")
+	}
+}
+
+// chain nests objects depth deep, each level with width components of the
+// level below, over a single tetrahedron
+func chain(depth, width int) string {
+	var b strings.Builder
+	b.WriteString(tetra(1, ""))
+	for level := 2; level <= depth+1; level++ {
+		fmt.Fprintf(&b, `<object id="%d"><components>`, level)
+		for range width {
+			fmt.Fprintf(&b, `<component objectid="%d"/>`, level-1)
+		}
+		b.WriteString(`</components></object>`)
+	}
+	return b.String()
+}
+
+func TestParseExpansionLimits(t *testing.T) {
+	// 4 * 10^7 triangles from a few kilobytes
+	wide := model(chain(7, 10), `<item objectid="8"/>`)
+	if _, err := ParseBytes(pack(t, map[string]string{defaultModelPath: wide})); !errors.Is(err, ErrTooManyTriangles) {
+		t.Errorf("wide components: error = %v, want ErrTooManyTriangles", err)
+	}
+
+	deep := model(chain(maxComponentDepth+1, 1), fmt.Sprintf(`<item objectid="%d"/>`, maxComponentDepth+2))
+	if _, err := ParseBytes(pack(t, map[string]string{defaultModelPath: deep})); err == nil {
+		t.Error("components nested past the limit parsed without error")
+	}
+}
@@ -0,0 +1,88 @@
+package geometry
+
+import "math"
+
+// Transform is an affine transform p' = M·p + T. Rigid transforms have an
+// orthonormal M with determinant +1.
+type Transform struct {
+	M [3][3]float64 `json:"rotation"`
+	T Vec3          `json:"translation"`
+}
+
+func Identity() Transform {
+	return Transform{M: [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}}
+}
+
+func (t Transform) Apply(p Vec3) Vec3 {
+	return Vec3{
+		t.M[0][0]*p.X + t.M[0][1]*p.Y + t.M[0][2]*p.Z + t.T.X,
+		t.M[1][0]*p.X + t.M[1][1]*p.Y + t.M[1][2]*p.Z + t.T.Y,
+		t.M[2][0]*p.X + t.M[2][1]*p.Y + t.M[2][2]*p.Z + t.T.Z,
+	}
+}
+
+// Scaling scales uniformly about the origin, e.g. to convert units
+func Scaling(s float64) Transform {
+	return Transform{M: [3][3]float64{{s, 0, 0}, {0, s, 0}, {0, 0, s}}}
+}
+
+// Then returns the transform that applies t first and then next
+func (t Transform) Then(next Transform) Transform {
+	var out Transform
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			for k := 0; k < 3; k++ {
+				out.M[i][j] += next.M[i][k] * t.M[k][j]
+			}
+		}
+	}
+	out.T = next.Apply(t.T)
+	return out
+}
+
+func (t Transform) IsIdentity(eps float64) bool {
+	id := Identity()
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if math.Abs(t.M[i][j]-id.M[i][j]) > eps {
+				return false
+			}
+		}
+	}
+	return t.T.Length() <= eps
+}
+
+// RotationAngle is the rotation angle of M in degrees
+func (t Transform) RotationAngle() float64 {
+	trace := t.M[0][0] + t.M[1][1] + t.M[2][2]
+	c := math.Max(-1, math.Min(1, (trace-1)/2))
+	return math.Acos(c) * 180 / math.Pi
+}
+
+// Transformed returns a copy of the mesh with every vertex transformed.
+// Triangle order is preserved, so face indices still line up.
+func (m *Mesh) Transformed(t Transform) *Mesh {
+	out := &Mesh{
+		Vertices:  make([]Vec3, len(m.Vertices)),
+		Triangles: m.Triangles,
+	}
+	for i, v := range m.Vertices {
+		out.Vertices[i] = t.Apply(v)
+	}
+
+	// A reflection reverses winding; keep normals pointing outward
+	if t.determinant() < 0 {
+		out.Triangles = make([][3]int, len(m.Triangles))
+		for i, tri := range m.Triangles {
+			out.Triangles[i] = [3]int{tri[0], tri[2], tri[1]}
+		}
+	}
+	return out
+}
+
+func (t Transform) determinant() float64 {
+	m := t.M
+	return m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) -
+		m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) +
+		m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+}
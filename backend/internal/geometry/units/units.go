@@ -0,0 +1,146 @@
+// Package units handles the length unit a mesh's coordinates are in. STL
+// and OBJ don't record one, so it comes from settings, and heuristics flag
+// files whose size suggests the wrong unit was assumed.
+package units
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// Unit names match 3MF's unit attribute
+const (
+	Micron     = "micron"
+	Millimeter = "millimeter"
+	Centimeter = "centimeter"
+	Meter      = "meter"
+	Inch       = "inch"
+	Foot       = "foot"
+
+	Default = Millimeter
+)
+
+const (
+	WarningImplausibleSize = "implausible_size"
+	WarningScaleChange     = "scale_change"
+
+	// Parts outside this range in millimeters are probably in another unit
+	minPlausibleMM = 1
+	maxPlausibleMM = 5000
+	// A size ratio this close to a unit conversion factor is a mix-up,
+	// not a redesign
+	ratioTolerance = 0.01
+)
+
+var millimeters = map[string]float64{
+	Micron:     0.001,
+	Millimeter: 1,
+	Centimeter: 10,
+	Meter:      1000,
+	Inch:       25.4,
+	Foot:       304.8,
+}
+
+// Candidates are tried in order of how often they're mixed up with mm
+var candidates = []string{Inch, Millimeter, Meter, Centimeter, Micron, Foot}
+
+func Valid(unit string) bool {
+	_, ok := millimeters[unit]
+	return ok
+}
+
+// Scale is the factor that converts lengths in one unit to another
+func Scale(from, to string) float64 {
+	if from == to || !Valid(from) || !Valid(to) {
+		return 1
+	}
+	return millimeters[from] / millimeters[to]
+}
+
+// ConvertStats expresses mesh statistics in another unit
+func ConvertStats(stats geometry.Stats, from, to string) geometry.Stats {
+	k := Scale(from, to)
+	stats.BoundingBox.Min = stats.BoundingBox.Min.Scale(k)
+	stats.BoundingBox.Max = stats.BoundingBox.Max.Scale(k)
+	stats.SurfaceArea *= k * k
+	stats.Volume *= k * k * k
+	stats.Centroid = stats.Centroid.Scale(k)
+	return stats
+}
+
+// Warning is a heuristic hint that a mesh's unit is wrong. Suggested is the
+// unit that would make it plausible, if one does.
+type Warning struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Suggested string `json:"suggested_unit,omitempty"`
+}
+
+// Check looks for signs a mesh's unit is wrong: a size no real part has in
+// that unit, or a jump from the previous version by a conversion factor.
+// previous may be nil for a file's first version.
+func Check(bounds geometry.BoundingBox, unit string, previous *geometry.BoundingBox, previousUnit string) []Warning {
+	var warnings []Warning
+	if bounds.IsEmpty() {
+		return warnings
+	}
+
+	size := largestExtent(bounds) * Scale(unit, Millimeter)
+	if size > 0 && (size < minPlausibleMM || size > maxPlausibleMM) {
+		w := Warning{
+			Code:    WarningImplausibleSize,
+			Message: fmt.Sprintf("Largest dimension is %.4g mm, which is unusual for a part", size),
+		}
+		for _, u := range candidates {
+			if u == unit {
+				continue
+			}
+			if s := largestExtent(bounds) * Scale(u, Millimeter); s >= minPlausibleMM && s <= maxPlausibleMM {
+				w.Suggested = u
+				w.Message += fmt.Sprintf("; as %s it would be %.4g mm", plural(u), s)
+				break
+			}
+		}
+		warnings = append(warnings, w)
+	}
+
+	if previous != nil && !previous.IsEmpty() {
+		before := largestExtent(*previous) * Scale(previousUnit, Millimeter)
+		if before > 0 && size > 0 {
+			ratio := size / before
+			for _, u := range candidates {
+				if u == unit {
+					continue
+				}
+				// Read in u instead, the part would be the size it was
+				factor := Scale(u, unit)
+				if factor != 1 && math.Abs(ratio*factor-1) <= ratioTolerance {
+					warnings = append(warnings, Warning{
+						Code:      WarningScaleChange,
+						Message:   fmt.Sprintf("Part is %.4gx the size of the previous version, the %s to %s conversion factor", ratio, plural(unit), plural(u)),
+						Suggested: u,
+					})
+					break
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+func largestExtent(b geometry.BoundingBox) float64 {
+	s := b.Size()
+	return math.Max(s.X, math.Max(s.Y, s.Z))
+}
+
+func plural(unit string) string {
+	switch unit {
+	case Foot:
+		return "feet"
+	case Inch:
+		return "inches"
+	}
+	return unit + "s"
+}
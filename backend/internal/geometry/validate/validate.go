@@ -0,0 +1,335 @@
+// Package validate checks meshes for the export defects that break slicers
+// and downstream tools: open or non-manifold edges, inconsistent winding,
+// degenerate faces and self-intersections.
+package validate
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/spatial"
+)
+
+const (
+	CheckDegenerate        = "degenerate_triangles"
+	CheckNonManifold       = "non_manifold_edges"
+	CheckHoles             = "holes"
+	CheckFlippedNormals    = "flipped_normals"
+	CheckSelfIntersections = "self_intersections"
+
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+
+	// Triangle indices listed per finding so the viewer can highlight them
+	maxSamples = 100
+)
+
+type Finding struct {
+	Check     string `json:"check"`
+	Severity  string `json:"severity"`
+	Count     int    `json:"count"`
+	Message   string `json:"message"`
+	Triangles []int  `json:"triangles,omitempty"`
+}
+
+type Report struct {
+	// Passed is false when any finding is an error; warnings don't fail
+	Passed   bool      `json:"passed"`
+	Findings []Finding `json:"findings"`
+}
+
+func (r *Report) Errors() int {
+	n := 0
+	for _, f := range r.Findings {
+		if f.Severity == SeverityError {
+			n++
+		}
+	}
+	return n
+}
+
+type edgeUse struct {
+	triangle int
+	// forward is true when the triangle lists the edge low index first
+	forward bool
+}
+
+// Check runs every validation on the mesh
+func Check(m *geometry.Mesh) *Report {
+	report := &Report{Findings: []Finding{}}
+	add := func(f Finding) {
+		if f.Count > 0 {
+			report.Findings = append(report.Findings, f)
+		}
+	}
+
+	edges := make(map[[2]int][]edgeUse)
+	for i, t := range m.Triangles {
+		for k := 0; k < 3; k++ {
+			a, b := t[k], t[(k+1)%3]
+			if a == b {
+				continue
+			}
+			key := [2]int{min(a, b), max(a, b)}
+			edges[key] = append(edges[key], edgeUse{triangle: i, forward: a < b})
+		}
+	}
+
+	add(degenerate(m))
+	add(nonManifold(edges))
+	add(holes(edges))
+	add(flippedNormals(m, edges))
+	add(selfIntersections(m))
+
+	report.Passed = report.Errors() == 0
+	return report
+}
+
+func degenerate(m *geometry.Mesh) Finding {
+	diag := m.Bounds().Diagonal()
+	minArea := 1e-12 * diag * diag
+
+	f := Finding{Check: CheckDegenerate, Severity: SeverityWarning}
+	for i, t := range m.Triangles {
+		if t[0] == t[1] || t[1] == t[2] || t[0] == t[2] || geometry.TriangleArea(m.Triangle(i)) <= minArea {
+			f.sample(i)
+		}
+	}
+	f.Message = fmt.Sprintf("%s with zero area", plural(f.Count, "triangle"))
+	return f
+}
+
+func nonManifold(edges map[[2]int][]edgeUse) Finding {
+	f := Finding{Check: CheckNonManifold, Severity: SeverityError}
+	for _, uses := range edges {
+		if len(uses) > 2 {
+			f.Count++
+			for _, u := range uses {
+				f.addTriangle(u.triangle)
+			}
+		}
+	}
+	f.Message = fmt.Sprintf("%s shared by more than two triangles", plural(f.Count, "edge"))
+	return f
+}
+
+// holes counts boundary loops: chains of edges used by only one triangle
+func holes(edges map[[2]int][]edgeUse) Finding {
+	f := Finding{Check: CheckHoles, Severity: SeverityError}
+
+	parent := make(map[int]int)
+	var find func(int) int
+	find = func(v int) int {
+		if p, ok := parent[v]; ok && p != v {
+			root := find(p)
+			parent[v] = root
+			return root
+		}
+		parent[v] = v
+		return v
+	}
+
+	openEdges := 0
+	for key, uses := range edges {
+		if len(uses) != 1 {
+			continue
+		}
+		openEdges++
+		f.addTriangle(uses[0].triangle)
+		parent[find(key[0])] = find(key[1])
+	}
+
+	loops := make(map[int]bool)
+	for v := range parent {
+		loops[find(v)] = true
+	}
+	f.Count = len(loops)
+	f.Message = fmt.Sprintf("%s bounded by %s", plural(f.Count, "hole"), plural(openEdges, "open edge"))
+	return f
+}
+
+// flippedNormals propagates winding across manifold edges. Within each
+// connected patch the minority orientation is reported as flipped; a closed
+// mesh that is consistent but encloses negative volume is inside out.
+func flippedNormals(m *geometry.Mesh, edges map[[2]int][]edgeUse) Finding {
+	f := Finding{Check: CheckFlippedNormals, Severity: SeverityError}
+
+	neighbours := make([][]edgeUse, len(m.Triangles))
+	// Two triangles agree on winding when they traverse the shared edge in
+	// opposite directions; same-direction neighbours have opposite parity
+	for _, uses := range edges {
+		if len(uses) != 2 {
+			continue
+		}
+		a, b := uses[0], uses[1]
+		same := a.forward == b.forward
+		neighbours[a.triangle] = append(neighbours[a.triangle], edgeUse{triangle: b.triangle, forward: same})
+		neighbours[b.triangle] = append(neighbours[b.triangle], edgeUse{triangle: a.triangle, forward: same})
+	}
+
+	parity := make([]int, len(m.Triangles))
+	for i := range parity {
+		parity[i] = -1
+	}
+
+	closed := true
+	for _, uses := range edges {
+		if len(uses) != 2 {
+			closed = false
+			break
+		}
+	}
+
+	for start := range m.Triangles {
+		if parity[start] >= 0 {
+			continue
+		}
+
+		parity[start] = 0
+		component := []int{start}
+		for q := 0; q < len(component); q++ {
+			t := component[q]
+			for _, n := range neighbours[t] {
+				if parity[n.triangle] >= 0 {
+					continue
+				}
+				p := parity[t]
+				if n.forward {
+					p = 1 - p
+				}
+				parity[n.triangle] = p
+				component = append(component, n.triangle)
+			}
+		}
+
+		flipped := 0
+		for _, t := range component {
+			flipped += parity[t]
+		}
+		minority := 1
+		if flipped*2 > len(component) {
+			minority = 0
+		}
+		for _, t := range component {
+			if parity[t] == minority {
+				f.sample(t)
+			}
+		}
+	}
+
+	if f.Count > 0 {
+		f.Message = fmt.Sprintf("%s facing the opposite way to their neighbours", plural(f.Count, "triangle"))
+		return f
+	}
+
+	if closed && signedVolume(m) < 0 {
+		for i := range m.Triangles {
+			f.sample(i)
+		}
+		f.Message = "all normals point inward"
+	}
+	return f
+}
+
+// selfIntersections counts pairs of triangles that share no vertex but
+// cross each other. Coplanar overlaps and surfaces that merely touch are not
+// reported.
+func selfIntersections(m *geometry.Mesh) Finding {
+	f := Finding{Check: CheckSelfIntersections, Severity: SeverityError}
+	bvh := spatial.Build(m)
+
+	for i, ti := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		box := geometry.EmptyBox().Extend(a).Extend(b).Extend(c)
+
+		bvh.Query(box, func(j int) {
+			if j <= i || sharesVertex(ti, m.Triangles[j]) {
+				return
+			}
+			d, e, g := m.Triangle(j)
+			if trianglesIntersect(a, b, c, d, e, g) {
+				f.sample(i)
+				f.addTriangle(j)
+			}
+		})
+	}
+
+	f.Message = fmt.Sprintf("%s intersecting", plural(f.Count, "triangle pair"))
+	return f
+}
+
+func signedVolume(m *geometry.Mesh) float64 {
+	v := 0.0
+	for i := range m.Triangles {
+		a, b, c := m.Triangle(i)
+		v += a.Dot(b.Cross(c)) / 6
+	}
+	return v
+}
+
+func sharesVertex(a, b [3]int) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// trianglesIntersect reports whether any edge of either triangle passes
+// through the other
+func trianglesIntersect(a, b, c, d, e, g geometry.Vec3) bool {
+	return segmentHitsTriangle(a, b, d, e, g) || segmentHitsTriangle(b, c, d, e, g) || segmentHitsTriangle(c, a, d, e, g) ||
+		segmentHitsTriangle(d, e, a, b, c) || segmentHitsTriangle(e, g, a, b, c) || segmentHitsTriangle(g, d, a, b, c)
+}
+
+// segmentHitsTriangle is Möller–Trumbore restricted to the segment p→q.
+// Hits on the boundary of either are ignored so touching faces pass.
+func segmentHitsTriangle(p, q, a, b, c geometry.Vec3) bool {
+	const eps = 1e-9
+
+	dir := q.Sub(p)
+	e1 := b.Sub(a)
+	e2 := c.Sub(a)
+	h := dir.Cross(e2)
+	det := e1.Dot(h)
+	if math.Abs(det) < eps*e1.Length()*e2.Length()*dir.Length() {
+		return false // parallel or coplanar
+	}
+
+	inv := 1 / det
+	s := p.Sub(a)
+	u := s.Dot(h) * inv
+	if u <= eps || u >= 1-eps {
+		return false
+	}
+	qv := s.Cross(e1)
+	v := dir.Dot(qv) * inv
+	if v <= eps || u+v >= 1-eps {
+		return false
+	}
+	t := e2.Dot(qv) * inv
+	return t > eps && t < 1-eps
+}
+
+func plural(n int, noun string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, noun)
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
+
+// sample counts a triangle and keeps it as an example
+func (f *Finding) sample(triangle int) {
+	f.Count++
+	f.addTriangle(triangle)
+}
+
+func (f *Finding) addTriangle(triangle int) {
+	if len(f.Triangles) < maxSamples {
+		f.Triangles = append(f.Triangles, triangle)
+	}
+}
@@ -0,0 +1,150 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+)
+
+// box adds an axis-aligned box's triangles facing outward, leaving out the
+// faces listed in skip
+func box(b *geometry.MeshBuilder, min geometry.Vec3, size float64, skip ...int) {
+	corner := func(c [3]float64) geometry.Vec3 {
+		return min.Add(geometry.Vec3{X: c[0] * size, Y: c[1] * size, Z: c[2] * size})
+	}
+	quads := [6][4][3]float64{
+		{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}},
+		{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}},
+		{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}},
+		{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}},
+		{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}},
+		{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}},
+	}
+faces:
+	for i, q := range quads {
+		for _, s := range skip {
+			if s == i {
+				continue faces
+			}
+		}
+		b.AddTriangle(corner(q[0]), corner(q[1]), corner(q[2]))
+		b.AddTriangle(corner(q[0]), corner(q[2]), corner(q[3]))
+	}
+}
+
+func cube() *geometry.Mesh {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10)
+	return b.Mesh()
+}
+
+// finding returns the report's finding for check, or nil
+func finding(r *Report, check string) *Finding {
+	for i := range r.Findings {
+		if r.Findings[i].Check == check {
+			return &r.Findings[i]
+		}
+	}
+	return nil
+}
+
+func TestCheckClean(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10)
+	box(b, geometry.Vec3{X: 20}, 5)
+	r := Check(b.Mesh())
+	if !r.Passed || len(r.Findings) != 0 {
+		t.Errorf("two separate cubes: %+v", r)
+	}
+}
+
+func TestCheckHoles(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10, 1)
+	box(b, geometry.Vec3{X: 20}, 10, 0)
+	r := Check(b.Mesh())
+	f := finding(r, CheckHoles)
+	if r.Passed || f == nil || f.Count != 2 {
+		t.Fatalf("report = %+v", r)
+	}
+	if f.Message != "2 holes bounded by 8 open edges" {
+		t.Errorf("message = %q", f.Message)
+	}
+}
+
+func TestCheckFlipped(t *testing.T) {
+	m := cube()
+	m.Triangles[3][0], m.Triangles[3][1] = m.Triangles[3][1], m.Triangles[3][0]
+	r := Check(m)
+	f := finding(r, CheckFlippedNormals)
+	if r.Passed || f == nil || f.Count != 1 || f.Triangles[0] != 3 {
+		t.Errorf("one flipped triangle: %+v", r)
+	}
+
+	for i := range m.Triangles {
+		m.Triangles[i][0], m.Triangles[i][1] = m.Triangles[i][1], m.Triangles[i][0]
+	}
+	m.Triangles[3][0], m.Triangles[3][1] = m.Triangles[3][1], m.Triangles[3][0]
+	r = Check(m)
+	f = finding(r, CheckFlippedNormals)
+	if f == nil || f.Count != 12 || f.Message != "all normals point inward" {
+		t.Errorf("inside-out cube: %+v", r)
+	}
+}
+
+func TestCheckNonManifold(t *testing.T) {
+	m := cube()
+	// A fin hanging off one of the cube's edges
+	b := geometry.NewMeshBuilder()
+	for i := range m.Triangles {
+		b.AddTriangle(m.Triangle(i))
+	}
+	b.AddTriangle(geometry.Vec3{}, geometry.Vec3{X: 10}, geometry.Vec3{X: 5, Y: -5, Z: -5})
+	r := Check(b.Mesh())
+	if f := finding(r, CheckNonManifold); r.Passed || f == nil || f.Count != 1 || len(f.Triangles) != 3 {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestCheckSelfIntersections(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	box(b, geometry.Vec3{}, 10)
+	box(b, geometry.Vec3{X: 3, Y: 4, Z: 6}, 10)
+	r := Check(b.Mesh())
+	if f := finding(r, CheckSelfIntersections); r.Passed || f == nil || f.Count == 0 {
+		t.Errorf("overlapping cubes: %+v", r)
+	}
+	if finding(r, CheckHoles) != nil || finding(r, CheckNonManifold) != nil {
+		t.Errorf("overlapping closed cubes reported other defects: %+v", r)
+	}
+}
+
+// Degenerate faces only warn, so they don't fail a mesh on their own
+func TestCheckDegenerate(t *testing.T) {
+	m := cube()
+	m.Triangles = append(m.Triangles, [3]int{0, 0, 1})
+	r := Check(m)
+	f := finding(r, CheckDegenerate)
+	if f == nil || f.Count != 1 || f.Severity != SeverityWarning {
+		t.Errorf("report = %+v", r)
+	}
+}
+
+func TestCheckSamplesCapped(t *testing.T) {
+	b := geometry.NewMeshBuilder()
+	for i := range 300 {
+		x := float64(i) * 2
+		b.AddTriangle(geometry.Vec3{X: x}, geometry.Vec3{X: x + 1}, geometry.Vec3{X: x, Y: 1})
+	}
+	r := Check(b.Mesh())
+	f := finding(r, CheckHoles)
+	if f == nil || f.Count != 300 || len(f.Triangles) != maxSamples {
+		t.Errorf("holes = %+v", f)
+	}
+}
+
+func TestCheckEmpty(t *testing.T) {
+	if r := Check(&geometry.Mesh{}); !r.Passed || len(r.Findings) != 0 {
+		t.Errorf("empty mesh: %+v", r)
+	}
+}
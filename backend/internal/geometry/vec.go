@@ -0,0 +1,133 @@
+package geometry
+
+import (
+	"encoding/json"
+	"math"
+)
+
+type Vec3 struct {
+	X, Y, Z float64
+}
+
+func (v Vec3) Add(o Vec3) Vec3 {
+	return Vec3{v.X + o.X, v.Y + o.Y, v.Z + o.Z}
+}
+
+func (v Vec3) Sub(o Vec3) Vec3 {
+	return Vec3{v.X - o.X, v.Y - o.Y, v.Z - o.Z}
+}
+
+func (v Vec3) Scale(s float64) Vec3 {
+	return Vec3{v.X * s, v.Y * s, v.Z * s}
+}
+
+func (v Vec3) Dot(o Vec3) float64 {
+	return v.X*o.X + v.Y*o.Y + v.Z*o.Z
+}
+
+func (v Vec3) Cross(o Vec3) Vec3 {
+	return Vec3{
+		v.Y*o.Z - v.Z*o.Y,
+		v.Z*o.X - v.X*o.Z,
+		v.X*o.Y - v.Y*o.X,
+	}
+}
+
+func (v Vec3) Length() float64 {
+	return math.Sqrt(v.Dot(v))
+}
+
+func (v Vec3) Normalize() Vec3 {
+	l := v.Length()
+	if l == 0 {
+		return v
+	}
+	return v.Scale(1 / l)
+}
+
+func (v Vec3) Min(o Vec3) Vec3 {
+	return Vec3{math.Min(v.X, o.X), math.Min(v.Y, o.Y), math.Min(v.Z, o.Z)}
+}
+
+func (v Vec3) Max(o Vec3) Vec3 {
+	return Vec3{math.Max(v.X, o.X), math.Max(v.Y, o.Y), math.Max(v.Z, o.Z)}
+}
+
+// Axis returns the component for axis 0, 1 or 2
+func (v Vec3) Axis(i int) float64 {
+	switch i {
+	case 0:
+		return v.X
+	case 1:
+		return v.Y
+	default:
+		return v.Z
+	}
+}
+
+func (v Vec3) IsFinite() bool {
+	return !math.IsNaN(v.X) && !math.IsInf(v.X, 0) &&
+		!math.IsNaN(v.Y) && !math.IsInf(v.Y, 0) &&
+		!math.IsNaN(v.Z) && !math.IsInf(v.Z, 0)
+}
+
+// Vectors are sent to clients as compact [x, y, z] arrays
+func (v Vec3) MarshalJSON() ([]byte, error) {
+	return json.Marshal([3]float64{v.X, v.Y, v.Z})
+}
+
+func (v *Vec3) UnmarshalJSON(data []byte) error {
+	var a [3]float64
+	if err := json.Unmarshal(data, &a); err != nil {
+		return err
+	}
+	*v = Vec3{a[0], a[1], a[2]}
+	return nil
+}
+
+type BoundingBox struct {
+	Min Vec3 `json:"min"`
+	Max Vec3 `json:"max"`
+}
+
+// EmptyBox is an inverted box that any Extend call will replace
+func EmptyBox() BoundingBox {
+	inf := math.Inf(1)
+	return BoundingBox{
+		Min: Vec3{inf, inf, inf},
+		Max: Vec3{-inf, -inf, -inf},
+	}
+}
+
+func (b BoundingBox) IsEmpty() bool {
+	return b.Min.X > b.Max.X || b.Min.Y > b.Max.Y || b.Min.Z > b.Max.Z
+}
+
+func (b BoundingBox) Extend(p Vec3) BoundingBox {
+	return BoundingBox{Min: b.Min.Min(p), Max: b.Max.Max(p)}
+}
+
+func (b BoundingBox) Union(o BoundingBox) BoundingBox {
+	return BoundingBox{Min: b.Min.Min(o.Min), Max: b.Max.Max(o.Max)}
+}
+
+func (b BoundingBox) Size() Vec3 {
+	if b.IsEmpty() {
+		return Vec3{}
+	}
+	return b.Max.Sub(b.Min)
+}
+
+func (b BoundingBox) Center() Vec3 {
+	return b.Min.Add(b.Max).Scale(0.5)
+}
+
+func (b BoundingBox) Diagonal() float64 {
+	return b.Size().Length()
+}
+
+func (b BoundingBox) Overlaps(o BoundingBox) bool {
+	return b.Min.X <= o.Max.X && b.Max.X >= o.Min.X &&
+		b.Min.Y <= o.Max.Y && b.Max.Y >= o.Min.Y &&
+		b.Min.Z <= o.Max.Z && b.Max.Z >= o.Min.Z
+}
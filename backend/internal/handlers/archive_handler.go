@@ -0,0 +1,275 @@
+package handlers
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
+	"github.com/rhblitstein/cad-version-control/pkg/utils"
+)
+
+type ArchiveHandler struct {
+	commitRepo *repository.CommitRepository
+	branchRepo *repository.BranchRepository
+	fileRepo   *repository.FileRepository
+	storage    *storage.BlobStore
+}
+
+func NewArchiveHandler(
+	commitRepo *repository.CommitRepository,
+	branchRepo *repository.BranchRepository,
+	fileRepo *repository.FileRepository,
+	storage *storage.BlobStore,
+) *ArchiveHandler {
+	return &ArchiveHandler{
+		commitRepo: commitRepo,
+		branchRepo: branchRepo,
+		fileRepo:   fileRepo,
+		storage:    storage,
+	}
+}
+
+type archiveManifest struct {
+	CommitID    uuid.UUID             `json:"commit_id"`
+	ProjectID   uuid.UUID             `json:"project_id"`
+	Ref         string                `json:"ref,omitempty"`
+	Author      string                `json:"author"`
+	Message     string                `json:"message"`
+	CommittedAt time.Time             `json:"committed_at"`
+	GeneratedAt time.Time             `json:"generated_at"`
+	Files       []archiveManifestFile `json:"files"`
+}
+
+type archiveManifestFile struct {
+	Path          string    `json:"path"`
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+}
+
+// ArchiveCommit streams the full tree of a commit
+func (h *ArchiveHandler) ArchiveCommit(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid commit ID")
+		return
+	}
+
+	commit, err := h.commitRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Commit not found")
+		return
+	}
+
+	h.streamArchive(w, r, commit, "")
+}
+
+// ArchiveRef streams the full tree at the head of a named branch
+func (h *ArchiveHandler) ArchiveRef(w http.ResponseWriter, r *http.Request) {
+	projectIDStr := chi.URLParam(r, "project_id")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	ref := r.URL.Query().Get("ref")
+	if ref == "" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Ref is required")
+		return
+	}
+
+	branch, err := h.branchRepo.GetByName(r.Context(), projectID, ref)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Branch not found")
+		return
+	}
+
+	if branch.HeadCommitID == nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Branch has no commits")
+		return
+	}
+
+	commit, err := h.commitRepo.GetByID(r.Context(), *branch.HeadCommitID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Commit not found")
+		return
+	}
+
+	h.streamArchive(w, r, commit, branch.Name)
+}
+
+func (h *ArchiveHandler) streamArchive(w http.ResponseWriter, r *http.Request, commit *models.Commit, ref string) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "tar.gz" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Format must be zip or tar.gz")
+		return
+	}
+
+	tree, err := h.fileRepo.GetTreeAtCommit(r.Context(), commit.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get commit tree")
+		return
+	}
+
+	root := "commit-" + commit.ID.String()[:8]
+	if ref != "" {
+		root = sanitizeArchivePath(ref) + "-" + commit.ID.String()[:8]
+	}
+
+	manifest := archiveManifest{
+		CommitID:    commit.ID,
+		ProjectID:   commit.ProjectID,
+		Ref:         ref,
+		Author:      commit.Author,
+		Message:     commit.Message,
+		CommittedAt: commit.CreatedAt,
+		GeneratedAt: time.Now().UTC(),
+	}
+	for _, v := range tree {
+		manifest.Files = append(manifest.Files, archiveManifestFile{
+			Path:          sanitizeArchivePath(v.Filename),
+			FileVersionID: v.ID,
+			Size:          v.FileSize,
+			SHA256:        v.Checksum,
+		})
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to build manifest")
+		return
+	}
+
+	// Archives of large trees outlive the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline: %v", err)
+	}
+
+	filename := root + "." + format
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		err = h.writeZip(r.Context(), w, commit.ProjectID, root, manifestJSON, tree)
+	} else {
+		w.Header().Set("Content-Type", "application/gzip")
+		err = h.writeTarGz(r.Context(), w, commit.ProjectID, root, manifestJSON, tree)
+	}
+
+	// Headers are already sent, so all we can do is log and drop the connection
+	if err != nil {
+		log.Printf("Failed to stream archive for commit %s: %v", commit.ID, err)
+	}
+}
+
+func (h *ArchiveHandler) writeZip(ctx context.Context, w io.Writer, projectID uuid.UUID, root string, manifest []byte, tree []models.FileVersion) error {
+	zw := zip.NewWriter(w)
+
+	mw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     root + "/MANIFEST.json",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := mw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, v := range tree {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     root + "/" + sanitizeArchivePath(v.Filename),
+			Method:   zip.Deflate,
+			Modified: v.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.copyObject(ctx, fw, projectID, v); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+func (h *ArchiveHandler) writeTarGz(ctx context.Context, w io.Writer, projectID uuid.UUID, root string, manifest []byte, tree []models.FileVersion) error {
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+
+	err := tw.WriteHeader(&tar.Header{
+		Name:    root + "/MANIFEST.json",
+		Mode:    0644,
+		Size:    int64(len(manifest)),
+		ModTime: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+
+	for _, v := range tree {
+		err := tw.WriteHeader(&tar.Header{
+			Name:    root + "/" + sanitizeArchivePath(v.Filename),
+			Mode:    0644,
+			Size:    v.FileSize,
+			ModTime: v.CreatedAt,
+		})
+		if err != nil {
+			return err
+		}
+		if err := h.copyObject(ctx, tw, projectID, v); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+func (h *ArchiveHandler) copyObject(ctx context.Context, w io.Writer, projectID uuid.UUID, version models.FileVersion) error {
+	object, err := h.storage.Download(ctx, projectID, version.StoragePath)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	if _, err := io.CopyN(w, object, version.FileSize); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", version.Filename, err)
+	}
+	return nil
+}
+
+// sanitizeArchivePath keeps archive entries inside the archive root
+func sanitizeArchivePath(name string) string {
+	cleaned := path.Clean("/" + strings.ReplaceAll(name, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." {
+		return "unnamed"
+	}
+	return cleaned
+}
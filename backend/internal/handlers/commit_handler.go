@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/analysis"
+	"github.com/rhblitstein/cad-version-control/internal/assembly"
+	"github.com/rhblitstein/cad-version-control/internal/bom"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
 	"github.com/rhblitstein/cad-version-control/internal/models"
 	"github.com/rhblitstein/cad-version-control/internal/repository"
 	"github.com/rhblitstein/cad-version-control/internal/storage"
@@ -17,26 +27,70 @@ import (
 )
 
 type CommitHandler struct {
-	commitRepo *repository.CommitRepository
-	branchRepo *repository.BranchRepository
-	fileRepo   *repository.FileRepository
-	storage    *storage.MinioClient
+	commitRepo    *repository.CommitRepository
+	branchRepo    *repository.BranchRepository
+	fileRepo      *repository.FileRepository
+	projectRepo   *repository.ProjectRepository
+	meshRepo      *repository.MeshRepository
+	storage       *storage.BlobStore
+	analyzer      *analysis.Analyzer
+	boms          *analysis.BOMExtractor
+	references    *analysis.ReferenceExtractor
+	background    *analysis.Background
+	presignExpiry time.Duration
+	// maxInspectSize bounds the staged uploads read into memory during the
+	// commit request; larger ones are inspected in the background
+	maxInspectSize int64
 }
 
 func NewCommitHandler(
 	commitRepo *repository.CommitRepository,
 	branchRepo *repository.BranchRepository,
 	fileRepo *repository.FileRepository,
-	storage *storage.MinioClient,
+	projectRepo *repository.ProjectRepository,
+	meshRepo *repository.MeshRepository,
+	storage *storage.BlobStore,
+	analyzer *analysis.Analyzer,
+	boms *analysis.BOMExtractor,
+	references *analysis.ReferenceExtractor,
+	background *analysis.Background,
+	presignExpiry time.Duration,
+	maxInspectSize int64,
 ) *CommitHandler {
 	return &CommitHandler{
-		commitRepo: commitRepo,
-		branchRepo: branchRepo,
-		fileRepo:   fileRepo,
-		storage:    storage,
+		commitRepo:     commitRepo,
+		branchRepo:     branchRepo,
+		fileRepo:       fileRepo,
+		projectRepo:    projectRepo,
+		meshRepo:       meshRepo,
+		storage:        storage,
+		analyzer:       analyzer,
+		boms:           boms,
+		references:     references,
+		background:     background,
+		presignExpiry:  presignExpiry,
+		maxInspectSize: maxInspectSize,
 	}
 }
 
+// pendingFile is a file read and inspected before the commit is created,
+// so a commit blocked by validation leaves nothing behind
+type pendingFile struct {
+	filename string
+	content  []byte
+	size     int64
+	// uploadPath is set for files staged in storage through presigned URLs
+	uploadPath string
+	// deferred uploads are too large to read during the request: content
+	// is nil, checksum is streamed and inspection runs after the commit
+	deferred   bool
+	checksum   string
+	inspection *analysis.Inspection
+	unit       string
+	// unitWarnings flag a mesh whose size suggests the wrong unit
+	unitWarnings []units.Warning
+}
+
 func (h *CommitHandler) Create(w http.ResponseWriter, r *http.Request) {
 	projectIDStr := chi.URLParam(r, "project_id")
 	projectID, err := uuid.Parse(projectIDStr)
@@ -71,86 +125,247 @@ func (h *CommitHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	commit := &models.Commit{
-		ProjectID:      projectID,
-		BranchID:       branchID,
-		ParentCommitID: branch.HeadCommitID,
-		Author:         author,
-		Message:        message,
-	}
-
-	if err := h.commitRepo.Create(r.Context(), commit); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create commit")
+	project, err := h.projectRepo.GetByID(r.Context(), projectID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Project not found")
 		return
 	}
 
-	files := r.MultipartForm.File["files"]
-	var fileVersions []models.FileVersion
+	var pending []*pendingFile
 
-	for _, fileHeader := range files {
+	for _, fileHeader := range r.MultipartForm.File["files"] {
 		file, err := fileHeader.Open()
 		if err != nil {
 			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
 			return
 		}
-		defer file.Close()
 
 		content, err := io.ReadAll(file)
+		file.Close()
 		if err != nil {
 			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read file content")
 			return
 		}
 
-		hash := sha256.Sum256(content)
-		checksum := hex.EncodeToString(hash[:])
+		pending = append(pending, &pendingFile{
+			filename: fileHeader.Filename,
+			content:  content,
+			size:     fileHeader.Size,
+		})
+	}
+
+	// Files uploaded directly to storage through presigned URLs
+	var uploads []struct {
+		UploadID uuid.UUID `json:"upload_id"`
+		Filename string    `json:"filename"`
+	}
+	if raw := r.FormValue("uploads"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &uploads); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid uploads")
+			return
+		}
+	}
+
+	for _, upload := range uploads {
+		if upload.Filename == "" {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Upload filename is required")
+			return
+		}
+
+		uploadPath := stagedUploadPath(projectID, upload.UploadID)
+		info, err := h.storage.Stat(r.Context(), uploadPath)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Upload not found")
+			return
+		}
+
+		pf := &pendingFile{
+			filename:   upload.Filename,
+			size:       info.Size,
+			uploadPath: uploadPath,
+		}
+		if info.Size > h.maxInspectSize {
+			pf.deferred = true
+			pf.checksum, err = h.checksumUpload(r.Context(), uploadPath)
+		} else {
+			pf.content, err = h.readUpload(r.Context(), uploadPath)
+		}
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read upload")
+			return
+		}
+		pending = append(pending, pf)
+	}
+
+	// Per-file units for formats that don't record one, keyed by filename
+	explicitUnits := make(map[string]string)
+	if raw := r.FormValue("units"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &explicitUnits); err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid units")
+			return
+		}
+		for filename, unit := range explicitUnits {
+			if !units.Valid(unit) {
+				utils.ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("Invalid unit %q for %s", unit, filename))
+				return
+			}
+		}
+	}
 
-		existingFile, err := h.fileRepo.GetByFilename(r.Context(), projectID, fileHeader.Filename)
+	// The branch's current versions, for carrying units forward and
+	// spotting unit mix-ups between versions
+	previousVersions := make(map[string]*models.FileVersion)
+	if branch.HeadCommitID != nil {
+		tree, err := h.fileRepo.GetTreeAtCommit(r.Context(), *branch.HeadCommitID)
 		if err != nil {
-			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to check file")
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get tree")
 			return
 		}
+		for i := range tree {
+			previousVersions[tree[i].Filename] = &tree[i]
+		}
+	}
 
-		var fileID uuid.UUID
-		if existingFile == nil {
-			newFile := &models.File{
-				ProjectID: projectID,
-				Filename:  fileHeader.Filename,
+	// Parse and validate meshes up front so a blocking project can reject
+	// the commit before anything is written
+	validation := project.ValidationMode != models.ValidationOff
+	var rejected []map[string]interface{}
+	for _, pf := range pending {
+		if pf.deferred && project.ValidationMode == models.ValidationBlock && analysis.IsMesh(pf.filename) {
+			// Validation has to pass before the commit, and a deferred mesh
+			// is only validated after it
+			rejected = append(rejected, map[string]interface{}{
+				"filename": pf.filename,
+				"error":    fmt.Sprintf("too large to validate before committing (over %d bytes)", h.maxInspectSize),
+			})
+			continue
+		}
+		if pf.deferred {
+			// The mesh isn't parsed yet, so its unit can't be checked or
+			// read from the file
+			switch prev := previousVersions[pf.filename]; {
+			case !analysis.IsMesh(pf.filename):
+			case explicitUnits[pf.filename] != "":
+				pf.unit = explicitUnits[pf.filename]
+			case prev != nil && prev.Unit != "":
+				pf.unit = prev.Unit
+			default:
+				pf.unit = project.DefaultUnit
+			}
+			continue
+		}
+		pf.inspection, err = analysis.Inspect(pf.filename, pf.content, validation)
+		if err != nil {
+			log.Printf("Failed to inspect %s: %v", pf.filename, err)
+			// A mesh that can't be parsed can't pass validation either
+			if project.ValidationMode == models.ValidationBlock && analysis.IsMesh(pf.filename) {
+				rejected = append(rejected, map[string]interface{}{
+					"filename": pf.filename,
+					"error":    err.Error(),
+				})
 			}
-			if err := h.fileRepo.Create(r.Context(), newFile); err != nil {
-				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create file")
+			continue
+		}
+		if pf.inspection != nil && pf.inspection.Mesh != nil {
+			if err := h.resolveUnit(r.Context(), pf, explicitUnits[pf.filename], previousVersions[pf.filename], project); err != nil {
+				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to check units")
 				return
 			}
-			fileID = newFile.ID
-		} else {
-			fileID = existingFile.ID
+		}
+		if pf.inspection != nil && pf.inspection.Validation != nil && !pf.inspection.Validation.Passed {
+			rejected = append(rejected, map[string]interface{}{
+				"filename":   pf.filename,
+				"validation": pf.inspection.Validation,
+			})
+		}
+	}
+
+	if project.ValidationMode == models.ValidationBlock && len(rejected) > 0 {
+		utils.JSONResponse(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": "Mesh validation failed",
+			"files": rejected,
+		})
+		return
+	}
+
+	commit := &models.Commit{
+		ProjectID:      projectID,
+		BranchID:       branchID,
+		ParentCommitID: branch.HeadCommitID,
+		Author:         author,
+		Message:        message,
+	}
+
+	if err := h.commitRepo.Create(r.Context(), commit); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create commit")
+		return
+	}
+
+	var fileVersions []models.FileVersion
+	var deferred []models.FileVersion
+
+	for _, pf := range pending {
+		checksum := pf.checksum
+		if !pf.deferred {
+			hash := sha256.Sum256(pf.content)
+			checksum = hex.EncodeToString(hash[:])
+		}
+
+		fileID, err := h.getOrCreateFile(r.Context(), projectID, pf.filename)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create file")
+			return
 		}
 
-		existingVersion, err := h.fileRepo.ChecksumExists(r.Context(), checksum)
+		existingVersion, err := h.fileRepo.ChecksumExists(r.Context(), projectID, checksum)
 		if err != nil {
 			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to check checksum")
 			return
 		}
 
-		var storagePath string
-		if existingVersion != nil {
+		storagePath := fmt.Sprintf("projects/%s/commits/%s/%s", projectID, commit.ID, fileID)
+		switch {
+		case existingVersion != nil:
 			storagePath = existingVersion.StoragePath
-		} else {
-			storagePath = fmt.Sprintf("projects/%s/commits/%s/%s", projectID, commit.ID, fileID)
-
-			file.Seek(0, 0)
+			if pf.uploadPath != "" {
+				h.storage.Delete(r.Context(), pf.uploadPath)
+			}
 
-			if err := h.storage.Upload(r.Context(), storagePath, file, fileHeader.Size, "application/octet-stream"); err != nil {
+		case pf.uploadPath == "":
+			if err := h.storage.Upload(r.Context(), projectID, storagePath, bytes.NewReader(pf.content), pf.size, "application/octet-stream"); err != nil {
 				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to upload file")
 				return
 			}
+
+		case h.storage.Encrypted():
+			// Presigned uploads land as plaintext; seal them before committing
+			if err := h.encryptUpload(r.Context(), projectID, pf.uploadPath, storagePath, pf.size); err != nil {
+				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store upload")
+				return
+			}
+
+		default:
+			// Staged uploads expire, so the object moves out of staging
+			if err := h.storage.Copy(r.Context(), pf.uploadPath, storagePath); err != nil {
+				utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store upload")
+				return
+			}
+			if err := h.storage.Delete(r.Context(), pf.uploadPath); err != nil {
+				log.Printf("Failed to delete staged upload %s: %v", pf.uploadPath, err)
+			}
 		}
 
 		version := &models.FileVersion{
-			FileID:      fileID,
-			CommitID:    commit.ID,
-			StoragePath: storagePath,
-			FileSize:    fileHeader.Size,
-			Checksum:    checksum,
+			FileID:       fileID,
+			CommitID:     commit.ID,
+			StoragePath:  storagePath,
+			FileSize:     pf.size,
+			Checksum:     checksum,
+			GeometryHash: pf.inspection.GeometryHash(),
+			Unit:         pf.unit,
+		}
+		if pf.deferred {
+			version.InspectionStatus = models.InspectionPending
 		}
 
 		if err := h.fileRepo.CreateVersion(r.Context(), version); err != nil {
@@ -158,8 +373,15 @@ func (h *CommitHandler) Create(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		version.Filename = fileHeader.Filename
+		version.Filename = pf.filename
+		version.UnitWarnings = pf.unitWarnings
+		if err := h.analyzer.Store(r.Context(), projectID, version, pf.inspection); err != nil {
+			log.Printf("Failed to analyze %s: %v", version.Filename, err)
+		}
 		fileVersions = append(fileVersions, *version)
+		if pf.deferred {
+			deferred = append(deferred, *version)
+		}
 	}
 
 	if err := h.branchRepo.UpdateHead(r.Context(), branchID, commit.ID); err != nil {
@@ -167,11 +389,98 @@ func (h *CommitHandler) Create(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Previews are only worth making once the commit is reachable, and
+	// they'd otherwise hold the request past the write timeout
+	for i, pf := range pending {
+		h.analyzer.QueuePreviews(projectID, fileVersions[i], pf.inspection, project.LODTriangleBudget)
+	}
+	h.analyzeLater(projectID, commit.ID, deferred, validation, project.LODTriangleBudget)
+
+	// Flag the assemblies each committed part is used in, so a change to a
+	// part is seen against everything that includes it. This commit's own
+	// graph is extracted in the background, so the parent's is used.
+	if commit.ParentCommitID != nil {
+		refs, err := h.references.Stored(r.Context(), *commit.ParentCommitID)
+		if err != nil {
+			log.Printf("Failed to get references for commit %s: %v", *commit.ParentCommitID, err)
+		} else if refs != nil {
+			for i := range fileVersions {
+				fileVersions[i].UsedBy = refs.WhereUsed(fileVersions[i].Filename, true)
+			}
+		}
+	}
+
 	commit.FileVersions = fileVersions
 
 	utils.JSONResponse(w, http.StatusCreated, commit)
 }
 
+// resolveUnit picks a committed mesh's unit: the one given with the commit,
+// then the one the format declares (3MF), then the previous version's, then
+// the project default. It then checks the mesh's size against that unit and
+// against the previous version, which is nil for a new file.
+func (h *CommitHandler) resolveUnit(ctx context.Context, pf *pendingFile, explicit string, previous *models.FileVersion, project *models.Project) error {
+	switch {
+	case explicit != "":
+		pf.unit = explicit
+	case pf.inspection.Package != nil && units.Valid(pf.inspection.Package.Unit):
+		pf.unit = pf.inspection.Package.Unit
+	case previous != nil && previous.Unit != "":
+		pf.unit = previous.Unit
+	default:
+		pf.unit = project.DefaultUnit
+	}
+
+	var previousBounds *geometry.BoundingBox
+	var previousUnit string
+	if previous != nil {
+		stats, err := h.meshRepo.GetStatsByVersion(ctx, previous.ID)
+		if err != nil {
+			return err
+		}
+		if stats != nil {
+			previousBounds = &stats.BoundingBox
+			previousUnit = analysis.VersionUnit(previous)
+		}
+	}
+
+	pf.unitWarnings = units.Check(pf.inspection.Mesh.Bounds(), pf.unit, previousBounds, previousUnit)
+	return nil
+}
+
+// CreateUpload hands out a presigned PUT URL so large files can be sent
+// straight to storage. The returned upload_id is referenced from the
+// "uploads" field when creating the commit.
+func (h *CommitHandler) CreateUpload(w http.ResponseWriter, r *http.Request) {
+	projectIDStr := chi.URLParam(r, "project_id")
+	projectID, err := uuid.Parse(projectIDStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	if _, err := h.projectRepo.GetByID(r.Context(), projectID); err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	uploadID := uuid.New()
+	url, err := h.storage.PresignedUploadURL(r.Context(), stagedUploadPath(projectID, uploadID), h.presignExpiry)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create upload URL")
+		return
+	}
+
+	h.recordAccess(r, projectID, nil, "upload", "presigned")
+
+	utils.JSONResponse(w, http.StatusCreated, map[string]interface{}{
+		"upload_id":  uploadID,
+		"url":        url.String(),
+		"method":     http.MethodPut,
+		"expires_at": time.Now().Add(h.presignExpiry),
+	})
+}
+
 func (h *CommitHandler) Get(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
@@ -192,11 +501,167 @@ func (h *CommitHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	meshStats, err := h.meshRepo.GetStatsByCommit(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh stats")
+		return
+	}
+
+	versionIDs := make([]uuid.UUID, len(fileVersions))
+	for i := range fileVersions {
+		versionIDs[i] = fileVersions[i].ID
+	}
+	validations, err := h.meshRepo.GetValidationsByVersions(r.Context(), versionIDs)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh validations")
+		return
+	}
+
+	for i := range fileVersions {
+		fileVersions[i].MeshStats = meshStats[fileVersions[i].ID]
+		fileVersions[i].Validation = validations[fileVersions[i].ID]
+	}
+
 	commit.FileVersions = fileVersions
 
 	utils.JSONResponse(w, http.StatusOK, commit)
 }
 
+// GetBOM returns the bill of materials derived from the commit's tree
+func (h *CommitHandler) GetBOM(w http.ResponseWriter, r *http.Request) {
+	commit, ok := h.commitFromRequest(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	commitBOM, err := h.boms.Get(r.Context(), commit.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get BOM")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, commitBOM)
+}
+
+// GetBOMDiff compares the commit's BOM with the BOM of the commit given by
+// ?against=: parts added or removed and quantity changes
+func (h *CommitHandler) GetBOMDiff(w http.ResponseWriter, r *http.Request) {
+	commit, ok := h.commitFromRequest(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+	other, ok := h.commitFromRequest(w, r, r.URL.Query().Get("against"))
+	if !ok {
+		return
+	}
+
+	to, err := h.boms.Get(r.Context(), commit.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get BOM")
+		return
+	}
+	from, err := h.boms.Get(r.Context(), other.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get BOM")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, bom.Compare(&from.BOM, &to.BOM))
+}
+
+// GetReferences returns the graph of file references in the commit's tree:
+// which assemblies reference which parts, and how many of each
+func (h *CommitHandler) GetReferences(w http.ResponseWriter, r *http.Request) {
+	commit, ok := h.commitFromRequest(w, r, chi.URLParam(r, "id"))
+	if !ok {
+		return
+	}
+
+	refs, err := h.references.Get(r.Context(), commit.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get references")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, refs)
+}
+
+// GetDependsOn lists the files a version references, through nested
+// assemblies down to the parts unless ?direct=true
+func (h *CommitHandler) GetDependsOn(w http.ResponseWriter, r *http.Request) {
+	h.referenceQuery(w, r, "depends_on", (*models.CommitReferences).DependsOn)
+}
+
+// GetWhereUsed lists the assemblies a version is used in, through nested
+// assemblies up to the top level unless ?direct=true
+func (h *CommitHandler) GetWhereUsed(w http.ResponseWriter, r *http.Request) {
+	h.referenceQuery(w, r, "where_used", (*models.CommitReferences).WhereUsed)
+}
+
+// referenceQuery answers a graph query about a version's file in the tree
+// of the version's commit, or of the commit given by ?commit=, e.g. a
+// branch head
+func (h *CommitHandler) referenceQuery(w http.ResponseWriter, r *http.Request, key string, query func(*models.CommitReferences, string, bool) []assembly.Usage) {
+	versionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid version ID")
+		return
+	}
+	version, err := h.fileRepo.GetVersionByID(r.Context(), versionID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version not found")
+		return
+	}
+
+	commitID := version.CommitID
+	if commitIDStr := r.URL.Query().Get("commit"); commitIDStr != "" {
+		commit, ok := h.commitFromRequest(w, r, commitIDStr)
+		if !ok {
+			return
+		}
+		file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusNotFound, "File not found")
+			return
+		}
+		if commit.ProjectID != file.ProjectID {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Commit is in a different project")
+			return
+		}
+		commitID = commit.ID
+	}
+
+	refs, err := h.references.Get(r.Context(), commitID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get references")
+		return
+	}
+
+	recursive := r.URL.Query().Get("direct") != "true"
+	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
+		"file":      version.Filename,
+		"commit_id": commitID,
+		key:         query(refs, version.Filename, recursive),
+	})
+}
+
+// commitFromRequest looks up a commit by ID, writing an error response on
+// failure
+func (h *CommitHandler) commitFromRequest(w http.ResponseWriter, r *http.Request, idStr string) (*models.Commit, bool) {
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid commit ID")
+		return nil, false
+	}
+
+	commit, err := h.commitRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Commit not found")
+		return nil, false
+	}
+	return commit, true
+}
+
 func (h *CommitHandler) ListByBranch(w http.ResponseWriter, r *http.Request) {
 	branchIDStr := chi.URLParam(r, "branch_id")
 	branchID, err := uuid.Parse(branchIDStr)
@@ -242,18 +707,247 @@ func (h *CommitHandler) DownloadFile(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	object, err := h.storage.Download(r.Context(), version.StoragePath)
+	file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
 	if err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to download file")
+		utils.ErrorResponse(w, http.StatusNotFound, "File not found")
+		return
+	}
+
+	// Encrypted blobs can only be decrypted here, so storage can't serve
+	// them directly
+	if r.URL.Query().Get("presigned") == "true" && h.storage.Encrypted() {
+		utils.ErrorResponse(w, http.StatusConflict, "Presigned downloads are unavailable with encryption at rest; download without presigned=true")
+		return
+	}
+	if r.URL.Query().Get("presigned") == "true" {
+		url, err := h.storage.PresignedDownloadURL(r.Context(), version.StoragePath, version.Filename, h.presignExpiry)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create download URL")
+			return
+		}
+
+		h.recordAccess(r, file.ProjectID, &version.ID, "download", "presigned")
+
+		utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
+			"url":        url.String(),
+			"method":     http.MethodGet,
+			"expires_at": time.Now().Add(h.presignExpiry),
+		})
+		return
+	}
+
+	// File versions are immutable, so the content checksum is a strong validator
+	etag := `"` + version.Checksum + `"`
+	lastModified := version.CreatedAt.UTC().Format(http.TimeFormat)
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", lastModified)
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("Accept-Ranges", "bytes")
+
+	if utils.ETagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	byteRange, err := utils.ParseRange(r.Header.Get("Range"), version.FileSize)
+	if ifRange := r.Header.Get("If-Range"); ifRange != "" && ifRange != etag && ifRange != lastModified {
+		// Validator is stale, fall back to the full object
+		byteRange, err = nil, nil
+	}
+	if err == utils.ErrRangeNotSatisfiable {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", version.FileSize))
+		utils.ErrorResponse(w, http.StatusRequestedRangeNotSatisfiable, "Requested range not satisfiable")
 		return
 	}
-	defer object.Close()
 
 	w.Header().Set("Content-Type", "application/octet-stream")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", version.Filename))
-	w.Header().Set("Content-Length", fmt.Sprintf("%d", version.FileSize))
 
-	if _, err := io.Copy(w, object); err != nil {
+	status := http.StatusOK
+	length := version.FileSize
+	if byteRange != nil {
+		status = http.StatusPartialContent
+		length = byteRange.Length()
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", byteRange.Start, byteRange.End, version.FileSize))
+	}
+	w.Header().Set("Content-Length", fmt.Sprintf("%d", length))
+
+	if r.Method == http.MethodHead {
+		w.WriteHeader(status)
+		return
+	}
+
+	var object io.ReadCloser
+	if byteRange != nil {
+		object, err = h.storage.DownloadRange(r.Context(), file.ProjectID, version.StoragePath, byteRange.Start, byteRange.End)
+	} else {
+		object, err = h.storage.Download(r.Context(), file.ProjectID, version.StoragePath)
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to download file")
 		return
 	}
+	defer object.Close()
+
+	h.recordAccess(r, file.ProjectID, &version.ID, "download", "proxy")
+
+	// Large files outlive the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		log.Printf("Failed to clear write deadline: %v", err)
+	}
+
+	w.WriteHeader(status)
+	if _, err := io.CopyN(w, object, length); err != nil {
+		return
+	}
+}
+
+func (h *CommitHandler) getOrCreateFile(ctx context.Context, projectID uuid.UUID, filename string) (uuid.UUID, error) {
+	existingFile, err := h.fileRepo.GetByFilename(ctx, projectID, filename)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if existingFile != nil {
+		return existingFile.ID, nil
+	}
+
+	newFile := &models.File{
+		ProjectID: projectID,
+		Filename:  filename,
+	}
+	if err := h.fileRepo.Create(ctx, newFile); err != nil {
+		return uuid.Nil, err
+	}
+	return newFile.ID, nil
+}
+
+// checksumUpload hashes a staged upload as it streams past, without
+// holding it in memory
+func (h *CommitHandler) checksumUpload(ctx context.Context, uploadPath string) (string, error) {
+	object, err := h.storage.DownloadRaw(ctx, uploadPath)
+	if err != nil {
+		return "", err
+	}
+	defer object.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, object); err != nil {
+		return "", fmt.Errorf("failed to read object: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// analyzeLater inspects the versions committed without inspection, then
+// derives the commit's BOM and references, once the commit request is done.
+// Both cover the whole tree, so they wait for the inspections to store the
+// metadata they read; GetBOM and GetReferences extract them on request if
+// the job is dropped or fails.
+func (h *CommitHandler) analyzeLater(projectID, commitID uuid.UUID, deferred []models.FileVersion, validation bool, budget int) {
+	h.background.Submit("analyze commit "+commitID.String(), func(ctx context.Context) error {
+		for _, version := range deferred {
+			if err := h.inspect(ctx, projectID, version, validation, budget); err != nil {
+				log.Printf("Failed to inspect %s: %v", version.Filename, err)
+			}
+		}
+		if _, err := h.boms.Extract(ctx, commitID); err != nil {
+			return fmt.Errorf("failed to extract BOM: %w", err)
+		}
+		if _, err := h.references.Extract(ctx, commitID); err != nil {
+			return fmt.Errorf("failed to extract references: %w", err)
+		}
+		return nil
+	})
+}
+
+// inspect analyzes a version committed without inspection. Validation then
+// reports findings rather than blocking the commit. The version stays
+// pending until this has run, then is inspected, or failed if anything
+// went wrong.
+func (h *CommitHandler) inspect(ctx context.Context, projectID uuid.UUID, version models.FileVersion, validation bool, budget int) (err error) {
+	// Deferred so a panicking parser fails only this version
+	status := models.InspectionFailed
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("inspection panicked: %v", r)
+		}
+		if serr := h.fileRepo.SetInspectionStatus(context.WithoutCancel(ctx), version.ID, status); serr != nil && err == nil {
+			err = serr
+		}
+	}()
+
+	content, err := h.readObject(ctx, projectID, version.StoragePath)
+	if err != nil {
+		return err
+	}
+	inspection, err := analysis.Inspect(version.Filename, content, validation)
+	if err != nil {
+		return err
+	}
+	if hash := inspection.GeometryHash(); hash != "" {
+		if err := h.fileRepo.SetGeometryHash(ctx, version.ID, hash); err != nil {
+			return err
+		}
+	}
+	if err := h.analyzer.Store(ctx, projectID, &version, inspection); err != nil {
+		return err
+	}
+	status = models.InspectionInspected
+	h.analyzer.QueuePreviews(projectID, version, inspection, budget)
+	return nil
+}
+
+func (h *CommitHandler) readObject(ctx context.Context, projectID uuid.UUID, objectName string) ([]byte, error) {
+	object, err := h.storage.Download(ctx, projectID, objectName)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+// readUpload reads a staged upload as sent. Uploads are untrusted
+// plaintext, so they're never decrypted, even if they look encrypted.
+func (h *CommitHandler) readUpload(ctx context.Context, uploadPath string) ([]byte, error) {
+	object, err := h.storage.DownloadRaw(ctx, uploadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+
+	return io.ReadAll(object)
+}
+
+func (h *CommitHandler) encryptUpload(ctx context.Context, projectID uuid.UUID, uploadPath, storagePath string, size int64) error {
+	object, err := h.storage.DownloadRaw(ctx, uploadPath)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	if err := h.storage.Upload(ctx, projectID, storagePath, object, size, "application/octet-stream"); err != nil {
+		return err
+	}
+	return h.storage.Delete(ctx, uploadPath)
+}
+
+// recordAccess logs a transfer. Failures are logged rather than surfaced so
+// an audit hiccup never blocks a download.
+func (h *CommitHandler) recordAccess(r *http.Request, projectID uuid.UUID, versionID *uuid.UUID, action, method string) {
+	access := &models.FileAccess{
+		ProjectID:     projectID,
+		FileVersionID: versionID,
+		Action:        action,
+		Method:        method,
+		RemoteAddr:    r.RemoteAddr,
+		UserAgent:     r.UserAgent(),
+	}
+	if err := h.fileRepo.RecordAccess(r.Context(), access); err != nil {
+		log.Printf("Failed to record file access: %v", err)
+	}
+}
+
+func stagedUploadPath(projectID, uploadID uuid.UUID) string {
+	return fmt.Sprintf("%s%s/%s", storage.StagedUploadsPrefix, projectID, uploadID)
 }
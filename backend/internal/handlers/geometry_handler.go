@@ -0,0 +1,1309 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/analysis"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/align"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/deviation"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gerber"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/render"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/section"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/stl"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/validate"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+	"github.com/rhblitstein/cad-version-control/internal/repository"
+	"github.com/rhblitstein/cad-version-control/pkg/utils"
+)
+
+// Derived geometry is keyed by immutable version IDs, so it only expires
+// to bound cache size
+const geometryCacheTTL = 7 * 24 * time.Hour
+
+type GeometryHandler struct {
+	fileRepo   *repository.FileRepository
+	meshRepo   *repository.MeshRepository
+	stepRepo   *repository.StepRepository
+	dxfRepo    *repository.DXFRepository
+	gerberRepo *repository.GerberRepository
+	kicadRepo  *repository.KiCadRepository
+	loader     *analysis.MeshLoader
+	analyzer   *analysis.Analyzer
+	thumbnails *analysis.Thumbnailer
+	gltf       *analysis.GLTFConverter
+	lods       *analysis.LODGenerator
+	projects   *repository.ProjectRepository
+	cache      *repository.RedisClient
+}
+
+func NewGeometryHandler(
+	fileRepo *repository.FileRepository,
+	meshRepo *repository.MeshRepository,
+	stepRepo *repository.StepRepository,
+	dxfRepo *repository.DXFRepository,
+	gerberRepo *repository.GerberRepository,
+	kicadRepo *repository.KiCadRepository,
+	loader *analysis.MeshLoader,
+	analyzer *analysis.Analyzer,
+	thumbnails *analysis.Thumbnailer,
+	gltf *analysis.GLTFConverter,
+	lods *analysis.LODGenerator,
+	projects *repository.ProjectRepository,
+	cache *repository.RedisClient,
+) *GeometryHandler {
+	return &GeometryHandler{
+		fileRepo:   fileRepo,
+		meshRepo:   meshRepo,
+		stepRepo:   stepRepo,
+		dxfRepo:    dxfRepo,
+		gerberRepo: gerberRepo,
+		kicadRepo:  kicadRepo,
+		loader:     loader,
+		analyzer:   analyzer,
+		thumbnails: thumbnails,
+		gltf:       gltf,
+		lods:       lods,
+		projects:   projects,
+		cache:      cache,
+	}
+}
+
+func (h *GeometryHandler) GetStats(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.meshRepo.GetStatsByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh stats")
+		return
+	}
+
+	if stats == nil && !analysis.IsMesh(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+		return
+	}
+
+	// Versions committed before analysis existed are analyzed on first request
+	if stats == nil {
+		content, err := h.loader.Read(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
+			return
+		}
+		file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get file")
+			return
+		}
+		if err := h.analyzer.Analyze(r.Context(), file.ProjectID, version, content); err != nil {
+			// Stats are attached before thumbnails render, so only a parse
+			// failure leaves them missing
+			if version.MeshStats == nil {
+				utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse mesh")
+				return
+			}
+			log.Printf("Failed to analyze %s: %v", version.Filename, err)
+		}
+		stats = version.MeshStats
+	}
+
+	// Stats are in the version's own unit; the millimeter copy lets
+	// versions exported in different units be compared directly
+	unit := analysis.VersionUnit(version)
+	utils.JSONResponse(w, http.StatusOK, struct {
+		*models.MeshStats
+		Unit        string         `json:"unit"`
+		Millimeters geometry.Stats `json:"millimeters"`
+	}{stats, unit, units.ConvertStats(stats.Stats, unit, units.Millimeter)})
+}
+
+// GetValidation returns the mesh validation findings for a version,
+// validating on first request if it predates validation or was committed
+// with validation switched off
+func (h *GeometryHandler) GetValidation(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	validation, err := h.meshRepo.GetValidationByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh validation")
+		return
+	}
+
+	if validation == nil {
+		if !analysis.IsMesh(version.Filename) {
+			utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+			return
+		}
+
+		mesh, err := h.loader.Load(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+			return
+		}
+
+		validation = &models.MeshValidation{
+			FileVersionID: version.ID,
+			Report:        *validate.Check(mesh),
+		}
+		if err := h.meshRepo.CreateValidation(r.Context(), validation); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store mesh validation")
+			return
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, validation)
+}
+
+// GetObjects returns the unit, metadata and per-object summary of a package
+// format such as 3MF, parsing it on first request for older versions
+func (h *GeometryHandler) GetObjects(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	pkg, err := h.meshRepo.GetPackageByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get model package")
+		return
+	}
+
+	if pkg == nil {
+		if !analysis.IsPackage(version.Filename) {
+			utils.ErrorResponse(w, http.StatusNotFound, "File version is not a multi-object package")
+			return
+		}
+
+		parsed, err := h.loader.LoadPackage(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load package")
+			return
+		}
+
+		pkg = analysis.NewModelPackage(version.ID, parsed)
+		if err := h.meshRepo.CreatePackage(r.Context(), pkg); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store model package")
+			return
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, pkg)
+}
+
+// GetStep returns the STEP header, products, assembly structure and entity
+// counts, parsing on first request for versions committed before extraction
+func (h *GeometryHandler) GetStep(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.stepRepo.GetByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get STEP metadata")
+		return
+	}
+
+	if metadata == nil {
+		if !step.IsSTEP(version.Filename) {
+			utils.ErrorResponse(w, http.StatusNotFound, "File version is not a STEP file")
+			return
+		}
+
+		parsed, err := h.loader.LoadStep(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse STEP file")
+			return
+		}
+
+		metadata = &models.StepMetadata{FileVersionID: version.ID, File: *parsed}
+		if err := h.stepRepo.Create(r.Context(), metadata); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store STEP metadata")
+			return
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, metadata)
+}
+
+// GetDXF returns a drawing's header, layers with entity counts, entity
+// counts by type and extents, parsing on first request for versions
+// committed before extraction
+func (h *GeometryHandler) GetDXF(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.dxfRepo.GetByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get DXF metadata")
+		return
+	}
+
+	if metadata == nil {
+		if !dxf.IsDXF(version.Filename) {
+			utils.ErrorResponse(w, http.StatusNotFound, "File version is not a DXF file")
+			return
+		}
+
+		parsed, err := h.loader.LoadDXF(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse DXF file")
+			return
+		}
+
+		metadata = &models.DXFMetadata{FileVersionID: version.ID, File: *parsed}
+		if err := h.dxfRepo.Create(r.Context(), metadata); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store DXF metadata")
+			return
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, metadata)
+}
+
+// GetDXFEntities lists a drawing's entities in file order, optionally only
+// those on ?layer= or of ?type=
+func (h *GeometryHandler) GetDXFEntities(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	drawing, ok := h.loadDXF(w, r, version)
+	if !ok {
+		return
+	}
+
+	layer := r.URL.Query().Get("layer")
+	entityType := r.URL.Query().Get("type")
+	entities := []dxf.Entity{}
+	for _, e := range drawing.Entities {
+		if (layer == "" || e.Layer == layer) && (entityType == "" || strings.EqualFold(e.Type, entityType)) {
+			entities = append(entities, e)
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
+		"version_id": version.ID,
+		"count":      len(entities),
+		"entities":   entities,
+	})
+}
+
+// GetDXFPreview draws the drawing's model space as SVG
+func (h *GeometryHandler) GetDXFPreview(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	drawing, ok := h.loadDXF(w, r, version)
+	if !ok {
+		return
+	}
+
+	svg := drawing.SVG()
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(svg)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(svg)
+}
+
+// loadDXF parses a DXF version, writing an error response on failure
+func (h *GeometryHandler) loadDXF(w http.ResponseWriter, r *http.Request, version *models.FileVersion) (*dxf.File, bool) {
+	if !dxf.IsDXF(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a DXF file")
+		return nil, false
+	}
+
+	drawing, err := h.loader.LoadDXF(r.Context(), version)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse DXF file")
+		return nil, false
+	}
+	return drawing, true
+}
+
+// GetGerber returns a Gerber or drill file's function, units, apertures
+// with flash and draw counts, totals and extents
+func (h *GeometryHandler) GetGerber(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, err := h.gerberRepo.GetByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get Gerber metadata")
+		return
+	}
+
+	if metadata == nil {
+		layer, ok := h.loadGerber(w, r, version)
+		if !ok {
+			return
+		}
+
+		metadata = &models.GerberMetadata{FileVersionID: version.ID, File: *layer}
+		if err := h.gerberRepo.Create(r.Context(), metadata); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store Gerber metadata")
+			return
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, metadata)
+}
+
+// GetGerberSVG draws the layer as SVG. With ?against= it overlays the
+// other version in red under this one in green.
+func (h *GeometryHandler) GetGerberSVG(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	layer, other, ok := h.loadGerberPair(w, r, version)
+	if !ok {
+		return
+	}
+
+	svg := layer.SVG()
+	if other != nil {
+		svg = gerber.OverlaySVG(other, layer)
+	}
+	w.Header().Set("Content-Type", "image/svg+xml")
+	w.Header().Set("Content-Length", strconv.Itoa(len(svg)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(svg)
+}
+
+// GetGerberPNG rasterizes the layer, ?size= pixels on the longer side.
+// With ?against= areas both versions draw are gray, areas only the other
+// version draws red and areas only this one draws green.
+func (h *GeometryHandler) GetGerberPNG(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	size := gerber.DefaultPNGSize
+	if s := r.URL.Query().Get("size"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > gerber.MaxPNGSize {
+			utils.ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("size must be between 1 and %d", gerber.MaxPNGSize))
+			return
+		}
+		size = n
+	}
+
+	layer, other, ok := h.loadGerberPair(w, r, version)
+	if !ok {
+		return
+	}
+
+	img := gerber.Render(layer, size)
+	if other != nil {
+		img = gerber.Overlay(other, layer, size)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to encode PNG")
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// loadGerberPair parses a Gerber version and, when ?against= is given, the
+// version to compare it with, writing an error response on failure
+func (h *GeometryHandler) loadGerberPair(w http.ResponseWriter, r *http.Request, version *models.FileVersion) (*gerber.File, *gerber.File, bool) {
+	layer, ok := h.loadGerber(w, r, version)
+	if !ok {
+		return nil, nil, false
+	}
+
+	againstStr := r.URL.Query().Get("against")
+	if againstStr == "" {
+		return layer, nil, true
+	}
+	otherID, err := uuid.Parse(againstStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid against version ID")
+		return nil, nil, false
+	}
+	other, err := h.fileRepo.GetVersionByID(r.Context(), otherID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Against file version not found")
+		return nil, nil, false
+	}
+	against, ok := h.loadGerber(w, r, other)
+	if !ok {
+		return nil, nil, false
+	}
+	return layer, against, true
+}
+
+// loadGerber parses a Gerber or drill version, writing an error response
+// on failure
+func (h *GeometryHandler) loadGerber(w http.ResponseWriter, r *http.Request, version *models.FileVersion) (*gerber.File, bool) {
+	if !gerber.IsGerber(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a Gerber or drill file")
+		return nil, false
+	}
+
+	layer, err := h.loader.LoadGerber(r.Context(), version)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse Gerber file")
+		return nil, false
+	}
+	return layer, true
+}
+
+// GetKiCad returns a KiCad schematic's or board's components, nets and,
+// for boards, routing totals
+func (h *GeometryHandler) GetKiCad(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	metadata, ok := h.kicadMetadata(w, r, version)
+	if !ok {
+		return
+	}
+	utils.JSONResponse(w, http.StatusOK, metadata)
+}
+
+// GetKiCadDiff compares this version with the version given by ?against=:
+// components added, removed or changed and nets whose pins changed
+func (h *GeometryHandler) GetKiCadDiff(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	otherID, err := uuid.Parse(r.URL.Query().Get("against"))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid against version ID")
+		return
+	}
+	other, err := h.fileRepo.GetVersionByID(r.Context(), otherID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Against file version not found")
+		return
+	}
+
+	to, ok := h.kicadMetadata(w, r, version)
+	if !ok {
+		return
+	}
+	from, ok := h.kicadMetadata(w, r, other)
+	if !ok {
+		return
+	}
+	utils.JSONResponse(w, http.StatusOK, kicad.Compare(&from.File, &to.File))
+}
+
+// kicadMetadata reads a KiCad version's stored components and nets,
+// parsing and storing them first for versions committed before KiCad
+// support. It writes an error response on failure.
+func (h *GeometryHandler) kicadMetadata(w http.ResponseWriter, r *http.Request, version *models.FileVersion) (*models.KiCadMetadata, bool) {
+	if !kicad.IsKiCad(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a KiCad schematic or board")
+		return nil, false
+	}
+
+	metadata, err := h.kicadRepo.GetByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get KiCad metadata")
+		return nil, false
+	}
+	if metadata != nil {
+		return metadata, true
+	}
+
+	design, err := h.loader.LoadKiCad(r.Context(), version)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to parse KiCad file")
+		return nil, false
+	}
+	metadata = &models.KiCadMetadata{FileVersionID: version.ID, File: *design}
+	if err := h.kicadRepo.Create(r.Context(), metadata); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store KiCad metadata")
+		return nil, false
+	}
+	return metadata, true
+}
+
+// GetDeviation measures surface deviation between this version and the
+// version given by ?against=. Versions are immutable, so results are cached
+// per pair and sampling settings.
+func (h *GeometryHandler) GetDeviation(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	otherID, err := uuid.Parse(r.URL.Query().Get("against"))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid against version ID")
+		return
+	}
+
+	other, err := h.fileRepo.GetVersionByID(r.Context(), otherID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Against file version not found")
+		return
+	}
+
+	samples, _ := strconv.Atoi(r.URL.Query().Get("samples"))
+	bins, _ := strconv.Atoi(r.URL.Query().Get("bins"))
+	if samples <= 0 {
+		samples = deviation.DefaultSamples
+	}
+	if samples > deviation.MaxSamples {
+		samples = deviation.MaxSamples
+	}
+	if bins <= 0 || bins > 200 {
+		bins = deviation.DefaultBins
+	}
+	alignMethod, ok := alignFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	cacheKey := fmt.Sprintf("deviation:%s:%s:%d:%d:%s", version.ID, other.ID, samples, bins, alignMethod)
+	if cached, err := h.cache.Get(r.Context(), cacheKey); err == nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(cached))
+		return
+	}
+
+	meshA, meshB, ok := h.loadPair(w, r, version, other)
+	if !ok {
+		return
+	}
+	meshB, alignment, ok := alignPair(w, meshA, meshB, alignMethod)
+	if !ok {
+		return
+	}
+
+	result := deviation.Compare(meshA, meshB, deviation.Options{Samples: samples, Bins: bins})
+	response := map[string]interface{}{
+		"version_id": version.ID,
+		"against_id": other.ID,
+		"unit":       analysis.VersionUnit(version),
+		"deviation":  result,
+	}
+	if alignment != nil {
+		response["alignment"] = alignment
+	}
+
+	if encoded, err := json.Marshal(response); err == nil {
+		if err := h.cache.Set(r.Context(), cacheKey, encoded, geometryCacheTTL); err != nil {
+			log.Printf("Failed to cache deviation: %v", err)
+		}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// GetHeatmap describes the signed deviation of this version's vertices from
+// the ?against= version's surface, with a suggested color scale. The values
+// themselves are served as a binary buffer from GetHeatmapBuffer, one per
+// vertex of the version's full-resolution glTF (geometry_url), or with
+// ?layout=triangle_corners one per corner of its STL.
+func (h *GeometryHandler) GetHeatmap(w http.ResponseWriter, r *http.Request) {
+	version, other, layout, values, ok := h.heatmap(w, r)
+	if !ok {
+		return
+	}
+
+	geometryURL := fmt.Sprintf("/api/file-versions/%s/gltf", version.ID)
+	if layout == heatmapTriangleCorners {
+		geometryURL = fmt.Sprintf("/api/file-versions/%s/stl", version.ID)
+	}
+	response := map[string]interface{}{
+		"version_id":   version.ID,
+		"against_id":   other.ID,
+		"vertex_count": len(values),
+		"unit":         analysis.VersionUnit(version),
+		"format":       "float32le",
+		"layout":       layout,
+		"color_scale":  deviation.SuggestColorScale(values),
+		"geometry_url": geometryURL,
+		"buffer_url":   fmt.Sprintf("/api/file-versions/%s/heatmap.bin?against=%s&layout=%s", version.ID, other.ID, layout),
+	}
+	if alignMethod := r.URL.Query().Get("align"); alignMethod != "" {
+		response["align"] = alignMethod
+		response["buffer_url"] = fmt.Sprintf("%s&align=%s", response["buffer_url"], alignMethod)
+	}
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// GetHeatmapBuffer serves the deviation values as little-endian float32s in
+// the order of the geometry GetHeatmap names
+func (h *GeometryHandler) GetHeatmapBuffer(w http.ResponseWriter, r *http.Request) {
+	_, _, _, values, ok := h.heatmap(w, r)
+	if !ok {
+		return
+	}
+
+	buf := encodeFloat32s(values)
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(buf)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.Header().Set("X-Vertex-Count", strconv.Itoa(len(values)))
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf)
+}
+
+// Heatmap buffer layouts. glTF conversions keep the parsed mesh's vertices
+// in order, so per-vertex values line up with them; decimated LODs have
+// other vertices and don't.
+const (
+	heatmapVertices        = "vertices"
+	heatmapTriangleCorners = "triangle_corners"
+)
+
+// heatmap loads or computes the signed deviation for a version pair in the
+// requested layout, writing an error response on failure
+func (h *GeometryHandler) heatmap(w http.ResponseWriter, r *http.Request) (*models.FileVersion, *models.FileVersion, string, []float32, bool) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return nil, nil, "", nil, false
+	}
+
+	layout := r.URL.Query().Get("layout")
+	switch layout {
+	case "":
+		layout = heatmapVertices
+	case heatmapVertices, heatmapTriangleCorners:
+	default:
+		utils.ErrorResponse(w, http.StatusBadRequest, "layout must be vertices or triangle_corners")
+		return nil, nil, "", nil, false
+	}
+
+	otherID, err := uuid.Parse(r.URL.Query().Get("against"))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid against version ID")
+		return nil, nil, "", nil, false
+	}
+
+	other, err := h.fileRepo.GetVersionByID(r.Context(), otherID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Against file version not found")
+		return nil, nil, "", nil, false
+	}
+
+	alignMethod, ok := alignFromRequest(w, r)
+	if !ok {
+		return nil, nil, "", nil, false
+	}
+
+	cacheKey := fmt.Sprintf("heatmap:%s:%s:%s:%s", version.ID, other.ID, alignMethod, layout)
+	if cached, err := h.cache.Get(r.Context(), cacheKey); err == nil {
+		return version, other, layout, decodeFloat32s([]byte(cached)), true
+	}
+
+	mesh, against, ok := h.loadPair(w, r, version, other)
+	if !ok {
+		return nil, nil, "", nil, false
+	}
+	// Only the other version moves, so the values still line up with this
+	// version's vertices
+	against, _, ok = alignPair(w, mesh, against, alignMethod)
+	if !ok {
+		return nil, nil, "", nil, false
+	}
+
+	distances := deviation.SignedVertexDistances(mesh, against)
+	var values []float32
+	if layout == heatmapTriangleCorners {
+		values = deviation.CornerValues(mesh, distances)
+	} else {
+		values = make([]float32, len(distances))
+		for i, d := range distances {
+			values[i] = float32(d)
+		}
+	}
+	if err := h.cache.Set(r.Context(), cacheKey, encodeFloat32s(values), geometryCacheTTL); err != nil {
+		log.Printf("Failed to cache heatmap: %v", err)
+	}
+
+	return version, other, layout, values, true
+}
+
+func encodeFloat32s(values []float32) []byte {
+	buf := make([]byte, 4*len(values))
+	for i, v := range values {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(v))
+	}
+	return buf
+}
+
+func decodeFloat32s(buf []byte) []float32 {
+	values := make([]float32, len(buf)/4)
+	for i := range values {
+		values[i] = math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:]))
+	}
+	return values
+}
+
+// Section colors match the diff viewer's source and target
+const (
+	sectionColor        = "#3b82f6"
+	sectionAgainstColor = "#10b981"
+)
+
+// sectionResult is what's cached for a section request: the cut through
+// this version and, for comparisons, through the ?against= version
+type sectionResult struct {
+	Section *section.Section `json:"section"`
+	Against *section.Section `json:"against,omitempty"`
+}
+
+// GetSection cuts a mesh with ?plane= ("z:12.5", "0,1,1:3", or just "x" to
+// cut through the middle) and returns the contour as JSON polylines or, with
+// ?format=svg, a drawing. ?against= overlays the same cut through another
+// version, converted into this version's unit.
+func (h *GeometryHandler) GetSection(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	q := r.URL.Query()
+	plane, offsetSet, err := section.ParsePlane(q.Get("plane"))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "svg" {
+		utils.ErrorResponse(w, http.StatusBadRequest, "format must be json or svg")
+		return
+	}
+
+	var other *models.FileVersion
+	if againstStr := q.Get("against"); againstStr != "" {
+		otherID, err := uuid.Parse(againstStr)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Invalid against version ID")
+			return
+		}
+		other, err = h.fileRepo.GetVersionByID(r.Context(), otherID)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusNotFound, "Against file version not found")
+			return
+		}
+	}
+
+	againstKey := "none"
+	if other != nil {
+		againstKey = other.ID.String()
+	}
+	cacheKey := fmt.Sprintf("section:%s:%s:%s", version.ID, againstKey, q.Get("plane"))
+
+	var result sectionResult
+	cached, err := h.cache.Get(r.Context(), cacheKey)
+	if err != nil || json.Unmarshal([]byte(cached), &result) != nil || result.Section == nil {
+		var mesh, against *geometry.Mesh
+		if other != nil {
+			if mesh, against, ok = h.loadPair(w, r, version, other); !ok {
+				return
+			}
+		} else {
+			if !analysis.IsMesh(version.Filename) {
+				utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+				return
+			}
+			if mesh, err = h.loader.Load(r.Context(), version); err != nil {
+				utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+				return
+			}
+		}
+
+		if !offsetSet {
+			plane = plane.Through(mesh.Bounds().Center())
+		}
+		result = sectionResult{Section: section.Cut(mesh, plane)}
+		if against != nil {
+			result.Against = section.Cut(against, plane)
+		}
+
+		if encoded, err := json.Marshal(result); err == nil {
+			if err := h.cache.Set(r.Context(), cacheKey, encoded, geometryCacheTTL); err != nil {
+				log.Printf("Failed to cache section: %v", err)
+			}
+		}
+	}
+
+	if format == "svg" {
+		layers := []section.Layer{{Section: result.Section, Label: sectionLabel(version), Color: sectionColor}}
+		if result.Against != nil {
+			layers = append(layers, section.Layer{Section: result.Against, Label: sectionLabel(other), Color: sectionAgainstColor})
+		}
+		svg := section.SVG(layers...)
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Header().Set("Content-Length", strconv.Itoa(len(svg)))
+		w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+		w.WriteHeader(http.StatusOK)
+		w.Write(svg)
+		return
+	}
+
+	response := map[string]interface{}{
+		"version_id": version.ID,
+		"unit":       analysis.VersionUnit(version),
+		"section":    result.Section,
+	}
+	if result.Against != nil {
+		response["against_id"] = other.ID
+		response["against"] = result.Against
+		// Positive when this version has more material in the cut
+		response["area_change"] = result.Section.Area - result.Against.Area
+	}
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+func sectionLabel(version *models.FileVersion) string {
+	return fmt.Sprintf("%s (%s)", version.Filename, version.ID.String()[:8])
+}
+
+// GetThumbnail serves a PNG preview. ?size= and either ?view= (iso, front,
+// top, ...) or ?azimuth=&elevation= pick the render; thumbnails not made at
+// commit time are rendered on first request and stored.
+func (h *GeometryHandler) GetThumbnail(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !analysis.IsMesh(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+		return
+	}
+
+	spec, err := thumbnailSpecFromQuery(r)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get file")
+		return
+	}
+
+	thumbnail, err := h.thumbnails.Get(r.Context(), file.ProjectID, version, spec)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read thumbnail")
+		return
+	}
+
+	if thumbnail == nil {
+		mesh, err := h.loader.Load(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+			return
+		}
+		thumbnail, err = h.thumbnails.Render(r.Context(), file.ProjectID, version, mesh, spec)
+		if err != nil {
+			log.Printf("Failed to render thumbnail for %s: %v", version.ID, err)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to render thumbnail")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(thumbnail)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(thumbnail)
+}
+
+func thumbnailSpecFromQuery(r *http.Request) (analysis.ThumbnailSpec, error) {
+	spec := analysis.DefaultThumbnailSpec()
+	q := r.URL.Query()
+
+	if s := q.Get("size"); s != "" {
+		size, err := strconv.Atoi(s)
+		if err != nil || size <= 0 || size > render.MaxSize {
+			return spec, fmt.Errorf("size must be between 1 and %d", render.MaxSize)
+		}
+		spec.Size = size
+	}
+
+	if v := q.Get("view"); v != "" {
+		angles, ok := render.Views[v]
+		if !ok {
+			return spec, fmt.Errorf("unknown view %q", v)
+		}
+		spec.Azimuth, spec.Elevation = angles[0], angles[1]
+	}
+
+	if a := q.Get("azimuth"); a != "" {
+		azimuth, err := strconv.ParseFloat(a, 64)
+		if err != nil || math.IsNaN(azimuth) || math.IsInf(azimuth, 0) {
+			return spec, fmt.Errorf("invalid azimuth")
+		}
+		spec.Azimuth = math.Mod(azimuth, 360)
+	}
+
+	if e := q.Get("elevation"); e != "" {
+		elevation, err := strconv.ParseFloat(e, 64)
+		if err != nil || elevation < -90 || elevation > 90 {
+			return spec, fmt.Errorf("elevation must be between -90 and 90")
+		}
+		spec.Elevation = elevation
+	}
+
+	return spec, nil
+}
+
+// GetViewerMesh serves any supported mesh as binary STL, the one format the
+// viewer loads
+func (h *GeometryHandler) GetViewerMesh(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !analysis.IsMesh(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+		return
+	}
+
+	mesh, err := h.loader.Load(r.Context(), version)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := stl.WriteBinary(&buf, mesh, version.Filename); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to convert mesh")
+		return
+	}
+
+	w.Header().Set("Content-Type", "model/stl")
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// GetGLTF serves a mesh as quantized, indexed GLB. Conversions not made at
+// commit time are made on first request and stored.
+func (h *GeometryHandler) GetGLTF(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !analysis.IsMesh(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+		return
+	}
+
+	file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get file")
+		return
+	}
+
+	glb, err := h.gltf.Get(r.Context(), file.ProjectID, version)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read glTF")
+		return
+	}
+
+	if glb == nil {
+		mesh, err := h.loader.Load(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+			return
+		}
+		glb, err = h.gltf.Convert(r.Context(), file.ProjectID, version, mesh)
+		if err != nil {
+			log.Printf("Failed to convert %s to glTF: %v", version.ID, err)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to convert mesh")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "model/gltf-binary")
+	w.Header().Set("Content-Length", strconv.Itoa(len(glb)))
+	w.Header().Set("Cache-Control", "private, max-age=31536000, immutable")
+	w.WriteHeader(http.StatusOK)
+	w.Write(glb)
+}
+
+type lodLevelResponse struct {
+	analysis.LODLevel
+	URL string `json:"url"`
+}
+
+// GetLODs lists the preview levels of a mesh under its project's triangle
+// budget, and which one the viewer should load first
+func (h *GeometryHandler) GetLODs(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	_, project, levels, ok := h.lodLevels(w, r, version)
+	if !ok {
+		return
+	}
+
+	response := make([]lodLevelResponse, len(levels))
+	for i, l := range levels {
+		response[i] = lodLevelResponse{LODLevel: l, URL: fmt.Sprintf("/api/file-versions/%s/lod/%d", version.ID, l.Level)}
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
+		"triangle_budget": project.LODTriangleBudget,
+		"recommended":     analysis.RecommendedLOD(levels, project.LODTriangleBudget).Level,
+		"levels":          response,
+	})
+}
+
+// GetLOD serves one preview level as GLB; "auto" picks the most detailed
+// level within the project's budget. Levels missing from storage (budget
+// changed, or generation was left to first view) are decimated now.
+func (h *GeometryHandler) GetLOD(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	file, project, levels, ok := h.lodLevels(w, r, version)
+	if !ok {
+		return
+	}
+
+	var level analysis.LODLevel
+	if param := chi.URLParam(r, "level"); param == "auto" {
+		level = analysis.RecommendedLOD(levels, project.LODTriangleBudget)
+	} else {
+		n, err := strconv.Atoi(param)
+		if err != nil || n < 0 || n >= len(levels) {
+			utils.ErrorResponse(w, http.StatusNotFound, "LOD level not found")
+			return
+		}
+		level = levels[n]
+	}
+
+	var glb []byte
+	var err error
+	if level.Level == 0 {
+		glb, err = h.gltf.Get(r.Context(), file.ProjectID, version)
+	} else {
+		glb, err = h.lods.Get(r.Context(), file.ProjectID, version, level)
+	}
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read LOD")
+		return
+	}
+
+	if glb == nil {
+		mesh, err := h.loader.Load(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+			return
+		}
+		if level.Level == 0 {
+			glb, err = h.gltf.Convert(r.Context(), file.ProjectID, version, mesh)
+		} else {
+			var generated [][]byte
+			generated, err = h.lods.Generate(r.Context(), file.ProjectID, version, mesh, levels)
+			if err == nil {
+				glb = generated[level.Level]
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to generate LOD %d of %s: %v", level.Level, version.ID, err)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to generate LOD")
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "model/gltf-binary")
+	w.Header().Set("Content-Length", strconv.Itoa(len(glb)))
+	// Level numbers follow the project budget, so unlike the full
+	// conversion they can't be cached as immutable
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("X-LOD-Level", strconv.Itoa(level.Level))
+	w.WriteHeader(http.StatusOK)
+	w.Write(glb)
+}
+
+// lodLevels works out a mesh version's preview levels from its stored
+// triangle count, or by loading it when it was never analyzed
+func (h *GeometryHandler) lodLevels(w http.ResponseWriter, r *http.Request, version *models.FileVersion) (*models.File, *models.Project, []analysis.LODLevel, bool) {
+	if !analysis.IsMesh(version.Filename) {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version is not a supported mesh")
+		return nil, nil, nil, false
+	}
+
+	file, err := h.fileRepo.GetByID(r.Context(), version.FileID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get file")
+		return nil, nil, nil, false
+	}
+
+	project, err := h.projects.GetByID(r.Context(), file.ProjectID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get project")
+		return nil, nil, nil, false
+	}
+
+	stats, err := h.meshRepo.GetStatsByVersion(r.Context(), version.ID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh stats")
+		return nil, nil, nil, false
+	}
+
+	var triangles int
+	if stats != nil {
+		triangles = stats.TriangleCount
+	} else {
+		mesh, err := h.loader.Load(r.Context(), version)
+		if err != nil {
+			utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+			return nil, nil, nil, false
+		}
+		triangles = len(mesh.Triangles)
+	}
+
+	return file, project, analysis.LODLevels(triangles, project.LODTriangleBudget), true
+}
+
+// GetCompanions lists the files a version loads by name (an OBJ's material
+// libraries and their textures), resolved against the tree of the commit
+// the version belongs to
+func (h *GeometryHandler) GetCompanions(w http.ResponseWriter, r *http.Request) {
+	version, ok := h.versionFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if !analysis.HasCompanions(version.Filename) {
+		utils.JSONResponse(w, http.StatusOK, []analysis.Companion{})
+		return
+	}
+
+	tree, err := h.fileRepo.GetTreeAtCommit(r.Context(), version.CommitID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get tree")
+		return
+	}
+
+	companions, err := h.loader.Companions(r.Context(), version, tree)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to read file")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, companions)
+}
+
+// loadPair loads two versions as meshes, the second converted into the
+// first's unit, writing an error response on failure
+func (h *GeometryHandler) loadPair(w http.ResponseWriter, r *http.Request, a, b *models.FileVersion) (*geometry.Mesh, *geometry.Mesh, bool) {
+	if !analysis.IsMesh(a.Filename) || !analysis.IsMesh(b.Filename) {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Both versions must be supported meshes")
+		return nil, nil, false
+	}
+
+	meshA, err := h.loader.Load(r.Context(), a)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+		return nil, nil, false
+	}
+
+	meshB, err := h.loader.LoadIn(r.Context(), b, analysis.VersionUnit(a))
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to load mesh")
+		return nil, nil, false
+	}
+
+	return meshA, meshB, true
+}
+
+// alignFromRequest reads ?align=principal|icp, writing an error response
+// for other methods. It's empty when no alignment was asked for.
+func alignFromRequest(w http.ResponseWriter, r *http.Request) (string, bool) {
+	method := r.URL.Query().Get("align")
+	if method != "" && !align.ValidMethod(method) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "align must be principal or icp")
+		return "", false
+	}
+	return method, true
+}
+
+// alignPair rigidly moves the other mesh onto the reference, so a part
+// that was only repositioned shows no deviation. Without a method the mesh
+// is returned as is.
+func alignPair(w http.ResponseWriter, reference, other *geometry.Mesh, method string) (*geometry.Mesh, *align.Result, bool) {
+	if method == "" {
+		return other, nil, true
+	}
+	alignment, err := align.Align(reference, other, align.Options{Method: method})
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusUnprocessableEntity, "Failed to align meshes")
+		return nil, nil, false
+	}
+	return other.Transformed(alignment.Transform), alignment, true
+}
+
+func (h *GeometryHandler) versionFromRequest(w http.ResponseWriter, r *http.Request) (*models.FileVersion, bool) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid version ID")
+		return nil, false
+	}
+
+	version, err := h.fileRepo.GetVersionByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "File version not found")
+		return nil, false
+	}
+
+	return version, true
+}
@@ -1,32 +1,78 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/analysis"
+	"github.com/rhblitstein/cad-version-control/internal/bom"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/align"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/diff"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gerber"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/stl"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
 	"github.com/rhblitstein/cad-version-control/internal/models"
 	"github.com/rhblitstein/cad-version-control/internal/repository"
+	"github.com/rhblitstein/cad-version-control/internal/storage"
 	"github.com/rhblitstein/cad-version-control/pkg/utils"
 )
 
 type MergeRequestHandler struct {
-	mrRepo     *repository.MergeRequestRepository
-	branchRepo *repository.BranchRepository
-	fileRepo   *repository.FileRepository
+	db          *repository.Postgres
+	mrRepo      *repository.MergeRequestRepository
+	branchRepo  *repository.BranchRepository
+	commitRepo  *repository.CommitRepository
+	fileRepo    *repository.FileRepository
+	projectRepo *repository.ProjectRepository
+	meshRepo    *repository.MeshRepository
+	storage     *storage.BlobStore
+	loader      *analysis.MeshLoader
+	analyzer    *analysis.Analyzer
+	boms        *analysis.BOMExtractor
+	references  *analysis.ReferenceExtractor
 }
 
 func NewMergeRequestHandler(
+	db *repository.Postgres,
 	mrRepo *repository.MergeRequestRepository,
 	branchRepo *repository.BranchRepository,
+	commitRepo *repository.CommitRepository,
 	fileRepo *repository.FileRepository,
+	projectRepo *repository.ProjectRepository,
+	meshRepo *repository.MeshRepository,
+	storage *storage.BlobStore,
+	loader *analysis.MeshLoader,
+	analyzer *analysis.Analyzer,
+	boms *analysis.BOMExtractor,
+	references *analysis.ReferenceExtractor,
 ) *MergeRequestHandler {
 	return &MergeRequestHandler{
-		mrRepo:     mrRepo,
-		branchRepo: branchRepo,
-		fileRepo:   fileRepo,
+		db:          db,
+		projectRepo: projectRepo,
+		mrRepo:      mrRepo,
+		branchRepo:  branchRepo,
+		commitRepo:  commitRepo,
+		fileRepo:    fileRepo,
+		meshRepo:    meshRepo,
+		storage:     storage,
+		loader:      loader,
+		analyzer:    analyzer,
+		boms:        boms,
+		references:  references,
 	}
 }
 
@@ -79,20 +125,27 @@ func (h *MergeRequestHandler) Create(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Detect conflicts
-	conflicts, err := h.detectConflicts(r.Context(), sourceBranch, targetBranch, mr.ID)
+	trees, err := h.loadMergeTrees(r.Context(), sourceBranch, targetBranch)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to detect conflicts")
 		return
 	}
+	conflicts := detectConflicts(trees, mr.ID)
 
 	// Create conflict records
-	for _, conflict := range conflicts {
-		if err := h.mrRepo.CreateConflict(r.Context(), &conflict); err != nil {
+	for i := range conflicts {
+		if err := h.mrRepo.CreateConflict(r.Context(), &conflicts[i]); err != nil {
 			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create conflict record")
 			return
 		}
 	}
 
+	// Mesh edits to disjoint regions don't need a manual step. Anything
+	// that can't be merged stays unresolved for a person to handle.
+	if err := h.autoResolve(r.Context(), trees, sourceBranch, targetBranch, conflicts); err != nil {
+		log.Printf("Auto-merge failed for merge request %s: %v", mr.ID, err)
+	}
+
 	utils.JSONResponse(w, http.StatusCreated, map[string]interface{}{
 		"merge_request": mr,
 		"conflicts":     conflicts,
@@ -159,12 +212,172 @@ func (h *MergeRequestHandler) Get(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
+	validation, err := h.validationFindings(r.Context(), mr.SourceBranchID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get mesh validations")
+		return
+	}
+
+	response := map[string]interface{}{
 		"merge_request": mr,
 		"conflicts":     conflicts,
 		"comments":      comments,
 		"approvals":     approvals,
-	})
+		"validation":    validation,
+	}
+
+	bomDiff, err := h.bomDiff(r.Context(), mr)
+	if err != nil {
+		log.Printf("Failed to diff BOMs for merge request %s: %v", id, err)
+		response["bom_diff_error"] = "Failed to compare BOMs"
+	} else if bomDiff != nil {
+		response["bom_diff"] = bomDiff
+	}
+
+	affected, err := h.affectedAssemblies(r.Context(), mr)
+	if err != nil {
+		log.Printf("Failed to find affected assemblies for merge request %s: %v", id, err)
+		response["affected_assemblies_error"] = "Failed to find affected assemblies"
+	} else {
+		response["affected_assemblies"] = affected
+	}
+
+	utils.JSONResponse(w, http.StatusOK, response)
+}
+
+// bomDiff compares the BOM at the branches' merge base with the source
+// branch's, i.e. what the source branch changed, so changes made on the
+// target since it branched don't show as reverted. With no merge base,
+// the whole source BOM is added. It's nil when either branch has no commits.
+func (h *MergeRequestHandler) bomDiff(ctx context.Context, mr *models.MergeRequest) (*bom.Diff, error) {
+	sourceBranch, err := h.branchRepo.GetByID(ctx, mr.SourceBranchID)
+	if err != nil {
+		return nil, err
+	}
+	targetBranch, err := h.branchRepo.GetByID(ctx, mr.TargetBranchID)
+	if err != nil {
+		return nil, err
+	}
+	if sourceBranch.HeadCommitID == nil || targetBranch.HeadCommitID == nil {
+		return nil, nil
+	}
+
+	to, err := h.boms.Get(ctx, *sourceBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	baseCommitID, err := h.commitRepo.MergeBase(ctx, *sourceBranch.HeadCommitID, *targetBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	if baseCommitID == nil {
+		return bom.Compare(&bom.BOM{}, &to.BOM), nil
+	}
+	from, err := h.boms.Get(ctx, *baseCommitID)
+	if err != nil {
+		return nil, err
+	}
+	return bom.Compare(&from.BOM, &to.BOM), nil
+}
+
+// affectedAssemblies lists the files the source branch changes relative to
+// the target that are used in assemblies, with every assembly that
+// includes them at the source head
+func (h *MergeRequestHandler) affectedAssemblies(ctx context.Context, mr *models.MergeRequest) ([]map[string]interface{}, error) {
+	affected := []map[string]interface{}{}
+
+	sourceBranch, err := h.branchRepo.GetByID(ctx, mr.SourceBranchID)
+	if err != nil {
+		return nil, err
+	}
+	targetBranch, err := h.branchRepo.GetByID(ctx, mr.TargetBranchID)
+	if err != nil {
+		return nil, err
+	}
+	if sourceBranch.HeadCommitID == nil {
+		return affected, nil
+	}
+
+	source, err := h.fileRepo.GetTreeAtCommit(ctx, *sourceBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	targetChecksums := make(map[string]string)
+	if targetBranch.HeadCommitID != nil {
+		target, err := h.fileRepo.GetTreeAtCommit(ctx, *targetBranch.HeadCommitID)
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range target {
+			targetChecksums[v.Filename] = v.Checksum
+		}
+	}
+
+	refs, err := h.references.Get(ctx, *sourceBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	for _, v := range source {
+		if checksum, ok := targetChecksums[v.Filename]; ok && checksum == v.Checksum {
+			continue
+		}
+		usedBy := refs.WhereUsed(v.Filename, true)
+		if len(usedBy) == 0 {
+			continue
+		}
+		affected = append(affected, map[string]interface{}{
+			"file_id":         v.FileID,
+			"file_version_id": v.ID,
+			"filename":        v.Filename,
+			"used_by":         usedBy,
+		})
+	}
+
+	return affected, nil
+}
+
+// validationFindings lists meshes at the source branch head that have
+// validation findings, so reviewers see problems before merging
+func (h *MergeRequestHandler) validationFindings(ctx context.Context, branchID uuid.UUID) ([]map[string]interface{}, error) {
+	findings := []map[string]interface{}{}
+
+	branch, err := h.branchRepo.GetByID(ctx, branchID)
+	if err != nil {
+		return nil, err
+	}
+	if branch.HeadCommitID == nil {
+		return findings, nil
+	}
+
+	tree, err := h.fileRepo.GetTreeAtCommit(ctx, *branch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+
+	versionIDs := make([]uuid.UUID, len(tree))
+	for i, v := range tree {
+		versionIDs[i] = v.ID
+	}
+	validations, err := h.meshRepo.GetValidationsByVersions(ctx, versionIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range tree {
+		validation := validations[v.ID]
+		if validation == nil || len(validation.Findings) == 0 {
+			continue
+		}
+		findings = append(findings, map[string]interface{}{
+			"file_id":         v.FileID,
+			"file_version_id": v.ID,
+			"filename":        v.Filename,
+			"passed":          validation.Passed,
+			"findings":        validation.Findings,
+		})
+	}
+
+	return findings, nil
 }
 
 func (h *MergeRequestHandler) Approve(w http.ResponseWriter, r *http.Request) {
@@ -203,6 +416,11 @@ func (h *MergeRequestHandler) Approve(w http.ResponseWriter, r *http.Request) {
 	utils.JSONResponse(w, http.StatusOK, approval)
 }
 
+// Merge commits the source branch into the target. The merge commit's
+// parents are the target head and the source head, so the source's head
+// becomes the merge base for anything merged later. Three-way merged meshes
+// are only built and stored now, and the commit, its versions, the target
+// head and the request's status are written in one transaction.
 func (h *MergeRequestHandler) Merge(w http.ResponseWriter, r *http.Request) {
 	idStr := chi.URLParam(r, "id")
 	id, err := uuid.Parse(idStr)
@@ -211,6 +429,16 @@ func (h *MergeRequestHandler) Merge(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	mr, err := h.mrRepo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Merge request not found")
+		return
+	}
+	if mr.Status == "merged" || mr.Status == "closed" {
+		utils.ErrorResponse(w, http.StatusConflict, fmt.Sprintf("Merge request is already %s", mr.Status))
+		return
+	}
+
 	// Check for unresolved conflicts
 	conflicts, err := h.mrRepo.GetConflicts(r.Context(), id)
 	if err != nil {
@@ -225,14 +453,182 @@ func (h *MergeRequestHandler) Merge(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// TODO: Create merge commit (simplified for now)
-	if err := h.mrRepo.UpdateStatus(r.Context(), id, "merged"); err != nil {
-		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update status")
+	sourceBranch, err := h.branchRepo.GetByID(r.Context(), mr.SourceBranchID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Source branch not found")
+		return
+	}
+	targetBranch, err := h.branchRepo.GetByID(r.Context(), mr.TargetBranchID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Target branch not found")
+		return
+	}
+	if sourceBranch.HeadCommitID == nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Source branch has no commits")
 		return
 	}
 
-	utils.JSONResponse(w, http.StatusOK, map[string]string{
+	project, err := h.projectRepo.GetByID(r.Context(), mr.ProjectID)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to get project")
+		return
+	}
+
+	trees, err := h.loadMergeTrees(r.Context(), sourceBranch, targetBranch)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to load branch trees")
+		return
+	}
+
+	// Everything on the source is already in the target
+	if trees.baseCommitID != nil && *trees.baseCommitID == *sourceBranch.HeadCommitID {
+		if err := h.mrRepo.MarkMerged(r.Context(), id); err != nil {
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update status")
+			return
+		}
+		utils.JSONResponse(w, http.StatusOK, map[string]string{
+			"message": "Merge request merged successfully",
+		})
+		return
+	}
+
+	entries, err := planMerge(trees, conflicts)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusConflict, "The branches changed since the merge request was created; open a new one to detect conflicts again")
+		return
+	}
+
+	// Merged meshes are validated like any committed mesh
+	validation := project.ValidationMode != models.ValidationOff
+	var rejected []map[string]interface{}
+	for _, entry := range entries {
+		if entry.base == nil {
+			// Committed before the project blocked, a mesh may not have
+			// been inspected yet or at all
+			if analysis.IsMesh(entry.source.Filename) && entry.source.InspectionStatus != models.InspectionInspected {
+				rejected = append(rejected, map[string]interface{}{
+					"filename": entry.source.Filename,
+					"error":    "inspection " + entry.source.InspectionStatus,
+				})
+			}
+			continue
+		}
+		entry.merged, err = h.mergeFile(r.Context(), entry, validation)
+		if errors.Is(err, diff.ErrOverlap) {
+			utils.ErrorResponse(w, http.StatusConflict, fmt.Sprintf("%s no longer merges automatically; resolve the conflict manually", entry.source.Filename))
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to merge %s: %v", entry.source.Filename, err)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to merge "+entry.source.Filename)
+			return
+		}
+		if v := entry.merged.inspection.Validation; v != nil && !v.Passed {
+			rejected = append(rejected, map[string]interface{}{
+				"filename":   entry.source.Filename,
+				"validation": v,
+			})
+		}
+	}
+	if project.ValidationMode == models.ValidationBlock && len(rejected) > 0 {
+		utils.JSONResponse(w, http.StatusUnprocessableEntity, map[string]interface{}{
+			"error": "Mesh validation failed",
+			"files": rejected,
+		})
+		return
+	}
+
+	// Versions are built before the transaction, so blobs are uploaded
+	// outside it
+	versions := make([]*models.FileVersion, len(entries))
+	for i, entry := range entries {
+		if entry.merged == nil {
+			versions[i] = &models.FileVersion{
+				FileID:           entry.source.FileID,
+				StoragePath:      entry.source.StoragePath,
+				FileSize:         entry.source.FileSize,
+				Checksum:         entry.source.Checksum,
+				GeometryHash:     entry.source.GeometryHash,
+				Unit:             entry.source.Unit,
+				InspectionStatus: entry.source.InspectionStatus,
+				Filename:         entry.source.Filename,
+			}
+			continue
+		}
+		versions[i], err = h.storeMerged(r.Context(), mr, entry)
+		if err != nil {
+			log.Printf("Failed to store merged %s: %v", entry.source.Filename, err)
+			utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to store merged file")
+			return
+		}
+	}
+
+	commit := &models.Commit{
+		ProjectID:           mr.ProjectID,
+		BranchID:            targetBranch.ID,
+		ParentCommitID:      targetBranch.HeadCommitID,
+		MergeParentCommitID: sourceBranch.HeadCommitID,
+		Author:              mr.Author,
+		Message:             fmt.Sprintf("Merge %s into %s: %s", sourceBranch.Name, targetBranch.Name, mr.Title),
+	}
+	err = h.db.InTx(r.Context(), func(tx *sql.Tx) error {
+		if err := h.commitRepo.WithTx(tx).Create(r.Context(), commit); err != nil {
+			return err
+		}
+		fileRepo, mrRepo := h.fileRepo.WithTx(tx), h.mrRepo.WithTx(tx)
+		for i, version := range versions {
+			version.CommitID = commit.ID
+			if err := fileRepo.CreateVersion(r.Context(), version); err != nil {
+				return err
+			}
+			if conflict := entries[i].conflict; conflict != nil {
+				if err := mrRepo.SetMergedVersion(r.Context(), conflict.ID, version.ID); err != nil {
+					return err
+				}
+			}
+		}
+		if err := h.branchRepo.WithTx(tx).MoveHead(r.Context(), targetBranch.ID, targetBranch.HeadCommitID, commit.ID); err != nil {
+			return err
+		}
+		return mrRepo.MarkMerged(r.Context(), id)
+	})
+	if errors.Is(err, repository.ErrHeadMoved) {
+		utils.ErrorResponse(w, http.StatusConflict, "The target branch changed during the merge; try again")
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to merge merge request %s: %v", id, err)
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to create merge commit")
+		return
+	}
+
+	for i, entry := range entries {
+		if entry.merged == nil {
+			continue
+		}
+		if err := h.analyzer.Store(r.Context(), mr.ProjectID, versions[i], entry.merged.inspection); err != nil {
+			log.Printf("Failed to analyze %s: %v", versions[i].Filename, err)
+		}
+		h.analyzer.QueuePreviews(mr.ProjectID, *versions[i], entry.merged.inspection, project.LODTriangleBudget)
+	}
+
+	// Derived like any commit's, so the target's BOM and assembly
+	// references include what was merged
+	if _, err := h.boms.Extract(r.Context(), commit.ID); err != nil {
+		log.Printf("Failed to extract BOM for commit %s: %v", commit.ID, err)
+	}
+	if _, err := h.references.Extract(r.Context(), commit.ID); err != nil {
+		log.Printf("Failed to extract references for commit %s: %v", commit.ID, err)
+	}
+
+	commit.FileVersions = make([]models.FileVersion, len(versions))
+	for i, version := range versions {
+		commit.FileVersions[i] = *version
+	}
+
+	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
 		"message": "Merge request merged successfully",
+		"commit":  commit,
 	})
 }
 
@@ -324,7 +720,24 @@ func (h *MergeRequestHandler) ResolveConflict(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	if err := h.mrRepo.ResolveConflict(r.Context(), id, req.ResolutionNotes); err != nil {
+	conflict, err := h.mrRepo.GetConflictByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Conflict not found")
+		return
+	}
+
+	// The chosen side is what the merge commit takes; without one it takes
+	// the source's version
+	var chosen *uuid.UUID
+	if req.ChosenVersionID != uuid.Nil {
+		if req.ChosenVersionID != conflict.SourceVersionID && req.ChosenVersionID != conflict.TargetVersionID {
+			utils.ErrorResponse(w, http.StatusBadRequest, "chosen_version_id must be the conflict's source or target version")
+			return
+		}
+		chosen = &req.ChosenVersionID
+	}
+
+	if err := h.mrRepo.ResolveConflict(r.Context(), id, req.ResolutionNotes, chosen); err != nil {
 		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to resolve conflict")
 		return
 	}
@@ -342,6 +755,14 @@ func (h *MergeRequestHandler) GetDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// ?align=principal|icp rigidly aligns the target onto the source before
+	// diffing, so a re-exported part with a new origin isn't all "changed"
+	alignMethod := r.URL.Query().Get("align")
+	if alignMethod != "" && !align.ValidMethod(alignMethod) {
+		utils.ErrorResponse(w, http.StatusBadRequest, "align must be principal or icp")
+		return
+	}
+
 	conflict, err := h.mrRepo.GetConflictByID(r.Context(), id)
 	if err != nil {
 		utils.ErrorResponse(w, http.StatusNotFound, "Conflict not found")
@@ -360,68 +781,543 @@ func (h *MergeRequestHandler) GetDiff(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// A re-export (ASCII vs binary STL, reordered faces) changes the bytes
+	// but not the geometry. Equal canonical hashes settle it; an unaligned
+	// diff with nothing changed catches exports that lost precision.
+	bytesChanged := sourceVersion.Checksum != targetVersion.Checksum
+	geometryChanged := bytesChanged
+	if bytesChanged {
+		same, err := h.sameGeometry(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to hash geometry for conflict %s: %v", id, err)
+		} else {
+			geometryChanged = !same
+		}
+	}
+
+	diffSummary := map[string]interface{}{
+		"size_diff": targetVersion.FileSize - sourceVersion.FileSize,
+	}
+	if analysis.IsMesh(sourceVersion.Filename) && analysis.IsMesh(targetVersion.Filename) {
+		sourceUnit, targetUnit := analysis.VersionUnit(sourceVersion), analysis.VersionUnit(targetVersion)
+		diffSummary["unit"] = sourceUnit
+		if sourceUnit != targetUnit {
+			diffSummary["unit_change"] = map[string]interface{}{
+				"from":  sourceUnit,
+				"to":    targetUnit,
+				"scale": units.Scale(targetUnit, sourceUnit),
+			}
+		}
+	}
+
+	geometryDiff, alignment, err := h.geometryDiff(r.Context(), sourceVersion, targetVersion, alignMethod)
+	if err != nil {
+		log.Printf("Failed to diff geometry for conflict %s: %v", id, err)
+		diffSummary["geometry_diff_error"] = "Failed to compare geometry"
+	} else if geometryDiff != nil {
+		diffSummary["geometry_diff"] = geometryDiff
+		unchanged := geometryDiff.TrianglesAdded == 0 && geometryDiff.TrianglesRemoved == 0
+		if alignment != nil {
+			diffSummary["alignment"] = alignment
+			diffSummary["repositioned_only"] = geometryChanged && unchanged
+		} else if unchanged {
+			geometryChanged = false
+		}
+	}
+
+	diffSummary["bytes_changed"] = bytesChanged
+	diffSummary["geometry_changed"] = geometryChanged
+	diffSummary["format_only"] = bytesChanged && !geometryChanged
+
+	if analysis.IsPackage(sourceVersion.Filename) && analysis.IsPackage(targetVersion.Filename) {
+		objectDiff, err := h.objectDiff(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to diff objects for conflict %s: %v", id, err)
+			diffSummary["object_diff_error"] = "Failed to compare objects"
+		} else {
+			diffSummary["object_diff"] = objectDiff
+		}
+	}
+
+	if dxf.IsDXF(sourceVersion.Filename) && dxf.IsDXF(targetVersion.Filename) {
+		dxfDiff, err := h.dxfDiff(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to diff DXF drawings for conflict %s: %v", id, err)
+			diffSummary["dxf_diff_error"] = "Failed to compare DXF drawings"
+		} else {
+			diffSummary["dxf_diff"] = dxfDiff
+		}
+	}
+
+	if gerber.IsGerber(sourceVersion.Filename) && gerber.IsGerber(targetVersion.Filename) {
+		gerberDiff, err := h.gerberDiff(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to diff Gerber layers for conflict %s: %v", id, err)
+			diffSummary["gerber_diff_error"] = "Failed to compare Gerber layers"
+		} else {
+			diffSummary["gerber_diff"] = gerberDiff
+			// Red where only the source draws, green where only the target does
+			diffSummary["gerber_overlay_url"] = fmt.Sprintf("/api/file-versions/%s/gerber.png?against=%s", targetVersion.ID, sourceVersion.ID)
+		}
+	}
+
+	if kicad.IsKiCad(sourceVersion.Filename) && kicad.IsKiCad(targetVersion.Filename) {
+		kicadDiff, err := h.kicadDiff(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to diff KiCad designs for conflict %s: %v", id, err)
+			diffSummary["kicad_diff_error"] = "Failed to compare KiCad designs"
+		} else {
+			diffSummary["kicad_diff"] = kicadDiff
+			// False when only UUIDs, the header or graphics changed
+			diffSummary["design_changed"] = !kicadDiff.Empty()
+		}
+	}
+
+	if step.IsSTEP(sourceVersion.Filename) && step.IsSTEP(targetVersion.Filename) {
+		stepDiff, err := h.stepDiff(r.Context(), sourceVersion, targetVersion)
+		if err != nil {
+			log.Printf("Failed to diff STEP structure for conflict %s: %v", id, err)
+			diffSummary["step_diff_error"] = "Failed to compare STEP files"
+		} else {
+			diffSummary["step_diff"] = stepDiff
+		}
+	}
+
 	utils.JSONResponse(w, http.StatusOK, map[string]interface{}{
-		"conflict_id": id,
-		"source_version": map[string]interface{}{
-			"id":           sourceVersion.ID,
-			"filename":     sourceVersion.Filename,
-			"download_url": "/api/file-versions/" + sourceVersion.ID.String() + "/download",
-			"file_size":    sourceVersion.FileSize,
-		},
-		"target_version": map[string]interface{}{
-			"id":           targetVersion.ID,
-			"filename":     targetVersion.Filename,
-			"download_url": "/api/file-versions/" + targetVersion.ID.String() + "/download",
-			"file_size":    targetVersion.FileSize,
-		},
-		"diff_summary": map[string]interface{}{
-			"geometry_changed": sourceVersion.Checksum != targetVersion.Checksum,
-			"size_diff":        targetVersion.FileSize - sourceVersion.FileSize,
-		},
+		"conflict_id":    id,
+		"source_version": diffVersion(sourceVersion),
+		"target_version": diffVersion(targetVersion),
+		"diff_summary":   diffSummary,
 	})
 }
 
-// Helper function to detect conflicts
-func (h *MergeRequestHandler) detectConflicts(ctx context.Context, sourceBranch, targetBranch *models.Branch, mrID uuid.UUID) ([]models.MergeConflict, error) {
-	var conflicts []models.MergeConflict
+// diffVersion describes one side of a diff. Meshes get a gltf_url for the
+// compact viewer format, and a viewer_url pointing at an STL conversion
+// when the original isn't STL; drawings and PCB layers get an SVG
+// preview_url.
+func diffVersion(version *models.FileVersion) map[string]interface{} {
+	prefix := "/api/file-versions/" + version.ID.String()
+	out := map[string]interface{}{
+		"id":           version.ID,
+		"filename":     version.Filename,
+		"download_url": prefix + "/download",
+		"file_size":    version.FileSize,
+	}
+	if analysis.IsMesh(version.Filename) {
+		out["gltf_url"] = prefix + "/gltf"
+		// The preview within the project's triangle budget
+		out["lod_url"] = prefix + "/lod/auto"
+		if !stl.IsSTL(version.Filename) {
+			out["viewer_url"] = prefix + "/stl"
+		}
+	}
+	if dxf.IsDXF(version.Filename) {
+		out["preview_url"] = prefix + "/dxf.svg"
+	}
+	if gerber.IsGerber(version.Filename) {
+		out["preview_url"] = prefix + "/gerber.svg"
+	}
+	return out
+}
 
-	// Get files from both branches
-	if sourceBranch.HeadCommitID == nil || targetBranch.HeadCommitID == nil {
-		return conflicts, nil // No commits yet
+// sameGeometry compares canonical geometry hashes. Hashes cover raw
+// coordinates, so they only count when both versions share a unit.
+// Versions committed before hashes were stored get theirs computed and
+// saved now.
+func (h *MergeRequestHandler) sameGeometry(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (bool, error) {
+	if !analysis.IsMesh(sourceVersion.Filename) || !analysis.IsMesh(targetVersion.Filename) {
+		return false, nil
+	}
+	if analysis.VersionUnit(sourceVersion) != analysis.VersionUnit(targetVersion) {
+		return false, nil
 	}
 
-	sourceFiles, err := h.fileRepo.GetVersionsByCommit(ctx, *sourceBranch.HeadCommitID)
+	for _, version := range []*models.FileVersion{sourceVersion, targetVersion} {
+		if version.GeometryHash != "" {
+			continue
+		}
+		mesh, err := h.loader.Load(ctx, version)
+		if err != nil {
+			return false, err
+		}
+		version.GeometryHash = mesh.CanonicalHash()
+		if err := h.fileRepo.SetGeometryHash(ctx, version.ID, version.GeometryHash); err != nil {
+			return false, err
+		}
+	}
+	return sourceVersion.GeometryHash == targetVersion.GeometryHash, nil
+}
+
+// objectDiff compares two multi-object packages object by object
+func (h *MergeRequestHandler) objectDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (*threemf.Diff, error) {
+	sourcePkg, err := h.loader.LoadPackage(ctx, sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	targetPkg, err := h.loader.LoadPackage(ctx, targetVersion)
 	if err != nil {
 		return nil, err
 	}
+	return threemf.Compare(sourcePkg, targetPkg, diff.Options{}), nil
+}
 
-	targetFiles, err := h.fileRepo.GetVersionsByCommit(ctx, *targetBranch.HeadCommitID)
+// stepDiff compares the entity counts and product structure of two STEP
+// files; without a geometry kernel that's the closest thing to a model diff
+func (h *MergeRequestHandler) stepDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (*step.Diff, error) {
+	source, err := h.loader.LoadStep(ctx, sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := h.loader.LoadStep(ctx, targetVersion)
 	if err != nil {
 		return nil, err
 	}
+	return step.Compare(source, target), nil
+}
 
-	// Create map of target files by filename
-	targetFileMap := make(map[string]models.FileVersion)
-	for _, tf := range targetFiles {
-		targetFileMap[tf.Filename] = tf
+// dxfDiff compares two drawings layer by layer and entity by entity
+func (h *MergeRequestHandler) dxfDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (*dxf.Diff, error) {
+	source, err := h.loader.LoadDXF(ctx, sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := h.loader.LoadDXF(ctx, targetVersion)
+	if err != nil {
+		return nil, err
 	}
+	return dxf.Compare(source, target), nil
+}
 
-	// Check for conflicts
-	for _, sf := range sourceFiles {
-		if tf, exists := targetFileMap[sf.Filename]; exists {
-			// File exists in both branches
-			if sf.Checksum != tf.Checksum {
-				// Different checksums = conflict
-				conflicts = append(conflicts, models.MergeConflict{
-					MergeRequestID:  mrID,
-					FileID:          sf.FileID,
-					SourceVersionID: sf.ID,
-					TargetVersionID: tf.ID,
-					Status:          "unresolved",
-				})
-			}
+// gerberDiff compares two Gerber layers or drill files by aperture use and
+// by the area each one draws
+func (h *MergeRequestHandler) gerberDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (*gerber.Diff, error) {
+	source, err := h.loader.LoadGerber(ctx, sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := h.loader.LoadGerber(ctx, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	return gerber.Compare(source, target), nil
+}
+
+// kicadDiff compares two KiCad schematics or boards by components and net
+// connectivity
+func (h *MergeRequestHandler) kicadDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion) (*kicad.Diff, error) {
+	source, err := h.loader.LoadKiCad(ctx, sourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	target, err := h.loader.LoadKiCad(ctx, targetVersion)
+	if err != nil {
+		return nil, err
+	}
+	return kicad.Compare(source, target), nil
+}
+
+// geometryDiff compares the two versions as meshes, returning nil when
+// either file is not a mesh format we can parse. With an alignment method
+// the target is first moved onto the source and the transform is returned.
+func (h *MergeRequestHandler) geometryDiff(ctx context.Context, sourceVersion, targetVersion *models.FileVersion, alignMethod string) (*diff.Result, *align.Result, error) {
+	if !analysis.IsMesh(sourceVersion.Filename) || !analysis.IsMesh(targetVersion.Filename) {
+		return nil, nil, nil
+	}
+
+	sourceMesh, err := h.loader.Load(ctx, sourceVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Compared in the source's unit, so a re-export in inches isn't a
+	// 25.4x scale change
+	targetMesh, err := h.loader.LoadIn(ctx, targetVersion, analysis.VersionUnit(sourceVersion))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if alignMethod == "" {
+		return diff.Compare(sourceMesh, targetMesh, diff.Options{}), nil, nil
+	}
+
+	alignment, err := align.Align(sourceMesh, targetMesh, align.Options{Method: alignMethod})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Alignment is only as exact as floating point allows; snap the moved
+	// vertices back onto the source so untouched faces still match
+	tol := diff.DefaultTolerance(sourceMesh, targetMesh)
+	aligned := align.SnapVertices(targetMesh.Transformed(alignment.Transform), sourceMesh, tol*100)
+
+	return diff.Compare(sourceMesh, aligned, diff.Options{Tolerance: tol}), alignment, nil
+}
+
+// mergeTrees are the trees a merge combines. Base is empty when the
+// branches share no history, and target when it has no commits yet.
+type mergeTrees struct {
+	baseCommitID *uuid.UUID
+	// source is in filename order, so conflicts and merge commits list
+	// files the same way every time
+	source []models.FileVersion
+	base   map[uuid.UUID]*models.FileVersion
+	target map[uuid.UUID]*models.FileVersion
+}
+
+func (h *MergeRequestHandler) loadMergeTrees(ctx context.Context, sourceBranch, targetBranch *models.Branch) (*mergeTrees, error) {
+	trees := &mergeTrees{
+		base:   map[uuid.UUID]*models.FileVersion{},
+		target: map[uuid.UUID]*models.FileVersion{},
+	}
+	if sourceBranch.HeadCommitID == nil {
+		return trees, nil
+	}
+
+	source, err := h.fileRepo.GetTreeAtCommit(ctx, *sourceBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	trees.source = source
+	if targetBranch.HeadCommitID == nil {
+		return trees, nil
+	}
+
+	target, err := h.fileRepo.GetTreeAtCommit(ctx, *targetBranch.HeadCommitID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range target {
+		trees.target[target[i].FileID] = &target[i]
+	}
+
+	trees.baseCommitID, err = h.commitRepo.MergeBase(ctx, *sourceBranch.HeadCommitID, *targetBranch.HeadCommitID)
+	if err != nil || trees.baseCommitID == nil {
+		return trees, err
+	}
+	base, err := h.fileRepo.GetTreeAtCommit(ctx, *trees.baseCommitID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range base {
+		trees.base[base[i].FileID] = &base[i]
+	}
+	return trees, nil
+}
+
+// sameContent is true when two versions hold the same file, or the same
+// geometry exported differently
+func sameContent(a, b *models.FileVersion) bool {
+	if a.Checksum == b.Checksum {
+		return true
+	}
+	return a.GeometryHash != "" && a.GeometryHash == b.GeometryHash &&
+		analysis.VersionUnit(a) == analysis.VersionUnit(b)
+}
+
+// detectConflicts lists files both branches changed, differently, since
+// their merge base. A file only one side changed merges without a
+// conflict, which is also what keeps a merged branch from conflicting
+// again with what it was merged into.
+func detectConflicts(trees *mergeTrees, mrID uuid.UUID) []models.MergeConflict {
+	var conflicts []models.MergeConflict
+	for i := range trees.source {
+		sf := &trees.source[i]
+		tf, ok := trees.target[sf.FileID]
+		if !ok || sameContent(sf, tf) {
+			continue
+		}
+		if bf, ok := trees.base[sf.FileID]; ok && (sameContent(sf, bf) || sameContent(tf, bf)) {
+			continue
+		}
+		conflicts = append(conflicts, models.MergeConflict{
+			MergeRequestID:  mrID,
+			FileID:          sf.FileID,
+			SourceVersionID: sf.ID,
+			TargetVersionID: tf.ID,
+			Status:          "unresolved",
+		})
+	}
+	return conflicts
+}
+
+// autoResolve three-way merges conflicting meshes against the merge base
+// and marks the ones whose edits combine cleanly as auto-resolved. Nothing
+// is committed here: the merge is redone, and stored, when the request is
+// merged.
+func (h *MergeRequestHandler) autoResolve(ctx context.Context, trees *mergeTrees, sourceBranch, targetBranch *models.Branch, conflicts []models.MergeConflict) error {
+	for i := range conflicts {
+		conflict := &conflicts[i]
+		baseVersion, ok := trees.base[conflict.FileID]
+		if !ok || !analysis.CanEncode(baseVersion.Filename) {
+			continue
+		}
+		sourceVersion, err := h.fileRepo.GetVersionByID(ctx, conflict.SourceVersionID)
+		if err != nil {
+			return err
+		}
+		targetVersion, err := h.fileRepo.GetVersionByID(ctx, conflict.TargetVersionID)
+		if err != nil {
+			return err
+		}
+
+		result, err := h.mergeVersions(ctx, baseVersion, sourceVersion, targetVersion)
+		if errors.Is(err, diff.ErrOverlap) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to merge %s: %v", baseVersion.Filename, err)
+			continue
+		}
+
+		notes := fmt.Sprintf("Auto-merged: %d triangles changed on %s, %d on %s",
+			result.Ours.TrianglesAdded+result.Ours.TrianglesRemoved, sourceBranch.Name,
+			result.Theirs.TrianglesAdded+result.Theirs.TrianglesRemoved, targetBranch.Name)
+		if err := h.mrRepo.AutoResolveConflict(ctx, conflict.ID, notes); err != nil {
+			return err
+		}
+		conflict.Status = "auto_resolved"
+		conflict.ResolutionNotes = notes
+	}
+	return nil
+}
+
+// errStaleConflicts means a branch changed since the merge request's
+// conflicts were detected, so they no longer describe the merge
+var errStaleConflicts = errors.New("conflicts are out of date")
+
+// mergeEntry is one file the merge commit takes from the source branch:
+// either a source version as is, or a three-way merge of both sides
+type mergeEntry struct {
+	source *models.FileVersion
+	// base and target are set when the file needs a three-way merge
+	base, target *models.FileVersion
+	conflict     *models.MergeConflict
+	merged       *mergedFile
+}
+
+// planMerge works out what the merge commit takes from the source branch.
+// Files only the source changed come across; files both changed need a
+// conflict resolved for them, which takes the chosen side, or for an
+// auto-resolved one, the three-way merge.
+func planMerge(trees *mergeTrees, conflicts []models.MergeConflict) ([]*mergeEntry, error) {
+	byFile := make(map[uuid.UUID]*models.MergeConflict, len(conflicts))
+	for i := range conflicts {
+		byFile[conflicts[i].FileID] = &conflicts[i]
+	}
+
+	var entries []*mergeEntry
+	for i := range trees.source {
+		sf := &trees.source[i]
+		tf, ok := trees.target[sf.FileID]
+		if !ok {
+			entries = append(entries, &mergeEntry{source: sf})
+			continue
+		}
+		if sameContent(sf, tf) {
+			continue
+		}
+		bf, inBase := trees.base[sf.FileID]
+		if inBase && sameContent(sf, bf) {
+			continue
 		}
+		if inBase && sameContent(tf, bf) {
+			entries = append(entries, &mergeEntry{source: sf})
+			continue
+		}
+
+		conflict := byFile[sf.FileID]
+		if conflict == nil || conflict.SourceVersionID != sf.ID || conflict.TargetVersionID != tf.ID {
+			return nil, errStaleConflicts
+		}
+		switch {
+		case conflict.Status == "auto_resolved" && inBase:
+			entries = append(entries, &mergeEntry{source: sf, base: bf, target: tf, conflict: conflict})
+		case conflict.MergedVersionID != nil && *conflict.MergedVersionID == tf.ID:
+			// Keeping the target's version needs nothing from the source
+		default:
+			entries = append(entries, &mergeEntry{source: sf, conflict: conflict})
+		}
+	}
+	return entries, nil
+}
+
+// mergedFile is the result of a successful three-way merge for one file
+type mergedFile struct {
+	content    []byte
+	inspection *analysis.Inspection
+	// unit is the merge base's, which both sides were converted into
+	unit string
+}
+
+// mergeFile three-way merges one entry's sides and inspects the result
+// the way a commit would
+func (h *MergeRequestHandler) mergeFile(ctx context.Context, entry *mergeEntry, validation bool) (*mergedFile, error) {
+	result, err := h.mergeVersions(ctx, entry.base, entry.source, entry.target)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := analysis.EncodeMesh(entry.base.Filename, result.Mesh, "Three-way merge")
+	if err != nil {
+		return nil, err
+	}
+	inspection, err := analysis.Inspect(entry.base.Filename, content, validation)
+	if err != nil {
+		return nil, err
+	}
+	return &mergedFile{
+		content:    content,
+		inspection: inspection,
+		unit:       analysis.VersionUnit(entry.base),
+	}, nil
+}
+
+func (h *MergeRequestHandler) mergeVersions(ctx context.Context, baseVersion, sourceVersion, targetVersion *models.FileVersion) (*diff.MergeResult, error) {
+	base, err := h.loader.Load(ctx, baseVersion)
+	if err != nil {
+		return nil, err
+	}
+	// Both sides are merged in the base's unit
+	unit := analysis.VersionUnit(baseVersion)
+	ours, err := h.loader.LoadIn(ctx, sourceVersion, unit)
+	if err != nil {
+		return nil, err
+	}
+	theirs, err := h.loader.LoadIn(ctx, targetVersion, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return diff.Merge3(base, ours, theirs, diff.Options{})
+}
+
+// storeMerged uploads a merged file, reusing an identical blob if there is
+// one. The path is per request and file, so retrying a failed merge
+// overwrites it rather than leaving another copy behind.
+func (h *MergeRequestHandler) storeMerged(ctx context.Context, mr *models.MergeRequest, entry *mergeEntry) (*models.FileVersion, error) {
+	m := entry.merged
+	hash := sha256.Sum256(m.content)
+	checksum := hex.EncodeToString(hash[:])
+
+	existingVersion, err := h.fileRepo.ChecksumExists(ctx, mr.ProjectID, checksum)
+	if err != nil {
+		return nil, err
+	}
+
+	storagePath := fmt.Sprintf("projects/%s/merges/%s/%s", mr.ProjectID, mr.ID, entry.source.FileID)
+	if existingVersion != nil {
+		storagePath = existingVersion.StoragePath
+	} else if err := h.storage.Upload(ctx, mr.ProjectID, storagePath, bytes.NewReader(m.content), int64(len(m.content)), "application/octet-stream"); err != nil {
+		return nil, err
 	}
 
-	return conflicts, nil
+	return &models.FileVersion{
+		FileID:       entry.source.FileID,
+		StoragePath:  storagePath,
+		FileSize:     int64(len(m.content)),
+		Checksum:     checksum,
+		GeometryHash: m.inspection.GeometryHash(),
+		Unit:         m.unit,
+		Filename:     entry.source.Filename,
+	}, nil
 }
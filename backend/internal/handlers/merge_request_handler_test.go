@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+func version(fileID uuid.UUID, filename, checksum string) models.FileVersion {
+	return models.FileVersion{ID: uuid.New(), FileID: fileID, Filename: filename, Checksum: checksum}
+}
+
+func treeOf(versions ...models.FileVersion) map[uuid.UUID]*models.FileVersion {
+	out := make(map[uuid.UUID]*models.FileVersion, len(versions))
+	for i := range versions {
+		out[versions[i].FileID] = &versions[i]
+	}
+	return out
+}
+
+func TestDetectConflictsIgnoresOneSidedChanges(t *testing.T) {
+	bracket, plate, cover := uuid.New(), uuid.New(), uuid.New()
+	trees := &mergeTrees{
+		source: []models.FileVersion{
+			version(bracket, "bracket.stl", "b-source"),
+			version(plate, "plate.stl", "p-base"),
+			version(cover, "cover.stl", "c-source"),
+		},
+		base: treeOf(
+			version(bracket, "bracket.stl", "b-base"),
+			version(plate, "plate.stl", "p-base"),
+			version(cover, "cover.stl", "c-base"),
+		),
+		target: treeOf(
+			version(bracket, "bracket.stl", "b-target"),
+			version(plate, "plate.stl", "p-target"),
+			version(cover, "cover.stl", "c-base"),
+		),
+	}
+
+	conflicts := detectConflicts(trees, uuid.New())
+	if len(conflicts) != 1 || conflicts[0].FileID != bracket {
+		t.Fatalf("conflicts = %+v, want only bracket.stl", conflicts)
+	}
+
+	conflicts[0].Status = "resolved"
+	entries, err := planMerge(trees, conflicts)
+	if err != nil {
+		t.Fatalf("planMerge: %v", err)
+	}
+	// The resolved bracket and the cover only the source changed
+	if len(entries) != 2 || entries[0].source.FileID != bracket || entries[1].source.FileID != cover {
+		t.Fatalf("planMerge took %d files, want bracket.stl and cover.stl", len(entries))
+	}
+	if entries[0].conflict == nil || entries[1].conflict != nil {
+		t.Fatal("only the bracket should record its conflict")
+	}
+}
+
+func TestPlanMergeKeepsChosenTarget(t *testing.T) {
+	bracket := uuid.New()
+	source := version(bracket, "bracket.stl", "b-source")
+	target := version(bracket, "bracket.stl", "b-target")
+	trees := &mergeTrees{
+		source: []models.FileVersion{source},
+		base:   treeOf(version(bracket, "bracket.stl", "b-base")),
+		target: treeOf(target),
+	}
+
+	conflicts := detectConflicts(trees, uuid.New())
+	conflicts[0].Status = "resolved"
+	conflicts[0].MergedVersionID = &trees.target[bracket].ID
+	entries, err := planMerge(trees, conflicts)
+	if err != nil {
+		t.Fatalf("planMerge: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("planMerge took %d files, want none", len(entries))
+	}
+}
+
+func TestPlanMergeRejectsStaleConflicts(t *testing.T) {
+	bracket := uuid.New()
+	trees := &mergeTrees{
+		source: []models.FileVersion{version(bracket, "bracket.stl", "b-source")},
+		base:   treeOf(version(bracket, "bracket.stl", "b-base")),
+		target: treeOf(version(bracket, "bracket.stl", "b-target")),
+	}
+	conflicts := detectConflicts(trees, uuid.New())
+
+	// The source branch gets another commit after the request was opened
+	trees.source[0] = version(bracket, "bracket.stl", "b-source-2")
+	if _, err := planMerge(trees, conflicts); !errors.Is(err, errStaleConflicts) {
+		t.Fatalf("planMerge error = %v, want errStaleConflicts", err)
+	}
+}
+
+// Once merged, the source head is the merge base, so merging the same
+// branch again doesn't bring the conflict back
+func TestDetectConflictsAfterMerge(t *testing.T) {
+	bracket := uuid.New()
+	sourceHead := version(bracket, "bracket.stl", "b-source")
+	trees := &mergeTrees{
+		source: []models.FileVersion{sourceHead},
+		base:   treeOf(sourceHead),
+		target: treeOf(version(bracket, "bracket.stl", "b-merged")),
+	}
+
+	if conflicts := detectConflicts(trees, uuid.New()); len(conflicts) != 0 {
+		t.Fatalf("conflicts = %+v, want none", conflicts)
+	}
+	entries, err := planMerge(trees, nil)
+	if err != nil || len(entries) != 0 {
+		t.Fatalf("planMerge = %d entries, %v; want none", len(entries), err)
+	}
+}
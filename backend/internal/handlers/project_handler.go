@@ -2,10 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
 	"github.com/rhblitstein/cad-version-control/internal/models"
 	"github.com/rhblitstein/cad-version-control/internal/repository"
 	"github.com/rhblitstein/cad-version-control/pkg/utils"
@@ -76,3 +78,73 @@ func (h *ProjectHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	utils.JSONResponse(w, http.StatusOK, project)
 }
+
+// Update changes project settings. Omitted fields are left as they are.
+func (h *ProjectHandler) Update(w http.ResponseWriter, r *http.Request) {
+	idStr := chi.URLParam(r, "id")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid project ID")
+		return
+	}
+
+	var req struct {
+		Name              *string `json:"name"`
+		Description       *string `json:"description"`
+		ValidationMode    *string `json:"validation_mode"`
+		LODTriangleBudget *int    `json:"lod_triangle_budget"`
+		DefaultUnit       *string `json:"default_unit"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		utils.ErrorResponse(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	project, err := h.repo.GetByID(r.Context(), id)
+	if err != nil {
+		utils.ErrorResponse(w, http.StatusNotFound, "Project not found")
+		return
+	}
+
+	if req.Name != nil {
+		if *req.Name == "" {
+			utils.ErrorResponse(w, http.StatusBadRequest, "Name is required")
+			return
+		}
+		project.Name = *req.Name
+	}
+	if req.Description != nil {
+		project.Description = *req.Description
+	}
+	if req.ValidationMode != nil {
+		switch *req.ValidationMode {
+		case models.ValidationOff, models.ValidationWarn, models.ValidationBlock:
+			project.ValidationMode = *req.ValidationMode
+		default:
+			utils.ErrorResponse(w, http.StatusBadRequest, "validation_mode must be off, warn or block")
+			return
+		}
+	}
+	if req.LODTriangleBudget != nil {
+		if *req.LODTriangleBudget < models.MinLODTriangleBudget {
+			utils.ErrorResponse(w, http.StatusBadRequest, fmt.Sprintf("lod_triangle_budget must be at least %d", models.MinLODTriangleBudget))
+			return
+		}
+		project.LODTriangleBudget = *req.LODTriangleBudget
+	}
+	if req.DefaultUnit != nil {
+		if !units.Valid(*req.DefaultUnit) {
+			utils.ErrorResponse(w, http.StatusBadRequest, "default_unit must be micron, millimeter, centimeter, meter, inch or foot")
+			return
+		}
+		project.DefaultUnit = *req.DefaultUnit
+	}
+
+	if err := h.repo.Update(r.Context(), project); err != nil {
+		utils.ErrorResponse(w, http.StatusInternalServerError, "Failed to update project")
+		return
+	}
+
+	utils.JSONResponse(w, http.StatusOK, project)
+}
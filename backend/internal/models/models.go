@@ -4,12 +4,47 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/assembly"
+	"github.com/rhblitstein/cad-version-control/internal/bom"
+	"github.com/rhblitstein/cad-version-control/internal/geometry"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/dxf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/gerber"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/kicad"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/step"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/threemf"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/validate"
+)
+
+// Project validation modes for committed meshes
+const (
+	ValidationOff   = "off"
+	ValidationWarn  = "warn"
+	ValidationBlock = "block"
+)
+
+// File version inspection statuses
+const (
+	InspectionInspected = "inspected"
+	InspectionPending   = "pending"
+	InspectionFailed    = "failed"
+)
+
+// Triangle budgets for the viewer's decimated previews
+const (
+	DefaultLODTriangleBudget = 500000
+	MinLODTriangleBudget     = 1000
 )
 
 type Project struct {
-	ID          uuid.UUID `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
+	ID             uuid.UUID `json:"id"`
+	Name           string    `json:"name"`
+	Description    string    `json:"description"`
+	ValidationMode string    `json:"validation_mode"`
+	// LODTriangleBudget caps the preview the viewer loads by default
+	LODTriangleBudget int `json:"lod_triangle_budget"`
+	// DefaultUnit is assumed for committed meshes whose format doesn't say
+	DefaultUnit string    `json:"default_unit"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -23,14 +58,16 @@ type Branch struct {
 }
 
 type Commit struct {
-	ID             uuid.UUID     `json:"id"`
-	ProjectID      uuid.UUID     `json:"project_id"`
-	BranchID       uuid.UUID     `json:"branch_id"`
-	ParentCommitID *uuid.UUID    `json:"parent_commit_id"`
-	Author         string        `json:"author"`
-	Message        string        `json:"message"`
-	CreatedAt      time.Time     `json:"created_at"`
-	FileVersions   []FileVersion `json:"file_versions,omitempty"`
+	ID             uuid.UUID  `json:"id"`
+	ProjectID      uuid.UUID  `json:"project_id"`
+	BranchID       uuid.UUID  `json:"branch_id"`
+	ParentCommitID *uuid.UUID `json:"parent_commit_id"`
+	// MergeParentCommitID is the merged branch's head, for merge commits
+	MergeParentCommitID *uuid.UUID    `json:"merge_parent_commit_id,omitempty"`
+	Author              string        `json:"author"`
+	Message             string        `json:"message"`
+	CreatedAt           time.Time     `json:"created_at"`
+	FileVersions        []FileVersion `json:"file_versions,omitempty"`
 }
 
 type File struct {
@@ -47,8 +84,30 @@ type FileVersion struct {
 	StoragePath string    `json:"storage_path"`
 	FileSize    int64     `json:"file_size"`
 	Checksum    string    `json:"checksum"`
-	CreatedAt   time.Time `json:"created_at"`
-	Filename    string    `json:"filename,omitempty"`
+	// GeometryHash fingerprints a mesh's surface independent of format,
+	// vertex precision and triangle order; empty for non-mesh files
+	GeometryHash string `json:"geometry_hash,omitempty"`
+	// Unit is the length unit a mesh's coordinates are in
+	Unit       string          `json:"unit,omitempty"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Filename   string          `json:"filename,omitempty"`
+	MeshStats  *MeshStats      `json:"mesh_stats,omitempty"`
+	Validation *MeshValidation `json:"validation,omitempty"`
+	Package    *ModelPackage   `json:"package,omitempty"`
+	Step       *StepMetadata   `json:"step,omitempty"`
+	DXF        *DXFMetadata    `json:"dxf,omitempty"`
+	Gerber     *GerberMetadata `json:"gerber,omitempty"`
+	KiCad      *KiCadMetadata  `json:"kicad,omitempty"`
+	// InspectionStatus is pending for a version too large to inspect during
+	// its commit until the background inspection has run, and failed when
+	// that went wrong; its metadata, validation and hash are missing until
+	// it's inspected
+	InspectionStatus string `json:"inspection_status"`
+	// UnitWarnings flag a likely wrong unit at commit time; not stored
+	UnitWarnings []units.Warning `json:"unit_warnings,omitempty"`
+	// UsedBy lists the assemblies a committed file is used in, so a change
+	// to a part flags them; not stored
+	UsedBy []assembly.Usage `json:"used_by,omitempty"`
 }
 
 type MergeRequest struct {
@@ -74,6 +133,9 @@ type MergeConflict struct {
 	Status          string     `json:"status"`
 	ResolutionNotes string     `json:"resolution_notes"`
 	ResolvedAt      *time.Time `json:"resolved_at"`
+	// The version the merge commit took for the file: the side chosen when
+	// resolving, or once merged, the three-way merge of both sides
+	MergedVersionID *uuid.UUID `json:"merged_version_id,omitempty"`
 }
 
 type Comment struct {
@@ -90,3 +152,93 @@ type Approval struct {
 	Approver       string    `json:"approver"`
 	CreatedAt      time.Time `json:"created_at"`
 }
+
+type FileAccess struct {
+	ID            uuid.UUID  `json:"id"`
+	ProjectID     uuid.UUID  `json:"project_id"`
+	FileVersionID *uuid.UUID `json:"file_version_id"`
+	Action        string     `json:"action"`
+	Method        string     `json:"method"`
+	RemoteAddr    string     `json:"remote_addr"`
+	UserAgent     string     `json:"user_agent"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+type ProjectKey struct {
+	ProjectID   uuid.UUID  `json:"project_id"`
+	Version     int        `json:"version"`
+	WrappedKey  []byte     `json:"-"`
+	MasterKeyID string     `json:"master_key_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RetiredAt   *time.Time `json:"retired_at"`
+}
+
+type MeshStats struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	geometry.Stats
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type MeshValidation struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	validate.Report
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ModelPackage summarizes a multi-object file such as a 3MF: one entry per
+// build item, with the item's placement and its own mesh statistics
+type ModelPackage struct {
+	FileVersionID uuid.UUID         `json:"file_version_id"`
+	Unit          string            `json:"unit"`
+	Metadata      map[string]string `json:"metadata"`
+	Objects       []PackageObject   `json:"objects"`
+	CreatedAt     time.Time         `json:"created_at"`
+}
+
+type PackageObject struct {
+	threemf.Object
+	Stats geometry.Stats `json:"stats"`
+}
+
+type StepMetadata struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	step.File
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DXFMetadata summarizes a drawing; entities themselves are read from the
+// file when needed
+type DXFMetadata struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	dxf.File
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// GerberMetadata summarizes a Gerber layer or Excellon drill file; its
+// primitives are read from the file when rendering or comparing
+type GerberMetadata struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	gerber.File
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// KiCadMetadata is a KiCad schematic's or board's components and nets
+type KiCadMetadata struct {
+	FileVersionID uuid.UUID `json:"file_version_id"`
+	kicad.File
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommitReferences is the graph of file references in a commit's tree
+type CommitReferences struct {
+	CommitID uuid.UUID `json:"commit_id"`
+	assembly.Graph
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CommitBOM is the bill of materials derived from a commit's tree
+type CommitBOM struct {
+	CommitID uuid.UUID `json:"commit_id"`
+	bom.BOM
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type BOMRepository struct {
+	db *sql.DB
+}
+
+func NewBOMRepository(db *sql.DB) *BOMRepository {
+	return &BOMRepository{db: db}
+}
+
+func (r *BOMRepository) Create(ctx context.Context, commitBOM *models.CommitBOM) error {
+	query := `
+		INSERT INTO commit_boms (commit_id, source, lines, warnings, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (commit_id) DO UPDATE SET
+			source = EXCLUDED.source,
+			lines = EXCLUDED.lines,
+			warnings = EXCLUDED.warnings
+		RETURNING created_at
+	`
+
+	lines, err := json.Marshal(commitBOM.Lines)
+	if err != nil {
+		return fmt.Errorf("failed to encode BOM lines: %w", err)
+	}
+	warnings := commitBOM.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	encodedWarnings, err := json.Marshal(warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode warnings: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		commitBOM.CommitID,
+		commitBOM.Source,
+		lines,
+		encodedWarnings,
+	).Scan(&commitBOM.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create commit BOM: %w", err)
+	}
+
+	return nil
+}
+
+func (r *BOMRepository) GetByCommit(ctx context.Context, commitID uuid.UUID) (*models.CommitBOM, error) {
+	query := `
+		SELECT commit_id, source, lines, warnings, created_at
+		FROM commit_boms
+		WHERE commit_id = $1
+	`
+
+	var b models.CommitBOM
+	var lines, warnings []byte
+	err := r.db.QueryRowContext(ctx, query, commitID).Scan(
+		&b.CommitID,
+		&b.Source,
+		&lines,
+		&warnings,
+		&b.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not extracted yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit BOM: %w", err)
+	}
+
+	if err := json.Unmarshal(lines, &b.Lines); err != nil {
+		return nil, fmt.Errorf("failed to decode BOM lines: %w", err)
+	}
+	if err := json.Unmarshal(warnings, &b.Warnings); err != nil {
+		return nil, fmt.Errorf("failed to decode warnings: %w", err)
+	}
+
+	return &b, nil
+}
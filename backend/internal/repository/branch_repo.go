@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 
 	"github.com/google/uuid"
@@ -10,7 +11,7 @@ import (
 )
 
 type BranchRepository struct {
-	db    *sql.DB
+	db    querier
 	cache *RedisClient
 }
 
@@ -21,6 +22,14 @@ func NewBranchRepository(db *sql.DB, cache *RedisClient) *BranchRepository {
 	}
 }
 
+// WithTx returns a repository that runs its statements in tx
+func (r *BranchRepository) WithTx(tx *sql.Tx) *BranchRepository {
+	return &BranchRepository{
+		db:    tx,
+		cache: r.cache,
+	}
+}
+
 func (r *BranchRepository) Create(ctx context.Context, branch *models.Branch) error {
 	query := `
 		INSERT INTO branches (id, project_id, name, head_commit_id, created_at)
@@ -70,6 +79,32 @@ func (r *BranchRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.B
 	return &branch, nil
 }
 
+func (r *BranchRepository) GetByName(ctx context.Context, projectID uuid.UUID, name string) (*models.Branch, error) {
+	query := `
+		SELECT id, project_id, name, head_commit_id, created_at
+		FROM branches
+		WHERE project_id = $1 AND name = $2
+	`
+
+	var branch models.Branch
+	err := r.db.QueryRowContext(ctx, query, projectID, name).Scan(
+		&branch.ID,
+		&branch.ProjectID,
+		&branch.Name,
+		&branch.HeadCommitID,
+		&branch.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("branch not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get branch: %w", err)
+	}
+
+	return &branch, nil
+}
+
 func (r *BranchRepository) ListByProject(ctx context.Context, projectID uuid.UUID) ([]models.Branch, error) {
 	query := `
 		SELECT id, project_id, name, head_commit_id, created_at
@@ -120,3 +155,31 @@ func (r *BranchRepository) UpdateHead(ctx context.Context, branchID, commitID uu
 
 	return nil
 }
+
+// ErrHeadMoved means a branch got a new commit since its head was read
+var ErrHeadMoved = errors.New("branch head moved")
+
+// MoveHead advances a branch from one head to another, failing with
+// ErrHeadMoved if the head is no longer from
+func (r *BranchRepository) MoveHead(ctx context.Context, branchID uuid.UUID, from *uuid.UUID, to uuid.UUID) error {
+	query := `
+		UPDATE branches
+		SET head_commit_id = $1
+		WHERE id = $2 AND head_commit_id IS NOT DISTINCT FROM $3
+	`
+
+	result, err := r.db.ExecContext(ctx, query, to, branchID, from)
+	if err != nil {
+		return fmt.Errorf("failed to update branch head: %w", err)
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return fmt.Errorf("failed to update branch head: %w", err)
+	} else if n == 0 {
+		return ErrHeadMoved
+	}
+
+	cacheKey := fmt.Sprintf("branch:%s", branchID)
+	r.cache.Del(ctx, cacheKey)
+
+	return nil
+}
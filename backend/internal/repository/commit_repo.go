@@ -10,17 +10,22 @@ import (
 )
 
 type CommitRepository struct {
-	db *sql.DB
+	db querier
 }
 
 func NewCommitRepository(db *sql.DB) *CommitRepository {
 	return &CommitRepository{db: db}
 }
 
+// WithTx returns a repository that runs its statements in tx
+func (r *CommitRepository) WithTx(tx *sql.Tx) *CommitRepository {
+	return &CommitRepository{db: tx}
+}
+
 func (r *CommitRepository) Create(ctx context.Context, commit *models.Commit) error {
 	query := `
-		INSERT INTO commits (id, project_id, branch_id, parent_commit_id, author, message, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		INSERT INTO commits (id, project_id, branch_id, parent_commit_id, merge_parent_commit_id, author, message, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
 		RETURNING created_at
 	`
 
@@ -31,6 +36,7 @@ func (r *CommitRepository) Create(ctx context.Context, commit *models.Commit) er
 		commit.ProjectID,
 		commit.BranchID,
 		commit.ParentCommitID,
+		commit.MergeParentCommitID,
 		commit.Author,
 		commit.Message,
 	).Scan(&commit.CreatedAt)
@@ -44,7 +50,7 @@ func (r *CommitRepository) Create(ctx context.Context, commit *models.Commit) er
 
 func (r *CommitRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Commit, error) {
 	query := `
-		SELECT id, project_id, branch_id, parent_commit_id, author, message, created_at
+		SELECT id, project_id, branch_id, parent_commit_id, merge_parent_commit_id, author, message, created_at
 		FROM commits
 		WHERE id = $1
 	`
@@ -55,6 +61,7 @@ func (r *CommitRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.C
 		&commit.ProjectID,
 		&commit.BranchID,
 		&commit.ParentCommitID,
+		&commit.MergeParentCommitID,
 		&commit.Author,
 		&commit.Message,
 		&commit.CreatedAt,
@@ -72,7 +79,7 @@ func (r *CommitRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.C
 
 func (r *CommitRepository) ListByBranch(ctx context.Context, branchID uuid.UUID, limit, offset int) ([]models.Commit, error) {
 	query := `
-		SELECT id, project_id, branch_id, parent_commit_id, author, message, created_at
+		SELECT id, project_id, branch_id, parent_commit_id, merge_parent_commit_id, author, message, created_at
 		FROM commits
 		WHERE branch_id = $1
 		ORDER BY created_at DESC
@@ -93,6 +100,7 @@ func (r *CommitRepository) ListByBranch(ctx context.Context, branchID uuid.UUID,
 			&c.ProjectID,
 			&c.BranchID,
 			&c.ParentCommitID,
+			&c.MergeParentCommitID,
 			&c.Author,
 			&c.Message,
 			&c.CreatedAt,
@@ -105,3 +113,47 @@ func (r *CommitRepository) ListByBranch(ctx context.Context, branchID uuid.UUID,
 
 	return commits, nil
 }
+
+// MergeBase finds the nearest commit that is an ancestor of both a and b,
+// returning nil when their histories never meet. Merge commits' second
+// parents count, so once a branch is merged its head becomes the base.
+// Ancestors are collected as sets so criss-cross merges don't multiply the
+// paths walked; a commit is always newer than its parents, so the newest
+// common ancestor is never an ancestor of another one.
+func (r *CommitRepository) MergeBase(ctx context.Context, a, b uuid.UUID) (*uuid.UUID, error) {
+	query := `
+		WITH RECURSIVE ancestors_a(id) AS (
+			SELECT $1::uuid
+			UNION
+			SELECT p.id
+			FROM ancestors_a aa
+			JOIN commits c ON c.id = aa.id
+			JOIN commits p ON p.id IN (c.parent_commit_id, c.merge_parent_commit_id)
+		),
+		ancestors_b(id) AS (
+			SELECT $2::uuid
+			UNION
+			SELECT p.id
+			FROM ancestors_b ab
+			JOIN commits c ON c.id = ab.id
+			JOIN commits p ON p.id IN (c.parent_commit_id, c.merge_parent_commit_id)
+		)
+		SELECT c.id
+		FROM commits c
+		JOIN ancestors_a aa ON aa.id = c.id
+		JOIN ancestors_b ab ON ab.id = c.id
+		ORDER BY c.created_at DESC, c.id
+		LIMIT 1
+	`
+
+	var base uuid.UUID
+	err := r.db.QueryRowContext(ctx, query, a, b).Scan(&base)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find merge base: %w", err)
+	}
+
+	return &base, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type DXFRepository struct {
+	db *sql.DB
+}
+
+func NewDXFRepository(db *sql.DB) *DXFRepository {
+	return &DXFRepository{db: db}
+}
+
+func (r *DXFRepository) Create(ctx context.Context, metadata *models.DXFMetadata) error {
+	query := `
+		INSERT INTO dxf_metadata (file_version_id, header, layers, entity_counts, entity_total, extents, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			header = EXCLUDED.header,
+			layers = EXCLUDED.layers,
+			entity_counts = EXCLUDED.entity_counts,
+			entity_total = EXCLUDED.entity_total,
+			extents = EXCLUDED.extents
+		RETURNING created_at
+	`
+
+	header, err := json.Marshal(metadata.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %w", err)
+	}
+	layers, err := json.Marshal(metadata.Layers)
+	if err != nil {
+		return fmt.Errorf("failed to encode layers: %w", err)
+	}
+	counts, err := json.Marshal(metadata.EntityCounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode entity counts: %w", err)
+	}
+	extents, err := json.Marshal(metadata.Extents)
+	if err != nil {
+		return fmt.Errorf("failed to encode extents: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		metadata.FileVersionID,
+		header,
+		layers,
+		counts,
+		metadata.EntityTotal,
+		extents,
+	).Scan(&metadata.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create DXF metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (r *DXFRepository) GetByVersion(ctx context.Context, versionID uuid.UUID) (*models.DXFMetadata, error) {
+	query := `
+		SELECT file_version_id, header, layers, entity_counts, entity_total, extents, created_at
+		FROM dxf_metadata
+		WHERE file_version_id = $1
+	`
+
+	var m models.DXFMetadata
+	var header, layers, counts, extents []byte
+	err := r.db.QueryRowContext(ctx, query, versionID).Scan(
+		&m.FileVersionID,
+		&header,
+		&layers,
+		&counts,
+		&m.EntityTotal,
+		&extents,
+		&m.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not analyzed yet, or not a DXF file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DXF metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(header, &m.Header); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	if err := json.Unmarshal(layers, &m.Layers); err != nil {
+		return nil, fmt.Errorf("failed to decode layers: %w", err)
+	}
+	if err := json.Unmarshal(counts, &m.EntityCounts); err != nil {
+		return nil, fmt.Errorf("failed to decode entity counts: %w", err)
+	}
+	if err := json.Unmarshal(extents, &m.Extents); err != nil {
+		return nil, fmt.Errorf("failed to decode extents: %w", err)
+	}
+
+	return &m, nil
+}
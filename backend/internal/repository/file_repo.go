@@ -10,13 +10,18 @@ import (
 )
 
 type FileRepository struct {
-	db *sql.DB
+	db querier
 }
 
 func NewFileRepository(db *sql.DB) *FileRepository {
 	return &FileRepository{db: db}
 }
 
+// WithTx returns a repository that runs its statements in tx
+func (r *FileRepository) WithTx(tx *sql.Tx) *FileRepository {
+	return &FileRepository{db: tx}
+}
+
 func (r *FileRepository) Create(ctx context.Context, file *models.File) error {
 	query := `
 		INSERT INTO files (id, project_id, filename, created_at)
@@ -66,12 +71,15 @@ func (r *FileRepository) GetByFilename(ctx context.Context, projectID uuid.UUID,
 
 func (r *FileRepository) CreateVersion(ctx context.Context, version *models.FileVersion) error {
 	query := `
-		INSERT INTO file_versions (id, file_id, commit_id, storage_path, file_size, checksum, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		INSERT INTO file_versions (id, file_id, commit_id, storage_path, file_size, checksum, geometry_hash, unit, inspection_status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, NOW())
 		RETURNING created_at
 	`
 
 	version.ID = uuid.New()
+	if version.InspectionStatus == "" {
+		version.InspectionStatus = models.InspectionInspected
+	}
 
 	err := r.db.QueryRowContext(ctx, query,
 		version.ID,
@@ -80,6 +88,9 @@ func (r *FileRepository) CreateVersion(ctx context.Context, version *models.File
 		version.StoragePath,
 		version.FileSize,
 		version.Checksum,
+		version.GeometryHash,
+		version.Unit,
+		version.InspectionStatus,
 	).Scan(&version.CreatedAt)
 
 	if err != nil {
@@ -91,7 +102,7 @@ func (r *FileRepository) CreateVersion(ctx context.Context, version *models.File
 
 func (r *FileRepository) GetVersionsByCommit(ctx context.Context, commitID uuid.UUID) ([]models.FileVersion, error) {
 	query := `
-		SELECT fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, fv.created_at, f.filename
+		SELECT fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, COALESCE(fv.geometry_hash, ''), COALESCE(fv.unit, ''), fv.inspection_status, fv.created_at, f.filename
 		FROM file_versions fv
 		JOIN files f ON fv.file_id = f.id
 		WHERE fv.commit_id = $1
@@ -113,6 +124,65 @@ func (r *FileRepository) GetVersionsByCommit(ctx context.Context, commitID uuid.
 			&v.StoragePath,
 			&v.FileSize,
 			&v.Checksum,
+			&v.GeometryHash,
+			&v.Unit,
+			&v.InspectionStatus,
+			&v.CreatedAt,
+			&v.Filename,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file version: %w", err)
+		}
+		versions = append(versions, v)
+	}
+
+	return versions, nil
+}
+
+// GetTreeAtCommit returns the latest version of every file reachable from a
+// commit by walking its parent chain, i.e. the full tree as of that commit.
+func (r *FileRepository) GetTreeAtCommit(ctx context.Context, commitID uuid.UUID) ([]models.FileVersion, error) {
+	query := `
+		WITH RECURSIVE history AS (
+			SELECT id, parent_commit_id, 0 AS depth
+			FROM commits
+			WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.parent_commit_id, h.depth + 1
+			FROM commits c
+			JOIN history h ON c.id = h.parent_commit_id
+		)
+		SELECT id, file_id, commit_id, storage_path, file_size, checksum, geometry_hash, unit, inspection_status, created_at, filename
+		FROM (
+			SELECT DISTINCT ON (fv.file_id)
+			       fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, COALESCE(fv.geometry_hash, '') AS geometry_hash, COALESCE(fv.unit, '') AS unit, fv.inspection_status, fv.created_at, f.filename
+			FROM history h
+			JOIN file_versions fv ON fv.commit_id = h.id
+			JOIN files f ON fv.file_id = f.id
+			ORDER BY fv.file_id, h.depth ASC
+		) tree
+		ORDER BY filename
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tree: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []models.FileVersion
+	for rows.Next() {
+		var v models.FileVersion
+		err := rows.Scan(
+			&v.ID,
+			&v.FileID,
+			&v.CommitID,
+			&v.StoragePath,
+			&v.FileSize,
+			&v.Checksum,
+			&v.GeometryHash,
+			&v.Unit,
+			&v.InspectionStatus,
 			&v.CreatedAt,
 			&v.Filename,
 		)
@@ -127,7 +197,7 @@ func (r *FileRepository) GetVersionsByCommit(ctx context.Context, commitID uuid.
 
 func (r *FileRepository) GetVersionByID(ctx context.Context, versionID uuid.UUID) (*models.FileVersion, error) {
 	query := `
-		SELECT fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, fv.created_at, f.filename
+		SELECT fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, COALESCE(fv.geometry_hash, ''), COALESCE(fv.unit, ''), fv.inspection_status, fv.created_at, f.filename
 		FROM file_versions fv
 		JOIN files f ON fv.file_id = f.id
 		WHERE fv.id = $1
@@ -141,6 +211,9 @@ func (r *FileRepository) GetVersionByID(ctx context.Context, versionID uuid.UUID
 		&version.StoragePath,
 		&version.FileSize,
 		&version.Checksum,
+		&version.GeometryHash,
+		&version.Unit,
+		&version.InspectionStatus,
 		&version.CreatedAt,
 		&version.Filename,
 	)
@@ -155,22 +228,61 @@ func (r *FileRepository) GetVersionByID(ctx context.Context, versionID uuid.UUID
 	return &version, nil
 }
 
-func (r *FileRepository) ChecksumExists(ctx context.Context, checksum string) (*models.FileVersion, error) {
+// SetGeometryHash backfills the canonical hash of a version committed
+// before hashes were stored
+func (r *FileRepository) SetGeometryHash(ctx context.Context, versionID uuid.UUID, hash string) error {
+	query := `
+		UPDATE file_versions
+		SET geometry_hash = $2
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, versionID, hash)
+	if err != nil {
+		return fmt.Errorf("failed to set geometry hash: %w", err)
+	}
+
+	return nil
+}
+
+// SetInspectionStatus records the outcome of a background inspection
+func (r *FileRepository) SetInspectionStatus(ctx context.Context, versionID uuid.UUID, status string) error {
+	query := `
+		UPDATE file_versions
+		SET inspection_status = $2
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, versionID, status)
+	if err != nil {
+		return fmt.Errorf("failed to set inspection status: %w", err)
+	}
+
+	return nil
+}
+
+// ChecksumExists looks for identical content within a project. Dedup is
+// scoped per project because each project's blobs use their own data key.
+func (r *FileRepository) ChecksumExists(ctx context.Context, projectID uuid.UUID, checksum string) (*models.FileVersion, error) {
 	query := `
-		SELECT id, file_id, commit_id, storage_path, file_size, checksum, created_at
-		FROM file_versions
-		WHERE checksum = $1
+		SELECT fv.id, fv.file_id, fv.commit_id, fv.storage_path, fv.file_size, fv.checksum, COALESCE(fv.geometry_hash, ''), COALESCE(fv.unit, ''), fv.inspection_status, fv.created_at
+		FROM file_versions fv
+		JOIN files f ON fv.file_id = f.id
+		WHERE f.project_id = $1 AND fv.checksum = $2
 		LIMIT 1
 	`
 
 	var version models.FileVersion
-	err := r.db.QueryRowContext(ctx, query, checksum).Scan(
+	err := r.db.QueryRowContext(ctx, query, projectID, checksum).Scan(
 		&version.ID,
 		&version.FileID,
 		&version.CommitID,
 		&version.StoragePath,
 		&version.FileSize,
 		&version.Checksum,
+		&version.GeometryHash,
+		&version.Unit,
+		&version.InspectionStatus,
 		&version.CreatedAt,
 	)
 
@@ -183,3 +295,55 @@ func (r *FileRepository) ChecksumExists(ctx context.Context, checksum string) (*
 
 	return &version, nil
 }
+
+func (r *FileRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.File, error) {
+	query := `
+		SELECT id, project_id, filename, created_at
+		FROM files
+		WHERE id = $1
+	`
+
+	var file models.File
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&file.ID,
+		&file.ProjectID,
+		&file.Filename,
+		&file.CreatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("file not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %w", err)
+	}
+
+	return &file, nil
+}
+
+// Access log
+func (r *FileRepository) RecordAccess(ctx context.Context, access *models.FileAccess) error {
+	query := `
+		INSERT INTO file_access_log (id, project_id, file_version_id, action, method, remote_addr, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING created_at
+	`
+
+	access.ID = uuid.New()
+
+	err := r.db.QueryRowContext(ctx, query,
+		access.ID,
+		access.ProjectID,
+		access.FileVersionID,
+		access.Action,
+		access.Method,
+		access.RemoteAddr,
+		access.UserAgent,
+	).Scan(&access.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to record file access: %w", err)
+	}
+
+	return nil
+}
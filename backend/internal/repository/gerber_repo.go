@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type GerberRepository struct {
+	db *sql.DB
+}
+
+func NewGerberRepository(db *sql.DB) *GerberRepository {
+	return &GerberRepository{db: db}
+}
+
+func (r *GerberRepository) Create(ctx context.Context, metadata *models.GerberMetadata) error {
+	query := `
+		INSERT INTO gerber_metadata (file_version_id, format, layer_function, units, apertures, counts, extents, warnings, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			format = EXCLUDED.format,
+			layer_function = EXCLUDED.layer_function,
+			units = EXCLUDED.units,
+			apertures = EXCLUDED.apertures,
+			counts = EXCLUDED.counts,
+			extents = EXCLUDED.extents,
+			warnings = EXCLUDED.warnings
+		RETURNING created_at
+	`
+
+	apertures, err := json.Marshal(metadata.Apertures)
+	if err != nil {
+		return fmt.Errorf("failed to encode apertures: %w", err)
+	}
+	counts, err := json.Marshal(metadata.Counts)
+	if err != nil {
+		return fmt.Errorf("failed to encode counts: %w", err)
+	}
+	extents, err := json.Marshal(metadata.Extents)
+	if err != nil {
+		return fmt.Errorf("failed to encode extents: %w", err)
+	}
+	warnings := metadata.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	encodedWarnings, err := json.Marshal(warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode warnings: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		metadata.FileVersionID,
+		metadata.Format,
+		metadata.Function,
+		metadata.Units,
+		apertures,
+		counts,
+		extents,
+		encodedWarnings,
+	).Scan(&metadata.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create Gerber metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (r *GerberRepository) GetByVersion(ctx context.Context, versionID uuid.UUID) (*models.GerberMetadata, error) {
+	query := `
+		SELECT file_version_id, format, COALESCE(layer_function, ''), units, apertures, counts, extents, warnings, created_at
+		FROM gerber_metadata
+		WHERE file_version_id = $1
+	`
+
+	var m models.GerberMetadata
+	var apertures, counts, extents, warnings []byte
+	err := r.db.QueryRowContext(ctx, query, versionID).Scan(
+		&m.FileVersionID,
+		&m.Format,
+		&m.Function,
+		&m.Units,
+		&apertures,
+		&counts,
+		&extents,
+		&warnings,
+		&m.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not analyzed yet, or not a Gerber file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get Gerber metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(apertures, &m.Apertures); err != nil {
+		return nil, fmt.Errorf("failed to decode apertures: %w", err)
+	}
+	if err := json.Unmarshal(counts, &m.Counts); err != nil {
+		return nil, fmt.Errorf("failed to decode counts: %w", err)
+	}
+	if err := json.Unmarshal(extents, &m.Extents); err != nil {
+		return nil, fmt.Errorf("failed to decode extents: %w", err)
+	}
+	if err := json.Unmarshal(warnings, &m.Warnings); err != nil {
+		return nil, fmt.Errorf("failed to decode warnings: %w", err)
+	}
+
+	return &m, nil
+}
@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type KiCadRepository struct {
+	db *sql.DB
+}
+
+func NewKiCadRepository(db *sql.DB) *KiCadRepository {
+	return &KiCadRepository{db: db}
+}
+
+func (r *KiCadRepository) Create(ctx context.Context, metadata *models.KiCadMetadata) error {
+	query := `
+		INSERT INTO kicad_metadata (file_version_id, kind, format_version, generator, components, nets, routing, warnings, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			kind = EXCLUDED.kind,
+			format_version = EXCLUDED.format_version,
+			generator = EXCLUDED.generator,
+			components = EXCLUDED.components,
+			nets = EXCLUDED.nets,
+			routing = EXCLUDED.routing,
+			warnings = EXCLUDED.warnings
+		RETURNING created_at
+	`
+
+	components, err := json.Marshal(metadata.Components)
+	if err != nil {
+		return fmt.Errorf("failed to encode components: %w", err)
+	}
+	nets, err := json.Marshal(metadata.Nets)
+	if err != nil {
+		return fmt.Errorf("failed to encode nets: %w", err)
+	}
+	// Schematics have no routing
+	var routing []byte
+	if metadata.Routing != nil {
+		if routing, err = json.Marshal(metadata.Routing); err != nil {
+			return fmt.Errorf("failed to encode routing: %w", err)
+		}
+	}
+	warnings := metadata.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	encodedWarnings, err := json.Marshal(warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode warnings: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		metadata.FileVersionID,
+		metadata.Kind,
+		metadata.Version,
+		metadata.Generator,
+		components,
+		nets,
+		routing,
+		encodedWarnings,
+	).Scan(&metadata.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create KiCad metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (r *KiCadRepository) GetByVersion(ctx context.Context, versionID uuid.UUID) (*models.KiCadMetadata, error) {
+	query := `
+		SELECT file_version_id, kind, COALESCE(format_version, ''), COALESCE(generator, ''), components, nets, routing, warnings, created_at
+		FROM kicad_metadata
+		WHERE file_version_id = $1
+	`
+
+	var m models.KiCadMetadata
+	var components, nets, routing, warnings []byte
+	err := r.db.QueryRowContext(ctx, query, versionID).Scan(
+		&m.FileVersionID,
+		&m.Kind,
+		&m.Version,
+		&m.Generator,
+		&components,
+		&nets,
+		&routing,
+		&warnings,
+		&m.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not analyzed yet, or not a KiCad file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get KiCad metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(components, &m.Components); err != nil {
+		return nil, fmt.Errorf("failed to decode components: %w", err)
+	}
+	if err := json.Unmarshal(nets, &m.Nets); err != nil {
+		return nil, fmt.Errorf("failed to decode nets: %w", err)
+	}
+	if routing != nil {
+		if err := json.Unmarshal(routing, &m.Routing); err != nil {
+			return nil, fmt.Errorf("failed to decode routing: %w", err)
+		}
+	}
+	if err := json.Unmarshal(warnings, &m.Warnings); err != nil {
+		return nil, fmt.Errorf("failed to decode warnings: %w", err)
+	}
+
+	return &m, nil
+}
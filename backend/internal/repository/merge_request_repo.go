@@ -10,13 +10,18 @@ import (
 )
 
 type MergeRequestRepository struct {
-	db *sql.DB
+	db querier
 }
 
 func NewMergeRequestRepository(db *sql.DB) *MergeRequestRepository {
 	return &MergeRequestRepository{db: db}
 }
 
+// WithTx returns a repository that runs its statements in tx
+func (r *MergeRequestRepository) WithTx(tx *sql.Tx) *MergeRequestRepository {
+	return &MergeRequestRepository{db: tx}
+}
+
 func (r *MergeRequestRepository) Create(ctx context.Context, mr *models.MergeRequest) error {
 	query := `
 		INSERT INTO merge_requests (id, project_id, source_branch_id, target_branch_id, title, description, status, author, created_at, updated_at)
@@ -131,6 +136,22 @@ func (r *MergeRequestRepository) UpdateStatus(ctx context.Context, id uuid.UUID,
 	return nil
 }
 
+// MarkMerged records that a merge request's merge commit landed
+func (r *MergeRequestRepository) MarkMerged(ctx context.Context, id uuid.UUID) error {
+	query := `
+		UPDATE merge_requests
+		SET status = 'merged', merged_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to mark merge request merged: %w", err)
+	}
+
+	return nil
+}
+
 // Conflicts
 func (r *MergeRequestRepository) CreateConflict(ctx context.Context, conflict *models.MergeConflict) error {
 	query := `
@@ -159,7 +180,7 @@ func (r *MergeRequestRepository) CreateConflict(ctx context.Context, conflict *m
 func (r *MergeRequestRepository) GetConflicts(ctx context.Context, mrID uuid.UUID) ([]models.MergeConflict, error) {
 	query := `
 		SELECT id, merge_request_id, file_id, source_version_id, target_version_id, status, 
-	       	COALESCE(resolution_notes, '') as resolution_notes, resolved_at
+	       	COALESCE(resolution_notes, '') as resolution_notes, resolved_at, merged_version_id
 		FROM merge_conflicts
 		WHERE merge_request_id = $1
 	`
@@ -182,6 +203,7 @@ func (r *MergeRequestRepository) GetConflicts(ctx context.Context, mrID uuid.UUI
 			&c.Status,
 			&c.ResolutionNotes,
 			&c.ResolvedAt,
+			&c.MergedVersionID,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan conflict: %w", err)
@@ -195,7 +217,7 @@ func (r *MergeRequestRepository) GetConflicts(ctx context.Context, mrID uuid.UUI
 func (r *MergeRequestRepository) GetConflictByID(ctx context.Context, id uuid.UUID) (*models.MergeConflict, error) {
 	query := `
 		SELECT id, merge_request_id, file_id, source_version_id, target_version_id, status, 
-		       COALESCE(resolution_notes, '') as resolution_notes, resolved_at
+		       COALESCE(resolution_notes, '') as resolution_notes, resolved_at, merged_version_id
 		FROM merge_conflicts
 		WHERE id = $1
 	`
@@ -210,6 +232,7 @@ func (r *MergeRequestRepository) GetConflictByID(ctx context.Context, id uuid.UU
 		&c.Status,
 		&c.ResolutionNotes, // Now handles empty string
 		&c.ResolvedAt,
+		&c.MergedVersionID,
 	)
 
 	if err == sql.ErrNoRows {
@@ -222,16 +245,51 @@ func (r *MergeRequestRepository) GetConflictByID(ctx context.Context, id uuid.UU
 	return &c, nil
 }
 
-func (r *MergeRequestRepository) ResolveConflict(ctx context.Context, id uuid.UUID, notes string) error {
+// ResolveConflict records a manual resolution and the side it kept, if one
+// was chosen
+func (r *MergeRequestRepository) ResolveConflict(ctx context.Context, id uuid.UUID, notes string, chosenVersionID *uuid.UUID) error {
+	query := `
+		UPDATE merge_conflicts
+		SET status = 'resolved', resolution_notes = $1, merged_version_id = $2, resolved_at = NOW()
+		WHERE id = $3
+	`
+
+	_, err := r.db.ExecContext(ctx, query, notes, chosenVersionID, id)
+	if err != nil {
+		return fmt.Errorf("failed to resolve conflict: %w", err)
+	}
+
+	return nil
+}
+
+// AutoResolveConflict records a conflict a three-way merge can settle. The
+// merged version itself is only stored when the request is merged.
+func (r *MergeRequestRepository) AutoResolveConflict(ctx context.Context, id uuid.UUID, notes string) error {
 	query := `
 		UPDATE merge_conflicts
-		SET status = 'resolved', resolution_notes = $1, resolved_at = NOW()
+		SET status = 'auto_resolved', resolution_notes = $1, resolved_at = NOW()
 		WHERE id = $2
 	`
 
 	_, err := r.db.ExecContext(ctx, query, notes, id)
 	if err != nil {
-		return fmt.Errorf("failed to resolve conflict: %w", err)
+		return fmt.Errorf("failed to auto-resolve conflict: %w", err)
+	}
+
+	return nil
+}
+
+// SetMergedVersion points a conflict at the version its merge commit took
+func (r *MergeRequestRepository) SetMergedVersion(ctx context.Context, id, versionID uuid.UUID) error {
+	query := `
+		UPDATE merge_conflicts
+		SET merged_version_id = $1
+		WHERE id = $2
+	`
+
+	_, err := r.db.ExecContext(ctx, query, versionID, id)
+	if err != nil {
+		return fmt.Errorf("failed to set merged version: %w", err)
 	}
 
 	return nil
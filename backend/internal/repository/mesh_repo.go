@@ -0,0 +1,283 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type MeshRepository struct {
+	db *sql.DB
+}
+
+func NewMeshRepository(db *sql.DB) *MeshRepository {
+	return &MeshRepository{db: db}
+}
+
+func (r *MeshRepository) CreateStats(ctx context.Context, stats *models.MeshStats) error {
+	query := `
+		INSERT INTO mesh_stats (
+			file_version_id, triangle_count, vertex_count,
+			bbox_min_x, bbox_min_y, bbox_min_z, bbox_max_x, bbox_max_y, bbox_max_z,
+			surface_area, volume, centroid_x, centroid_y, centroid_z, created_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			triangle_count = EXCLUDED.triangle_count,
+			vertex_count = EXCLUDED.vertex_count,
+			bbox_min_x = EXCLUDED.bbox_min_x,
+			bbox_min_y = EXCLUDED.bbox_min_y,
+			bbox_min_z = EXCLUDED.bbox_min_z,
+			bbox_max_x = EXCLUDED.bbox_max_x,
+			bbox_max_y = EXCLUDED.bbox_max_y,
+			bbox_max_z = EXCLUDED.bbox_max_z,
+			surface_area = EXCLUDED.surface_area,
+			volume = EXCLUDED.volume,
+			centroid_x = EXCLUDED.centroid_x,
+			centroid_y = EXCLUDED.centroid_y,
+			centroid_z = EXCLUDED.centroid_z
+		RETURNING created_at
+	`
+
+	bbox := stats.BoundingBox
+	err := r.db.QueryRowContext(ctx, query,
+		stats.FileVersionID,
+		stats.TriangleCount,
+		stats.VertexCount,
+		bbox.Min.X, bbox.Min.Y, bbox.Min.Z,
+		bbox.Max.X, bbox.Max.Y, bbox.Max.Z,
+		stats.SurfaceArea,
+		stats.Volume,
+		stats.Centroid.X, stats.Centroid.Y, stats.Centroid.Z,
+	).Scan(&stats.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create mesh stats: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MeshRepository) GetStatsByVersion(ctx context.Context, versionID uuid.UUID) (*models.MeshStats, error) {
+	query := `
+		SELECT file_version_id, triangle_count, vertex_count,
+		       bbox_min_x, bbox_min_y, bbox_min_z, bbox_max_x, bbox_max_y, bbox_max_z,
+		       surface_area, volume, centroid_x, centroid_y, centroid_z, created_at
+		FROM mesh_stats
+		WHERE file_version_id = $1
+	`
+
+	stats, err := scanMeshStats(r.db.QueryRowContext(ctx, query, versionID))
+	if err == sql.ErrNoRows {
+		return nil, nil // Not an error, version is not a parsed mesh
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mesh stats: %w", err)
+	}
+
+	return stats, nil
+}
+
+func (r *MeshRepository) GetStatsByCommit(ctx context.Context, commitID uuid.UUID) (map[uuid.UUID]*models.MeshStats, error) {
+	query := `
+		SELECT ms.file_version_id, ms.triangle_count, ms.vertex_count,
+		       ms.bbox_min_x, ms.bbox_min_y, ms.bbox_min_z, ms.bbox_max_x, ms.bbox_max_y, ms.bbox_max_z,
+		       ms.surface_area, ms.volume, ms.centroid_x, ms.centroid_y, ms.centroid_z, ms.created_at
+		FROM mesh_stats ms
+		JOIN file_versions fv ON ms.file_version_id = fv.id
+		WHERE fv.commit_id = $1
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, commitID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mesh stats: %w", err)
+	}
+	defer rows.Close()
+
+	statsByVersion := make(map[uuid.UUID]*models.MeshStats)
+	for rows.Next() {
+		stats, err := scanMeshStats(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mesh stats: %w", err)
+		}
+		statsByVersion[stats.FileVersionID] = stats
+	}
+
+	return statsByVersion, nil
+}
+
+func (r *MeshRepository) CreateValidation(ctx context.Context, validation *models.MeshValidation) error {
+	query := `
+		INSERT INTO mesh_validations (file_version_id, passed, findings, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			passed = EXCLUDED.passed,
+			findings = EXCLUDED.findings
+		RETURNING created_at
+	`
+
+	findings, err := json.Marshal(validation.Findings)
+	if err != nil {
+		return fmt.Errorf("failed to encode findings: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		validation.FileVersionID,
+		validation.Passed,
+		findings,
+	).Scan(&validation.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create mesh validation: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MeshRepository) GetValidationByVersion(ctx context.Context, versionID uuid.UUID) (*models.MeshValidation, error) {
+	query := `
+		SELECT file_version_id, passed, findings, created_at
+		FROM mesh_validations
+		WHERE file_version_id = $1
+	`
+
+	validation, err := scanMeshValidation(r.db.QueryRowContext(ctx, query, versionID))
+	if err == sql.ErrNoRows {
+		return nil, nil // Not validated, or not a mesh
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mesh validation: %w", err)
+	}
+
+	return validation, nil
+}
+
+func (r *MeshRepository) GetValidationsByVersions(ctx context.Context, versionIDs []uuid.UUID) (map[uuid.UUID]*models.MeshValidation, error) {
+	query := `
+		SELECT file_version_id, passed, findings, created_at
+		FROM mesh_validations
+		WHERE file_version_id = ANY($1)
+	`
+
+	ids := make([]string, len(versionIDs))
+	for i, id := range versionIDs {
+		ids[i] = id.String()
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mesh validations: %w", err)
+	}
+	defer rows.Close()
+
+	validations := make(map[uuid.UUID]*models.MeshValidation)
+	for rows.Next() {
+		validation, err := scanMeshValidation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan mesh validation: %w", err)
+		}
+		validations[validation.FileVersionID] = validation
+	}
+
+	return validations, nil
+}
+
+func (r *MeshRepository) CreatePackage(ctx context.Context, pkg *models.ModelPackage) error {
+	query := `
+		INSERT INTO model_packages (file_version_id, unit, metadata, objects, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			unit = EXCLUDED.unit,
+			metadata = EXCLUDED.metadata,
+			objects = EXCLUDED.objects
+		RETURNING created_at
+	`
+
+	metadata, err := json.Marshal(pkg.Metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	objects, err := json.Marshal(pkg.Objects)
+	if err != nil {
+		return fmt.Errorf("failed to encode objects: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		pkg.FileVersionID,
+		pkg.Unit,
+		metadata,
+		objects,
+	).Scan(&pkg.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create model package: %w", err)
+	}
+
+	return nil
+}
+
+func (r *MeshRepository) GetPackageByVersion(ctx context.Context, versionID uuid.UUID) (*models.ModelPackage, error) {
+	query := `
+		SELECT file_version_id, unit, metadata, objects, created_at
+		FROM model_packages
+		WHERE file_version_id = $1
+	`
+
+	var pkg models.ModelPackage
+	var metadata, objects []byte
+	err := r.db.QueryRowContext(ctx, query, versionID).Scan(&pkg.FileVersionID, &pkg.Unit, &metadata, &objects, &pkg.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not analyzed yet, or not a package format
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get model package: %w", err)
+	}
+
+	if err := json.Unmarshal(metadata, &pkg.Metadata); err != nil {
+		return nil, fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	if err := json.Unmarshal(objects, &pkg.Objects); err != nil {
+		return nil, fmt.Errorf("failed to decode objects: %w", err)
+	}
+	return &pkg, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanMeshStats(row rowScanner) (*models.MeshStats, error) {
+	var s models.MeshStats
+	err := row.Scan(
+		&s.FileVersionID,
+		&s.TriangleCount,
+		&s.VertexCount,
+		&s.BoundingBox.Min.X, &s.BoundingBox.Min.Y, &s.BoundingBox.Min.Z,
+		&s.BoundingBox.Max.X, &s.BoundingBox.Max.Y, &s.BoundingBox.Max.Z,
+		&s.SurfaceArea,
+		&s.Volume,
+		&s.Centroid.X, &s.Centroid.Y, &s.Centroid.Z,
+		&s.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func scanMeshValidation(row rowScanner) (*models.MeshValidation, error) {
+	var v models.MeshValidation
+	var findings []byte
+	if err := row.Scan(&v.FileVersionID, &v.Passed, &findings, &v.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(findings, &v.Findings); err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"time"
@@ -32,3 +33,28 @@ func NewPostgres(dsn string) (*Postgres, error) {
 func (p *Postgres) Close() error {
 	return p.DB.Close()
 }
+
+// InTx runs fn in a transaction, committing if it returns nil and rolling
+// back otherwise
+func (p *Postgres) InTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := p.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// querier is what repositories run statements against: the pool, or a
+// transaction when writes to several tables must land together
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
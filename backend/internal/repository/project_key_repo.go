@@ -0,0 +1,179 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type ProjectKeyRepository struct {
+	db *sql.DB
+}
+
+func NewProjectKeyRepository(db *sql.DB) *ProjectKeyRepository {
+	return &ProjectKeyRepository{db: db}
+}
+
+// Create inserts a key version, returning false if that version already exists
+func (r *ProjectKeyRepository) Create(ctx context.Context, key *models.ProjectKey) (bool, error) {
+	query := `
+		INSERT INTO project_keys (project_id, version, wrapped_key, master_key_id, created_at)
+		VALUES ($1, $2, $3, $4, NOW())
+		ON CONFLICT (project_id, version) DO NOTHING
+		RETURNING created_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		key.ProjectID,
+		key.Version,
+		key.WrappedKey,
+		key.MasterKeyID,
+	).Scan(&key.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create project key: %w", err)
+	}
+
+	return true, nil
+}
+
+func (r *ProjectKeyRepository) GetActive(ctx context.Context, projectID uuid.UUID) (*models.ProjectKey, error) {
+	query := `
+		SELECT project_id, version, wrapped_key, master_key_id, created_at, retired_at
+		FROM project_keys
+		WHERE project_id = $1 AND retired_at IS NULL
+		ORDER BY version DESC
+		LIMIT 1
+	`
+
+	var key models.ProjectKey
+	err := r.db.QueryRowContext(ctx, query, projectID).Scan(
+		&key.ProjectID,
+		&key.Version,
+		&key.WrappedKey,
+		&key.MasterKeyID,
+		&key.CreatedAt,
+		&key.RetiredAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, nil // Not an error, project has no key yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (r *ProjectKeyRepository) GetByVersion(ctx context.Context, projectID uuid.UUID, version int) (*models.ProjectKey, error) {
+	query := `
+		SELECT project_id, version, wrapped_key, master_key_id, created_at, retired_at
+		FROM project_keys
+		WHERE project_id = $1 AND version = $2
+	`
+
+	var key models.ProjectKey
+	err := r.db.QueryRowContext(ctx, query, projectID, version).Scan(
+		&key.ProjectID,
+		&key.Version,
+		&key.WrappedKey,
+		&key.MasterKeyID,
+		&key.CreatedAt,
+		&key.RetiredAt,
+	)
+
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("project key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (r *ProjectKeyRepository) GetLatestVersion(ctx context.Context, projectID uuid.UUID) (int, error) {
+	query := `
+		SELECT COALESCE(MAX(version), 0)
+		FROM project_keys
+		WHERE project_id = $1
+	`
+
+	var version int
+	if err := r.db.QueryRowContext(ctx, query, projectID).Scan(&version); err != nil {
+		return 0, fmt.Errorf("failed to get latest key version: %w", err)
+	}
+
+	return version, nil
+}
+
+func (r *ProjectKeyRepository) List(ctx context.Context) ([]models.ProjectKey, error) {
+	query := `
+		SELECT project_id, version, wrapped_key, master_key_id, created_at, retired_at
+		FROM project_keys
+		ORDER BY project_id, version
+	`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list project keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []models.ProjectKey
+	for rows.Next() {
+		var k models.ProjectKey
+		err := rows.Scan(
+			&k.ProjectID,
+			&k.Version,
+			&k.WrappedKey,
+			&k.MasterKeyID,
+			&k.CreatedAt,
+			&k.RetiredAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan project key: %w", err)
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, nil
+}
+
+func (r *ProjectKeyRepository) UpdateWrappedKey(ctx context.Context, projectID uuid.UUID, version int, wrappedKey []byte, masterKeyID string) error {
+	query := `
+		UPDATE project_keys
+		SET wrapped_key = $1, master_key_id = $2
+		WHERE project_id = $3 AND version = $4
+	`
+
+	_, err := r.db.ExecContext(ctx, query, wrappedKey, masterKeyID, projectID, version)
+	if err != nil {
+		return fmt.Errorf("failed to update project key: %w", err)
+	}
+
+	return nil
+}
+
+// RetireBefore marks every key older than version as retired
+func (r *ProjectKeyRepository) RetireBefore(ctx context.Context, projectID uuid.UUID, version int) error {
+	query := `
+		UPDATE project_keys
+		SET retired_at = NOW()
+		WHERE project_id = $1 AND version < $2 AND retired_at IS NULL
+	`
+
+	_, err := r.db.ExecContext(ctx, query, projectID, version)
+	if err != nil {
+		return fmt.Errorf("failed to retire project keys: %w", err)
+	}
+
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 
 	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/geometry/units"
 	"github.com/rhblitstein/cad-version-control/internal/models"
 )
 
@@ -23,17 +24,29 @@ func NewProjectRepository(db *sql.DB, cache *RedisClient) *ProjectRepository {
 
 func (r *ProjectRepository) Create(ctx context.Context, project *models.Project) error {
 	query := `
-		INSERT INTO projects (id, name, description, created_at, updated_at)
-		VALUES ($1, $2, $3, NOW(), NOW())
+		INSERT INTO projects (id, name, description, validation_mode, lod_triangle_budget, default_unit, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW(), NOW())
 		RETURNING created_at, updated_at
 	`
 
 	project.ID = uuid.New()
+	if project.ValidationMode == "" {
+		project.ValidationMode = models.ValidationWarn
+	}
+	if project.LODTriangleBudget == 0 {
+		project.LODTriangleBudget = models.DefaultLODTriangleBudget
+	}
+	if project.DefaultUnit == "" {
+		project.DefaultUnit = units.Default
+	}
 
 	err := r.db.QueryRowContext(ctx, query,
 		project.ID,
 		project.Name,
 		project.Description,
+		project.ValidationMode,
+		project.LODTriangleBudget,
+		project.DefaultUnit,
 	).Scan(&project.CreatedAt, &project.UpdatedAt)
 
 	if err != nil {
@@ -45,7 +58,7 @@ func (r *ProjectRepository) Create(ctx context.Context, project *models.Project)
 
 func (r *ProjectRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Project, error) {
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT id, name, description, validation_mode, lod_triangle_budget, default_unit, created_at, updated_at
 		FROM projects
 		WHERE id = $1
 	`
@@ -55,6 +68,9 @@ func (r *ProjectRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 		&project.ID,
 		&project.Name,
 		&project.Description,
+		&project.ValidationMode,
+		&project.LODTriangleBudget,
+		&project.DefaultUnit,
 		&project.CreatedAt,
 		&project.UpdatedAt,
 	)
@@ -71,7 +87,7 @@ func (r *ProjectRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.
 
 func (r *ProjectRepository) List(ctx context.Context) ([]models.Project, error) {
 	query := `
-		SELECT id, name, description, created_at, updated_at
+		SELECT id, name, description, validation_mode, lod_triangle_budget, default_unit, created_at, updated_at
 		FROM projects
 		ORDER BY created_at DESC
 	`
@@ -89,6 +105,9 @@ func (r *ProjectRepository) List(ctx context.Context) ([]models.Project, error)
 			&p.ID,
 			&p.Name,
 			&p.Description,
+			&p.ValidationMode,
+			&p.LODTriangleBudget,
+			&p.DefaultUnit,
 			&p.CreatedAt,
 			&p.UpdatedAt,
 		)
@@ -100,3 +119,30 @@ func (r *ProjectRepository) List(ctx context.Context) ([]models.Project, error)
 
 	return projects, nil
 }
+
+func (r *ProjectRepository) Update(ctx context.Context, project *models.Project) error {
+	query := `
+		UPDATE projects
+		SET name = $2, description = $3, validation_mode = $4, lod_triangle_budget = $5, default_unit = $6, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`
+
+	err := r.db.QueryRowContext(ctx, query,
+		project.ID,
+		project.Name,
+		project.Description,
+		project.ValidationMode,
+		project.LODTriangleBudget,
+		project.DefaultUnit,
+	).Scan(&project.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("project not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update project: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type ReferenceRepository struct {
+	db *sql.DB
+}
+
+func NewReferenceRepository(db *sql.DB) *ReferenceRepository {
+	return &ReferenceRepository{db: db}
+}
+
+func (r *ReferenceRepository) Create(ctx context.Context, refs *models.CommitReferences) error {
+	query := `
+		INSERT INTO commit_references (commit_id, file_references, warnings, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (commit_id) DO UPDATE SET
+			file_references = EXCLUDED.file_references,
+			warnings = EXCLUDED.warnings
+		RETURNING created_at
+	`
+
+	references, err := json.Marshal(refs.References)
+	if err != nil {
+		return fmt.Errorf("failed to encode file references: %w", err)
+	}
+	warnings := refs.Warnings
+	if warnings == nil {
+		warnings = []string{}
+	}
+	encodedWarnings, err := json.Marshal(warnings)
+	if err != nil {
+		return fmt.Errorf("failed to encode warnings: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		refs.CommitID,
+		references,
+		encodedWarnings,
+	).Scan(&refs.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create commit references: %w", err)
+	}
+
+	return nil
+}
+
+func (r *ReferenceRepository) GetByCommit(ctx context.Context, commitID uuid.UUID) (*models.CommitReferences, error) {
+	query := `
+		SELECT commit_id, file_references, warnings, created_at
+		FROM commit_references
+		WHERE commit_id = $1
+	`
+
+	var c models.CommitReferences
+	var references, warnings []byte
+	err := r.db.QueryRowContext(ctx, query, commitID).Scan(
+		&c.CommitID,
+		&references,
+		&warnings,
+		&c.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not extracted yet
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit references: %w", err)
+	}
+
+	if err := json.Unmarshal(references, &c.References); err != nil {
+		return nil, fmt.Errorf("failed to decode file references: %w", err)
+	}
+	if err := json.Unmarshal(warnings, &c.Warnings); err != nil {
+		return nil, fmt.Errorf("failed to decode warnings: %w", err)
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/rhblitstein/cad-version-control/internal/models"
+)
+
+type StepRepository struct {
+	db *sql.DB
+}
+
+func NewStepRepository(db *sql.DB) *StepRepository {
+	return &StepRepository{db: db}
+}
+
+func (r *StepRepository) Create(ctx context.Context, metadata *models.StepMetadata) error {
+	query := `
+		INSERT INTO step_metadata (file_version_id, header, products, structure, entity_counts, entity_total, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		ON CONFLICT (file_version_id) DO UPDATE SET
+			header = EXCLUDED.header,
+			products = EXCLUDED.products,
+			structure = EXCLUDED.structure,
+			entity_counts = EXCLUDED.entity_counts,
+			entity_total = EXCLUDED.entity_total
+		RETURNING created_at
+	`
+
+	header, err := json.Marshal(metadata.Header)
+	if err != nil {
+		return fmt.Errorf("failed to encode header: %w", err)
+	}
+	products, err := json.Marshal(metadata.Products)
+	if err != nil {
+		return fmt.Errorf("failed to encode products: %w", err)
+	}
+	structure, err := json.Marshal(metadata.Structure)
+	if err != nil {
+		return fmt.Errorf("failed to encode structure: %w", err)
+	}
+	counts, err := json.Marshal(metadata.EntityCounts)
+	if err != nil {
+		return fmt.Errorf("failed to encode entity counts: %w", err)
+	}
+
+	err = r.db.QueryRowContext(ctx, query,
+		metadata.FileVersionID,
+		header,
+		products,
+		structure,
+		counts,
+		metadata.EntityTotal,
+	).Scan(&metadata.CreatedAt)
+
+	if err != nil {
+		return fmt.Errorf("failed to create STEP metadata: %w", err)
+	}
+
+	return nil
+}
+
+func (r *StepRepository) GetByVersion(ctx context.Context, versionID uuid.UUID) (*models.StepMetadata, error) {
+	query := `
+		SELECT file_version_id, header, products, structure, entity_counts, entity_total, created_at
+		FROM step_metadata
+		WHERE file_version_id = $1
+	`
+
+	var m models.StepMetadata
+	var header, products, structure, counts []byte
+	err := r.db.QueryRowContext(ctx, query, versionID).Scan(
+		&m.FileVersionID,
+		&header,
+		&products,
+		&structure,
+		&counts,
+		&m.EntityTotal,
+		&m.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, nil // Not analyzed yet, or not a STEP file
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get STEP metadata: %w", err)
+	}
+
+	if err := json.Unmarshal(header, &m.Header); err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	if err := json.Unmarshal(products, &m.Products); err != nil {
+		return nil, fmt.Errorf("failed to decode products: %w", err)
+	}
+	if err := json.Unmarshal(structure, &m.Structure); err != nil {
+		return nil, fmt.Errorf("failed to decode structure: %w", err)
+	}
+	if err := json.Unmarshal(counts, &m.EntityCounts); err != nil {
+		return nil, fmt.Errorf("failed to decode entity counts: %w", err)
+	}
+
+	return &m, nil
+}
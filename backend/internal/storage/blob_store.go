@@ -0,0 +1,190 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"github.com/rhblitstein/cad-version-control/internal/encryption"
+)
+
+// BlobStore reads and writes project blobs, transparently applying
+// per-project envelope encryption when a key manager is configured.
+// Objects written before encryption was enabled are detected by their
+// missing header and passed through as plaintext.
+type BlobStore struct {
+	minio *MinioClient
+	keys  *encryption.KeyManager
+}
+
+func NewBlobStore(minio *MinioClient, keys *encryption.KeyManager) *BlobStore {
+	return &BlobStore{
+		minio: minio,
+		keys:  keys,
+	}
+}
+
+func (s *BlobStore) Encrypted() bool {
+	return s.keys != nil
+}
+
+func (s *BlobStore) Upload(ctx context.Context, projectID uuid.UUID, objectName string, reader io.Reader, size int64, contentType string) error {
+	if s.keys == nil {
+		return s.minio.Upload(ctx, objectName, reader, size, contentType)
+	}
+
+	key, version, err := s.keys.ActiveKey(ctx, projectID)
+	if err != nil {
+		return fmt.Errorf("failed to get project key: %w", err)
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		ew, err := encryption.NewEncryptWriter(pw, key, version)
+		if err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(ew, reader); err != nil {
+			pw.CloseWithError(err)
+			return
+		}
+		pw.CloseWithError(ew.Close())
+	}()
+
+	err = s.minio.Upload(ctx, objectName, pr, encryption.EncryptedSize(size, encryption.DefaultChunkSize), contentType)
+	// Unblock the encrypting goroutine if the upload stopped reading early
+	pr.CloseWithError(io.ErrClosedPipe)
+	return err
+}
+
+func (s *BlobStore) Download(ctx context.Context, projectID uuid.UUID, objectName string) (io.ReadCloser, error) {
+	object, err := s.minio.Download(ctx, objectName)
+	if err != nil {
+		return nil, err
+	}
+	if s.keys == nil {
+		return object, nil
+	}
+
+	headerBuf := make([]byte, encryption.HeaderSize)
+	n, err := io.ReadFull(object, headerBuf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		object.Close()
+		return nil, fmt.Errorf("failed to read object: %w", err)
+	}
+
+	header, ok := encryption.ParseHeader(headerBuf[:n])
+	if !ok {
+		return readCloser{io.MultiReader(bytes.NewReader(headerBuf[:n]), object), object}, nil
+	}
+
+	key, err := s.keys.Key(ctx, projectID, header.KeyVersion)
+	if err != nil {
+		object.Close()
+		return nil, fmt.Errorf("failed to get project key: %w", err)
+	}
+
+	plain, err := encryption.NewDecryptReader(object, key, header, 0, 0)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	return readCloser{plain, object}, nil
+}
+
+// DownloadRaw reads an object as stored, without decrypting it. Staged
+// uploads are read this way: they're plaintext from clients, and one that
+// happens to start with an encryption header mustn't be decrypted.
+func (s *BlobStore) DownloadRaw(ctx context.Context, objectName string) (io.ReadCloser, error) {
+	return s.minio.Download(ctx, objectName)
+}
+
+// DownloadRange returns plaintext bytes start..end inclusive. For encrypted
+// objects only the chunks covering the range are fetched from storage.
+func (s *BlobStore) DownloadRange(ctx context.Context, projectID uuid.UUID, objectName string, start, end int64) (io.ReadCloser, error) {
+	if s.keys == nil {
+		return s.minio.DownloadRange(ctx, objectName, start, end)
+	}
+
+	headerObj, err := s.minio.DownloadRange(ctx, objectName, 0, encryption.HeaderSize-1)
+	if err != nil {
+		return nil, err
+	}
+	headerBuf := make([]byte, encryption.HeaderSize)
+	n, err := io.ReadFull(headerObj, headerBuf)
+	headerObj.Close()
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("failed to read object header: %w", err)
+	}
+
+	header, ok := encryption.ParseHeader(headerBuf[:n])
+	if !ok {
+		return s.minio.DownloadRange(ctx, objectName, start, end)
+	}
+
+	key, err := s.keys.Key(ctx, projectID, header.KeyVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project key: %w", err)
+	}
+
+	// Read to the end of the object so the final chunk can be recognised
+	index, offset := encryption.ChunkOffset(header, start)
+	object, err := s.minio.DownloadRange(ctx, objectName, offset, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	plain, err := decryptRange(object, key, header, index, start, end)
+	if err != nil {
+		object.Close()
+		return nil, err
+	}
+	return readCloser{plain, object}, nil
+}
+
+// decryptRange reads plaintext bytes start..end inclusive from stored
+// chunks beginning at chunk index, the one holding start
+func decryptRange(stored io.Reader, key []byte, header encryption.Header, index uint32, start, end int64) (io.Reader, error) {
+	skip := int(start - int64(index)*int64(header.ChunkSize))
+	plain, err := encryption.NewDecryptReader(stored, key, header, index, skip)
+	if err != nil {
+		return nil, err
+	}
+	return io.LimitReader(plain, end-start+1), nil
+}
+
+func (s *BlobStore) Stat(ctx context.Context, objectName string) (minio.ObjectInfo, error) {
+	return s.minio.Stat(ctx, objectName)
+}
+
+// Copy duplicates an object as stored; it can't seal plaintext objects
+func (s *BlobStore) Copy(ctx context.Context, srcName, dstName string) error {
+	return s.minio.Copy(ctx, srcName, dstName)
+}
+
+func (s *BlobStore) Delete(ctx context.Context, objectName string) error {
+	return s.minio.Delete(ctx, objectName)
+}
+
+func (s *BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	return s.minio.List(ctx, prefix)
+}
+
+func (s *BlobStore) PresignedDownloadURL(ctx context.Context, objectName, filename string, expiry time.Duration) (*url.URL, error) {
+	return s.minio.PresignedDownloadURL(ctx, objectName, filename, expiry)
+}
+
+func (s *BlobStore) PresignedUploadURL(ctx context.Context, objectName string, expiry time.Duration) (*url.URL, error) {
+	return s.minio.PresignedUploadURL(ctx, objectName, expiry)
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
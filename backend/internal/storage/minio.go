@@ -4,17 +4,28 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net/url"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
 )
 
+// StagedUploadsPrefix holds presigned uploads until a commit moves them
+// into place. Nothing else is stored under it, so uploads that are never
+// committed can be expired by prefix.
+const StagedUploadsPrefix = "uploads/"
+
+const stagedUploadsRule = "expire-staged-uploads"
+
 type MinioClient struct {
 	client     *minio.Client
+	presigner  *minio.Client
 	bucketName string
 }
 
-func NewMinioClient(endpoint, accessKey, secretKey string) (*MinioClient, error) {
+func NewMinioClient(endpoint, publicEndpoint, accessKey, secretKey string) (*MinioClient, error) {
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
 		Secure: false, // Set to true if using HTTPS
@@ -39,8 +50,21 @@ func NewMinioClient(endpoint, accessKey, secretKey string) (*MinioClient, error)
 		}
 	}
 
+	// Presigned URLs are handed to browsers, so they must be signed for the
+	// host clients can reach. The region is fixed so signing never has to
+	// look up the bucket location through the public endpoint.
+	presigner, err := minio.New(publicEndpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(accessKey, secretKey, ""),
+		Secure: false,
+		Region: "us-east-1",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MinIO presign client: %w", err)
+	}
+
 	return &MinioClient{
 		client:     client,
+		presigner:  presigner,
 		bucketName: bucketName,
 	}, nil
 }
@@ -63,6 +87,49 @@ func (m *MinioClient) Download(ctx context.Context, objectName string) (*minio.O
 	return object, nil
 }
 
+// Copy duplicates an object within the bucket without passing its bytes
+// through the API
+func (m *MinioClient) Copy(ctx context.Context, srcName, dstName string) error {
+	_, err := m.client.CopyObject(ctx,
+		minio.CopyDestOptions{Bucket: m.bucketName, Object: dstName},
+		minio.CopySrcOptions{Bucket: m.bucketName, Object: srcName},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to copy object: %w", err)
+	}
+	return nil
+}
+
+// ExpireStagedUploads adds a lifecycle rule deleting staged uploads days
+// after they were written, keeping any other rules on the bucket
+func (m *MinioClient) ExpireStagedUploads(ctx context.Context, days int) error {
+	config, err := m.client.GetBucketLifecycle(ctx, m.bucketName)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code != "NoSuchLifecycleConfiguration" {
+			return fmt.Errorf("failed to get bucket lifecycle: %w", err)
+		}
+		config = lifecycle.NewConfiguration()
+	}
+
+	rules := config.Rules[:0]
+	for _, rule := range config.Rules {
+		if rule.ID != stagedUploadsRule {
+			rules = append(rules, rule)
+		}
+	}
+	config.Rules = append(rules, lifecycle.Rule{
+		ID:         stagedUploadsRule,
+		Status:     "Enabled",
+		RuleFilter: lifecycle.Filter{Prefix: StagedUploadsPrefix},
+		Expiration: lifecycle.Expiration{Days: lifecycle.ExpirationDays(days)},
+	})
+
+	if err := m.client.SetBucketLifecycle(ctx, m.bucketName, config); err != nil {
+		return fmt.Errorf("failed to set bucket lifecycle: %w", err)
+	}
+	return nil
+}
+
 func (m *MinioClient) Delete(ctx context.Context, objectName string) error {
 	err := m.client.RemoveObject(ctx, m.bucketName, objectName, minio.RemoveObjectOptions{})
 	if err != nil {
@@ -70,3 +137,54 @@ func (m *MinioClient) Delete(ctx context.Context, objectName string) error {
 	}
 	return nil
 }
+
+func (m *MinioClient) DownloadRange(ctx context.Context, objectName string, start, end int64) (*minio.Object, error) {
+	opts := minio.GetObjectOptions{}
+	if err := opts.SetRange(start, end); err != nil {
+		return nil, fmt.Errorf("invalid range: %w", err)
+	}
+
+	object, err := m.client.GetObject(ctx, m.bucketName, objectName, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download object range: %w", err)
+	}
+	return object, nil
+}
+
+func (m *MinioClient) Stat(ctx context.Context, objectName string) (minio.ObjectInfo, error) {
+	info, err := m.client.StatObject(ctx, m.bucketName, objectName, minio.StatObjectOptions{})
+	if err != nil {
+		return minio.ObjectInfo{}, fmt.Errorf("failed to stat object: %w", err)
+	}
+	return info, nil
+}
+
+func (m *MinioClient) PresignedDownloadURL(ctx context.Context, objectName, filename string, expiry time.Duration) (*url.URL, error) {
+	params := url.Values{}
+	params.Set("response-content-disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
+
+	u, err := m.presigner.PresignedGetObject(ctx, m.bucketName, objectName, expiry, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign download: %w", err)
+	}
+	return u, nil
+}
+
+func (m *MinioClient) PresignedUploadURL(ctx context.Context, objectName string, expiry time.Duration) (*url.URL, error) {
+	u, err := m.presigner.PresignedPutObject(ctx, m.bucketName, objectName, expiry)
+	if err != nil {
+		return nil, fmt.Errorf("failed to presign upload: %w", err)
+	}
+	return u, nil
+}
+
+func (m *MinioClient) List(ctx context.Context, prefix string) ([]string, error) {
+	var names []string
+	for object := range m.client.ListObjects(ctx, m.bucketName, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, fmt.Errorf("failed to list objects: %w", object.Err)
+		}
+		names = append(names, object.Key)
+	}
+	return names, nil
+}
@@ -0,0 +1,16 @@
+-- File Access Log: Record every download/upload, including presigned transfers
+CREATE TABLE file_access_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    file_version_id UUID REFERENCES file_versions(id) ON DELETE CASCADE, -- NULL for uploads not yet committed
+    action VARCHAR(50) NOT NULL, -- download, upload
+    method VARCHAR(50) NOT NULL, -- proxy, presigned
+    remote_addr VARCHAR(255),
+    user_agent TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (action IN ('download', 'upload')),
+    CHECK (method IN ('proxy', 'presigned'))
+);
+
+CREATE INDEX idx_file_access_log_project ON file_access_log(project_id);
+CREATE INDEX idx_file_access_log_version ON file_access_log(file_version_id);
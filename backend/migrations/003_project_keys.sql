@@ -0,0 +1,12 @@
+-- Project Keys: Per-project data keys, wrapped by a master key
+CREATE TABLE project_keys (
+    project_id UUID NOT NULL REFERENCES projects(id) ON DELETE CASCADE,
+    version INT NOT NULL,
+    wrapped_key BYTEA NOT NULL,
+    master_key_id VARCHAR(255) NOT NULL, -- Master key that wraps this data key
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    retired_at TIMESTAMP, -- Set on rotation; kept so older blobs stay readable
+    PRIMARY KEY (project_id, version)
+);
+
+CREATE INDEX idx_project_keys_master ON project_keys(master_key_id);
@@ -0,0 +1,18 @@
+-- Mesh Stats: Geometry statistics computed when a mesh version is committed
+CREATE TABLE mesh_stats (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    triangle_count INT NOT NULL,
+    vertex_count INT NOT NULL,
+    bbox_min_x DOUBLE PRECISION NOT NULL,
+    bbox_min_y DOUBLE PRECISION NOT NULL,
+    bbox_min_z DOUBLE PRECISION NOT NULL,
+    bbox_max_x DOUBLE PRECISION NOT NULL,
+    bbox_max_y DOUBLE PRECISION NOT NULL,
+    bbox_max_z DOUBLE PRECISION NOT NULL,
+    surface_area DOUBLE PRECISION NOT NULL,
+    volume DOUBLE PRECISION NOT NULL,
+    centroid_x DOUBLE PRECISION NOT NULL,
+    centroid_y DOUBLE PRECISION NOT NULL,
+    centroid_z DOUBLE PRECISION NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
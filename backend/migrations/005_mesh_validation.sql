@@ -0,0 +1,11 @@
+-- Mesh Validation: Per-project policy and per-version findings for committed meshes
+ALTER TABLE projects
+    ADD COLUMN validation_mode VARCHAR(10) NOT NULL DEFAULT 'warn'
+    CHECK (validation_mode IN ('off', 'warn', 'block'));
+
+CREATE TABLE mesh_validations (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    passed BOOLEAN NOT NULL,
+    findings JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,7 @@
+-- Auto Merge: Conflicts resolved by a three-way geometric merge point at the merged version
+ALTER TABLE merge_conflicts DROP CONSTRAINT merge_conflicts_status_check;
+ALTER TABLE merge_conflicts
+    ADD CONSTRAINT merge_conflicts_status_check CHECK (status IN ('unresolved', 'resolved', 'auto_resolved'));
+
+ALTER TABLE merge_conflicts
+    ADD COLUMN merged_version_id UUID REFERENCES file_versions(id);
@@ -0,0 +1,8 @@
+-- Model Packages: Units, metadata and per-object summaries of multi-object formats such as 3MF
+CREATE TABLE model_packages (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    unit VARCHAR(20) NOT NULL,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    objects JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,10 @@
+-- STEP Metadata: Part 21 header, products, assembly structure and entity counts per version
+CREATE TABLE step_metadata (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    header JSONB NOT NULL,
+    products JSONB NOT NULL DEFAULT '[]',
+    structure JSONB NOT NULL DEFAULT '[]',
+    entity_counts JSONB NOT NULL DEFAULT '{}',
+    entity_total INT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
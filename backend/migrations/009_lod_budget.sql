@@ -0,0 +1,4 @@
+-- LOD Previews: Per-project triangle budget for decimated viewer meshes
+ALTER TABLE projects
+    ADD COLUMN lod_triangle_budget INT NOT NULL DEFAULT 500000
+    CHECK (lod_triangle_budget >= 1000);
@@ -0,0 +1,3 @@
+-- Geometry Hash: Format-independent fingerprint of a mesh version's surface, next to the byte checksum
+ALTER TABLE file_versions
+    ADD COLUMN geometry_hash VARCHAR(64);
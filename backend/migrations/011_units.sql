@@ -0,0 +1,14 @@
+-- Units: Project default length unit and the unit each mesh version's coordinates are in
+ALTER TABLE projects
+    ADD COLUMN default_unit VARCHAR(20) NOT NULL DEFAULT 'millimeter'
+    CHECK (default_unit IN ('micron', 'millimeter', 'centimeter', 'meter', 'inch', 'foot'));
+
+ALTER TABLE file_versions
+    ADD COLUMN unit VARCHAR(20)
+    CHECK (unit IN ('micron', 'millimeter', 'centimeter', 'meter', 'inch', 'foot'));
+
+-- Existing meshes were all read as millimeters, except 3MF files that declare their own unit
+UPDATE file_versions fv
+SET unit = COALESCE((SELECT mp.unit FROM model_packages mp WHERE mp.file_version_id = fv.id), 'millimeter')
+FROM files f
+WHERE fv.file_id = f.id AND lower(f.filename) ~ '\.(stl|obj|3mf)$';
@@ -0,0 +1,10 @@
+-- DXF Metadata: drawing header, layers, entity counts and extents per version
+CREATE TABLE dxf_metadata (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    header JSONB NOT NULL,
+    layers JSONB NOT NULL DEFAULT '[]',
+    entity_counts JSONB NOT NULL DEFAULT '{}',
+    entity_total INT NOT NULL,
+    extents JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
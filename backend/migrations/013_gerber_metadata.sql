@@ -0,0 +1,12 @@
+-- Gerber Metadata: layer function, units, apertures with flash/draw counts and extents per Gerber or Excellon version
+CREATE TABLE gerber_metadata (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    format VARCHAR(20) NOT NULL,
+    layer_function VARCHAR(255),
+    units VARCHAR(20) NOT NULL,
+    apertures JSONB NOT NULL DEFAULT '[]',
+    counts JSONB NOT NULL,
+    extents JSONB NOT NULL,
+    warnings JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,12 @@
+-- KiCad Metadata: components, nets and board routing totals per KiCad schematic or board version
+CREATE TABLE kicad_metadata (
+    file_version_id UUID PRIMARY KEY REFERENCES file_versions(id) ON DELETE CASCADE,
+    kind VARCHAR(20) NOT NULL,
+    format_version VARCHAR(20),
+    generator VARCHAR(255),
+    components JSONB NOT NULL DEFAULT '[]',
+    nets JSONB NOT NULL DEFAULT '[]',
+    routing JSONB,
+    warnings JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,8 @@
+-- Commit BOMs: the bill of materials derived from each commit's tree and where its lines came from
+CREATE TABLE commit_boms (
+    commit_id UUID PRIMARY KEY REFERENCES commits(id) ON DELETE CASCADE,
+    source VARCHAR(20) NOT NULL,
+    lines JSONB NOT NULL DEFAULT '[]',
+    warnings JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
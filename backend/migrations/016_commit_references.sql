@@ -0,0 +1,7 @@
+-- Commit references: the assembly → part graph of each commit's tree, read from the files or declared in assembly manifests
+CREATE TABLE commit_references (
+    commit_id UUID PRIMARY KEY REFERENCES commits(id) ON DELETE CASCADE,
+    file_references JSONB NOT NULL DEFAULT '[]',
+    warnings JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
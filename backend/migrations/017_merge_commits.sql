@@ -0,0 +1,3 @@
+-- Merge Commits: Merging a request commits to the target branch with the source head as a second parent
+ALTER TABLE commits
+    ADD COLUMN merge_parent_commit_id UUID REFERENCES commits(id);
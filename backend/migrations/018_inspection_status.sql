@@ -0,0 +1,3 @@
+-- Inspection Status: Versions too large to inspect during the commit are inspected afterwards; pending until then, failed if they couldn't be read
+ALTER TABLE file_versions
+    ADD COLUMN inspection_status VARCHAR(20) NOT NULL DEFAULT 'inspected';
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	const size = 1000
+	for _, c := range []struct {
+		header string
+		size   int64
+		want   *ByteRange
+		err    error
+	}{
+		{"", size, nil, nil},
+		{"bytes=0-99", size, &ByteRange{0, 99}, nil},
+		{"bytes=0-0", size, &ByteRange{0, 0}, nil},
+		{"bytes= 100 - 199 ", size, &ByteRange{100, 199}, nil},
+
+		// Open-ended
+		{"bytes=500-", size, &ByteRange{500, 999}, nil},
+		{"bytes=999-", size, &ByteRange{999, 999}, nil},
+
+		// Suffix
+		{"bytes=-100", size, &ByteRange{900, 999}, nil},
+		{"bytes=-1", size, &ByteRange{999, 999}, nil},
+		{"bytes=-5000", size, &ByteRange{0, 999}, nil},
+		{"bytes=-0", size, nil, ErrRangeNotSatisfiable},
+		{"bytes=-10", 0, nil, ErrRangeNotSatisfiable},
+
+		// Past EOF
+		{"bytes=900-5000", size, &ByteRange{900, 999}, nil},
+		{"bytes=1000-", size, nil, ErrRangeNotSatisfiable},
+		{"bytes=1000-1100", size, nil, ErrRangeNotSatisfiable},
+		{"bytes=0-", 0, nil, ErrRangeNotSatisfiable},
+
+		// Invalid or unsupported, so the whole object is served
+		{"bytes=200-100", size, nil, nil},
+		{"bytes=0-99,200-299", size, nil, nil},
+		{"bytes=-", size, nil, nil},
+		{"bytes=", size, nil, nil},
+		{"bytes=abc-def", size, nil, nil},
+		{"bytes=-1-5", size, nil, nil},
+		{"bytes=--5", size, nil, nil},
+		{"bytes=5", size, nil, nil},
+		{"items=0-99", size, nil, nil},
+	} {
+		got, err := ParseRange(c.header, c.size)
+		if !errors.Is(err, c.err) {
+			t.Errorf("ParseRange(%q, %d) error = %v, want %v", c.header, c.size, err, c.err)
+			continue
+		}
+		if (got == nil) != (c.want == nil) || got != nil && *got != *c.want {
+			t.Errorf("ParseRange(%q, %d) = %+v, want %+v", c.header, c.size, got, c.want)
+		}
+	}
+}
+
+func TestByteRangeLength(t *testing.T) {
+	if n := (ByteRange{Start: 10, End: 10}).Length(); n != 1 {
+		t.Errorf("Length = %d, want 1", n)
+	}
+	if n := (ByteRange{Start: 0, End: 999}).Length(); n != 1000 {
+		t.Errorf("Length = %d, want 1000", n)
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	for _, c := range []struct {
+		header, etag string
+		want         bool
+	}{
+		{"", `"abc"`, false},
+		{`"abc"`, `"abc"`, true},
+		{`"abc"`, `"abd"`, false},
+		{"*", `"abc"`, true},
+		{" * ", `"abc"`, true},
+		{`"x", "abc"`, `"abc"`, true},
+		{`"x","y"`, `"abc"`, false},
+
+		// Weak comparison ignores the W/ prefix on either side
+		{`W/"abc"`, `"abc"`, true},
+		{`"abc"`, `W/"abc"`, true},
+		{`W/"abc"`, `W/"abc"`, true},
+		{`"x", W/"abc"`, `"abc"`, true},
+
+		// Quotes are part of the tag
+		{`abc`, `"abc"`, false},
+	} {
+		if got := ETagMatches(c.header, c.etag); got != c.want {
+			t.Errorf("ETagMatches(%q, %q) = %v, want %v", c.header, c.etag, got, c.want)
+		}
+	}
+}